@@ -196,7 +196,12 @@ func Callback(c fiber.Ctx) error {
 // CurrentUser returns the currently authenticated user
 func CurrentUser(c fiber.Ctx) error {
 	user := c.Locals("user").(*entities.User)
-	return c.JSON(user)
+	permissions, _ := c.Locals("permissions").([]string)
+
+	return c.JSON(struct {
+		*entities.User
+		Permissions []string `json:"permissions"`
+	}{user, permissions})
 }
 
 // Logout logs out the user
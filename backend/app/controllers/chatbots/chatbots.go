@@ -1,9 +1,12 @@
 package chatbots
 
 import (
+	"fmt"
 	"sef/app/entities"
 	"sef/internal/paginator"
 	"sef/internal/search"
+	"sef/pkg/access"
+	"sef/pkg/documentservice"
 
 	"github.com/gofiber/fiber/v3"
 	"gorm.io/gorm"
@@ -11,12 +14,15 @@ import (
 )
 
 type Controller struct {
-	DB *gorm.DB
+	DB              *gorm.DB
+	DocumentService *documentservice.DocumentService
 }
 
 func (h *Controller) Index(c fiber.Ctx) error {
 	var items []*entities.Chatbot
-	db := h.DB.Model(&entities.Chatbot{}).Preload(clause.Associations)
+	db := h.DB.Model(&entities.Chatbot{}).
+		Scopes(access.SubjectFromContext(c).Scope).
+		Preload(clause.Associations)
 
 	if c.Query("search") != "" {
 		search.Search(c.Query("search"), db)
@@ -36,6 +42,11 @@ func (h *Controller) Show(c fiber.Ctx) error {
 		return err
 	}
 
+	// Chatbots the user cannot use are hidden as if they did not exist
+	if !access.SubjectFromContext(c).CanUse(item) {
+		return fiber.NewError(fiber.StatusNotFound, "Chatbot not found")
+	}
+
 	return c.JSON(item)
 }
 
@@ -47,6 +58,18 @@ func (h *Controller) Create(c fiber.Ctx) error {
 		SystemPrompt      string   `json:"system_prompt"`
 		ModelName         string   `json:"model_name"`
 		PromptSuggestions []string `json:"prompt_suggestions"`
+		ToolConcurrency   int      `json:"tool_concurrency"`
+		MaxContextTokens  int      `json:"max_context_tokens"`
+		ThinkingBudget    int      `json:"thinking_budget"`
+		KnowledgeBase     string   `json:"knowledge_base"`
+		RetrievalMode     string   `json:"retrieval_mode"`
+		Reranker          string   `json:"reranker"`
+		RerankTopN        int      `json:"rerank_top_n"`
+		RerankTopK        int      `json:"rerank_top_k"`
+		Access            string   `json:"access"`
+		AllowedRoles      []string `json:"allowed_roles"`
+		AllowedGroups     []string `json:"allowed_groups"`
+		AllowedUsers      []string `json:"allowed_users"`
 		ToolIDs           []uint   `json:"tool_ids"`
 		DocumentIDs       []uint   `json:"document_ids"`
 	}
@@ -54,6 +77,22 @@ func (h *Controller) Create(c fiber.Ctx) error {
 		return err
 	}
 
+	if payload.KnowledgeBase != "" && !documentservice.ValidKnowledgeBase(payload.KnowledgeBase) {
+		return fiber.NewError(fiber.StatusBadRequest, "Knowledge base may only contain lowercase letters, digits, dashes and underscores")
+	}
+	if payload.RetrievalMode != "" && !validRetrievalMode(payload.RetrievalMode) {
+		return fiber.NewError(fiber.StatusBadRequest, "Retrieval mode must be dense or hybrid")
+	}
+	if !validReranker(payload.Reranker) {
+		return fiber.NewError(fiber.StatusBadRequest, "Reranker must be empty, http or llm")
+	}
+	if payload.RerankTopN < 0 || payload.RerankTopK < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rerank limits must not be negative")
+	}
+	if !validThinkingBudget(float64(payload.ThinkingBudget)) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Thinking budget must be 0 or at least %d tokens", entities.MinThinkingBudget))
+	}
+
 	// Create chatbot entity
 	chatbot := &entities.Chatbot{
 		Name:              payload.Name,
@@ -62,6 +101,21 @@ func (h *Controller) Create(c fiber.Ctx) error {
 		SystemPrompt:      payload.SystemPrompt,
 		ModelName:         payload.ModelName,
 		PromptSuggestions: payload.PromptSuggestions,
+		ToolConcurrency:   payload.ToolConcurrency,
+		MaxContextTokens:  payload.MaxContextTokens,
+		ThinkingBudget:    payload.ThinkingBudget,
+		KnowledgeBase:     payload.KnowledgeBase,
+		RetrievalMode:     payload.RetrievalMode,
+		Reranker:          payload.Reranker,
+		RerankTopN:        payload.RerankTopN,
+		RerankTopK:        payload.RerankTopK,
+		Access:            payload.Access,
+		AllowedRoles:      payload.AllowedRoles,
+		AllowedGroups:     payload.AllowedGroups,
+		AllowedUsers:      payload.AllowedUsers,
+	}
+	if err := access.NormalizePolicy(chatbot); err != nil {
+		return err
 	}
 
 	if err := h.DB.Create(chatbot).Error; err != nil {
@@ -88,6 +142,7 @@ func (h *Controller) Create(c fiber.Ctx) error {
 		if err := h.DB.Model(chatbot).Association("Documents").Replace(documents); err != nil {
 			return err
 		}
+		h.DocumentService.SyncScopes(payload.DocumentIDs)
 	}
 
 	// Return the created chatbot with associations
@@ -133,6 +188,42 @@ func (h *Controller) Update(c fiber.Ctx) error {
 		}
 	}
 
+	if knowledgeBase, ok := payload["knowledge_base"].(string); ok && knowledgeBase != "" && !documentservice.ValidKnowledgeBase(knowledgeBase) {
+		return fiber.NewError(fiber.StatusBadRequest, "Knowledge base may only contain lowercase letters, digits, dashes and underscores")
+	}
+	if retrievalMode, ok := payload["retrieval_mode"]; ok {
+		if mode, _ := retrievalMode.(string); !validRetrievalMode(mode) {
+			return fiber.NewError(fiber.StatusBadRequest, "Retrieval mode must be dense or hybrid")
+		}
+	}
+	if reranker, ok := payload["reranker"]; ok {
+		if name, isString := reranker.(string); !isString || !validReranker(name) {
+			return fiber.NewError(fiber.StatusBadRequest, "Reranker must be empty, http or llm")
+		}
+	}
+	if err := normalizeAccessUpdate(payload); err != nil {
+		return err
+	}
+	for _, key := range []string{"rerank_top_n", "rerank_top_k"} {
+		if value, ok := payload[key]; ok {
+			if limit, isNumber := value.(float64); !isNumber || limit < 1 {
+				return fiber.NewError(fiber.StatusBadRequest, "Rerank limits must be positive numbers")
+			}
+		}
+	}
+
+	if value, ok := payload["thinking_budget"]; ok {
+		if budget, isNumber := value.(float64); !isNumber || !validThinkingBudget(budget) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Thinking budget must be 0 or at least %d tokens", entities.MinThinkingBudget))
+		}
+	}
+
+	// Documents whose retrieval scope may change with this update
+	var previousDocumentIDs []uint
+	if err := h.DB.Table("chatbot_documents").Where("chatbot_id = ?", chatbot.ID).Pluck("document_id", &previousDocumentIDs).Error; err != nil {
+		return err
+	}
+
 	// Remove tool_ids and document_ids from payload before updating
 	delete(payload, "tool_ids")
 	delete(payload, "document_ids")
@@ -166,6 +257,10 @@ func (h *Controller) Update(c fiber.Ctx) error {
 		}
 	}
 
+	if _, ok := payload["knowledge_base"]; ok || len(documentIDs) > 0 {
+		h.DocumentService.SyncScopes(unionIDs(previousDocumentIDs, documentIDs))
+	}
+
 	// Return the updated chatbot with associations
 	if err := h.DB.Preload("Tools").Preload("Provider").Preload("Documents").First(chatbot, c.Params("id")).Error; err != nil {
 		return err
@@ -175,9 +270,77 @@ func (h *Controller) Update(c fiber.Ctx) error {
 }
 
 func (h *Controller) Delete(c fiber.Ctx) error {
+	var documentIDs []uint
+	if err := h.DB.Table("chatbot_documents").Where("chatbot_id = ?", c.Params("id")).Pluck("document_id", &documentIDs).Error; err != nil {
+		return err
+	}
+
 	if err := h.DB.Delete(&entities.Chatbot{}, c.Params("id")).Error; err != nil {
 		return err
 	}
 
+	// The deleted chatbot must no longer be able to retrieve its documents
+	h.DocumentService.SyncScopes(documentIDs)
+
 	return c.JSON(fiber.Map{"message": "Chatbot deleted successfully"})
 }
+
+func validRetrievalMode(mode string) bool {
+	return mode == entities.RetrievalModeDense || mode == entities.RetrievalModeHybrid
+}
+
+// normalizeAccessUpdate validates the access policy fields of an update and
+// converts the allow lists so they can be stored
+func normalizeAccessUpdate(payload map[string]interface{}) error {
+	if value, ok := payload["access"]; ok {
+		policy, _ := value.(string)
+		if policy != entities.ChatbotAccessPublic && policy != entities.ChatbotAccessRestricted {
+			return fiber.NewError(fiber.StatusBadRequest, "Access must be public or restricted")
+		}
+	}
+
+	for key, cutset := range map[string]string{"allowed_roles": "", "allowed_groups": "/", "allowed_users": ""} {
+		value, ok := payload[key]
+		if !ok {
+			continue
+		}
+
+		var values []string
+		items, isList := value.([]interface{})
+		if !isList && value != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Allowed roles, groups and users must be lists")
+		}
+		for _, item := range items {
+			name, isString := item.(string)
+			if !isString {
+				return fiber.NewError(fiber.StatusBadRequest, "Allowed roles, groups and users must be lists of names")
+			}
+			values = append(values, name)
+		}
+		payload[key] = access.NormalizeList(values, cutset)
+	}
+
+	return nil
+}
+
+func validReranker(reranker string) bool {
+	return reranker == "" || reranker == entities.RerankerHTTP || reranker == entities.RerankerLLM
+}
+
+// validThinkingBudget allows disabling thinking or a budget providers accept
+func validThinkingBudget(budget float64) bool {
+	return budget == 0 || (budget >= entities.MinThinkingBudget && budget == float64(int(budget)))
+}
+
+// unionIDs returns the IDs contained in either list
+func unionIDs(a, b []uint) []uint {
+	seen := make(map[uint]bool, len(a)+len(b))
+	var ids []uint
+	for _, id := range append(append([]uint{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
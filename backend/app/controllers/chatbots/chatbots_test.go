@@ -0,0 +1,39 @@
+package chatbots
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestCreateValidatesRetrieval(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid retrieval mode", body: `{"name": "Support", "retrieval_mode": "semantic"}`},
+		{name: "invalid knowledge base", body: `{"name": "Support", "knowledge_base": "HR Documents"}`},
+		{name: "invalid reranker", body: `{"name": "Support", "reranker": "cohere"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The requests are rejected before the database is used
+			controller := &Controller{}
+			app := fiber.New()
+			app.Post("/", controller.Create)
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -2,22 +2,27 @@ package documents
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"path/filepath"
 	"sef/app/entities"
 	"sef/internal/paginator"
 	"sef/pkg/documentservice"
+	"sef/pkg/extraction"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Controller struct {
 	DB              *gorm.DB
 	DocumentService *documentservice.DocumentService
+	JobQueue        *documentservice.JobQueue
 }
 
 // Index returns paginated list of all documents (global)
@@ -59,9 +64,9 @@ func (h *Controller) Upload(c fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "No file uploaded")
 	}
 
-	// Validate file size (max 10MB)
-	if file.Size > 10*1024*1024 {
-		return fiber.NewError(fiber.StatusBadRequest, "File too large (max 10MB)")
+	extracted, err := extractFile(file)
+	if err != nil {
+		return err
 	}
 
 	// Get optional parameters
@@ -72,80 +77,295 @@ func (h *Controller) Upload(c fiber.Ctx) error {
 
 	description := c.FormValue("description")
 
+	// Create document entity
+	document := &entities.Document{
+		Title:       title,
+		Description: description,
+		Content:     extracted.Text,
+		ContentHash: documentservice.ContentHash(extracted.Text),
+		FileName:    file.Filename,
+		FileType:    filepath.Ext(file.Filename),
+		FileSize:    file.Size,
+		Status:      "pending",
+		Version:     1,
+		Metadata:    extractionMetadata(extracted),
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(document).Error; err != nil {
+			return err
+		}
+		return tx.Create(newVersion(document, c)).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Queue document for processing
+	if _, err := h.JobQueue.Enqueue(document); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to queue document: %v", err))
+	}
+
+	return c.JSON(document)
+}
+
+// Update replaces the content of a document with an uploaded file or text and
+// queues it for re-indexing. Only changed chunks are embedded again. (admin only)
+func (h *Controller) Update(c fiber.Ctx) error {
+	var document *entities.Document
+	if err := h.DB.First(&document, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	var payload struct {
+		Title       *string `json:"title" form:"title"`
+		Description *string `json:"description" form:"description"`
+		Content     *string `json:"content" form:"content"`
+	}
+	if err := c.Bind().Body(&payload); err != nil {
+		return err
+	}
+
+	previousHash := document.ContentHash
+	previousTitle := document.Title
+	changed := false
+
+	if file, err := c.FormFile("file"); err == nil {
+		extracted, err := extractFile(file)
+		if err != nil {
+			return err
+		}
+
+		document.Content = extracted.Text
+		document.FileName = file.Filename
+		document.FileType = filepath.Ext(file.Filename)
+		document.FileSize = file.Size
+		document.Metadata = extractionMetadata(extracted)
+		changed = true
+	} else if payload.Content != nil {
+		if strings.TrimSpace(*payload.Content) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Content is required")
+		}
+
+		document.Content = *payload.Content
+		document.FileSize = int64(len(document.Content))
+		document.Metadata = entities.SingleJSONB{"format": "text"}
+		changed = true
+	}
+
+	if payload.Title != nil && *payload.Title != "" && *payload.Title != document.Title {
+		document.Title = *payload.Title
+		changed = true
+	}
+	if payload.Description != nil && *payload.Description != document.Description {
+		document.Description = *payload.Description
+		changed = true
+	}
+
+	if !changed {
+		return c.JSON(document)
+	}
+
+	document.ContentHash = documentservice.ContentHash(document.Content)
+	reindex := document.ContentHash != previousHash || document.Title != previousTitle
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Workers read the document under the same lock, so a job either started
+		// before this check or reads the new content
+		var current entities.Document
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, document.ID).Error; err != nil {
+			return err
+		}
+
+		// A running job has already read the old content
+		if reindex {
+			var running int64
+			if err := tx.Model(&entities.DocumentJob{}).
+				Where("document_id = ? AND status = ?", document.ID, entities.JobStatusRunning).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running > 0 {
+				return fiber.NewError(fiber.StatusConflict, "Document is being processed, try again when it is finished")
+			}
+		}
+
+		// Documents uploaded before versioning have no snapshot of their current state
+		var count int64
+		if err := tx.Model(&entities.DocumentVersion{}).Where("document_id = ?", document.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Create(newVersion(&current, nil)).Error; err != nil {
+				return err
+			}
+		}
+
+		// Status and progress belong to the processing job and are left alone
+		document.Version = current.Version + 1
+		if err := tx.Model(document).Updates(map[string]interface{}{
+			"title":        document.Title,
+			"description":  document.Description,
+			"content":      document.Content,
+			"file_name":    document.FileName,
+			"file_type":    document.FileType,
+			"file_size":    document.FileSize,
+			"metadata":     document.Metadata,
+			"content_hash": document.ContentHash,
+			"version":      document.Version,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(newVersion(document, c)).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// A job that is still queued reads the new content when it runs
+	if reindex {
+		if _, err := h.JobQueue.Enqueue(document); err != nil && !errors.Is(err, documentservice.ErrJobAlreadyQueued) {
+			return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to queue document: %v", err))
+		}
+	}
+
+	return c.JSON(document)
+}
+
+// Versions returns the version history of a document without contents
+func (h *Controller) Versions(c fiber.Ctx) error {
+	var items []*entities.DocumentVersion
+	db := h.DB.Model(&entities.DocumentVersion{}).
+		Omit("content").
+		Preload("CreatedBy").
+		Where("document_id = ?", c.Params("id")).
+		Order("version DESC")
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// ShowVersion returns a single version of a document with its content
+func (h *Controller) ShowVersion(c fiber.Ctx) error {
+	var item *entities.DocumentVersion
+	if err := h.DB.Preload("CreatedBy").
+		Where("document_id = ? AND version = ?", c.Params("id"), c.Params("version")).
+		First(&item).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+// extractFile validates an uploaded file and extracts its text
+func extractFile(file *multipart.FileHeader) (*extraction.Result, error) {
+	// Validate file size (max 10MB)
+	if file.Size > 10*1024*1024 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "File too large (max 10MB)")
+	}
+
+	// Determine file type
+	if _, ok := extraction.ForFile(file.Filename); !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "File type not supported. Allowed: "+strings.Join(extraction.SupportedExtensions(), ", "))
+	}
+
 	// Open and read file
 	fileHandle, err := file.Open()
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
 	}
 	defer fileHandle.Close()
 
 	content, err := io.ReadAll(fileHandle)
 	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Failed to read file")
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to read file")
 	}
 
-	// Determine file type and validate
-	fileType := filepath.Ext(file.Filename)
-	allowedTypes := []string{".txt", ".md", ".markdown", ".text"}
-	isAllowed := false
-	for _, allowed := range allowedTypes {
-		if strings.EqualFold(fileType, allowed) {
-			isAllowed = true
-			break
-		}
+	extracted, err := extraction.Extract(file.Filename, content)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Failed to extract text: %v", err))
 	}
 
-	if !isAllowed {
-		return fiber.NewError(fiber.StatusBadRequest, "File type not supported. Allowed: .txt, .md, .markdown")
-	}
+	return extracted, nil
+}
 
-	// Create document entity
-	document := &entities.Document{
-		Title:       title,
-		Description: description,
-		Content:     string(content),
-		FileName:    file.Filename,
-		FileType:    fileType,
-		FileSize:    file.Size,
-		Status:      "pending",
+// extractionMetadata builds the document metadata of an extraction result
+func extractionMetadata(extracted *extraction.Result) entities.SingleJSONB {
+	metadata := entities.SingleJSONB{"format": extracted.Format}
+	if extracted.PageCount > 0 {
+		metadata["page_count"] = extracted.PageCount
 	}
-
-	if err := h.DB.Create(document).Error; err != nil {
-		return err
+	if len(extracted.Sections) > 0 {
+		metadata["sections"] = extraction.SectionsToMetadata(extracted.Sections)
 	}
+	return metadata
+}
 
-	// Process document asynchronously
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
+// newVersion snapshots the current state of a document, c is nil for system snapshots
+func newVersion(document *entities.Document, c fiber.Ctx) *entities.DocumentVersion {
+	version := &entities.DocumentVersion{
+		DocumentID:  document.ID,
+		Version:     document.Version,
+		Title:       document.Title,
+		Description: document.Description,
+		Content:     document.Content,
+		ContentHash: document.ContentHash,
+		FileName:    document.FileName,
+		FileType:    document.FileType,
+		FileSize:    document.FileSize,
+		Metadata:    document.Metadata,
+	}
 
-		if err := h.DocumentService.ProcessDocument(ctx, document); err != nil {
-			// Log error (in production, use proper logging)
-			fmt.Printf("Error processing document %d: %v\n", document.ID, err)
+	if c != nil {
+		if user, ok := c.Locals("user").(*entities.User); ok {
+			version.CreatedByID = &user.ID
 		}
-	}()
+	}
 
-	return c.JSON(document)
+	return version
 }
 
+// ProcessManually queues a document for processing again
 func (h *Controller) ProcessManually(c fiber.Ctx) error {
 	var document *entities.Document
 	if err := h.DB.First(&document, c.Params("id")).Error; err != nil {
 		return err
 	}
 
-	// Process document asynchronously
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
+	job, err := h.JobQueue.Enqueue(document)
+	if errors.Is(err, documentservice.ErrJobAlreadyQueued) {
+		return fiber.NewError(fiber.StatusConflict, "Document is already being processed")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to queue document: %v", err))
+	}
 
-		if err := h.DocumentService.ProcessDocument(ctx, document); err != nil {
-			// Log error (in production, use proper logging)
-			fmt.Printf("Error processing document %d: %v\n", document.ID, err)
-		}
-	}()
+	return c.JSON(fiber.Map{"message": "Document processing started", "job": job})
+}
+
+// Jobs returns the processing jobs of a document, newest first
+func (h *Controller) Jobs(c fiber.Ctx) error {
+	var document *entities.Document
+	if err := h.DB.First(&document, c.Params("id")).Error; err != nil {
+		return err
+	}
 
-	return c.JSON(fiber.Map{"message": "Document processing started"})
+	var jobs []*entities.DocumentJob
+	if err := h.DB.Where("document_id = ?", document.ID).Order("created_at DESC").Find(&jobs).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"document_id":    document.ID,
+		"status":         document.Status,
+		"progress":       document.Progress,
+		"failure_reason": document.FailureReason,
+		"jobs":           jobs,
+	})
 }
 
 // Delete removes a document and its embeddings (admin only)
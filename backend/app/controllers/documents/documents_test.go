@@ -0,0 +1,127 @@
+package documents
+
+import (
+	"net/http/httptest"
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sef/pkg/documentservice"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		jobStatus   string
+		wantStatus  int
+		wantContent string
+		wantVersion int
+		wantJobs    int64
+	}{
+		{name: "idle document", wantStatus: fiber.StatusOK, wantContent: "new content", wantVersion: 2, wantJobs: 1},
+		{name: "queued job reads the new content", jobStatus: entities.JobStatusQueued, wantStatus: fiber.StatusOK, wantContent: "new content", wantVersion: 2, wantJobs: 1},
+		{name: "running job", jobStatus: entities.JobStatusRunning, wantStatus: fiber.StatusConflict, wantContent: "old content", wantVersion: 1, wantJobs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t, &entities.User{}, &entities.Document{}, &entities.DocumentVersion{}, &entities.DocumentJob{})
+
+			document := &entities.Document{
+				Title:       "Handbook",
+				Content:     "old content",
+				ContentHash: documentservice.ContentHash("old content"),
+				Status:      "processing",
+				Progress:    40,
+				Version:     1,
+			}
+			if err := db.Create(document).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.jobStatus != "" {
+				if err := db.Create(&entities.DocumentJob{DocumentID: document.ID, Status: tt.jobStatus, MaxAttempts: 3}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &Controller{DB: db, JobQueue: documentservice.NewJobQueue(db, nil, 1, 3)}
+			app := fiber.New()
+			app.Patch("/:id", controller.Update)
+
+			req := httptest.NewRequest(fiber.MethodPatch, "/1", strings.NewReader(`{"content": "new content"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			var stored entities.Document
+			if err := db.First(&stored, document.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Content != tt.wantContent || stored.Version != tt.wantVersion {
+				t.Errorf("content = %q version %d, want %q version %d", stored.Content, stored.Version, tt.wantContent, tt.wantVersion)
+			}
+
+			var jobs int64
+			db.Model(&entities.DocumentJob{}).Where("document_id = ?", document.ID).Count(&jobs)
+			if jobs != tt.wantJobs {
+				t.Errorf("document has %d jobs, want %d", jobs, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsProcessingState(t *testing.T) {
+	db := testdb.Open(t, &entities.User{}, &entities.Document{}, &entities.DocumentVersion{}, &entities.DocumentJob{})
+
+	document := &entities.Document{Title: "Handbook", Content: "content", Status: "processing", Progress: 40, Version: 1}
+	if err := db.Create(document).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusQueued, MaxAttempts: 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker reports progress right after the request loaded the document
+	var once sync.Once
+	db.Callback().Query().After("gorm:query").Register("test:worker_progress", func(tx *gorm.DB) {
+		once.Do(func() {
+			if err := db.Exec("UPDATE documents SET progress = 80 WHERE id = ?", document.ID).Error; err != nil {
+				t.Error(err)
+			}
+		})
+	})
+
+	controller := &Controller{DB: db, JobQueue: documentservice.NewJobQueue(db, nil, 1, 3)}
+	app := fiber.New()
+	app.Patch("/:id", controller.Update)
+
+	req := httptest.NewRequest(fiber.MethodPatch, "/1", strings.NewReader(`{"description": "Employee handbook"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var stored entities.Document
+	if err := db.First(&stored, document.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Description != "Employee handbook" {
+		t.Errorf("description = %q, want the update", stored.Description)
+	}
+	if stored.Status != "processing" || stored.Progress != 80 {
+		t.Errorf("status %q progress %d, want the worker's processing 80", stored.Status, stored.Progress)
+	}
+}
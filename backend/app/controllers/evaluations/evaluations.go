@@ -0,0 +1,270 @@
+package evaluations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sef/app/entities"
+	"sef/internal/paginator"
+	"sef/pkg/rag"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Controller struct {
+	DB         *gorm.DB
+	RAGService *rag.RAGService
+	Evaluator  *rag.Evaluator
+}
+
+type questionPayload struct {
+	Question            string `json:"question"`
+	ExpectedDocumentIDs []uint `json:"expected_document_ids"`
+	ExpectedAnswer      string `json:"expected_answer"`
+}
+
+// Questions returns the golden questions, optionally of a single chatbot
+func (h *Controller) Questions(c fiber.Ctx) error {
+	var items []*entities.EvaluationQuestion
+	db := h.DB.Model(&entities.EvaluationQuestion{}).Order("id")
+
+	if c.Query("chatbot_id") != "" {
+		db = db.Where("chatbot_id = ?", c.Query("chatbot_id"))
+	}
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateQuestion adds a golden question to a chatbot
+func (h *Controller) CreateQuestion(c fiber.Ctx) error {
+	var payload struct {
+		ChatbotID uint `json:"chatbot_id"`
+		questionPayload
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	question, err := h.newQuestion(payload.ChatbotID, payload.questionPayload)
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.Create(question).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(question)
+}
+
+// ImportQuestions uploads a set of golden questions to a chatbot. With replace
+// the chatbot's existing questions are removed first.
+func (h *Controller) ImportQuestions(c fiber.Ctx) error {
+	var payload struct {
+		ChatbotID uint              `json:"chatbot_id"`
+		Replace   bool              `json:"replace"`
+		Questions []questionPayload `json:"questions"`
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if len(payload.Questions) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Questions are required")
+	}
+
+	questions := make([]*entities.EvaluationQuestion, 0, len(payload.Questions))
+	for i, item := range payload.Questions {
+		question, err := h.newQuestion(payload.ChatbotID, item)
+		if err != nil {
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				return fiber.NewError(fiberErr.Code, fmt.Sprintf("Question %d: %s", i+1, fiberErr.Message))
+			}
+			return err
+		}
+		questions = append(questions, question)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if payload.Replace {
+			if err := tx.Where("chatbot_id = ?", payload.ChatbotID).Delete(&entities.EvaluationQuestion{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.CreateInBatches(questions, 100).Error
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Questions imported successfully",
+		"imported": len(questions),
+	})
+}
+
+// UpdateQuestion changes a golden question
+func (h *Controller) UpdateQuestion(c fiber.Ctx) error {
+	var question *entities.EvaluationQuestion
+	if err := h.DB.First(&question, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	var payload questionPayload
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	updated, err := h.newQuestion(question.ChatbotID, payload)
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.Model(question).
+		Select("question", "expected_document_ids", "expected_answer").
+		Updates(updated).Error; err != nil {
+		return err
+	}
+
+	if err := h.DB.First(&question, question.ID).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(question)
+}
+
+// DeleteQuestion removes a golden question
+func (h *Controller) DeleteQuestion(c fiber.Ctx) error {
+	if err := h.DB.Delete(&entities.EvaluationQuestion{}, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Question deleted successfully"})
+}
+
+// Runs returns evaluation runs, newest first. Per question results are only
+// included when showing a single run.
+func (h *Controller) Runs(c fiber.Ctx) error {
+	var items []*entities.EvaluationRun
+	db := h.DB.Model(&entities.EvaluationRun{}).Omit("results").Order("id DESC")
+
+	if c.Query("chatbot_id") != "" {
+		db = db.Where("chatbot_id = ?", c.Query("chatbot_id"))
+	}
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// ShowRun returns an evaluation run with the results of every question
+func (h *Controller) ShowRun(c fiber.Ctx) error {
+	var item *entities.EvaluationRun
+	if err := h.DB.First(&item, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+// CreateRun evaluates a chatbot's golden questions against its current
+// retrieval configuration in the background
+func (h *Controller) CreateRun(c fiber.Ctx) error {
+	var payload struct {
+		ChatbotID       uint `json:"chatbot_id"`
+		K               int  `json:"k"`
+		GenerateAnswers bool `json:"generate_answers"`
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if payload.K < 0 || payload.K > 50 {
+		return fiber.NewError(fiber.StatusBadRequest, "K must be between 1 and 50, zero uses the default")
+	}
+
+	run, err := h.Evaluator.Start(payload.ChatbotID, payload.K, payload.GenerateAnswers)
+	if errors.Is(err, rag.ErrEvaluationRunning) {
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Chatbot not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(run)
+}
+
+// Health returns the document health of a chatbot's knowledge
+func (h *Controller) Health(c fiber.Ctx) error {
+	var chatbot entities.Chatbot
+	if err := h.DB.First(&chatbot, c.Params("chatbot_id")).Error; err != nil {
+		return err
+	}
+
+	health, err := h.RAGService.GetSystemHealth(context.Background(), chatbot.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(health)
+}
+
+// newQuestion validates a golden question. Expected documents must be
+// assigned to the chatbot, others can never be retrieved.
+func (h *Controller) newQuestion(chatbotID uint, payload questionPayload) (*entities.EvaluationQuestion, error) {
+	var chatbot entities.Chatbot
+	if err := h.DB.First(&chatbot, chatbotID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Chatbot not found")
+	}
+
+	question := strings.TrimSpace(payload.Question)
+	if question == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Question is required")
+	}
+
+	if len(payload.ExpectedDocumentIDs) > 0 {
+		var assigned int64
+		if err := h.DB.Table("chatbot_documents").
+			Where("chatbot_id = ? AND document_id IN ?", chatbotID, payload.ExpectedDocumentIDs).
+			Distinct("document_id").
+			Count(&assigned).Error; err != nil {
+			return nil, err
+		}
+		if int(assigned) != len(uniqueIDs(payload.ExpectedDocumentIDs)) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Expected documents must be assigned to the chatbot")
+		}
+	}
+
+	return &entities.EvaluationQuestion{
+		ChatbotID:           chatbotID,
+		Question:            question,
+		ExpectedDocumentIDs: uniqueIDs(payload.ExpectedDocumentIDs),
+		ExpectedAnswer:      strings.TrimSpace(payload.ExpectedAnswer),
+	}, nil
+}
+
+// uniqueIDs removes duplicate IDs keeping the first occurrence
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := []uint{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,92 @@
+package mcp_servers
+
+import (
+	"context"
+	"fmt"
+	"sef/app/entities"
+	"sef/pkg/access"
+	"sef/pkg/mcp"
+	"sef/pkg/messaging"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// toolTimeout bounds a tool call. fasthttp only cancels the request context
+// on shutdown, so a tool whose client left is stopped by the timeout instead.
+const toolTimeout = 5 * time.Minute
+
+// Controller serves the tools of a chatbot or a tool category over the
+// streamable HTTP transport of the Model Context Protocol. Every request is
+// answered with JSON, there are no server initiated messages.
+type Controller struct {
+	DB               *gorm.DB
+	MessagingService messaging.MessagingServiceInterface
+}
+
+// Chatbot serves the tools of a chatbot the user can use
+func (h *Controller) Chatbot(c fiber.Ctx) error {
+	var chatbot *entities.Chatbot
+	if err := h.DB.Preload("Tools").First(&chatbot, c.Params("id")).Error; err != nil || !access.SubjectFromContext(c).CanUse(chatbot) {
+		return fiber.NewError(fiber.StatusNotFound, "Chatbot not found")
+	}
+
+	return h.serve(c, &mcp.Server{
+		Name:         chatbot.Name,
+		Instructions: chatbot.Description,
+		Tools:        chatbot.Tools,
+	})
+}
+
+// Category serves the tools of a category. Users who do not manage tools only
+// get the tools of chatbots they can use.
+func (h *Controller) Category(c fiber.Ctx) error {
+	var category *entities.ToolCategory
+	if err := h.DB.Where("name = ?", c.Params("name")).First(&category).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Tool category not found")
+	}
+
+	db := h.DB.Where("category_id = ?", category.ID).Order("name")
+	if !access.HasPermission(c, access.PermissionToolsManage) {
+		chatbots := h.DB.Model(&entities.Chatbot{}).
+			Scopes(access.SubjectFromContext(c).Scope).
+			Select("chatbots.id")
+		db = db.Where("id IN (?)", h.DB.Table("chatbot_tools").
+			Select("tool_id").
+			Where("chatbot_id IN (?)", chatbots))
+	}
+
+	var tools []entities.Tool
+	if err := db.Find(&tools).Error; err != nil {
+		return err
+	}
+
+	return h.serve(c, &mcp.Server{
+		Name:         category.DisplayName,
+		Instructions: category.Description,
+		Tools:        tools,
+	})
+}
+
+// MethodNotAllowed answers GET and DELETE requests, the server neither opens
+// event streams nor keeps sessions
+func (h *Controller) MethodNotAllowed(c fiber.Ctx) error {
+	c.Set(fiber.HeaderAllow, fiber.MethodPost)
+	return fiber.NewError(fiber.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported, send JSON-RPC messages with POST", c.Method()))
+}
+
+// serve answers the JSON-RPC message of the request
+func (h *Controller) serve(c fiber.Ctx, server *mcp.Server) error {
+	server.Definitions = h.MessagingService.ConvertToolsToDefinitions(server.Tools, "json")
+
+	ctx, cancel := context.WithTimeout(c.RequestCtx(), toolTimeout)
+	defer cancel()
+
+	answer := server.Handle(ctx, c.Body())
+	if answer == nil {
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	return c.JSON(answer)
+}
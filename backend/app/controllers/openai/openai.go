@@ -0,0 +1,594 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sef/app/entities"
+	"sef/pkg/access"
+	"sef/pkg/messaging"
+	"sef/pkg/providers"
+	"sef/pkg/rag"
+	"sef/pkg/summary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/log"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+)
+
+// Clients keep a conversation in a session by sending its ID in the
+// X-Session-ID header, "new" starts one. The session ID is returned in the
+// same response header. Without it every completion is stateless.
+const (
+	sessionHeader = "X-Session-ID"
+	newSession    = "new"
+)
+
+// completionTimeout bounds a completion that is not streamed. fasthttp only
+// cancels the request context on shutdown, so an answer nobody waits for
+// anymore is stopped by the timeout instead.
+const completionTimeout = 10 * time.Minute
+
+// Controller serves an OpenAI compatible API over chatbots. The chatbot's
+// system prompt, documents and tools are applied server side, client side
+// tools and sampling parameters are ignored.
+type Controller struct {
+	DB               *gorm.DB
+	MessagingService messaging.MessagingServiceInterface
+	SummaryService   summary.SummaryServiceInterface
+}
+
+type chatCompletionRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	WebSearchOptions json.RawMessage `json:"web_search_options"` // Enables web search when the chatbot allows it
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // A string or an array of content parts
+}
+
+type model struct {
+	ID          string `json:"id"`
+	Object      string `json:"object"`
+	Created     int64  `json:"created"`
+	OwnedBy     string `json:"owned_by"`
+	Description string `json:"description,omitempty"`
+}
+
+type chatCompletion struct {
+	ID        string                     `json:"id"`
+	Object    string                     `json:"object"`
+	Created   int64                      `json:"created"`
+	Model     string                     `json:"model"`
+	Choices   []choice                   `json:"choices"`
+	Usage     *usage                     `json:"usage,omitempty"`
+	Citations []entities.MessageCitation `json:"citations,omitempty"` // Document chunks the answer cites as [n]
+}
+
+type choice struct {
+	Index        int              `json:"index"`
+	Message      *responseMessage `json:"message,omitempty"`
+	Delta        *delta           `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+type responseMessage struct {
+	Role             string `json:"role"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+type delta struct {
+	Role             string `json:"role,omitempty"`
+	Content          string `json:"content,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Models lists the chatbots the caller can use as models
+func (h *Controller) Models(c fiber.Ctx) error {
+	var chatbots []*entities.Chatbot
+	if err := h.DB.Model(&entities.Chatbot{}).
+		Scopes(access.SubjectFromContext(c).Scope).
+		Order("name").
+		Find(&chatbots).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	models := make([]model, 0, len(chatbots))
+	for _, chatbot := range chatbots {
+		models = append(models, model{
+			ID:          chatbot.Name,
+			Object:      "model",
+			Created:     chatbot.CreatedAt.Unix(),
+			OwnedBy:     "sef",
+			Description: chatbot.Description,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+// QuotaChatbot returns the chatbot a completion request is sent to, so its
+// quotas apply. Invalid requests are rejected by the handler.
+func (h *Controller) QuotaChatbot(c fiber.Ctx) (uint, error) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return 0, nil
+	}
+
+	chatbot, err := h.findChatbot(c, req.Model)
+	if err != nil {
+		return 0, nil
+	}
+	return chatbot.ID, nil
+}
+
+// ChatCompletions answers a conversation with the chatbot selected by the
+// model. Stateless requests send the whole conversation, persisted ones only
+// need the new user message since the history is kept in the session.
+func (h *Controller) ChatCompletions(c fiber.Ctx) error {
+	var req chatCompletionRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return apiError(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+
+	if len(req.Messages) == 0 {
+		return apiError(c, fiber.NewError(fiber.StatusBadRequest, "messages are required"))
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" {
+		return apiError(c, fiber.NewError(fiber.StatusBadRequest, "the last message must be a user message"))
+	}
+	content, err := messageText(last.Content)
+	if err != nil {
+		return apiError(c, err)
+	}
+	if strings.TrimSpace(content) == "" {
+		return apiError(c, fiber.NewError(fiber.StatusBadRequest, "the last message must have text content"))
+	}
+	history, err := historyMessages(req.Messages[:len(req.Messages)-1])
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	chatbot, err := h.findChatbot(c, req.Model)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	user := c.Locals("user").(*entities.User)
+	session, persistent, err := h.session(c, user, chatbot)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	var parentID *uint
+	if persistent {
+		parentID = session.ActiveMessageID
+	}
+	userMessage, err := h.MessagingService.SaveUserMessage(session.ID, parentID, content)
+	if err != nil {
+		h.discard(session, persistent)
+		return apiError(c, err)
+	}
+
+	var messages []providers.ChatMessage
+	var ragResult *rag.AugmentPromptResult
+	if persistent {
+		messages, ragResult = h.MessagingService.PrepareChatMessages(session, parentID, content)
+	} else {
+		messages, ragResult = h.MessagingService.PrepareCompletionMessages(session, history, content)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelCauseFunc
+	if req.Stream {
+		// Generation outlives the handler, it is cancelled when the stream writer fails
+		ctx, cancel = context.WithCancelCause(context.Background())
+	} else {
+		requestCtx, stop := context.WithTimeout(c.RequestCtx(), completionTimeout)
+		defer stop()
+		ctx, cancel = context.WithCancelCause(requestCtx)
+	}
+	stream, assistantMessage, err := h.MessagingService.GenerateChatResponse(ctx, session, userMessage.ID, messages, ragResult, req.WebSearchOptions != nil)
+	if err != nil {
+		cancel(nil)
+		h.discard(session, persistent)
+		return apiError(c, err)
+	}
+
+	if persistent {
+		c.Set(sessionHeader, strconv.FormatUint(uint64(session.ID), 10))
+	}
+
+	completion := chatCompletion{
+		ID:      fmt.Sprintf("chatcmpl-%d", assistantMessage.ID),
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+
+	// finish persists the answer once the generation is over
+	finish := func(fullResponse string) {
+		h.MessagingService.UpdateAssistantMessageWithCallback(assistantMessage, fullResponse, func() {
+			if persistent {
+				go h.SummaryService.AutoGenerateSummaryIfNeeded(session.ID, user.ID)
+				return
+			}
+			h.discard(session, persistent)
+		})
+	}
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		return h.streamCompletion(c, stream, cancel, completion, includeUsage, finish)
+	}
+	return h.completion(c, stream, cancel, completion, finish)
+}
+
+// findChatbot returns the chatbot the caller can use with the model's name or ID
+func (h *Controller) findChatbot(c fiber.Ctx, model string) (*entities.Chatbot, error) {
+	if strings.TrimSpace(model) == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "model is required")
+	}
+
+	db := h.DB.Model(&entities.Chatbot{}).Scopes(access.SubjectFromContext(c).Scope)
+	if id, err := strconv.ParseUint(model, 10, 32); err == nil {
+		db = db.Where("id = ? OR LOWER(name) = LOWER(?)", id, model)
+	} else {
+		db = db.Where("LOWER(name) = LOWER(?)", model)
+	}
+
+	var chatbots []*entities.Chatbot
+	if err := db.Limit(2).Find(&chatbots).Error; err != nil {
+		return nil, err
+	}
+	if len(chatbots) == 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("The model '%s' does not exist", model))
+	}
+	if len(chatbots) > 1 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("The model '%s' names several chatbots, use the chatbot ID instead", model))
+	}
+	return chatbots[0], nil
+}
+
+// session returns the session a completion runs in and whether it is kept.
+// Stateless completions run in a session as well so their usage counts
+// towards quotas, it is deleted once the answer is saved.
+func (h *Controller) session(c fiber.Ctx, user *entities.User, chatbot *entities.Chatbot) (*entities.Session, bool, error) {
+	header := c.Get(sessionHeader)
+	if header != "" && header != newSession {
+		sessionID, err := h.MessagingService.ValidateAndParseSessionID(header)
+		if err != nil {
+			return nil, false, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		session, err := h.MessagingService.LoadSessionWithChatbotToolsAndMessages(sessionID, user.ID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return nil, false, fiber.NewError(fiber.StatusNotFound, err.Error())
+			}
+			return nil, false, err
+		}
+		if session.ChatbotID != chatbot.ID {
+			return nil, false, fiber.NewError(fiber.StatusBadRequest, "The session belongs to another model")
+		}
+		return session, true, nil
+	}
+
+	created := entities.Session{
+		UserID:    user.ID,
+		ChatbotID: chatbot.ID,
+	}
+	if err := h.DB.Create(&created).Error; err != nil {
+		return nil, false, err
+	}
+
+	session, err := h.MessagingService.LoadSessionWithChatbotToolsAndMessages(created.ID, user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	return session, header == newSession, nil
+}
+
+// discard deletes the session of a stateless completion
+func (h *Controller) discard(session *entities.Session, persistent bool) {
+	if persistent {
+		return
+	}
+	if err := h.DB.Delete(&entities.Session{}, session.ID).Error; err != nil {
+		log.Error("Failed to delete completion session:", err)
+	}
+}
+
+// completion waits for the whole answer and returns it at once
+func (h *Controller) completion(c fiber.Ctx, stream <-chan messaging.StreamEvent, cancel context.CancelCauseFunc, completion chatCompletion, finish func(string)) error {
+	defer cancel(nil)
+
+	var fullResponse, content, reasoning strings.Builder
+	var failure *messaging.ErrorEvent
+	for event := range stream {
+		// The persisted content keeps the legacy pseudo-tag format
+		fullResponse.WriteString(event.Legacy)
+
+		switch data := event.Data.(type) {
+		case messaging.DeltaEvent:
+			if event.Type == messaging.EventThinkingDelta {
+				reasoning.WriteString(data.Content)
+			} else {
+				content.WriteString(data.Content)
+			}
+		case messaging.RAGSourcesEvent:
+			completion.Citations = data.Sources
+		case messaging.UsageEvent:
+			completion.Usage = newUsage(data)
+		case messaging.ErrorEvent:
+			failure = &data
+		}
+	}
+	go finish(fullResponse.String())
+
+	if failure != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(errorBody(failure.Message, "server_error", failure.Code))
+	}
+
+	finishReason := "stop"
+	completion.Object = "chat.completion"
+	completion.Choices = []choice{{
+		Message: &responseMessage{
+			Role:             "assistant",
+			Content:          content.String(),
+			ReasoningContent: reasoning.String(),
+		},
+		FinishReason: &finishReason,
+	}}
+
+	return c.JSON(completion)
+}
+
+// streamCompletion streams the answer as chat completion chunks
+func (h *Controller) streamCompletion(c fiber.Ctx, stream <-chan messaging.StreamEvent, cancel context.CancelCauseFunc, completion chatCompletion, includeUsage bool, finish func(string)) error {
+	// Concurrent generation slot reserved by the quota middleware
+	release, _ := c.Locals("quota_release").(func())
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	c.Set("Access-Control-Expose-Headers", sessionHeader)
+
+	completion.Object = "chat.completion.chunk"
+
+	c.Response().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		var fullResponse strings.Builder
+		defer cancel(nil)
+		if release != nil {
+			defer release()
+		}
+		defer func() {
+			go finish(fullResponse.String())
+		}()
+
+		// Pings detect a disconnected client while tools are running
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		// disconnect stops the generation and waits until the partial answer is persisted
+		disconnect := func(err error) {
+			log.Error("Client disconnected, stopping completion:", completion.ID, err)
+			cancel(messaging.ErrClientDisconnected)
+			for event := range stream {
+				fullResponse.WriteString(event.Legacy)
+			}
+		}
+
+		if err := sendChunk(w, completion, &delta{Role: "assistant"}, nil); err != nil {
+			disconnect(err)
+			return
+		}
+
+		var usageChunk *usage
+		failed := false
+		for {
+			select {
+			case event, ok := <-stream:
+				if !ok {
+					// A failed completion ends with its error instead of a finish reason
+					if failed {
+						return
+					}
+
+					finishReason := "stop"
+					if err := sendChunk(w, completion, &delta{}, &finishReason); err != nil {
+						return
+					}
+					if includeUsage && usageChunk != nil {
+						completion.Usage = usageChunk
+						completion.Choices = []choice{}
+						if err := sendData(w, completion); err != nil {
+							return
+						}
+					}
+					fmt.Fprint(w, "data: [DONE]\n\n")
+					w.Flush()
+					return
+				}
+
+				fullResponse.WriteString(event.Legacy)
+
+				var err error
+				switch data := event.Data.(type) {
+				case messaging.DeltaEvent:
+					if event.Type == messaging.EventThinkingDelta {
+						err = sendChunk(w, completion, &delta{ReasoningContent: data.Content}, nil)
+					} else {
+						err = sendChunk(w, completion, &delta{Content: data.Content}, nil)
+					}
+				case messaging.RAGSourcesEvent:
+					chunk := completion
+					chunk.Citations = data.Sources
+					err = sendChunk(w, chunk, &delta{}, nil)
+				case messaging.UsageEvent:
+					usageChunk = newUsage(data)
+				case messaging.ErrorEvent:
+					failed = true
+					err = sendData(w, errorBody(data.Message, "server_error", data.Code))
+				}
+				if err != nil {
+					disconnect(err)
+					return
+				}
+			case <-keepAlive.C:
+				// SSE comment lines are ignored by clients
+				fmt.Fprint(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					disconnect(err)
+					return
+				}
+			}
+		}
+	}))
+
+	return nil
+}
+
+// sendChunk writes a chat completion chunk with a single choice
+func sendChunk(w *bufio.Writer, completion chatCompletion, d *delta, finishReason *string) error {
+	completion.Choices = []choice{{Delta: d, FinishReason: finishReason}}
+	return sendData(w, completion)
+}
+
+// sendData writes an SSE data frame
+func sendData(w *bufio.Writer, data interface{}) error {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		log.Error("Failed to marshal chunk to JSON:", err)
+		return err
+	}
+
+	fmt.Fprintf(w, "data: %s\n\n", jsonBytes)
+	return w.Flush()
+}
+
+// messageText returns the text of a message, content parts other than text are ignored
+func messageText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "message content must be a string or an array of content parts")
+	}
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// historyMessages converts the earlier messages of a stateless request.
+// Tool calls and results of client side tools are left out, the chatbot's
+// tools run on the server.
+func historyMessages(messages []chatMessage) ([]providers.ChatMessage, error) {
+	var history []providers.ChatMessage
+	for _, msg := range messages {
+		role := msg.Role
+		switch role {
+		case "developer":
+			role = "system"
+		case "system", "user", "assistant":
+		default:
+			continue
+		}
+
+		content, err := messageText(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		if content == "" {
+			continue
+		}
+
+		history = append(history, providers.ChatMessage{
+			Role:    role,
+			Content: content,
+		})
+	}
+	return history, nil
+}
+
+// newUsage converts the usage of a generation
+func newUsage(event messaging.UsageEvent) *usage {
+	return &usage{
+		PromptTokens:     event.PromptTokens,
+		CompletionTokens: event.CompletionTokens,
+		TotalTokens:      event.PromptTokens + event.CompletionTokens,
+	}
+}
+
+// apiError responds with an error in the OpenAI format
+func apiError(c fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	errType := "server_error"
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+		errType = "invalid_request_error"
+		if status == fiber.StatusNotFound {
+			errType = "not_found_error"
+		}
+	}
+
+	return c.Status(status).JSON(errorBody(err.Error(), errType, ""))
+}
+
+// errorBody creates the body of an OpenAI error
+func errorBody(message string, errType string, code string) fiber.Map {
+	var errCode interface{}
+	if code != "" {
+		errCode = code
+	}
+	return fiber.Map{
+		"error": fiber.Map{
+			"message": message,
+			"type":    errType,
+			"code":    errCode,
+		},
+	}
+}
@@ -0,0 +1,337 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sef/pkg/access"
+	"sef/pkg/messaging"
+	"sef/pkg/providers"
+	"sef/pkg/rag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// fakeMessaging answers every completion with the same events
+type fakeMessaging struct {
+	messaging.MessagingServiceInterface
+	events []messaging.StreamEvent
+	ctx    context.Context
+	saved  chan string
+}
+
+func (f *fakeMessaging) SaveUserMessage(sessionID uint, parentID *uint, content string) (*entities.Message, error) {
+	return &entities.Message{Base: entities.Base{ID: 1}, SessionID: sessionID, Role: "user", Content: content}, nil
+}
+
+func (f *fakeMessaging) LoadSessionWithChatbotToolsAndMessages(sessionID, userID uint) (*entities.Session, error) {
+	return &entities.Session{Base: entities.Base{ID: sessionID}, UserID: userID}, nil
+}
+
+func (f *fakeMessaging) PrepareCompletionMessages(session *entities.Session, history []providers.ChatMessage, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult) {
+	return append(history, providers.ChatMessage{Role: "user", Content: userContent}), nil
+}
+
+func (f *fakeMessaging) GenerateChatResponse(ctx context.Context, session *entities.Session, parentID uint, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool) (<-chan messaging.StreamEvent, *entities.Message, error) {
+	f.ctx = ctx
+	stream := make(chan messaging.StreamEvent)
+	go func() {
+		defer close(stream)
+		for _, event := range f.events {
+			stream <- event
+		}
+	}()
+	return stream, &entities.Message{Base: entities.Base{ID: 2}, SessionID: session.ID, Role: "assistant"}, nil
+}
+
+func (f *fakeMessaging) UpdateAssistantMessageWithCallback(assistantMessage *entities.Message, content string, callback func()) {
+	callback()
+	f.saved <- content
+}
+
+func content(text string) messaging.StreamEvent {
+	return messaging.StreamEvent{Type: messaging.EventContentDelta, Data: messaging.DeltaEvent{Content: text}, Legacy: text}
+}
+
+func failure(message string) messaging.StreamEvent {
+	return messaging.StreamEvent{Type: messaging.EventError, Data: messaging.ErrorEvent{Code: messaging.ErrorCodeProviderError, Message: message}, Legacy: message}
+}
+
+// newTestApp serves the facade for a chatbot manager with a "Support" chatbot
+func newTestApp(t *testing.T, events ...messaging.StreamEvent) (*fiber.App, *fakeMessaging) {
+	t.Helper()
+
+	db := testdb.Open(t, &entities.User{}, &entities.Chatbot{}, &entities.Session{})
+	chatbot := &entities.Chatbot{
+		Name:              "Support",
+		ProviderID:        1,
+		ModelName:         "llama3",
+		PromptSuggestions: entities.StringArray{},
+		AllowedRoles:      entities.StringArray{},
+		AllowedGroups:     entities.StringArray{},
+		AllowedUsers:      entities.StringArray{},
+	}
+	if err := db.Create(chatbot).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := &fakeMessaging{events: events, saved: make(chan string, 1)}
+	controller := &Controller{DB: db, MessagingService: service}
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("user", &entities.User{Base: entities.Base{ID: 1}, Username: "ayse"})
+		c.Locals("permissions", []string{access.PermissionChatbotsManage})
+		return c.Next()
+	})
+	app.Post("/v1/chat/completions", controller.ChatCompletions)
+	return app, service
+}
+
+// complete sends a completion request and returns the response status and body
+func complete(t *testing.T, app *fiber.App, body string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+// waitSaved returns the answer persisted after a completion
+func waitSaved(t *testing.T, service *fakeMessaging) string {
+	t.Helper()
+
+	select {
+	case saved := <-service.saved:
+		return saved
+	case <-time.After(5 * time.Second):
+		t.Fatal("answer was not persisted")
+		return ""
+	}
+}
+
+func TestChatCompletionsValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantType   string
+	}{
+		{
+			name:       "invalid body",
+			body:       `{"model": `,
+			wantStatus: fiber.StatusBadRequest,
+			wantType:   "invalid_request_error",
+		},
+		{
+			name:       "no messages",
+			body:       `{"model": "Support", "messages": []}`,
+			wantStatus: fiber.StatusBadRequest,
+			wantType:   "invalid_request_error",
+		},
+		{
+			name:       "last message from the assistant",
+			body:       `{"model": "Support", "messages": [{"role": "assistant", "content": "Hi"}]}`,
+			wantStatus: fiber.StatusBadRequest,
+			wantType:   "invalid_request_error",
+		},
+		{
+			name:       "unknown model",
+			body:       `{"model": "Sales", "messages": [{"role": "user", "content": "Hi"}]}`,
+			wantStatus: fiber.StatusNotFound,
+			wantType:   "not_found_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp(t)
+
+			status, body := complete(t, app, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+
+			var response struct {
+				Error struct {
+					Type string `json:"type"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(body), &response); err != nil {
+				t.Fatalf("invalid error body %q: %v", body, err)
+			}
+			if response.Error.Type != tt.wantType {
+				t.Errorf("error type = %q, want %q", response.Error.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestChatCompletions(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []messaging.StreamEvent
+		wantStatus  int
+		wantContent string
+		wantError   string
+	}{
+		{
+			name:        "answer",
+			events:      []messaging.StreamEvent{content("Hello"), content(" there")},
+			wantStatus:  fiber.StatusOK,
+			wantContent: "Hello there",
+		},
+		{
+			name:       "failed generation",
+			events:     []messaging.StreamEvent{content("Hel"), failure("provider unavailable")},
+			wantStatus: fiber.StatusBadGateway,
+			wantError:  "provider unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, service := newTestApp(t, tt.events...)
+
+			status, body := complete(t, app, `{"model": "Support", "messages": [{"role": "user", "content": "Hi"}]}`)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+
+			var response struct {
+				Object  string `json:"object"`
+				Choices []struct {
+					Message      responseMessage `json:"message"`
+					FinishReason string          `json:"finish_reason"`
+				} `json:"choices"`
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(body), &response); err != nil {
+				t.Fatalf("invalid body %q: %v", body, err)
+			}
+			if tt.wantError != "" {
+				if response.Error.Message != tt.wantError || len(response.Choices) != 0 {
+					t.Errorf("response = %s, want only the error %q", body, tt.wantError)
+				}
+			} else if len(response.Choices) != 1 || response.Choices[0].Message.Content != tt.wantContent || response.Choices[0].FinishReason != "stop" {
+				t.Errorf("response = %s, want %q finished with stop", body, tt.wantContent)
+			}
+
+			waitSaved(t, service)
+
+			// The generation ends with the request instead of running unbounded
+			if _, ok := service.ctx.Deadline(); !ok {
+				t.Error("generation context has no deadline")
+			}
+			if service.ctx.Err() == nil {
+				t.Error("generation context was not cancelled when the request ended")
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []messaging.StreamEvent
+		wantDeltas []string
+		wantError  string
+	}{
+		{
+			name:       "answer",
+			events:     []messaging.StreamEvent{content("Hello"), content(" there")},
+			wantDeltas: []string{"Hello", " there"},
+		},
+		{
+			name:       "failed generation",
+			events:     []messaging.StreamEvent{content("Hel"), failure("provider unavailable")},
+			wantDeltas: []string{"Hel"},
+			wantError:  "provider unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, service := newTestApp(t, tt.events...)
+
+			status, body := complete(t, app, `{"model": "Support", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`)
+			if status != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", status, fiber.StatusOK, body)
+			}
+
+			var deltas, finishReasons []string
+			var errorMessage string
+			done := false
+			for _, line := range strings.Split(body, "\n") {
+				data, ok := strings.CutPrefix(line, "data: ")
+				if !ok {
+					continue
+				}
+				if data == "[DONE]" {
+					done = true
+					continue
+				}
+
+				var chunk struct {
+					Choices []struct {
+						Delta        delta   `json:"delta"`
+						FinishReason *string `json:"finish_reason"`
+					} `json:"choices"`
+					Error *struct {
+						Message string `json:"message"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("invalid chunk %q: %v", data, err)
+				}
+				if chunk.Error != nil {
+					errorMessage = chunk.Error.Message
+				}
+				for _, choice := range chunk.Choices {
+					if choice.Delta.Content != "" {
+						deltas = append(deltas, choice.Delta.Content)
+					}
+					if choice.FinishReason != nil {
+						finishReasons = append(finishReasons, *choice.FinishReason)
+					}
+				}
+			}
+
+			if strings.Join(deltas, "|") != strings.Join(tt.wantDeltas, "|") {
+				t.Errorf("deltas = %q, want %q", deltas, tt.wantDeltas)
+			}
+			if tt.wantError != "" {
+				if errorMessage != tt.wantError {
+					t.Errorf("error = %q, want %q", errorMessage, tt.wantError)
+				}
+				if len(finishReasons) != 0 || done {
+					t.Errorf("failed stream finished with %q and [DONE] %v, want it to end with the error", finishReasons, done)
+				}
+			} else if len(finishReasons) != 1 || finishReasons[0] != "stop" || !done {
+				t.Errorf("stream finished with %q and [DONE] %v, want stop and [DONE]", finishReasons, done)
+			}
+
+			if saved := waitSaved(t, service); !strings.HasPrefix(saved, strings.Join(tt.wantDeltas, "")) {
+				t.Errorf("persisted answer = %q, want it to start with the streamed deltas", saved)
+			}
+		})
+	}
+}
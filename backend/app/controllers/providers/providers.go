@@ -57,7 +57,11 @@ func (h *Controller) Create(c fiber.Ctx) error {
 }
 
 func (h *Controller) Update(c fiber.Ctx) error {
-	var payload *entities.Provider
+	var payload struct {
+		entities.Provider
+		// Omitted keeps the stored key, an empty key clears it
+		ApiKey *string `json:"api_key"`
+	}
 	if err := c.Bind().JSON(&payload); err != nil {
 		return err
 	}
@@ -67,15 +71,24 @@ func (h *Controller) Update(c fiber.Ctx) error {
 		return err
 	}
 
+	columns := []string{"name", "type", "description", "base_url"}
+	if payload.ApiKey != nil {
+		payload.Provider.ApiKey = *payload.ApiKey
+		columns = append(columns, "api_key")
+	}
+
 	if err := h.DB.
-		Clauses(clause.Returning{}).
-		Model(&entities.Provider{}).
-		Where("id = ?", c.Params("id")).
-		Updates(&payload).Error; err != nil {
+		Model(provider).
+		Select(columns).
+		Updates(&payload.Provider).Error; err != nil {
 		return err
 	}
 
-	return c.JSON(payload)
+	if err := h.DB.First(&provider, provider.ID).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(provider)
 }
 
 func (h *Controller) Delete(c fiber.Ctx) error {
@@ -89,7 +102,7 @@ func (h *Controller) Delete(c fiber.Ctx) error {
 func (h *Controller) Types(c fiber.Ctx) error {
 	// For now, hardcoded list of supported provider types
 	// In the future, this could be dynamic based on available providers
-	types := []string{"ollama", "openai", "litellm"}
+	types := []string{"ollama", "openai", "litellm", "anthropic"}
 	return c.JSON(fiber.Map{"types": types})
 }
 
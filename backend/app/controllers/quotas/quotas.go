@@ -0,0 +1,108 @@
+package quotas
+
+import (
+	"sef/app/entities"
+	"sef/internal/paginator"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Controller struct {
+	DB *gorm.DB
+}
+
+func (h *Controller) Index(c fiber.Ctx) error {
+	var items []*entities.Quota
+	db := h.DB.Model(&entities.Quota{})
+
+	if c.Query("scope") != "" {
+		db = db.Where("scope = ?", c.Query("scope"))
+	}
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+func (h *Controller) Show(c fiber.Ctx) error {
+	var item *entities.Quota
+	if err := h.DB.First(&item, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(item)
+}
+
+func (h *Controller) Create(c fiber.Ctx) error {
+	var payload *entities.Quota
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if err := validateQuota(payload); err != nil {
+		return err
+	}
+
+	if err := h.DB.
+		Clauses(clause.Returning{}).
+		Create(&payload).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(payload)
+}
+
+func (h *Controller) Update(c fiber.Ctx) error {
+	var payload *entities.Quota
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if err := validateQuota(payload); err != nil {
+		return err
+	}
+
+	// Select all fields so limits can be set back to zero (unlimited)
+	if err := h.DB.
+		Clauses(clause.Returning{}).
+		Model(&entities.Quota{}).
+		Where("id = ?", c.Params("id")).
+		Select("scope", "target", "messages_per_minute", "tokens_per_day", "concurrent_generations").
+		Updates(&payload).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(payload)
+}
+
+func (h *Controller) Delete(c fiber.Ctx) error {
+	if err := h.DB.Delete(&entities.Quota{}, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Quota deleted successfully"})
+}
+
+// validateQuota checks the scope, target and limits of a quota
+func validateQuota(quota *entities.Quota) error {
+	switch quota.Scope {
+	case entities.QuotaScopeUser, entities.QuotaScopeRole, entities.QuotaScopeChatbot:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Scope must be one of user, role or chatbot")
+	}
+
+	if quota.Target == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Target is required")
+	}
+
+	if quota.MessagesPerMinute < 0 || quota.TokensPerDay < 0 || quota.ConcurrentGenerations < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Limits cannot be negative")
+	}
+
+	return nil
+}
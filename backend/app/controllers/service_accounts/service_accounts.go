@@ -0,0 +1,246 @@
+package service_accounts
+
+import (
+	"fmt"
+	"regexp"
+	"sef/app/entities"
+	"sef/internal/paginator"
+	"sef/pkg/access"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,49}$`)
+
+type Controller struct {
+	DB *gorm.DB
+}
+
+type accountPayload struct {
+	Name        string   `json:"name"`
+	Roles       []string `json:"roles"`
+	Groups      []string `json:"groups"`
+	Permissions []string `json:"permissions"`
+}
+
+func (h *Controller) Index(c fiber.Ctx) error {
+	var items []*entities.User
+	db := h.DB.Model(&entities.User{}).Where("service_account = ?", true)
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+func (h *Controller) Show(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(account)
+}
+
+// Create adds a service account. It has no Keycloak user and can only
+// authenticate with the tokens issued to it.
+func (h *Controller) Create(c fiber.Ctx) error {
+	var payload struct {
+		Username string `json:"username"`
+		accountPayload
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if !usernamePattern.MatchString(payload.Username) {
+		return fiber.NewError(fiber.StatusBadRequest, "Username must be 3 to 50 lowercase letters, digits, dots, dashes or underscores")
+	}
+
+	account := &entities.User{
+		KeycloakID:     "service-account:" + payload.Username,
+		Username:       payload.Username,
+		Locale:         entities.LocaleEN,
+		ServiceAccount: true,
+	}
+	if err := applyAccount(c, account, payload.accountPayload); err != nil {
+		return err
+	}
+
+	var taken int64
+	if err := h.DB.Unscoped().Model(&entities.User{}).Where("username = ?", account.Username).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Username is already taken")
+	}
+
+	if err := h.DB.Create(account).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(account)
+}
+
+// Update changes the name, roles, groups and permissions of a service account.
+// Token scopes beyond the new permissions stop granting them.
+func (h *Controller) Update(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	var payload accountPayload
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if err := applyAccount(c, account, payload); err != nil {
+		return err
+	}
+
+	if err := h.DB.Model(account).
+		Select("name", "roles", "groups", "permissions").
+		Updates(account).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(account)
+}
+
+// Delete removes a service account and revokes its tokens
+func (h *Controller) Delete(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entities.ApiToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", account.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Delete(account).Error
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Service account deleted successfully"})
+}
+
+// Tokens returns the tokens issued to a service account
+func (h *Controller) Tokens(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	var items []*entities.ApiToken
+	db := h.DB.Model(&entities.ApiToken{}).
+		Where("user_id = ?", account.ID).
+		Order("id DESC")
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// CreateToken issues a token to a service account
+func (h *Controller) CreateToken(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	var payload struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+	if err := requireGranted(c, access.NormalizeList(payload.Scopes, "")); err != nil {
+		return err
+	}
+
+	apiToken, token, err := access.IssueToken(h.DB, account, payload.Name, payload.Scopes, payload.ExpiresInDays)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"token":     token,
+		"api_token": apiToken,
+	})
+}
+
+// RevokeToken revokes a token of a service account
+func (h *Controller) RevokeToken(c fiber.Ctx) error {
+	account, err := h.find(c)
+	if err != nil {
+		return err
+	}
+
+	if err := access.RevokeToken(h.DB, account.ID, c.Params("token_id")); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Token revoked successfully"})
+}
+
+// find loads the service account of the request
+func (h *Controller) find(c fiber.Ctx) (*entities.User, error) {
+	var account *entities.User
+	if err := h.DB.Where("service_account = ?", true).First(&account, c.Params("id")).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// applyAccount validates the editable fields of a service account. Callers
+// can only hand out the permissions they hold themselves.
+func applyAccount(c fiber.Ctx, account *entities.User, payload accountPayload) error {
+	if payload.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+
+	permissions := access.NormalizeList(payload.Permissions, "")
+	for _, permission := range permissions {
+		if !slices.Contains(access.AllPermissions, permission) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown permission %s", permission))
+		}
+	}
+	if err := requireGranted(c, permissions); err != nil {
+		return err
+	}
+
+	account.Name = payload.Name
+	account.Roles = access.NormalizeList(payload.Roles, "")
+	account.Groups = access.NormalizeList(payload.Groups, "/")
+	account.Permissions = permissions
+
+	return nil
+}
+
+// requireGranted rejects permissions or token scopes the caller does not hold
+func requireGranted(c fiber.Ctx, permissions []string) error {
+	for _, permission := range permissions {
+		if permission == access.ScopeChat {
+			continue
+		}
+		if !access.HasPermission(c, permission) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("You cannot grant the %s permission", permission))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package service_accounts
+
+import (
+	"net/http/httptest"
+	"sef/pkg/access"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestCreateRequiresGrantedPermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "permission the caller lacks",
+			body:       `{"username": "reporting", "name": "Reporting", "permissions": ["service_accounts:manage", "providers:manage"]}`,
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "unknown permission",
+			body:       `{"username": "reporting", "name": "Reporting", "permissions": ["everything"]}`,
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "missing name",
+			body:       `{"username": "reporting", "permissions": ["service_accounts:manage"]}`,
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The requests are rejected before the database is used
+			controller := &Controller{}
+			app := fiber.New()
+			app.Use(func(c fiber.Ctx) error {
+				c.Locals("permissions", []string{access.PermissionServiceAccountsManage})
+				return c.Next()
+			})
+			app.Post("/", controller.Create)
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCreateTokenRequiresGrantedScopes(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("permissions", []string{access.PermissionServiceAccountsManage})
+		return c.Next()
+	})
+	app.Post("/", func(c fiber.Ctx) error {
+		var payload struct {
+			Scopes []string `json:"scopes"`
+		}
+		if err := c.Bind().JSON(&payload); err != nil {
+			return err
+		}
+		if err := requireGranted(c, payload.Scopes); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := map[string]int{
+		`{"scopes": ["chat", "service_accounts:manage"]}`: fiber.StatusOK,
+		`{"scopes": ["chat", "settings:manage"]}`:         fiber.StatusForbidden,
+	}
+	for body, want := range tests {
+		req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%s: status = %d, want %d", body, resp.StatusCode, want)
+		}
+	}
+}
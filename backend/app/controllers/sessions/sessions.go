@@ -2,16 +2,20 @@ package sessions
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"sef/app/entities"
 	"sef/internal/paginator"
 	"sef/internal/search"
+	"sef/pkg/access"
 	"sef/pkg/messaging"
 	"sef/pkg/providers"
 	"sef/pkg/rag"
 	"sef/pkg/summary"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
@@ -69,7 +73,7 @@ func (h *Controller) Show(c fiber.Ctx) error {
 	}
 
 	currentUser := c.Locals("user").(*entities.User)
-	if item.UserID != currentUser.ID && !currentUser.IsAdmin {
+	if item.UserID != currentUser.ID && !access.HasPermission(c, access.PermissionSessionsAudit) {
 		return fiber.ErrForbidden
 	}
 
@@ -84,6 +88,11 @@ func (h *Controller) Create(c fiber.Ctx) error {
 
 	payload.UserID = c.Locals("user").(*entities.User).ID
 
+	var chatbot *entities.Chatbot
+	if err := h.DB.First(&chatbot, payload.ChatbotID).Error; err != nil || !access.SubjectFromContext(c).CanUse(chatbot) {
+		return fiber.NewError(fiber.StatusNotFound, "Chatbot not found")
+	}
+
 	if err := h.DB.
 		Clauses(clause.Returning{}).
 		Create(&payload).Error; err != nil {
@@ -100,7 +109,7 @@ func (h *Controller) Delete(c fiber.Ctx) error {
 	}
 
 	currentUser := c.Locals("user").(*entities.User)
-	if item.UserID != currentUser.ID && !currentUser.IsAdmin {
+	if item.UserID != currentUser.ID && !access.HasPermission(c, access.PermissionSessionsAudit) {
 		return fiber.ErrForbidden
 	}
 
@@ -118,18 +127,54 @@ func (h *Controller) Messages(c fiber.Ctx) error {
 	}
 
 	currentUser := c.Locals("user").(*entities.User)
-	if session.UserID != currentUser.ID && !currentUser.IsAdmin {
+	if session.UserID != currentUser.ID && !access.HasPermission(c, access.PermissionSessionsAudit) {
 		return fiber.ErrForbidden
 	}
 
-	var messages []*entities.Message
+	var messages []entities.Message
 	if err := h.DB.Where("session_id = ?", session.ID).
-		Where("role != ?", "tool").
-		Order("created_at ASC").Find(&messages).Error; err != nil {
+		Order("id ASC").Find(&messages).Error; err != nil {
 		return err
 	}
 
-	return c.JSON(messages)
+	// Alternative versions of a message share its parent
+	siblings := make(map[uint][]uint)
+	for _, msg := range messages {
+		if messaging.IsTurnMessage(msg) {
+			siblings[parentKey(msg)] = append(siblings[parentKey(msg)], msg.ID)
+		}
+	}
+
+	// Only the active branch is shown, tool rows are internal
+	items := []*entities.Message{}
+	for _, msg := range messaging.BranchMessages(messages, session.ActiveMessageID) {
+		if !messaging.IsTurnMessage(msg) {
+			continue
+		}
+		if len(siblings[parentKey(msg)]) > 1 {
+			msg.Siblings = siblings[parentKey(msg)]
+		}
+		items = append(items, &msg)
+	}
+
+	return c.JSON(items)
+}
+
+// checkChatbotAccess rejects messages to a chatbot the user is no longer
+// allowed to use, its access policy may have changed since the session started
+func checkChatbotAccess(c fiber.Ctx, session *entities.Session) error {
+	if !access.SubjectFromContext(c).CanUse(&session.Chatbot) {
+		return fiber.NewError(fiber.StatusForbidden, "You do not have access to this chatbot")
+	}
+	return nil
+}
+
+// parentKey groups root messages of a session under zero
+func parentKey(msg entities.Message) uint {
+	if msg.ParentID == nil {
+		return 0
+	}
+	return *msg.ParentID
 }
 
 func (h *Controller) SendMessage(c fiber.Ctx) error {
@@ -170,43 +215,250 @@ func (h *Controller) SendMessage(c fiber.Ctx) error {
 		}
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
+	if err := checkChatbotAccess(c, session); err != nil {
+		return err
+	}
 
-	// Save user message
-	if err := h.MessagingService.SaveUserMessage(sessionID, req.Content); err != nil {
+	// Save user message, continuing the active branch
+	userMessage, err := h.MessagingService.SaveUserMessage(sessionID, session.ActiveMessageID, req.Content)
+	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
 
 	// Prepare chat messages
-	messages, ragResult := h.MessagingService.PrepareChatMessages(session, req.Content)
+	messages, ragResult := h.MessagingService.PrepareChatMessages(session, session.ActiveMessageID, req.Content)
 
 	// Generate and stream response
-	return h.streamChatResponse(c, session, messages, ragResult, req.WebSearchEnabled, sessionID, user.ID)
+	return h.streamChatResponse(c, session, userMessage.ID, messages, ragResult, req.WebSearchEnabled, sessionID, user.ID)
+}
+
+// RegenerateMessage generates a new answer to the user message of an assistant message.
+// The new answer becomes a sibling of the old one on a new branch.
+func (h *Controller) RegenerateMessage(c fiber.Ctx) error {
+	sessionID, err := h.MessagingService.ValidateAndParseSessionID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var req struct {
+		WebSearchEnabled bool `json:"web_search_enabled"`
+	}
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	user := c.Locals("user").(*entities.User)
+	session, err := h.MessagingService.LoadSessionWithChatbotToolsAndMessages(sessionID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := checkChatbotAccess(c, session); err != nil {
+		return err
+	}
+
+	message := findTurnMessage(session, c.Params("message_id"))
+	if message == nil || message.Role != "assistant" || message.ParentID == nil {
+		return fiber.NewError(fiber.StatusNotFound, "assistant message not found")
+	}
+
+	userMessage := findTurnMessage(session, strconv.FormatUint(uint64(*message.ParentID), 10))
+	if userMessage == nil || userMessage.Role != "user" {
+		return fiber.NewError(fiber.StatusNotFound, "user message not found")
+	}
+
+	messages, ragResult := h.MessagingService.PrepareChatMessages(session, userMessage.ParentID, userMessage.Content)
+
+	return h.streamChatResponse(c, session, userMessage.ID, messages, ragResult, req.WebSearchEnabled, sessionID, user.ID)
+}
+
+// EditMessage sends an edited version of a user message on a new branch, the original
+// message and its answers are kept on their branch
+func (h *Controller) EditMessage(c fiber.Ctx) error {
+	sessionID, err := h.MessagingService.ValidateAndParseSessionID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	req, err := h.MessagingService.ParseSendMessageRequest(c.Body())
+	if err != nil {
+		if strings.Contains(err.Error(), "validation failed") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"errors": strings.TrimPrefix(err.Error(), "validation failed: "),
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	user := c.Locals("user").(*entities.User)
+	session, err := h.MessagingService.LoadSessionWithChatbotToolsAndMessages(sessionID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err := checkChatbotAccess(c, session); err != nil {
+		return err
+	}
+
+	original := findTurnMessage(session, c.Params("message_id"))
+	if original == nil || original.Role != "user" {
+		return fiber.NewError(fiber.StatusNotFound, "user message not found")
+	}
+
+	// The edited message forks from the same parent as the original
+	userMessage, err := h.MessagingService.SaveUserMessage(sessionID, original.ParentID, req.Content)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	messages, ragResult := h.MessagingService.PrepareChatMessages(session, original.ParentID, req.Content)
+
+	return h.streamChatResponse(c, session, userMessage.ID, messages, ragResult, req.WebSearchEnabled, sessionID, user.ID)
+}
+
+// ActivateMessage switches the session to the newest branch going through a message
+func (h *Controller) ActivateMessage(c fiber.Ctx) error {
+	sessionID, err := h.MessagingService.ValidateAndParseSessionID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	user := c.Locals("user").(*entities.User)
+	session, err := h.MessagingService.LoadSessionWithChatbotAndMessages(sessionID, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	message := findTurnMessage(session, c.Params("message_id"))
+	if message == nil {
+		return fiber.NewError(fiber.StatusNotFound, "message not found")
+	}
+
+	leafID, err := h.MessagingService.ActivateBranch(session, message.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"active_message_id": leafID})
+}
+
+// findTurnMessage finds a message shown in the conversation among the loaded session messages
+func findTurnMessage(session *entities.Session, messageID string) *entities.Message {
+	id, err := strconv.ParseUint(messageID, 10, 32)
+	if err != nil {
+		return nil
+	}
+
+	for i := range session.Messages {
+		if session.Messages[i].ID == uint(id) && messaging.IsTurnMessage(session.Messages[i]) {
+			return &session.Messages[i]
+		}
+	}
+	return nil
+}
+
+// StopMessage stops the in-flight generation of an assistant message.
+// The partial answer is kept and marked as stopped.
+func (h *Controller) StopMessage(c fiber.Ctx) error {
+	sessionID, err := h.MessagingService.ValidateAndParseSessionID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	user := c.Locals("user").(*entities.User)
+	if _, err := h.MessagingService.GetSessionByIDAndUser(sessionID, user.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	var message *entities.Message
+	if err := h.DB.
+		Where("id = ? AND session_id = ? AND role = ?", c.Params("message_id"), sessionID, "assistant").
+		First(&message).Error; err != nil {
+		return err
+	}
+
+	if !h.MessagingService.StopGeneration(message.ID) {
+		return fiber.NewError(fiber.StatusConflict, "Message is not being generated")
+	}
+
+	return c.JSON(fiber.Map{"message": "Generation stopped successfully"})
 }
 
+// Stream protocols are negotiated with the X-Stream-Protocol request header.
+// Clients get typed SSE events unless they ask for the old newline delimited
+// JSON chunks by sending "legacy".
+const (
+	streamProtocolHeader = "X-Stream-Protocol"
+	legacyStreamProtocol = "legacy"
+)
+
 // streamChatResponse handles the streaming chat response
-func (h *Controller) streamChatResponse(c fiber.Ctx, session *entities.Session, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool, sessionID uint, userID uint) error {
+func (h *Controller) streamChatResponse(c fiber.Ctx, session *entities.Session, parentID uint, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool, sessionID uint, userID uint) error {
+	// Generation outlives the handler, it is cancelled when the stream writer fails
+	ctx, cancel := context.WithCancelCause(context.Background())
+
 	// Generate response stream
-	stream, finalMessage, err := h.MessagingService.GenerateChatResponse(session, messages, ragResult, webSearchEnabled)
+	stream, finalMessage, err := h.MessagingService.GenerateChatResponse(ctx, session, parentID, messages, ragResult, webSearchEnabled)
 	if err != nil {
+		cancel(nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	legacy := c.Get(streamProtocolHeader) == legacyStreamProtocol
+
 	// Set streaming headers
 	h.setStreamingHeaders(c)
+	c.Set("X-Message-ID", strconv.FormatUint(uint64(finalMessage.ID), 10))
+	if legacy {
+		c.Set(streamProtocolHeader, legacyStreamProtocol)
+	} else {
+		c.Set(streamProtocolHeader, messaging.StreamProtocolVersion)
+	}
 
 	// Stream the response with summary generation callback
-	return h.streamResponseWithCallback(c, stream, finalMessage, sessionID, userID)
+	return h.streamResponseWithCallback(c, stream, cancel, legacy, finalMessage, sessionID, userID)
 }
 
 // streamResponseWithCallback handles the actual streaming of the response with callback
-func (h *Controller) streamResponseWithCallback(c fiber.Ctx, stream <-chan string, assistantMessage *entities.Message, sessionID uint, userID uint) error {
+func (h *Controller) streamResponseWithCallback(c fiber.Ctx, stream <-chan messaging.StreamEvent, cancel context.CancelCauseFunc, legacy bool, assistantMessage *entities.Message, sessionID uint, userID uint) error {
 	var fullResponse strings.Builder
 
 	log.Info("Starting stream response callback for session:", sessionID)
 
+	// Concurrent generation slot reserved by the quota middleware
+	release, _ := c.Locals("quota_release").(func())
+
 	c.Response().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer cancel(nil)
+		if release != nil {
+			defer release()
+		}
 		defer func() {
 			log.Info("Stream ended for session:", sessionID, "Full response length:", fullResponse.Len())
 			// Update the assistant message with full content and trigger summary generation (async)
@@ -216,26 +468,49 @@ func (h *Controller) streamResponseWithCallback(c fiber.Ctx, stream <-chan strin
 			})
 		}()
 
-		chunkCount := 0
-		for chunk := range stream {
-			chunkCount++
+		// Pings detect a disconnected client while tools are running
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
 
-			if chunk == "" {
-				continue
+		// disconnect stops the generation and waits until the partial answer is persisted
+		disconnect := func(err error) {
+			log.Error("Client disconnected, stopping generation for session:", sessionID, err)
+			cancel(messaging.ErrClientDisconnected)
+			for event := range stream {
+				fullResponse.WriteString(event.Legacy)
 			}
+		}
 
-			fullResponse.WriteString(chunk)
-
-			// Send JSON formatted chunk
-			if err := h.sendChunk(w, chunk); err != nil {
-				log.Error("Error sending chunk:", err)
-				return // Exit gracefully on connection error
+		eventCount := 0
+		for {
+			select {
+			case event, ok := <-stream:
+				if !ok {
+					log.Info("Stream processing complete for session:", sessionID, "Total events:", eventCount)
+					// Send end event
+					h.sendEndEvent(w, legacy, messaging.DoneEvent{
+						MessageID: assistantMessage.ID,
+						Stopped:   assistantMessage.Stopped,
+						Version:   messaging.StreamProtocolVersion,
+					})
+					return
+				}
+				eventCount++
+
+				// The persisted content keeps the legacy pseudo-tag format
+				fullResponse.WriteString(event.Legacy)
+
+				if err := h.sendEvent(w, legacy, event); err != nil {
+					disconnect(err)
+					return
+				}
+			case <-keepAlive.C:
+				if err := h.sendKeepAlive(w, legacy); err != nil {
+					disconnect(err)
+					return
+				}
 			}
 		}
-
-		log.Info("Stream processing complete for session:", sessionID, "Total chunks:", chunkCount)
-		// Send end event
-		h.sendEndEvent(w)
 	}))
 
 	return nil
@@ -249,32 +524,48 @@ func (h *Controller) setStreamingHeaders(c fiber.Ctx) {
 	c.Set("Transfer-Encoding", "chunked")
 	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering
 	c.Set("Access-Control-Allow-Origin", "*")
-	c.Set("Access-Control-Allow-Headers", "Cache-Control")
+	c.Set("Access-Control-Allow-Headers", "Cache-Control, "+streamProtocolHeader)
+	c.Set("Access-Control-Expose-Headers", "X-Message-ID, "+streamProtocolHeader)
 }
 
-// sendChunk sends a single chunk of the response
-func (h *Controller) sendChunk(w *bufio.Writer, chunk string) error {
-	var msgType string
-	var content string
-
-	// Detect if this is an error message
-	if strings.HasPrefix(chunk, "I apologize, but I'm having trouble") ||
-		strings.Contains(chunk, "Error details:") ||
-		strings.Contains(chunk, "Tool") && strings.Contains(chunk, "encountered an error") ||
-		strings.Contains(chunk, "not available or has been removed") ||
-		strings.Contains(chunk, "took too long to respond") {
-		msgType = "error"
-		content = chunk
-		log.Info("Sending error message:", chunk)
-	} else {
-		msgType = "chunk"
-		content = chunk
+// sendEvent sends a single stream event in the negotiated protocol
+func (h *Controller) sendEvent(w *bufio.Writer, legacy bool, event messaging.StreamEvent) error {
+	if legacy {
+		if event.Legacy == "" {
+			return nil
+		}
+
+		msgType := "chunk"
+		if event.Type == messaging.EventError {
+			msgType = "error"
+			log.Info("Sending error message:", event.Legacy)
+		}
+		return h.sendLegacyEvent(w, map[string]interface{}{
+			"type": msgType,
+			"data": event.Legacy,
+		})
 	}
 
-	data := map[string]interface{}{
-		"type": msgType,
-		"data": content,
+	if event.Type == "" {
+		return nil
 	}
+	return h.sendSSEEvent(w, event.Type, event.Data)
+}
+
+// sendSSEEvent writes a typed event as an SSE frame
+func (h *Controller) sendSSEEvent(w *bufio.Writer, eventType string, data interface{}) error {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		log.Error("Failed to marshal event to JSON:", err)
+		return err
+	}
+
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonBytes)
+	return w.Flush()
+}
+
+// sendLegacyEvent writes a newline delimited JSON chunk of the legacy protocol
+func (h *Controller) sendLegacyEvent(w *bufio.Writer, data map[string]interface{}) error {
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Error("Failed to marshal chunk to JSON:", err)
@@ -283,37 +574,33 @@ func (h *Controller) sendChunk(w *bufio.Writer, chunk string) error {
 
 	jsonData := string(jsonBytes) + "\n"
 	fmt.Fprint(w, jsonData)
-
 	return w.Flush()
 }
 
 // sendEndEvent sends the end event to signal completion
-func (h *Controller) sendEndEvent(w *bufio.Writer) {
-	endData := map[string]interface{}{
-		"type": "done",
+func (h *Controller) sendEndEvent(w *bufio.Writer, legacy bool, done messaging.DoneEvent) {
+	var err error
+	if legacy {
+		err = h.sendLegacyEvent(w, map[string]interface{}{
+			"type": "done",
+		})
+	} else {
+		err = h.sendSSEEvent(w, messaging.EventDone, done)
 	}
-	endBytes, err := json.Marshal(endData)
 	if err != nil {
-		log.Error("Failed to marshal end event to JSON:", err)
-		return
+		log.Error("Failed to send end event:", err)
 	}
-
-	endJson := string(endBytes) + "\n"
-	fmt.Fprint(w, endJson)
-	w.Flush()
 }
 
 // sendKeepAlive sends a keep-alive ping to maintain connection
-func (h *Controller) sendKeepAlive(w *bufio.Writer) error {
-	keepAliveData := map[string]interface{}{
-		"type": "ping",
-	}
-	jsonBytes, err := json.Marshal(keepAliveData)
-	if err != nil {
-		return err
+func (h *Controller) sendKeepAlive(w *bufio.Writer, legacy bool) error {
+	if legacy {
+		return h.sendLegacyEvent(w, map[string]interface{}{
+			"type": "ping",
+		})
 	}
 
-	jsonData := string(jsonBytes) + "\n"
-	fmt.Fprint(w, jsonData)
+	// SSE comment lines are ignored by clients
+	fmt.Fprint(w, ": ping\n\n")
 	return w.Flush()
 }
@@ -0,0 +1,195 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sef/pkg/messaging"
+	"sef/pkg/providers"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// newStallingProvider serves an Ollama chat stream that sends its first chunk
+// and then waits until the request is cancelled
+func newStallingProvider(t *testing.T, chunk string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintf(w, `{"model":"test","message":{"role":"assistant","content":%q},"done":false}`+"\n", chunk)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// startGeneration starts answering a user message of alice's session and
+// returns once the first chunk was streamed
+func startGeneration(t *testing.T) (*Controller, *entities.Session, <-chan messaging.StreamEvent, *entities.Message, context.CancelCauseFunc) {
+	t.Helper()
+
+	server := newStallingProvider(t, "Merhaba, ")
+	db := testdb.Open(t, &entities.User{}, &entities.Provider{}, &entities.Chatbot{}, &entities.Session{}, &entities.Message{})
+
+	for _, username := range []string{"alice", "bob"} {
+		user := &entities.User{Name: username, Username: username, KeycloakID: username, Roles: entities.StringArray{}, Groups: entities.StringArray{}, Permissions: entities.StringArray{}}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider := &entities.Provider{Name: "ollama", Type: "ollama", BaseURL: server.URL}
+	if err := db.Create(provider).Error; err != nil {
+		t.Fatal(err)
+	}
+	chatbot := &entities.Chatbot{
+		Name:              "Support",
+		ProviderID:        provider.ID,
+		Provider:          *provider,
+		ModelName:         "test",
+		PromptSuggestions: entities.StringArray{},
+		AllowedRoles:      entities.StringArray{},
+		AllowedGroups:     entities.StringArray{},
+		AllowedUsers:      entities.StringArray{},
+	}
+	if err := db.Create(chatbot).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := &entities.Session{UserID: 1, ChatbotID: chatbot.ID}
+	if err := db.Create(session).Error; err != nil {
+		t.Fatal(err)
+	}
+	session.Chatbot = *chatbot
+	question := &entities.Message{SessionID: session.ID, Role: "user", Content: "Selam"}
+	if err := db.Create(question).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := &messaging.MessagingService{DB: db}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+
+	stream, message, err := service.GenerateChatResponse(ctx, session, question.ID, []providers.ChatMessage{{Role: "user", Content: "Selam"}}, nil, false)
+	if err != nil {
+		t.Fatalf("GenerateChatResponse() error = %v", err)
+	}
+
+	select {
+	case event := <-stream:
+		if event.Type != messaging.EventContentDelta {
+			t.Fatalf("first event = %s, want %s", event.Type, messaging.EventContentDelta)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generation did not stream")
+	}
+
+	return &Controller{DB: db, MessagingService: service}, session, stream, message, cancel
+}
+
+// stop sends a stop request for a message as the user
+func stop(t *testing.T, controller *Controller, user uint, sessionID uint, messageID uint) int {
+	t.Helper()
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("user", &entities.User{Base: entities.Base{ID: user}})
+		return c.Next()
+	})
+	app.Post("/:id/messages/:message_id/stop", controller.StopMessage)
+
+	req := httptest.NewRequest(fiber.MethodPost, fmt.Sprintf("/%d/messages/%d/stop", sessionID, messageID), nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// waitForEnd drains the stream until the generation finished
+func waitForEnd(t *testing.T, stream <-chan messaging.StreamEvent) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-stream:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("generation did not stop")
+		}
+	}
+}
+
+func TestStopMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(t *testing.T, controller *Controller, session *entities.Session, message *entities.Message, cancel context.CancelCauseFunc)
+	}{
+		{
+			name: "stop endpoint",
+			stop: func(t *testing.T, controller *Controller, session *entities.Session, message *entities.Message, cancel context.CancelCauseFunc) {
+				if status := stop(t, controller, session.UserID, session.ID, message.ID); status != fiber.StatusOK {
+					t.Fatalf("stop status = %d, want %d", status, fiber.StatusOK)
+				}
+			},
+		},
+		{
+			name: "client disconnect",
+			stop: func(t *testing.T, controller *Controller, session *entities.Session, message *entities.Message, cancel context.CancelCauseFunc) {
+				cancel(messaging.ErrClientDisconnected)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller, session, stream, message, cancel := startGeneration(t)
+
+			tt.stop(t, controller, session, message, cancel)
+			waitForEnd(t, stream)
+
+			var stored entities.Message
+			if err := controller.DB.First(&stored, message.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !stored.Stopped {
+				t.Error("stored message is not marked as stopped")
+			}
+			if stored.Content != "Merhaba, " {
+				t.Errorf("stored content = %q, want the partial answer", stored.Content)
+			}
+
+			// Nothing is left to stop once the partial answer is saved
+			if status := stop(t, controller, session.UserID, session.ID, message.ID); status != fiber.StatusConflict {
+				t.Errorf("second stop status = %d, want %d", status, fiber.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestStopMessageOfOtherUser(t *testing.T) {
+	controller, session, stream, message, cancel := startGeneration(t)
+
+	if status := stop(t, controller, 2, session.ID, message.ID); status != fiber.StatusNotFound {
+		t.Errorf("stop status = %d, want %d", status, fiber.StatusNotFound)
+	}
+
+	cancel(nil)
+	waitForEnd(t, stream)
+
+	var stored entities.Message
+	if err := controller.DB.First(&stored, message.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Content != "Merhaba, " {
+		t.Errorf("stored content = %q, want the partial answer", stored.Content)
+	}
+}
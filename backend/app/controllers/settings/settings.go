@@ -1,9 +1,13 @@
 package settings
 
 import (
+	"errors"
 	"fmt"
 	"sef/app/entities"
+	"sef/internal/paginator"
+	"sef/pkg/documentservice"
 	"sef/pkg/providers"
+	"sef/pkg/rag"
 	"strconv"
 
 	"github.com/gofiber/fiber/v3"
@@ -11,7 +15,8 @@ import (
 )
 
 type Controller struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Migrator *documentservice.Migrator
 }
 
 // GetEmbeddingConfig returns current embedding configuration
@@ -19,6 +24,9 @@ func (h *Controller) GetEmbeddingConfig(c fiber.Ctx) error {
 	var providerSetting entities.Settings
 	var modelSetting entities.Settings
 	var vectorSizeSetting entities.Settings
+	var batchSizeSetting entities.Settings
+	var concurrencySetting entities.Settings
+	var collectionSetting entities.Settings
 
 	// Get provider
 	var provider *entities.Provider
@@ -32,54 +40,246 @@ func (h *Controller) GetEmbeddingConfig(c fiber.Ctx) error {
 	// Get vector size
 	h.DB.Where("key = ?", "embedding_vector_size").First(&vectorSizeSetting)
 
+	// Get batch settings
+	h.DB.Where("key = ?", "embedding_batch_size").First(&batchSizeSetting)
+	h.DB.Where("key = ?", "embedding_concurrency").First(&concurrencySetting)
+
+	// Get active collection and running migration
+	h.DB.Where("key = ?", "embedding_collection").First(&collectionSetting)
+	collection := collectionSetting.Value
+	if collection == "" {
+		collection = documentservice.GlobalCollectionName
+	}
+
+	var migration *entities.EmbeddingMigration
+	h.DB.Where("status = ?", entities.MigrationStatusRunning).Order("id DESC").Limit(1).Find(&migration)
+	if migration != nil && migration.ID == 0 {
+		migration = nil
+	}
+
 	return c.JSON(fiber.Map{
 		"provider":    provider,
 		"model":       modelSetting.Value,
 		"vector_size": vectorSizeSetting.Value,
+		"batch_size":  batchSizeSetting.Value,
+		"concurrency": concurrencySetting.Value,
+		"collection":  collection,
+		"migration":   migration,
 	})
 }
 
-// UpdateEmbeddingConfig updates embedding configuration (admin only)
+// UpdateEmbeddingConfig updates embedding configuration (admin only).
+// Changing the model or vector size starts a migration that re-embeds the
+// documents into a new collection; the new settings apply once it completes.
 func (h *Controller) UpdateEmbeddingConfig(c fiber.Ctx) error {
 	var payload struct {
-		ProviderID uint   `json:"provider_id"`
-		Model      string `json:"model"`
-		VectorSize int    `json:"vector_size"`
+		ProviderID  uint   `json:"provider_id"`
+		Model       string `json:"model"`
+		VectorSize  int    `json:"vector_size"`
+		BatchSize   int    `json:"batch_size"`
+		Concurrency int    `json:"concurrency"`
 	}
 
 	if err := c.Bind().JSON(&payload); err != nil {
 		return err
 	}
 
+	if payload.VectorSize <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Vector size must be positive")
+	}
+	if payload.BatchSize < 0 || payload.BatchSize > documentservice.MaxEmbeddingBatchSize {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Batch size must be between 1 and %d", documentservice.MaxEmbeddingBatchSize))
+	}
+	if payload.Concurrency < 0 || payload.Concurrency > documentservice.MaxEmbeddingConcurrency {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Concurrency must be between 1 and %d", documentservice.MaxEmbeddingConcurrency))
+	}
+
 	// Validate provider exists and is Ollama type
 	var provider entities.Provider
 	if err := h.DB.First(&provider, payload.ProviderID).Error; err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Provider not found")
 	}
 
-	// Save provider setting
-	h.DB.Where("key = ?", "embedding_provider_id").
-		Assign(entities.Settings{Key: "embedding_provider_id", Value: fmt.Sprintf("%d", payload.ProviderID)}).
-		FirstOrCreate(&entities.Settings{})
+	needsMigration, err := h.Migrator.NeedsMigration(payload.ProviderID, payload.Model, payload.VectorSize)
+	if err != nil {
+		return err
+	}
 
-	// Save model setting
-	h.DB.Where("key = ?", "embedding_model").
-		Assign(entities.Settings{Key: "embedding_model", Value: payload.Model}).
-		FirstOrCreate(&entities.Settings{})
+	var migration *entities.EmbeddingMigration
+	if needsMigration {
+		migration, err = h.Migrator.Start(payload.ProviderID, payload.Model, payload.VectorSize)
+		if errors.Is(err, documentservice.ErrMigrationRunning) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		// Save provider setting
+		h.DB.Where("key = ?", "embedding_provider_id").
+			Assign(entities.Settings{Key: "embedding_provider_id", Value: fmt.Sprintf("%d", payload.ProviderID)}).
+			FirstOrCreate(&entities.Settings{})
+
+		// Save model setting
+		h.DB.Where("key = ?", "embedding_model").
+			Assign(entities.Settings{Key: "embedding_model", Value: payload.Model}).
+			FirstOrCreate(&entities.Settings{})
+
+		// Save vector size setting
+		h.DB.Where("key = ?", "embedding_vector_size").
+			Assign(entities.Settings{Key: "embedding_vector_size", Value: fmt.Sprintf("%d", payload.VectorSize)}).
+			FirstOrCreate(&entities.Settings{})
+	}
 
-	// Save vector size setting
-	h.DB.Where("key = ?", "embedding_vector_size").
-		Assign(entities.Settings{Key: "embedding_vector_size", Value: fmt.Sprintf("%d", payload.VectorSize)}).
-		FirstOrCreate(&entities.Settings{})
+	// Save batch settings, zero keeps the current value
+	if payload.BatchSize > 0 {
+		h.DB.Where("key = ?", "embedding_batch_size").
+			Assign(entities.Settings{Key: "embedding_batch_size", Value: fmt.Sprintf("%d", payload.BatchSize)}).
+			FirstOrCreate(&entities.Settings{})
+	}
+	if payload.Concurrency > 0 {
+		h.DB.Where("key = ?", "embedding_concurrency").
+			Assign(entities.Settings{Key: "embedding_concurrency", Value: fmt.Sprintf("%d", payload.Concurrency)}).
+			FirstOrCreate(&entities.Settings{})
+	}
 
 	return c.JSON(fiber.Map{
 		"message":     "Embedding configuration updated",
 		"provider_id": payload.ProviderID,
 		"model":       payload.Model,
 		"vector_size": payload.VectorSize,
+		"batch_size":  payload.BatchSize,
+		"concurrency": payload.Concurrency,
+		"migration":   migration,
 	})
 }
 
+// ListEmbeddingMigrations returns embedding migrations, newest first
+func (h *Controller) ListEmbeddingMigrations(c fiber.Ctx) error {
+	var items []*entities.EmbeddingMigration
+	db := h.DB.Model(&entities.EmbeddingMigration{}).Order("id DESC")
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// ShowEmbeddingMigration returns the progress of an embedding migration
+func (h *Controller) ShowEmbeddingMigration(c fiber.Ctx) error {
+	var migration *entities.EmbeddingMigration
+	if err := h.DB.First(&migration, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(migration)
+}
+
+// RetryEmbeddingMigration runs a failed embedding migration again
+func (h *Controller) RetryEmbeddingMigration(c fiber.Ctx) error {
+	var migration *entities.EmbeddingMigration
+	if err := h.DB.First(&migration, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	if err := h.Migrator.Retry(migration); err != nil {
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	}
+
+	return c.JSON(migration)
+}
+
+// RollbackEmbeddingMigration switches back to the collection used before the migration
+func (h *Controller) RollbackEmbeddingMigration(c fiber.Ctx) error {
+	var migration *entities.EmbeddingMigration
+	if err := h.DB.First(&migration, c.Params("id")).Error; err != nil {
+		return err
+	}
+
+	if err := h.Migrator.Rollback(migration); err != nil {
+		if errors.Is(err, documentservice.ErrMigrationNotRollbackable) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		return err
+	}
+
+	return c.JSON(migration)
+}
+
+// GetRerankConfig returns the rerank endpoint used by chatbots with the http reranker
+func (h *Controller) GetRerankConfig(c fiber.Ctx) error {
+	var settings []entities.Settings
+	h.DB.Where("key IN ?", []string{"rerank_url", "rerank_api_key", "rerank_model", "rerank_format"}).Find(&settings)
+
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+
+	apiKey, err := entities.DecryptValue(values["rerank_api_key"])
+	if err != nil {
+		return err
+	}
+
+	format := values["rerank_format"]
+	if format == "" {
+		format = rag.RerankFormatCohere
+	}
+
+	return c.JSON(fiber.Map{
+		"url":     values["rerank_url"],
+		"api_key": entities.MaskSecret(apiKey),
+		"model":   values["rerank_model"],
+		"format":  format,
+	})
+}
+
+// UpdateRerankConfig updates the rerank endpoint (admin only).
+// An omitted API key keeps the current one, an empty one clears it.
+func (h *Controller) UpdateRerankConfig(c fiber.Ctx) error {
+	var payload struct {
+		URL    string  `json:"url"`
+		APIKey *string `json:"api_key"`
+		Model  string  `json:"model"`
+		Format string  `json:"format"`
+	}
+
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	if payload.Format == "" {
+		payload.Format = rag.RerankFormatCohere
+	}
+	if payload.Format != rag.RerankFormatCohere && payload.Format != rag.RerankFormatTEI {
+		return fiber.NewError(fiber.StatusBadRequest, "Format must be cohere or tei")
+	}
+
+	values := map[string]string{
+		"rerank_url":    payload.URL,
+		"rerank_model":  payload.Model,
+		"rerank_format": payload.Format,
+	}
+
+	if payload.APIKey != nil {
+		encrypted, err := entities.EncryptValue(*payload.APIKey)
+		if err != nil {
+			return err
+		}
+		values["rerank_api_key"] = encrypted
+	}
+
+	for key, value := range values {
+		h.DB.Where("key = ?", key).
+			Assign(entities.Settings{Key: key, Value: value}).
+			FirstOrCreate(&entities.Settings{})
+	}
+
+	return c.JSON(fiber.Map{"message": "Rerank configuration updated"})
+}
+
 // ListEmbeddingModels returns available embedding models from configured provider
 func (h *Controller) ListEmbeddingModels(c fiber.Ctx) error {
 	providerIDStr := c.Params("provider_id")
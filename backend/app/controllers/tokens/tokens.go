@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"sef/app/entities"
+	"sef/internal/paginator"
+	"sef/pkg/access"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Controller struct {
+	DB *gorm.DB
+}
+
+// Index returns the personal access tokens of the current user
+func (h *Controller) Index(c fiber.Ctx) error {
+	var items []*entities.ApiToken
+	currentUser := c.Locals("user").(*entities.User)
+
+	db := h.DB.Model(&entities.ApiToken{}).
+		Where("user_id = ?", currentUser.ID).
+		Order("id DESC")
+
+	page, err := paginator.New(db, c).Paginate(&items)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(page)
+}
+
+// Create issues a personal access token. Its scopes are limited to chatting
+// and the permissions of the current user.
+func (h *Controller) Create(c fiber.Ctx) error {
+	var payload struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.Bind().JSON(&payload); err != nil {
+		return err
+	}
+
+	apiToken, token, err := access.IssueToken(h.DB, c.Locals("user").(*entities.User), payload.Name, payload.Scopes, payload.ExpiresInDays)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"token":     token,
+		"api_token": apiToken,
+	})
+}
+
+// Revoke revokes a personal access token of the current user
+func (h *Controller) Revoke(c fiber.Ctx) error {
+	if err := access.RevokeToken(h.DB, c.Locals("user").(*entities.User).ID, c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Token revoked successfully"})
+}
@@ -12,6 +12,7 @@ import (
 	"sef/pkg/providers"
 	"sef/pkg/toolrunners"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"gopkg.in/yaml.v3"
@@ -410,7 +411,10 @@ Please provide only the JQ query without any explanation or markdown formatting.
 		"model": payload.Model,
 	}
 
-	resultChan, err := llmProvider.GenerateChat(context.Background(), messages, options)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	resultChan, err := llmProvider.GenerateChat(ctx, messages, options)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("Failed to generate JQ query: %v", err)})
 	}
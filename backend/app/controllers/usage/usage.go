@@ -0,0 +1,171 @@
+package usage
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Controller struct {
+	DB *gorm.DB
+}
+
+// usageAggregates are the totals selected for every usage grouping
+const usageAggregates = `COUNT(*) AS messages,
+	COALESCE(SUM(messages.prompt_tokens), 0) AS prompt_tokens,
+	COALESCE(SUM(messages.completion_tokens), 0) AS completion_tokens,
+	COALESCE(SUM(messages.prompt_tokens + messages.completion_tokens), 0) AS total_tokens,
+	COUNT(*) FILTER (WHERE messages.usage_estimated) AS estimated_messages,
+	COALESCE(AVG(messages.latency_ms), 0)::bigint AS avg_latency_ms`
+
+// Totals is the aggregated usage of a group of assistant messages
+type Totals struct {
+	Messages          int64 `json:"messages"`
+	PromptTokens      int64 `json:"prompt_tokens"`
+	CompletionTokens  int64 `json:"completion_tokens"`
+	TotalTokens       int64 `json:"total_tokens"`
+	EstimatedMessages int64 `json:"estimated_messages"`
+	AvgLatencyMs      int64 `json:"avg_latency_ms"`
+}
+
+type UserUsage struct {
+	UserID   uint   `json:"user_id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Totals
+}
+
+type ChatbotUsage struct {
+	ChatbotID uint   `json:"chatbot_id"`
+	Name      string `json:"name"`
+	Totals
+}
+
+type ProviderUsage struct {
+	ProviderID uint   `json:"provider_id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Totals
+}
+
+type DailyUsage struct {
+	Day string `json:"day"`
+	Totals
+}
+
+// query builds the base usage query with the from, to, user_id, chatbot_id and provider_id filters.
+// Messages of deleted sessions are included since their tokens were still consumed.
+func (h *Controller) query(c fiber.Ctx) (*gorm.DB, error) {
+	db := h.DB.Table("messages").
+		Joins("JOIN sessions ON sessions.id = messages.session_id").
+		Where("messages.role = ?", "assistant").
+		Where("messages.provider_id IS NOT NULL")
+
+	if from := c.Query("from"); from != "" {
+		day, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+		}
+		db = db.Where("messages.created_at >= ?", day)
+	}
+
+	if to := c.Query("to"); to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+		}
+		db = db.Where("messages.created_at < ?", day.AddDate(0, 0, 1))
+	}
+
+	if userID := c.Query("user_id"); userID != "" {
+		db = db.Where("sessions.user_id = ?", userID)
+	}
+	if chatbotID := c.Query("chatbot_id"); chatbotID != "" {
+		db = db.Where("sessions.chatbot_id = ?", chatbotID)
+	}
+	if providerID := c.Query("provider_id"); providerID != "" {
+		db = db.Where("messages.provider_id = ?", providerID)
+	}
+
+	return db, nil
+}
+
+// ByUser returns token usage grouped by user
+func (h *Controller) ByUser(c fiber.Ctx) error {
+	db, err := h.query(c)
+	if err != nil {
+		return err
+	}
+
+	var items []*UserUsage
+	if err := db.
+		Select("sessions.user_id, users.name, users.username, " + usageAggregates).
+		Joins("JOIN users ON users.id = sessions.user_id").
+		Group("sessions.user_id, users.name, users.username").
+		Order("total_tokens DESC").
+		Scan(&items).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(items)
+}
+
+// ByChatbot returns token usage grouped by chatbot
+func (h *Controller) ByChatbot(c fiber.Ctx) error {
+	db, err := h.query(c)
+	if err != nil {
+		return err
+	}
+
+	var items []*ChatbotUsage
+	if err := db.
+		Select("sessions.chatbot_id, chatbots.name, " + usageAggregates).
+		Joins("JOIN chatbots ON chatbots.id = sessions.chatbot_id").
+		Group("sessions.chatbot_id, chatbots.name").
+		Order("total_tokens DESC").
+		Scan(&items).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(items)
+}
+
+// ByProvider returns token usage grouped by the provider that served the messages
+func (h *Controller) ByProvider(c fiber.Ctx) error {
+	db, err := h.query(c)
+	if err != nil {
+		return err
+	}
+
+	var items []*ProviderUsage
+	if err := db.
+		Select("messages.provider_id, providers.name, providers.type, " + usageAggregates).
+		Joins("JOIN providers ON providers.id = messages.provider_id").
+		Group("messages.provider_id, providers.name, providers.type").
+		Order("total_tokens DESC").
+		Scan(&items).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(items)
+}
+
+// ByDay returns token usage grouped by day
+func (h *Controller) ByDay(c fiber.Ctx) error {
+	db, err := h.query(c)
+	if err != nil {
+		return err
+	}
+
+	var items []*DailyUsage
+	if err := db.
+		Select("TO_CHAR(DATE(messages.created_at), 'YYYY-MM-DD') AS day, " + usageAggregates).
+		Group("DATE(messages.created_at)").
+		Order("DATE(messages.created_at) ASC").
+		Scan(&items).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(items)
+}
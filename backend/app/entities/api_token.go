@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+// ApiToken is a personal access token of a user or a token of a service
+// account. Only the SHA-256 hash of the token is stored.
+type ApiToken struct {
+	Base
+	UserID     uint        `json:"user_id" gorm:"not null;index"`
+	User       *User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Name       string      `json:"name" gorm:"not null;size:255"`
+	Prefix     string      `json:"prefix" gorm:"size:16"` // beginning of the token to recognize it
+	Hash       string      `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes     StringArray `json:"scopes" gorm:"type:json"`
+	ExpiresAt  *time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time  `json:"revoked_at"`
+}
+
+func (ApiToken) TableName() string {
+	return "api_tokens"
+}
+
+// Active reports whether the token can still be used
+func (t *ApiToken) Active() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || t.ExpiresAt.After(time.Now())
+}
@@ -40,12 +40,86 @@ type Chatbot struct {
 	WebSearchEnabled  bool        `json:"web_search_enabled" gorm:"default:false"`
 	ToolFormat        string      `json:"tool_format" gorm:"default:'json';size:10"`
 	OutputFormat      string      `json:"output_format" gorm:"default:'json';size:10"`
+	ToolConcurrency   int         `json:"tool_concurrency" gorm:"default:3"`      // Max tool calls executed in parallel per turn
+	MaxContextTokens  int         `json:"max_context_tokens" gorm:"default:8192"` // Context window of the model, older turns are summarized to fit
+	ThinkingBudget    int         `json:"thinking_budget" gorm:"default:0"`       // Extended thinking tokens for models that support it, 0 disables thinking
 	PromptSuggestions StringArray `json:"prompt_suggestions" gorm:"type:json"`
+	KnowledgeBase     string      `json:"knowledge_base" gorm:"size:64;default:''"`      // Separate Qdrant collection shared by chatbots with the same name, empty uses the global one
+	RetrievalMode     string      `json:"retrieval_mode" gorm:"default:'dense';size:10"` // dense or hybrid
+	Reranker          string      `json:"reranker" gorm:"default:'';size:10"`            // Empty, http or llm
+	RerankTopN        int         `json:"rerank_top_n" gorm:"default:20"`                // Candidates passed to the reranker
+	RerankTopK        int         `json:"rerank_top_k" gorm:"default:5"`                 // Chunks kept after reranking
+	Access            string      `json:"access" gorm:"default:'public';size:10"`        // public or restricted
+	AllowedRoles      StringArray `json:"allowed_roles" gorm:"type:json"`                // Keycloak roles that can use a restricted chatbot
+	AllowedGroups     StringArray `json:"allowed_groups" gorm:"type:json"`               // Keycloak group paths without the leading slash
+	AllowedUsers      StringArray `json:"allowed_users" gorm:"type:json"`                // Usernames
 	Sessions          []Session   `json:"sessions,omitempty" gorm:"foreignKey:ChatbotID"`
 	Tools             []Tool      `json:"tools,omitempty" gorm:"many2many:chatbot_tools;"`
 	Documents         []Document  `json:"documents,omitempty" gorm:"many2many:chatbot_documents;"`
 }
 
+// Retrieval modes of a chatbot's documents
+const (
+	RetrievalModeDense  = "dense"  // Vector similarity only
+	RetrievalModeHybrid = "hybrid" // Vector similarity and full text search fused by rank
+)
+
+// Access policies of a chatbot
+const (
+	ChatbotAccessPublic     = "public"     // Every authenticated user
+	ChatbotAccessRestricted = "restricted" // Only the allowed roles, groups and users
+)
+
+// Rerankers reordering retrieved chunks before they are added to the prompt
+const (
+	RerankerHTTP = "http" // Rerank endpoint configured in the settings
+	RerankerLLM  = "llm"  // The chatbot's own model scores the chunks
+)
+
+// Default reranking window
+const (
+	DefaultRerankTopN = 20
+	DefaultRerankTopK = 5
+)
+
+// GetRerankTopN returns how many retrieved chunks are passed to the reranker
+func (c *Chatbot) GetRerankTopN() int {
+	if c.RerankTopN < 1 {
+		return DefaultRerankTopN
+	}
+	return c.RerankTopN
+}
+
+// GetRerankTopK returns how many chunks are kept after reranking, at most top-N
+func (c *Chatbot) GetRerankTopK() int {
+	if c.RerankTopK < 1 {
+		return min(DefaultRerankTopK, c.GetRerankTopN())
+	}
+	return min(c.RerankTopK, c.GetRerankTopN())
+}
+
+// GetToolConcurrency returns how many tool calls may run in parallel, at least one
+func (c *Chatbot) GetToolConcurrency() int {
+	if c.ToolConcurrency < 1 {
+		return 1
+	}
+	return c.ToolConcurrency
+}
+
+// DefaultMaxContextTokens is used for chatbots without a context window size
+const DefaultMaxContextTokens = 8192
+
+// GetMaxContextTokens returns the context window size of the chatbot's model
+func (c *Chatbot) GetMaxContextTokens() int {
+	if c.MaxContextTokens < 1 {
+		return DefaultMaxContextTokens
+	}
+	return c.MaxContextTokens
+}
+
+// MinThinkingBudget is the smallest extended thinking budget providers accept
+const MinThinkingBudget = 1024
+
 // GetPromptSuggestions returns the prompt suggestions, or default ones if none are set
 func (c *Chatbot) GetPromptSuggestions() []string {
 	if len(c.PromptSuggestions) > 0 {
@@ -0,0 +1,12 @@
+package entities
+
+// ContextSummary is a rolling summary of the older turns of a session branch,
+// sent to the model instead of the turns that no longer fit in its context window.
+// Branches share their common prefix, so a summary is used by every branch
+// that goes through the message it ends at.
+type ContextSummary struct {
+	Base
+	SessionID     uint   `json:"session_id" gorm:"not null;index"`
+	UpToMessageID uint   `json:"up_to_message_id" gorm:"not null"` // last message covered by the summary
+	Content       string `json:"content" gorm:"type:text;not null"`
+}
@@ -2,16 +2,20 @@ package entities
 
 type Document struct {
 	Base
-	Title       string      `json:"title" gorm:"not null"`
-	Description string      `json:"description" gorm:"type:text"`
-	Content     string      `json:"content" gorm:"type:text"`
-	FileName    string      `json:"file_name"`
-	FileType    string      `json:"file_type"`
-	FileSize    int64       `json:"file_size"`
-	ChunkCount  int         `json:"chunk_count" gorm:"default:0"`
-	Status      string      `json:"status" gorm:"default:'pending'"` // pending, processing, ready, failed
-	Metadata    SingleJSONB `json:"metadata" gorm:"type:jsonb"`
-	Chatbots    []Chatbot   `json:"chatbots,omitempty" gorm:"many2many:chatbot_documents;"`
+	Title         string      `json:"title" gorm:"not null"`
+	Description   string      `json:"description" gorm:"type:text"`
+	Content       string      `json:"content" gorm:"type:text"`
+	FileName      string      `json:"file_name"`
+	FileType      string      `json:"file_type"`
+	FileSize      int64       `json:"file_size"`
+	ChunkCount    int         `json:"chunk_count" gorm:"default:0"`
+	Status        string      `json:"status" gorm:"default:'pending'"` // pending, processing, ready, failed
+	Progress      int         `json:"progress" gorm:"default:0"`       // 0-100 while processing
+	FailureReason string      `json:"failure_reason" gorm:"type:text"` // Reason of the last failed processing attempt
+	Version       int         `json:"version" gorm:"default:1"`
+	ContentHash   string      `json:"content_hash" gorm:"size:64"`
+	Metadata      SingleJSONB `json:"metadata" gorm:"type:jsonb"`
+	Chatbots      []Chatbot   `json:"chatbots,omitempty" gorm:"many2many:chatbot_documents;"`
 }
 
 func (Document) TableName() string {
@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+// DocumentChunk is the text of an indexed chunk kept in Postgres for full text
+// search next to its vector in Qdrant
+type DocumentChunk struct {
+	ID           uint        `json:"id" gorm:"primaryKey;autoIncrement"`
+	DocumentID   uint        `json:"document_id" gorm:"not null;uniqueIndex:idx_document_chunk"`
+	ChunkIndex   int         `json:"chunk_index" gorm:"not null;uniqueIndex:idx_document_chunk"`
+	Title        string      `json:"title"`
+	Content      string      `json:"content" gorm:"type:text"`
+	Metadata     SingleJSONB `json:"metadata" gorm:"type:jsonb"` // Page, heading or rows the chunk came from
+	SearchVector string      `json:"-" gorm:"type:tsvector GENERATED ALWAYS AS (setweight(to_tsvector('simple', coalesce(title, '')), 'A') || to_tsvector('simple', coalesce(content, ''))) STORED;index:,type:gin;->"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+func (DocumentChunk) TableName() string {
+	return "document_chunks"
+}
@@ -0,0 +1,31 @@
+package entities
+
+import "time"
+
+// Document job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// DocumentJob is a persisted document processing job picked up by the worker pool.
+// Failed attempts are retried with backoff until MaxAttempts is reached.
+type DocumentJob struct {
+	Base
+	DocumentID  uint       `json:"document_id" gorm:"not null;index"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:'queued';index:idx_document_job_pickup"`
+	RunAt       time.Time  `json:"run_at" gorm:"not null;index:idx_document_job_pickup"`
+	Attempts    int        `json:"attempts" gorm:"default:0"`
+	MaxAttempts int        `json:"max_attempts" gorm:"default:3"`
+	Progress    int        `json:"progress" gorm:"default:0"` // 0-100
+	Error       string     `json:"error" gorm:"type:text"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	HeartbeatAt *time.Time `json:"heartbeat_at"`
+}
+
+func (DocumentJob) TableName() string {
+	return "document_jobs"
+}
@@ -0,0 +1,23 @@
+package entities
+
+// DocumentVersion is an audit snapshot of a document's content, written on
+// upload and on every update
+type DocumentVersion struct {
+	Base
+	DocumentID  uint        `json:"document_id" gorm:"not null;uniqueIndex:idx_document_version"`
+	Version     int         `json:"version" gorm:"not null;uniqueIndex:idx_document_version"`
+	Title       string      `json:"title"`
+	Description string      `json:"description" gorm:"type:text"`
+	Content     string      `json:"content,omitempty" gorm:"type:text"`
+	ContentHash string      `json:"content_hash" gorm:"size:64"`
+	FileName    string      `json:"file_name"`
+	FileType    string      `json:"file_type"`
+	FileSize    int64       `json:"file_size"`
+	Metadata    SingleJSONB `json:"metadata,omitempty" gorm:"type:jsonb"`
+	CreatedByID *uint       `json:"created_by_id"`
+	CreatedBy   *User       `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+}
+
+func (DocumentVersion) TableName() string {
+	return "document_versions"
+}
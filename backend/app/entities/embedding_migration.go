@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// Embedding migration statuses
+const (
+	MigrationStatusRunning    = "running"
+	MigrationStatusCompleted  = "completed"
+	MigrationStatusFailed     = "failed"
+	MigrationStatusRolledBack = "rolled_back"
+)
+
+// EmbeddingMigration re-embeds all documents into a new collection when the
+// embedding model changes. The previous configuration is kept for rollback.
+type EmbeddingMigration struct {
+	Base
+	ProviderID         uint       `json:"provider_id" gorm:"not null"`
+	Model              string     `json:"model" gorm:"not null"`
+	VectorSize         int        `json:"vector_size" gorm:"not null"`
+	Collection         string     `json:"collection" gorm:"size:255"`
+	PreviousProviderID string     `json:"previous_provider_id"`
+	PreviousModel      string     `json:"previous_model"`
+	PreviousVectorSize string     `json:"previous_vector_size"`
+	PreviousCollection string     `json:"previous_collection"`
+	Status             string     `json:"status" gorm:"size:20;not null;default:'running';index"`
+	TotalDocuments     int        `json:"total_documents" gorm:"default:0"`
+	ProcessedDocuments int        `json:"processed_documents" gorm:"default:0"`
+	FailedDocuments    int        `json:"failed_documents" gorm:"default:0"`
+	Progress           int        `json:"progress" gorm:"default:0"` // 0-100
+	Error              string     `json:"error" gorm:"type:text"`
+	StartedAt          *time.Time `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at"`
+	HeartbeatAt        *time.Time `json:"heartbeat_at"`
+}
+
+func (EmbeddingMigration) TableName() string {
+	return "embedding_migrations"
+}
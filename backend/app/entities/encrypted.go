@@ -0,0 +1,85 @@
+package entities
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sef/pkg/aes"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// EncryptedPrefix marks column values that were encrypted with the APP_KEY
+const EncryptedPrefix = "enc:"
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer transparently encrypts string columns at rest.
+// Usage: `gorm:"serializer:encrypted"`
+type EncryptedSerializer struct{}
+
+// Scan decrypts the database value into the field
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported data type for encrypted field: %T", dbValue)
+	}
+
+	decrypted, err := DecryptValue(value)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(decrypted)
+	return nil
+}
+
+// Value encrypts the field value before it is written to the database
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return EncryptValue(value)
+}
+
+// EncryptValue encrypts a plaintext value into its stored representation.
+// Values are always encrypted, even ones that happen to start with the prefix.
+func EncryptValue(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+
+	encrypted, err := aes.Encrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+
+	return EncryptedPrefix + encrypted, nil
+}
+
+// DecryptValue decrypts a stored value. Values without the prefix are legacy
+// plaintext rows that have not been migrated yet and are returned as they are.
+func DecryptValue(value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return value, nil
+	}
+	return aes.Decrypt(strings.TrimPrefix(value, EncryptedPrefix))
+}
+
+// MaskSecret hides all but the last four characters of a secret
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + value[len(value)-4:]
+}
@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "empty", value: ""},
+		{name: "api key", value: "sk-1234567890abcdef"},
+		{name: "starts with the prefix", value: EncryptedPrefix + "not-encrypted"},
+		{name: "unicode", value: "anahtar-çğıöşü"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := EncryptValue(tt.value)
+			if err != nil {
+				t.Fatalf("EncryptValue() error = %v", err)
+			}
+
+			if tt.value == "" {
+				if encrypted != "" {
+					t.Fatalf("EncryptValue() = %q, want empty", encrypted)
+				}
+			} else {
+				if !strings.HasPrefix(encrypted, EncryptedPrefix) {
+					t.Fatalf("EncryptValue() = %q, want %q prefix", encrypted, EncryptedPrefix)
+				}
+				if encrypted == EncryptedPrefix+tt.value || strings.Contains(encrypted, tt.value) {
+					t.Fatalf("EncryptValue() = %q stores the plaintext", encrypted)
+				}
+			}
+
+			decrypted, err := DecryptValue(encrypted)
+			if err != nil {
+				t.Fatalf("DecryptValue() error = %v", err)
+			}
+			if decrypted != tt.value {
+				t.Fatalf("DecryptValue() = %q, want %q", decrypted, tt.value)
+			}
+		})
+	}
+}
+
+func TestDecryptValueLegacyPlaintext(t *testing.T) {
+	decrypted, err := DecryptValue("sk-legacy")
+	if err != nil {
+		t.Fatalf("DecryptValue() error = %v", err)
+	}
+	if decrypted != "sk-legacy" {
+		t.Fatalf("DecryptValue() = %q, want the plaintext", decrypted)
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "short", want: "********"},
+		{value: "12345678", want: "********"},
+		{value: "sk-1234567890abcdef", want: "********cdef"},
+	}
+
+	for _, tt := range tests {
+		if got := MaskSecret(tt.value); got != tt.want {
+			t.Errorf("MaskSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
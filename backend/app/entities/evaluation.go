@@ -0,0 +1,119 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Evaluation run statuses
+const (
+	EvaluationStatusRunning   = "running"
+	EvaluationStatusCompleted = "completed"
+	EvaluationStatusFailed    = "failed"
+)
+
+// EvaluationQuestion is a golden question of a chatbot with the documents that
+// should be retrieved to answer it and optionally the expected answer
+type EvaluationQuestion struct {
+	Base
+	ChatbotID           uint      `json:"chatbot_id" gorm:"not null;index"`
+	Question            string    `json:"question" gorm:"type:text;not null"`
+	ExpectedDocumentIDs UintArray `json:"expected_document_ids" gorm:"type:jsonb"`
+	ExpectedAnswer      string    `json:"expected_answer" gorm:"type:text"`
+}
+
+func (EvaluationQuestion) TableName() string {
+	return "evaluation_questions"
+}
+
+// EvaluationRun scores a chatbot's golden questions against the retrieval
+// configuration at the time of the run, which is kept for comparison
+type EvaluationRun struct {
+	Base
+	ChatbotID          uint              `json:"chatbot_id" gorm:"not null;index"`
+	Status             string            `json:"status" gorm:"size:20;not null;default:'running';index"`
+	K                  int               `json:"k" gorm:"not null"`
+	GenerateAnswers    bool              `json:"generate_answers" gorm:"default:false"`
+	Config             SingleJSONB       `json:"config" gorm:"type:jsonb"` // retrieval and embedding settings used
+	TotalQuestions     int               `json:"total_questions" gorm:"default:0"`
+	ProcessedQuestions int               `json:"processed_questions" gorm:"default:0"`
+	RecallAtK          float64           `json:"recall_at_k" gorm:"default:0"`
+	MRR                float64           `json:"mrr" gorm:"default:0"`
+	Faithfulness       *float64          `json:"faithfulness"` // only when answers were generated
+	Correctness        *float64          `json:"correctness"`  // only for questions with an expected answer
+	Results            EvaluationResults `json:"results,omitempty" gorm:"type:jsonb"`
+	Error              string            `json:"error" gorm:"type:text"`
+	StartedAt          *time.Time        `json:"started_at"`
+	FinishedAt         *time.Time        `json:"finished_at"`
+}
+
+func (EvaluationRun) TableName() string {
+	return "evaluation_runs"
+}
+
+// EvaluationResult is the outcome of one golden question in a run
+type EvaluationResult struct {
+	QuestionID           uint     `json:"question_id"`
+	Question             string   `json:"question"`
+	ExpectedDocumentIDs  []uint   `json:"expected_document_ids"`
+	RetrievedDocumentIDs []uint   `json:"retrieved_document_ids"`
+	Recall               float64  `json:"recall"`
+	ReciprocalRank       float64  `json:"reciprocal_rank"`
+	Answer               string   `json:"answer,omitempty"`
+	Faithfulness         *float64 `json:"faithfulness,omitempty"`
+	Correctness          *float64 `json:"correctness,omitempty"`
+	DurationMs           int64    `json:"duration_ms"`
+	Error                string   `json:"error,omitempty"`
+}
+
+type EvaluationResults []EvaluationResult
+
+// Scan Unmarshal
+func (a *EvaluationResults) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value Marshal
+func (a EvaluationResults) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+type UintArray []uint
+
+// Scan Unmarshal
+func (a *UintArray) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value Marshal
+func (a UintArray) Value() (driver.Value, error) {
+	if a == nil {
+		return json.Marshal([]uint{})
+	}
+	return json.Marshal(a)
+}
@@ -1,9 +1,100 @@
 package entities
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
 type Message struct {
 	Base
-	SessionID uint    `json:"session_id" gorm:"not null"`
-	Role      string  `json:"role" gorm:"size:50;not null"` // user, assistant
-	Content   string  `json:"content" gorm:"type:text;not null"`
-	Session   Session `json:"session,omitempty" gorm:"foreignKey:SessionID"`
+	SessionID  uint             `json:"session_id" gorm:"not null"`
+	ParentID   *uint            `json:"parent_id" gorm:"index"`       // previous message of the branch, tool rows point to the assistant message of their turn
+	Role       string           `json:"role" gorm:"size:50;not null"` // user, assistant, tool
+	Content    string           `json:"content" gorm:"type:text;not null"`
+	ToolCalls  MessageToolCalls `json:"tool_calls,omitempty" gorm:"type:jsonb"` // assistant turns that requested tools
+	ToolCallID string           `json:"tool_call_id,omitempty" gorm:"size:255"` // tool results
+	Name       string           `json:"name,omitempty" gorm:"size:255"`         // tool results
+	Stopped    bool             `json:"stopped" gorm:"default:false"`           // generation was cancelled before completion
+	Citations  MessageCitations `json:"citations,omitempty" gorm:"type:jsonb"`  // sources numbered [n] in an assistant answer
+	Session    Session          `json:"session,omitempty" gorm:"foreignKey:SessionID"`
+	Siblings   []uint           `json:"siblings,omitempty" gorm:"-"` // alternative versions of the message on other branches, including itself
+
+	// Usage of the generation that produced an assistant message
+	Model            string `json:"model,omitempty" gorm:"size:255"`
+	ProviderID       *uint  `json:"provider_id,omitempty" gorm:"index"`
+	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
+	UsageEstimated   bool   `json:"usage_estimated" gorm:"default:false"` // provider did not report usage for every request
+	LatencyMs        int64  `json:"latency_ms" gorm:"default:0"`
+}
+
+// MessageToolCall is a persisted tool call requested by the assistant
+type MessageToolCall struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+type MessageToolCalls []MessageToolCall
+
+// Scan Unmarshal
+func (a *MessageToolCalls) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value Marshal, empty lists are stored as NULL so plain messages are easy to filter
+func (a MessageToolCalls) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+// MessageCitation is the document chunk an assistant answer cites as [Number]
+type MessageCitation struct {
+	Number     int     `json:"number"`
+	DocumentID uint    `json:"document_id"`
+	ChunkIndex int     `json:"chunk_index"`
+	Title      string  `json:"title"`
+	Page       int     `json:"page,omitempty"`
+	Heading    string  `json:"heading,omitempty"`
+	Snippet    string  `json:"snippet"`
+	Score      float32 `json:"score"`
+}
+
+type MessageCitations []MessageCitation
+
+// Scan Unmarshal
+func (a *MessageCitations) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// Value Marshal, answers without sources are stored as NULL
+func (a MessageCitations) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(a)
 }
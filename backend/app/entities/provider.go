@@ -1,10 +1,20 @@
 package entities
 
+import "encoding/json"
+
 type Provider struct {
 	Base
 	Name        string `json:"name" gorm:"not null"`
 	Type        string `json:"type" gorm:"not null"`
 	Description string `json:"description"`
 	BaseURL     string `json:"base_url" gorm:"not null"`
-	ApiKey      string `json:"api_key"`
+	ApiKey      string `json:"api_key" gorm:"serializer:encrypted"`
+}
+
+// MarshalJSON masks the API key so it never leaves the server in plaintext
+func (p Provider) MarshalJSON() ([]byte, error) {
+	type provider Provider
+	masked := provider(p)
+	masked.ApiKey = MaskSecret(p.ApiKey)
+	return json.Marshal(masked)
 }
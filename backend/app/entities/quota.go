@@ -0,0 +1,21 @@
+package entities
+
+// Quota scopes
+const (
+	QuotaScopeUser    = "user"
+	QuotaScopeRole    = "role"
+	QuotaScopeChatbot = "chatbot"
+)
+
+// Quota limits how much a user can chat, zero limits are unlimited.
+// User quotas override role quotas and a user with several roles gets the most generous
+// role quota, both count usage across all chatbots. Chatbot quotas apply on top and only
+// count each user's usage of that chatbot.
+type Quota struct {
+	Base
+	Scope                 string `json:"scope" gorm:"size:20;not null;index:idx_quota_target"`
+	Target                string `json:"target" gorm:"size:255;not null;index:idx_quota_target"` // user ID, Keycloak role name or chatbot ID
+	MessagesPerMinute     int    `json:"messages_per_minute" gorm:"default:0"`
+	TokensPerDay          int    `json:"tokens_per_day" gorm:"default:0"`
+	ConcurrentGenerations int    `json:"concurrent_generations" gorm:"default:0"`
+}
@@ -2,10 +2,11 @@ package entities
 
 type Session struct {
 	Base
-	UserID    uint      `json:"user_id" gorm:"not null"`
-	ChatbotID uint      `json:"chatbot_id" gorm:"not null"`
-	Summary   string    `json:"summary" gorm:"type:text"`
-	User      User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Chatbot   Chatbot   `json:"chatbot,omitempty" gorm:"foreignKey:ChatbotID"`
-	Messages  []Message `json:"messages,omitempty" gorm:"foreignKey:SessionID"`
+	UserID          uint      `json:"user_id" gorm:"not null"`
+	ChatbotID       uint      `json:"chatbot_id" gorm:"not null"`
+	Summary         string    `json:"summary" gorm:"type:text"`
+	ActiveMessageID *uint     `json:"active_message_id"` // last message of the branch the conversation continues from
+	User            User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Chatbot         Chatbot   `json:"chatbot,omitempty" gorm:"foreignKey:ChatbotID"`
+	Messages        []Message `json:"messages,omitempty" gorm:"foreignKey:SessionID"`
 }
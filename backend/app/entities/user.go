@@ -15,4 +15,13 @@ type User struct {
 	Email      string `json:"email" gorm:"size:255"`
 	Locale     Locale `json:"locale" gorm:"type:VARCHAR(5);default:'tr'"`
 	IsAdmin    bool   `json:"super_admin" gorm:"default:false"`
+
+	// Service accounts are created by admins for other services and only
+	// authenticate with API tokens
+	ServiceAccount bool `json:"service_account" gorm:"default:false"`
+	// Roles, groups and permissions API tokens act with. They are copied from
+	// Keycloak whenever the user signs in and assigned directly to service accounts.
+	Roles       StringArray `json:"roles,omitempty" gorm:"type:json"`
+	Groups      StringArray `json:"groups,omitempty" gorm:"type:json"`
+	Permissions StringArray `json:"permissions,omitempty" gorm:"type:json"`
 }
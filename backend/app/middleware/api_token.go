@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"sef/app/entities"
+	"sef/internal/database"
+	"sef/internal/error_handler"
+	"sef/pkg/access"
+	"sef/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// lastUsedResolution limits how often the last use of a token is written
+const lastUsedResolution = time.Minute
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(c fiber.Ctx) string {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateApiToken signs a request in with an API token. The request acts
+// with the current roles and groups of the token's owner and only with the
+// permissions the token's scopes allow.
+func authenticateApiToken(c fiber.Ctx, token string) error {
+	db := database.Connection()
+
+	var apiToken entities.ApiToken
+	if err := db.Preload("User").Where("hash = ?", access.HashToken(token)).First(&apiToken).Error; err != nil {
+		log.Info("Unknown API token")
+		return error_handler.ErrorHandler(c, utils.NewAuthError())
+	}
+	if !apiToken.Active() || apiToken.User == nil {
+		log.Info("Expired or revoked API token:", apiToken.Prefix)
+		return error_handler.ErrorHandler(c, utils.NewAuthError())
+	}
+
+	// Disabled users and removed roles must not live on in the owner's tokens
+	owner, err := tokenOwners.get(c, apiToken.User)
+	if err != nil {
+		log.Warn("Failed to resolve the owner of API token", apiToken.Prefix+":", err)
+		return error_handler.ErrorHandler(c, utils.NewAuthError())
+	}
+	if !owner.Enabled {
+		log.Info("API token of a disabled user:", apiToken.Prefix)
+		return error_handler.ErrorHandler(c, utils.NewAuthError())
+	}
+
+	if apiToken.LastUsedAt == nil || time.Since(*apiToken.LastUsedAt) > lastUsedResolution {
+		now := time.Now()
+		apiToken.LastUsedAt = &now
+		if err := db.Model(&apiToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Warn("Failed to update API token last use:", err)
+		}
+	}
+
+	user := apiToken.User
+	c.Locals("user", user)
+	c.Locals("roles", owner.Roles)
+	c.Locals("groups", owner.Groups)
+	c.Locals("permissions", access.TokenPermissions(owner.Permissions, apiToken.Scopes))
+	c.Locals("api_token", &apiToken)
+
+	return c.Next()
+}
+
+// RequireScope rejects API tokens without the given scope. Users signed in
+// with Keycloak are not limited by scopes.
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if apiToken, ok := c.Locals("api_token").(*entities.ApiToken); ok && !slices.Contains(apiToken.Scopes, scope) {
+			return fiber.NewError(fiber.StatusForbidden, "token scope does not allow this request")
+		}
+
+		return c.Next()
+	}
+}
+
+// SignedIn rejects API tokens, used for endpoints that manage tokens themselves
+func SignedIn() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if _, ok := c.Locals("api_token").(*entities.ApiToken); ok {
+			return fiber.NewError(fiber.StatusForbidden, "this request requires signing in")
+		}
+
+		return c.Next()
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"sef/app/entities"
 	"sef/internal/database"
 	"sef/internal/error_handler"
+	"sef/pkg/access"
 	"sef/pkg/config"
 	"sef/pkg/keycloak"
 	"sef/utils"
+	"slices"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
@@ -45,6 +48,12 @@ func Authenticated() fiber.Handler {
 			return error_handler.ErrorHandler(c, utils.NewAuthError())
 		}
 
+		// Scripts and services send API tokens as bearer tokens
+		bearer := bearerToken(c)
+		if strings.HasPrefix(bearer, access.TokenPrefix) {
+			return authenticateApiToken(c, bearer)
+		}
+
 		// Get access token from cookie
 		accessToken := c.Cookies("access_token")
 		refreshToken := c.Cookies("refresh_token")
@@ -94,15 +103,31 @@ func Authenticated() fiber.Handler {
 			}
 		}
 
-		// Update user's admin status if changed
-		if user.IsAdmin != isAdmin {
+		// Groups decide which restricted chatbots the user can use
+		groups, _ := keycloakClient.GetUserGroups(accessToken)
+
+		// Client roles grant the administrative permissions
+		clientRoles, _ := keycloakClient.GetClientRoles(accessToken)
+		permissions := access.Permissions(isAdmin, clientRoles)
+
+		// Update user's admin status and the roles its API tokens act with if changed
+		if user.IsAdmin != isAdmin ||
+			!slices.Equal([]string(user.Roles), roles) ||
+			!slices.Equal([]string(user.Groups), groups) ||
+			!slices.Equal([]string(user.Permissions), permissions) {
 			user.IsAdmin = isAdmin
+			user.Roles = roles
+			user.Groups = groups
+			user.Permissions = permissions
 			db.Save(&user)
 		}
 
 		// Store user in context
 		c.Locals("user", &user)
 		c.Locals("access_token", accessToken)
+		c.Locals("roles", roles)
+		c.Locals("groups", groups)
+		c.Locals("permissions", permissions)
 
 		return c.Next()
 	}
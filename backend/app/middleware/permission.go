@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"sef/app/entities"
+	"sef/pkg/access"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RequirePermission only lets users with all of the given permissions through
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if user, _ := c.Locals("user").(*entities.User); user == nil {
+			return fiber.NewError(fiber.StatusUnauthorized, "user not authenticated")
+		}
+
+		for _, permission := range permissions {
+			if !access.HasPermission(c, permission) {
+				return fiber.NewError(fiber.StatusForbidden, "insufficient permissions")
+			}
+		}
+
+		return c.Next()
+	}
+}
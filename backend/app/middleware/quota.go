@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sef/app/entities"
+	"sef/pkg/quota"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// Quota enforces the message quotas of the current user before a message is sent.
+// The reserved generation slot is stored in the "quota_release" local, streaming
+// handlers call it once the generation finishes, otherwise it is freed on return.
+func Quota(limiter *quota.Limiter) fiber.Handler {
+	// Chatbot quotas need the session's chatbot, unknown sessions are rejected by the handler
+	return QuotaFor(limiter, func(c fiber.Ctx) (uint, error) {
+		var session entities.Session
+		if err := limiter.DB.
+			Select("id", "chatbot_id").
+			Where("id = ? AND user_id = ?", c.Params("id"), c.Locals("user").(*entities.User).ID).
+			Limit(1).
+			Find(&session).Error; err != nil {
+			return 0, err
+		}
+		return session.ChatbotID, nil
+	})
+}
+
+// QuotaFor enforces the message quotas like Quota for requests that name their
+// chatbot another way. chatbotOf returns zero when the chatbot is unknown.
+func QuotaFor(limiter *quota.Limiter, chatbotOf func(c fiber.Ctx) (uint, error)) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		user := c.Locals("user").(*entities.User)
+		roles, _ := c.Locals("roles").([]string)
+
+		chatbotID, err := chatbotOf(c)
+		if err != nil {
+			return err
+		}
+
+		release, err := limiter.Acquire(context.Background(), quota.Subject{
+			UserID:    user.ID,
+			Roles:     roles,
+			ChatbotID: chatbotID,
+		})
+		if err != nil {
+			var exceeded *quota.ExceededError
+			if !errors.As(err, &exceeded) {
+				return err
+			}
+
+			log.Info("Quota exceeded for user:", user.ID, exceeded.Error())
+			retryAfter := max(1, int(math.Ceil(exceeded.RetryAfter.Seconds())))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Quota exceeded",
+				"code":        "quota_exceeded",
+				"limit":       exceeded.Limit,
+				"scope":       exceeded.Scope,
+				"max":         exceeded.Max,
+				"current":     exceeded.Current,
+				"retry_after": retryAfter,
+			})
+		}
+
+		c.Locals("quota_release", release)
+		err = c.Next()
+		if !c.Response().IsBodyStream() {
+			release()
+		}
+		return err
+	}
+}
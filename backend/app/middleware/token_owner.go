@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"sef/app/entities"
+	"sef/internal/database"
+	"sef/pkg/access"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// tokenOwnerTTL bounds how long a disabled user or removed role keeps working
+// through the user's API tokens
+const tokenOwnerTTL = time.Minute
+
+// tokenOwner is what an API token's owner may currently do
+type tokenOwner struct {
+	Enabled     bool
+	IsAdmin     bool
+	Roles       []string
+	Groups      []string
+	Permissions []string
+}
+
+type cachedTokenOwner struct {
+	owner     *tokenOwner
+	expiresAt time.Time
+}
+
+// tokenOwnerCache keeps the resolved owners of API tokens for a short time so
+// not every token request asks Keycloak
+type tokenOwnerCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	resolve func(ctx context.Context, user *entities.User) (*tokenOwner, error)
+	entries map[uint]cachedTokenOwner
+}
+
+var tokenOwners = &tokenOwnerCache{
+	ttl:     tokenOwnerTTL,
+	now:     time.Now,
+	resolve: resolveTokenOwner,
+	entries: make(map[uint]cachedTokenOwner),
+}
+
+// get returns the cached owner of a user's tokens, resolving it when it expired.
+// Failed lookups are not cached.
+func (oc *tokenOwnerCache) get(ctx context.Context, user *entities.User) (*tokenOwner, error) {
+	oc.mu.Lock()
+	entry, ok := oc.entries[user.ID]
+	oc.mu.Unlock()
+	if ok && oc.now().Before(entry.expiresAt) {
+		return entry.owner, nil
+	}
+
+	owner, err := oc.resolve(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	oc.mu.Lock()
+	oc.entries[user.ID] = cachedTokenOwner{owner: owner, expiresAt: oc.now().Add(oc.ttl)}
+	oc.mu.Unlock()
+	return owner, nil
+}
+
+// resolveTokenOwner reads the current state of a user from Keycloak. Service
+// accounts only exist here, their roles are assigned directly.
+func resolveTokenOwner(ctx context.Context, user *entities.User) (*tokenOwner, error) {
+	if user.ServiceAccount || user.KeycloakID == "" {
+		return &tokenOwner{
+			Enabled:     true,
+			IsAdmin:     user.IsAdmin,
+			Roles:       user.Roles,
+			Groups:      user.Groups,
+			Permissions: user.Permissions,
+		}, nil
+	}
+
+	if err := initKeycloak(); err != nil {
+		return nil, err
+	}
+	account, err := keycloakClient.GetAccount(ctx, user.KeycloakID)
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin := slices.Contains(account.Roles, "admin")
+	owner := &tokenOwner{
+		Enabled:     account.Enabled,
+		IsAdmin:     isAdmin,
+		Roles:       account.Roles,
+		Groups:      account.Groups,
+		Permissions: access.Permissions(isAdmin, account.ClientRoles),
+	}
+	if owner.Enabled {
+		syncTokenOwner(user, owner)
+	}
+	return owner, nil
+}
+
+// syncTokenOwner stores changed roles on the user, the same way signing in does,
+// so new tokens can only be issued with the current permissions
+func syncTokenOwner(user *entities.User, owner *tokenOwner) {
+	if user.IsAdmin == owner.IsAdmin &&
+		slices.Equal([]string(user.Roles), owner.Roles) &&
+		slices.Equal([]string(user.Groups), owner.Groups) &&
+		slices.Equal([]string(user.Permissions), owner.Permissions) {
+		return
+	}
+
+	user.IsAdmin = owner.IsAdmin
+	user.Roles = owner.Roles
+	user.Groups = owner.Groups
+	user.Permissions = owner.Permissions
+	if err := database.Connection().Model(user).Updates(map[string]interface{}{
+		"is_admin":    user.IsAdmin,
+		"roles":       user.Roles,
+		"groups":      user.Groups,
+		"permissions": user.Permissions,
+	}).Error; err != nil {
+		log.Warn("Failed to update API token owner roles:", err)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sef/app/entities"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTokenOwnerCache(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	var calls int
+	var resolveErr error
+	permissions := []string{"sessions:audit"}
+
+	cache := &tokenOwnerCache{
+		ttl: time.Minute,
+		now: func() time.Time { return now },
+		resolve: func(ctx context.Context, user *entities.User) (*tokenOwner, error) {
+			calls++
+			if resolveErr != nil {
+				return nil, resolveErr
+			}
+			return &tokenOwner{Enabled: true, Permissions: permissions}, nil
+		},
+		entries: make(map[uint]cachedTokenOwner),
+	}
+	user := &entities.User{Base: entities.Base{ID: 1}}
+
+	steps := []struct {
+		name            string
+		advance         time.Duration
+		err             error
+		permissions     []string
+		wantCalls       int
+		wantErr         bool
+		wantPermissions []string
+	}{
+		{name: "first request resolves", permissions: permissions, wantCalls: 1, wantPermissions: permissions},
+		{name: "cached within the TTL", advance: 30 * time.Second, permissions: nil, wantCalls: 1, wantPermissions: permissions},
+		{name: "removed permission after the TTL", advance: 31 * time.Second, permissions: nil, wantCalls: 2, wantPermissions: nil},
+		{name: "failed lookup", advance: time.Minute, err: errors.New("keycloak unavailable"), wantCalls: 3, wantErr: true},
+		{name: "failed lookup is not cached", err: nil, permissions: permissions, wantCalls: 4, wantPermissions: permissions},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		resolveErr = step.err
+		permissions = step.permissions
+
+		owner, err := cache.get(context.Background(), user)
+		if calls != step.wantCalls {
+			t.Errorf("%s: %d lookups, want %d", step.name, calls, step.wantCalls)
+		}
+		if step.wantErr {
+			if err == nil {
+				t.Errorf("%s: get() error = nil, want the lookup error", step.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: get() error = %v", step.name, err)
+		}
+		if !slices.Equal(owner.Permissions, step.wantPermissions) {
+			t.Errorf("%s: permissions = %v, want %v", step.name, owner.Permissions, step.wantPermissions)
+		}
+	}
+}
+
+func TestResolveServiceAccountOwner(t *testing.T) {
+	user := &entities.User{
+		ServiceAccount: true,
+		Roles:          entities.StringArray{"reporting"},
+		Groups:         entities.StringArray{"ops"},
+		Permissions:    entities.StringArray{"sessions:audit"},
+	}
+
+	owner, err := resolveTokenOwner(context.Background(), user)
+	if err != nil {
+		t.Fatalf("resolveTokenOwner() error = %v", err)
+	}
+	if !owner.Enabled || !slices.Equal(owner.Roles, []string{"reporting"}) ||
+		!slices.Equal(owner.Groups, []string{"ops"}) || !slices.Equal(owner.Permissions, []string{"sessions:audit"}) {
+		t.Errorf("owner = %+v, want the service account's own roles", owner)
+	}
+}
@@ -1,20 +1,30 @@
 package routes
 
 import (
+	"context"
 	"sef/app/controllers/auth"
 	"sef/app/controllers/chatbots"
 	"sef/app/controllers/documents"
+	"sef/app/controllers/evaluations"
+	"sef/app/controllers/mcp_servers"
+	"sef/app/controllers/openai"
 	"sef/app/controllers/providers"
+	"sef/app/controllers/quotas"
+	"sef/app/controllers/service_accounts"
 	"sef/app/controllers/sessions"
 	"sef/app/controllers/settings"
+	"sef/app/controllers/tokens"
 	"sef/app/controllers/tool_categories"
 	"sef/app/controllers/tools"
+	"sef/app/controllers/usage"
 	"sef/app/entities"
 	"sef/app/middleware"
 	"sef/internal/database"
+	"sef/pkg/access"
 	"sef/pkg/config"
 	"sef/pkg/documentservice"
 	"sef/pkg/messaging"
+	"sef/pkg/quota"
 	"sef/pkg/rag"
 	"sef/pkg/summary"
 
@@ -58,16 +68,65 @@ func Server(app *fiber.App) {
 		return c.SendStatus(fiber.StatusOK)
 	})
 
+	tokensGroup := apiV1.Group("/tokens")
+	{
+		controller := &tokens.Controller{
+			DB: database.Connection(),
+		}
+
+		tokensGroup.Use(middleware.SignedIn())
+		tokensGroup.Get("/", controller.Index)
+		tokensGroup.Post("/", controller.Create)
+		tokensGroup.Delete("/:id", controller.Revoke)
+	}
+
+	serviceAccountsGroup := apiV1.Group("/service_accounts")
+	{
+		controller := &service_accounts.Controller{
+			DB: database.Connection(),
+		}
+
+		serviceAccountsGroup.Use(middleware.SignedIn())
+		serviceAccountsGroup.Use(middleware.RequirePermission(access.PermissionServiceAccountsManage))
+		serviceAccountsGroup.Get("/", controller.Index)
+		serviceAccountsGroup.Get("/:id", controller.Show)
+		serviceAccountsGroup.Post("/", controller.Create)
+		serviceAccountsGroup.Patch("/:id", controller.Update)
+		serviceAccountsGroup.Delete("/:id", controller.Delete)
+		serviceAccountsGroup.Get("/:id/tokens", controller.Tokens)
+		serviceAccountsGroup.Post("/:id/tokens", controller.CreateToken)
+		serviceAccountsGroup.Delete("/:id/tokens/:token_id", controller.RevokeToken)
+	}
+
+	cfg, _ := config.Load()
+	docService := documentservice.NewDocumentService(
+		database.Connection(),
+		cfg.QdrantURL,
+	)
+	jobQueue := documentservice.NewJobQueue(
+		database.Connection(),
+		docService,
+		cfg.Documents.Workers,
+		cfg.Documents.MaxAttempts,
+	)
+	jobQueue.Start(context.Background())
+	migrator := documentservice.NewMigrator(database.Connection(), docService, jobQueue)
+	migrator.Resume()
+	go docService.BackfillScopes()
+	go docService.BackfillChunks()
+
 	chatbotsGroup := apiV1.Group("/chatbots")
 	{
 		controller := &chatbots.Controller{
-			DB: database.Connection(),
+			DB:              database.Connection(),
+			DocumentService: docService,
 		}
 
+		chatbotsGroup.Use(middleware.RequireScope(access.ScopeChat))
 		chatbotsGroup.Get("/", controller.Index)
 		chatbotsGroup.Get("/:id", controller.Show)
 
-		chatbotsGroup.Use(middleware.IsSuperAdmin())
+		chatbotsGroup.Use(middleware.RequirePermission(access.PermissionChatbotsManage))
 		chatbotsGroup.Post("/", controller.Create)
 		chatbotsGroup.Patch("/:id", controller.Update)
 		chatbotsGroup.Delete("/:id", controller.Delete)
@@ -79,7 +138,7 @@ func Server(app *fiber.App) {
 			DB: database.Connection(),
 		}
 
-		providersGroup.Use(middleware.IsSuperAdmin())
+		providersGroup.Use(middleware.RequirePermission(access.PermissionProvidersManage))
 		providersGroup.Get("/", controller.Index)
 		providersGroup.Get("/types", controller.Types)
 		providersGroup.Get("/:id", controller.Show)
@@ -95,7 +154,7 @@ func Server(app *fiber.App) {
 			DB: database.Connection(),
 		}
 
-		toolCategoriesGroup.Use(middleware.IsSuperAdmin())
+		toolCategoriesGroup.Use(middleware.RequirePermission(access.PermissionToolsManage))
 		toolCategoriesGroup.Get("/", controller.Index)
 		toolCategoriesGroup.Get("/:id", controller.Show)
 		toolCategoriesGroup.Post("/", controller.Create)
@@ -109,7 +168,7 @@ func Server(app *fiber.App) {
 			DB: database.Connection(),
 		}
 
-		toolsGroup.Use(middleware.IsSuperAdmin())
+		toolsGroup.Use(middleware.RequirePermission(access.PermissionToolsManage))
 		toolsGroup.Get("/", controller.Index)
 		toolsGroup.Get("/types", controller.Types)
 		toolsGroup.Get("/schema", controller.Schema)
@@ -125,28 +184,32 @@ func Server(app *fiber.App) {
 		toolsGroup.Post("/:id/generate-jq", controller.GenerateJq)
 	}
 
-	cfg, _ := config.Load()
-	docService := documentservice.NewDocumentService(
-		database.Connection(),
-		cfg.QdrantURL,
-	)
+	// Chat generation is shared by the sessions and the OpenAI compatible API,
+	// so generations started by either can be stopped from the other
+	ragService := rag.NewRAGService(database.Connection(), docService)
+	summaryService := summary.NewSummaryService(database.Connection())
+	messagingService := &messaging.MessagingService{
+		DB:             database.Connection(),
+		RAGService:     ragService,
+		SummaryService: summaryService,
+	}
+	limiter := quota.NewLimiter(database.Connection())
 
 	sessionsGroup := apiV1.Group("/sessions")
 	{
-		ragService := rag.NewRAGService(database.Connection(), docService)
+		quotaMiddleware := middleware.Quota(limiter)
 
 		controller := &sessions.Controller{
-			DB: database.Connection(),
-			MessagingService: &messaging.MessagingService{
-				DB:         database.Connection(),
-				RAGService: ragService,
-			},
-			SummaryService: summary.NewSummaryService(database.Connection()),
+			DB:               database.Connection(),
+			MessagingService: messagingService,
+			SummaryService:   summaryService,
 		}
 
+		sessionsGroup.Use(middleware.RequireScope(access.ScopeChat))
+
 		sessionsAdminGroup := sessionsGroup.Group("/admin")
 		{
-			sessionsAdminGroup.Use(middleware.IsSuperAdmin())
+			sessionsAdminGroup.Use(middleware.RequirePermission(access.PermissionSessionsAudit))
 			sessionsAdminGroup.Get("/", controller.IndexAdmin)
 		}
 
@@ -162,7 +225,15 @@ func Server(app *fiber.App) {
 		// GetSessionMessages
 		sessionsGroup.Get("/:id/messages", controller.Messages)
 		// SendMessage
-		sessionsGroup.Post("/:id/messages", controller.SendMessage)
+		sessionsGroup.Post("/:id/messages", quotaMiddleware, controller.SendMessage)
+		// EditMessage
+		sessionsGroup.Put("/:id/messages/:message_id", quotaMiddleware, controller.EditMessage)
+		// RegenerateMessage
+		sessionsGroup.Post("/:id/messages/:message_id/regenerate", quotaMiddleware, controller.RegenerateMessage)
+		// ActivateMessage
+		sessionsGroup.Post("/:id/messages/:message_id/activate", controller.ActivateMessage)
+		// StopMessage
+		sessionsGroup.Post("/:id/messages/:message_id/stop", controller.StopMessage)
 
 	}
 
@@ -171,27 +242,123 @@ func Server(app *fiber.App) {
 		controller := &documents.Controller{
 			DB:              database.Connection(),
 			DocumentService: docService,
+			JobQueue:        jobQueue,
 		}
 
 		// All document endpoints require admin
-		documentsGroup.Use(middleware.IsSuperAdmin())
+		documentsGroup.Use(middleware.RequirePermission(access.PermissionDocumentsManage))
 		documentsGroup.Get("/", controller.Index)
 		documentsGroup.Get("/:id", controller.Show)
 		documentsGroup.Post("/upload", controller.Upload)
+		documentsGroup.Put("/:id", controller.Update)
+		documentsGroup.Get("/:id/versions", controller.Versions)
+		documentsGroup.Get("/:id/versions/:version", controller.ShowVersion)
 		documentsGroup.Delete("/:id", controller.Delete)
 		documentsGroup.Post("/search", controller.Search)
 		documentsGroup.Get("/:id/process", controller.ProcessManually)
+		documentsGroup.Get("/:id/jobs", controller.Jobs)
+	}
+
+	quotasGroup := apiV1.Group("/quotas")
+	{
+		controller := &quotas.Controller{
+			DB: database.Connection(),
+		}
+
+		quotasGroup.Use(middleware.RequirePermission(access.PermissionQuotasManage))
+		quotasGroup.Get("/", controller.Index)
+		quotasGroup.Get("/:id", controller.Show)
+		quotasGroup.Post("/", controller.Create)
+		quotasGroup.Patch("/:id", controller.Update)
+		quotasGroup.Delete("/:id", controller.Delete)
+	}
+
+	usageGroup := apiV1.Group("/usage")
+	{
+		controller := &usage.Controller{
+			DB: database.Connection(),
+		}
+
+		usageGroup.Use(middleware.RequirePermission(access.PermissionUsageView))
+		usageGroup.Get("/users", controller.ByUser)
+		usageGroup.Get("/chatbots", controller.ByChatbot)
+		usageGroup.Get("/providers", controller.ByProvider)
+		usageGroup.Get("/daily", controller.ByDay)
+	}
+
+	evaluationsGroup := apiV1.Group("/evaluations")
+	{
+		evaluator := rag.NewEvaluator(database.Connection(), ragService)
+		evaluator.FailInterrupted()
+
+		controller := &evaluations.Controller{
+			DB:         database.Connection(),
+			RAGService: ragService,
+			Evaluator:  evaluator,
+		}
+
+		evaluationsGroup.Use(middleware.RequirePermission(access.PermissionChatbotsManage))
+		evaluationsGroup.Get("/questions", controller.Questions)
+		evaluationsGroup.Post("/questions", controller.CreateQuestion)
+		evaluationsGroup.Post("/questions/import", controller.ImportQuestions)
+		evaluationsGroup.Patch("/questions/:id", controller.UpdateQuestion)
+		evaluationsGroup.Delete("/questions/:id", controller.DeleteQuestion)
+		evaluationsGroup.Get("/runs", controller.Runs)
+		evaluationsGroup.Post("/runs", controller.CreateRun)
+		evaluationsGroup.Get("/runs/:id", controller.ShowRun)
+		evaluationsGroup.Get("/health/:chatbot_id", controller.Health)
 	}
 
 	settingsGroup := apiV1.Group("/settings")
 	{
 		controller := &settings.Controller{
-			DB: database.Connection(),
+			DB:       database.Connection(),
+			Migrator: migrator,
 		}
 
-		settingsGroup.Use(middleware.IsSuperAdmin())
+		settingsGroup.Use(middleware.RequirePermission(access.PermissionSettingsManage))
 		settingsGroup.Get("/embedding", controller.GetEmbeddingConfig)
 		settingsGroup.Put("/embedding", controller.UpdateEmbeddingConfig)
 		settingsGroup.Get("/embedding/models/:provider_id", controller.ListEmbeddingModels)
+		settingsGroup.Get("/embedding/migrations", controller.ListEmbeddingMigrations)
+		settingsGroup.Get("/embedding/migrations/:id", controller.ShowEmbeddingMigration)
+		settingsGroup.Post("/embedding/migrations/:id/retry", controller.RetryEmbeddingMigration)
+		settingsGroup.Post("/embedding/migrations/:id/rollback", controller.RollbackEmbeddingMigration)
+		settingsGroup.Get("/rerank", controller.GetRerankConfig)
+		settingsGroup.Put("/rerank", controller.UpdateRerankConfig)
+	}
+
+	// OpenAI compatible API, the model of a request selects a chatbot.
+	// It is served outside /api/v1 so OpenAI clients only need a base URL and a token.
+	openaiGroup := app.Group("/openai/v1")
+	{
+		controller := &openai.Controller{
+			DB:               database.Connection(),
+			MessagingService: messagingService,
+			SummaryService:   summaryService,
+		}
+
+		openaiGroup.Use(middleware.TokenLookup)
+		openaiGroup.Use(middleware.Authenticated())
+		openaiGroup.Use(middleware.RequireScope(access.ScopeChat))
+		openaiGroup.Get("/models", controller.Models)
+		openaiGroup.Post("/chat/completions", middleware.QuotaFor(limiter, controller.QuotaChatbot), controller.ChatCompletions)
+	}
+
+	// Model Context Protocol servers over the tools of a chatbot or a tool category
+	mcpGroup := app.Group("/mcp")
+	{
+		controller := &mcp_servers.Controller{
+			DB:               database.Connection(),
+			MessagingService: messagingService,
+		}
+
+		mcpGroup.Use(middleware.TokenLookup)
+		mcpGroup.Use(middleware.Authenticated())
+		mcpGroup.Use(middleware.RequireScope(access.ScopeChat))
+		mcpGroup.Post("/chatbots/:id", controller.Chatbot)
+		mcpGroup.Post("/categories/:name", controller.Category)
+		mcpGroup.Get("/*", controller.MethodNotAllowed)
+		mcpGroup.Delete("/*", controller.MethodNotAllowed)
 	}
 }
@@ -1,7 +1,21 @@
 package main
 
-import "sef/internal/server"
+import (
+	"fmt"
+	"os"
+	"sef/internal/server"
+	"sef/pkg/mcp"
+)
 
 func main() {
+	// "mcp" serves the tools of a chatbot or category to MCP clients over stdio
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		if err := mcp.RunStdio(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	server.RunServer()
 }
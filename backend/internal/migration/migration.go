@@ -3,12 +3,17 @@ package migration
 import (
 	"sef/app/entities"
 	"sef/internal/database"
+
+	"gorm.io/gorm"
 )
 
 func Init() error {
 	if err := database.Connection().AutoMigrate(&entities.User{}); err != nil {
 		return err
 	}
+	if err := database.Connection().AutoMigrate(&entities.ApiToken{}); err != nil {
+		return err
+	}
 	if err := database.Connection().AutoMigrate(&entities.Provider{}); err != nil {
 		return err
 	}
@@ -30,8 +35,118 @@ func Init() error {
 	if err := database.Connection().AutoMigrate(&entities.Document{}); err != nil {
 		return err
 	}
+	if err := database.Connection().AutoMigrate(&entities.DocumentVersion{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.DocumentChunk{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.DocumentJob{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.EmbeddingMigration{}); err != nil {
+		return err
+	}
 	if err := database.Connection().AutoMigrate(&entities.Settings{}); err != nil {
 		return err
 	}
+	if err := database.Connection().AutoMigrate(&entities.Quota{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.ContextSummary{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.EvaluationQuestion{}); err != nil {
+		return err
+	}
+	if err := database.Connection().AutoMigrate(&entities.EvaluationRun{}); err != nil {
+		return err
+	}
+	if err := encryptProviderApiKeys(); err != nil {
+		return err
+	}
+	if err := linkMessageBranches(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// encryptProviderApiKeys re-encrypts provider API keys that were stored in plaintext
+func encryptProviderApiKeys() error {
+	var rows []struct {
+		ID     uint
+		ApiKey string
+	}
+	if err := database.Connection().
+		Table("providers").
+		Select("id, api_key").
+		Where("api_key <> '' AND api_key NOT LIKE ?", entities.EncryptedPrefix+"%").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		encrypted, err := entities.EncryptValue(row.ApiKey)
+		if err != nil {
+			return err
+		}
+		if err := database.Connection().
+			Table("providers").
+			Where("id = ?", row.ID).
+			UpdateColumn("api_key", encrypted).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkMessageBranches links the messages of sessions created before branching into a single branch
+func linkMessageBranches() error {
+	var sessionIDs []uint
+	if err := database.Connection().
+		Table("sessions").
+		Where("active_message_id IS NULL").
+		Where("EXISTS (SELECT 1 FROM messages WHERE messages.session_id = sessions.id)").
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		err := database.Connection().Transaction(func(tx *gorm.DB) error {
+			var messages []entities.Message
+			if err := tx.Where("session_id = ?", sessionID).Order("id ASC").Find(&messages).Error; err != nil {
+				return err
+			}
+
+			var last, lastAssistant *uint
+			for _, message := range messages {
+				id := message.ID
+				parentID := lastAssistant
+				// Tool rows hang off the assistant message of their turn
+				if message.Role != "tool" && len(message.ToolCalls) == 0 {
+					parentID = last
+					last = &id
+					if message.Role == "assistant" {
+						lastAssistant = &id
+					}
+				}
+
+				if err := tx.Model(&entities.Message{}).
+					Where("id = ?", message.ID).
+					UpdateColumn("parent_id", parentID).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Model(&entities.Session{}).
+				Where("id = ?", sessionID).
+				UpdateColumn("active_message_id", last).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,109 @@
+package access
+
+import (
+	"sef/app/entities"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// Subject is the user whose access to chatbots is checked, with the roles,
+// groups and permissions of their token
+type Subject struct {
+	User        *entities.User
+	Roles       []string
+	Groups      []string
+	Permissions []string
+}
+
+// SubjectFromContext returns the subject of an authenticated request
+func SubjectFromContext(c fiber.Ctx) Subject {
+	user, _ := c.Locals("user").(*entities.User)
+	roles, _ := c.Locals("roles").([]string)
+	groups, _ := c.Locals("groups").([]string)
+	permissions, _ := c.Locals("permissions").([]string)
+
+	return Subject{User: user, Roles: roles, Groups: groups, Permissions: permissions}
+}
+
+// managesChatbots reports whether the subject can see every chatbot
+func (s Subject) managesChatbots() bool {
+	return slices.Contains(s.Permissions, PermissionChatbotsManage)
+}
+
+// CanUse reports whether the subject can see and chat with a chatbot. Chatbot
+// managers can use every chatbot.
+func (s Subject) CanUse(chatbot *entities.Chatbot) bool {
+	if s.User == nil {
+		return false
+	}
+	if s.managesChatbots() || chatbot.Access != entities.ChatbotAccessRestricted {
+		return true
+	}
+
+	if slices.Contains(chatbot.AllowedUsers, s.User.Username) {
+		return true
+	}
+	for _, role := range s.Roles {
+		if slices.Contains(chatbot.AllowedRoles, role) {
+			return true
+		}
+	}
+	for _, group := range s.Groups {
+		if slices.Contains(chatbot.AllowedGroups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope restricts a chatbots query to the chatbots the subject can use
+func (s Subject) Scope(db *gorm.DB) *gorm.DB {
+	if s.User == nil {
+		return db.Where("1 = 0")
+	}
+	if s.managesChatbots() {
+		return db
+	}
+
+	// Lists are matched with IN, gorm expands a slice inside ARRAY[] to a row
+	return db.Where(
+		"chatbots.access IS DISTINCT FROM ? "+
+			"OR jsonb_exists(COALESCE(chatbots.allowed_users::jsonb, '[]'), ?) "+
+			"OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_roles::jsonb, '[]')) AS role(name) WHERE role.name IN ?) "+
+			"OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_groups::jsonb, '[]')) AS grp(name) WHERE grp.name IN ?)",
+		entities.ChatbotAccessRestricted, s.User.Username, s.Roles, s.Groups,
+	)
+}
+
+// NormalizePolicy validates a chatbot's access policy and cleans up its lists.
+// Group paths are stored without their leading slash like in tokens.
+func NormalizePolicy(chatbot *entities.Chatbot) error {
+	if chatbot.Access == "" {
+		chatbot.Access = entities.ChatbotAccessPublic
+	}
+	if chatbot.Access != entities.ChatbotAccessPublic && chatbot.Access != entities.ChatbotAccessRestricted {
+		return fiber.NewError(fiber.StatusBadRequest, "Access must be public or restricted")
+	}
+
+	chatbot.AllowedRoles = NormalizeList(chatbot.AllowedRoles, "")
+	chatbot.AllowedGroups = NormalizeList(chatbot.AllowedGroups, "/")
+	chatbot.AllowedUsers = NormalizeList(chatbot.AllowedUsers, "")
+
+	return nil
+}
+
+// NormalizeList trims the entries of an allow list and drops empty and
+// duplicate ones
+func NormalizeList(values []string, cutset string) entities.StringArray {
+	list := entities.StringArray{}
+	for _, value := range values {
+		value = strings.Trim(strings.TrimSpace(value), cutset)
+		if value != "" && !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,220 @@
+package access
+
+import (
+	"sef/app/entities"
+	"slices"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestCanUse(t *testing.T) {
+	alice := &entities.User{Username: "alice"}
+	restricted := &entities.Chatbot{
+		Access:        entities.ChatbotAccessRestricted,
+		AllowedRoles:  entities.StringArray{"analyst"},
+		AllowedGroups: entities.StringArray{"finance/reports"},
+		AllowedUsers:  entities.StringArray{"bob"},
+	}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		chatbot *entities.Chatbot
+		want    bool
+	}{
+		{
+			name:    "no user",
+			subject: Subject{Permissions: []string{PermissionChatbotsManage}},
+			chatbot: &entities.Chatbot{Access: entities.ChatbotAccessPublic},
+			want:    false,
+		},
+		{
+			name:    "public chatbot",
+			subject: Subject{User: alice},
+			chatbot: &entities.Chatbot{Access: entities.ChatbotAccessPublic},
+			want:    true,
+		},
+		{
+			name:    "chatbot without access policy",
+			subject: Subject{User: alice},
+			chatbot: &entities.Chatbot{},
+			want:    true,
+		},
+		{
+			name:    "restricted without a match",
+			subject: Subject{User: alice, Roles: []string{"user"}, Groups: []string{"finance"}},
+			chatbot: restricted,
+			want:    false,
+		},
+		{
+			name:    "restricted by username",
+			subject: Subject{User: &entities.User{Username: "bob"}},
+			chatbot: restricted,
+			want:    true,
+		},
+		{
+			name:    "restricted by role",
+			subject: Subject{User: alice, Roles: []string{"user", "analyst"}},
+			chatbot: restricted,
+			want:    true,
+		},
+		{
+			name:    "restricted by group path",
+			subject: Subject{User: alice, Groups: []string{"finance", "finance/reports"}},
+			chatbot: restricted,
+			want:    true,
+		},
+		{
+			name:    "restricted by a role named like an allowed group",
+			subject: Subject{User: alice, Roles: []string{"finance/reports"}},
+			chatbot: restricted,
+			want:    false,
+		},
+		{
+			name:    "chatbot managers use every chatbot",
+			subject: Subject{User: alice, Permissions: []string{PermissionChatbotsManage}},
+			chatbot: restricted,
+			want:    true,
+		},
+		{
+			name:    "other permissions do not",
+			subject: Subject{User: alice, Permissions: []string{PermissionToolsManage}},
+			chatbot: restricted,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.subject.CanUse(tt.chatbot); got != tt.want {
+				t.Errorf("CanUse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	// The policy relies on Postgres JSON functions, so the generated SQL is checked
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	alice := &entities.User{Username: "alice"}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		want    string
+	}{
+		{
+			name:    "no user",
+			subject: Subject{},
+			want:    `SELECT * FROM "chatbots" WHERE chatbots.id = 1 AND 1 = 0 AND "chatbots"."deleted_at" IS NULL`,
+		},
+		{
+			name:    "chatbot managers are not filtered",
+			subject: Subject{User: alice, Permissions: []string{PermissionChatbotsManage}},
+			want:    `SELECT * FROM "chatbots" WHERE chatbots.id = 1 AND "chatbots"."deleted_at" IS NULL`,
+		},
+		{
+			name:    "without roles and groups",
+			subject: Subject{User: alice},
+			want: `SELECT * FROM "chatbots" WHERE chatbots.id = 1 AND (chatbots.access IS DISTINCT FROM 'restricted' ` +
+				`OR jsonb_exists(COALESCE(chatbots.allowed_users::jsonb, '[]'), 'alice') ` +
+				`OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_roles::jsonb, '[]')) AS role(name) WHERE role.name IN (NULL)) ` +
+				`OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_groups::jsonb, '[]')) AS grp(name) WHERE grp.name IN (NULL))) ` +
+				`AND "chatbots"."deleted_at" IS NULL`,
+		},
+		{
+			name:    "every role and group is matched",
+			subject: Subject{User: alice, Roles: []string{"user", "analyst"}, Groups: []string{"finance", "finance/reports"}},
+			want: `SELECT * FROM "chatbots" WHERE chatbots.id = 1 AND (chatbots.access IS DISTINCT FROM 'restricted' ` +
+				`OR jsonb_exists(COALESCE(chatbots.allowed_users::jsonb, '[]'), 'alice') ` +
+				`OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_roles::jsonb, '[]')) AS role(name) WHERE role.name IN ('user','analyst')) ` +
+				`OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(chatbots.allowed_groups::jsonb, '[]')) AS grp(name) WHERE grp.name IN ('finance','finance/reports'))) ` +
+				`AND "chatbots"."deleted_at" IS NULL`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("chatbots.id = ?", 1).Scopes(tt.subject.Scope).Find(&[]entities.Chatbot{})
+			})
+			if got != tt.want {
+				t.Errorf("Scope() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		chatbot entities.Chatbot
+		want    entities.Chatbot
+		wantErr bool
+	}{
+		{
+			name:    "defaults to public",
+			chatbot: entities.Chatbot{},
+			want: entities.Chatbot{
+				Access:        entities.ChatbotAccessPublic,
+				AllowedRoles:  entities.StringArray{},
+				AllowedGroups: entities.StringArray{},
+				AllowedUsers:  entities.StringArray{},
+			},
+		},
+		{
+			name: "cleans up the lists",
+			chatbot: entities.Chatbot{
+				Access:        entities.ChatbotAccessRestricted,
+				AllowedRoles:  entities.StringArray{" analyst ", "", "analyst"},
+				AllowedGroups: entities.StringArray{"/finance/reports", "finance/reports/", " "},
+				AllowedUsers:  entities.StringArray{"bob", " bob"},
+			},
+			want: entities.Chatbot{
+				Access:        entities.ChatbotAccessRestricted,
+				AllowedRoles:  entities.StringArray{"analyst"},
+				AllowedGroups: entities.StringArray{"finance/reports"},
+				AllowedUsers:  entities.StringArray{"bob"},
+			},
+		},
+		{
+			name:    "rejects unknown access",
+			chatbot: entities.Chatbot{Access: "private"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NormalizePolicy(&tt.chatbot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if tt.chatbot.Access != tt.want.Access {
+				t.Errorf("Access = %q, want %q", tt.chatbot.Access, tt.want.Access)
+			}
+			if !slices.Equal(tt.chatbot.AllowedRoles, tt.want.AllowedRoles) {
+				t.Errorf("AllowedRoles = %q, want %q", tt.chatbot.AllowedRoles, tt.want.AllowedRoles)
+			}
+			if !slices.Equal(tt.chatbot.AllowedGroups, tt.want.AllowedGroups) {
+				t.Errorf("AllowedGroups = %q, want %q", tt.chatbot.AllowedGroups, tt.want.AllowedGroups)
+			}
+			if !slices.Equal(tt.chatbot.AllowedUsers, tt.want.AllowedUsers) {
+				t.Errorf("AllowedUsers = %q, want %q", tt.chatbot.AllowedUsers, tt.want.AllowedUsers)
+			}
+		})
+	}
+}
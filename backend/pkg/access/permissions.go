@@ -0,0 +1,56 @@
+package access
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Permissions of the administrative areas. Each is granted by the Keycloak
+// client role of the same name, the admin role grants all of them.
+const (
+	PermissionProvidersManage = "providers:manage"
+	PermissionToolsManage     = "tools:manage"
+	PermissionDocumentsManage = "documents:manage"
+	PermissionChatbotsManage  = "chatbots:manage"
+	PermissionSessionsAudit   = "sessions:audit"
+	PermissionQuotasManage    = "quotas:manage"
+	PermissionUsageView       = "usage:view"
+	PermissionSettingsManage  = "settings:manage"
+
+	PermissionServiceAccountsManage = "service_accounts:manage"
+)
+
+// AllPermissions lists every permission
+var AllPermissions = []string{
+	PermissionProvidersManage,
+	PermissionToolsManage,
+	PermissionDocumentsManage,
+	PermissionChatbotsManage,
+	PermissionSessionsAudit,
+	PermissionQuotasManage,
+	PermissionUsageView,
+	PermissionSettingsManage,
+	PermissionServiceAccountsManage,
+}
+
+// Permissions returns the permissions granted by a user's client roles
+func Permissions(isAdmin bool, clientRoles []string) []string {
+	if isAdmin {
+		return slices.Clone(AllPermissions)
+	}
+
+	permissions := []string{}
+	for _, permission := range AllPermissions {
+		if slices.Contains(clientRoles, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// HasPermission reports whether the authenticated user of a request has a permission
+func HasPermission(c fiber.Ctx, permission string) bool {
+	permissions, _ := c.Locals("permissions").([]string)
+	return slices.Contains(permissions, permission)
+}
@@ -0,0 +1,104 @@
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sef/app/entities"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// TokenPrefix starts every API token so they can be told apart from Keycloak tokens
+const TokenPrefix = "sef_"
+
+// ScopeChat lets a token list chatbots and chat with them. The other scopes
+// are the permissions of the token's owner.
+const ScopeChat = "chat"
+
+// Lifetime of API tokens in days
+const (
+	DefaultTokenLifetimeDays = 90
+	MaxTokenLifetimeDays     = 365
+)
+
+// HashToken returns the hash an API token is stored and looked up by
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenPermissions returns the owner's permissions the token's scopes allow
+func TokenPermissions(ownerPermissions, scopes []string) []string {
+	permissions := []string{}
+	for _, permission := range ownerPermissions {
+		if slices.Contains(scopes, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// IssueToken creates an API token for a user. The token itself is only
+// returned here, afterwards it can only be recognized by its prefix.
+func IssueToken(db *gorm.DB, user *entities.User, name string, scopes []string, lifetimeDays int) (*entities.ApiToken, string, error) {
+	if name == "" {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+
+	if lifetimeDays == 0 {
+		lifetimeDays = DefaultTokenLifetimeDays
+	}
+	if lifetimeDays < 1 || lifetimeDays > MaxTokenLifetimeDays {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Tokens must expire within 1 to %d days", MaxTokenLifetimeDays))
+	}
+
+	scopes = NormalizeList(scopes, "")
+	if len(scopes) == 0 {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, "At least one scope is required")
+	}
+	for _, scope := range scopes {
+		if scope != ScopeChat && !slices.Contains(user.Permissions, scope) {
+			return nil, "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Scope %s is not available to %s", scope, user.Username))
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(secret)
+
+	expiresAt := time.Now().AddDate(0, 0, lifetimeDays)
+	apiToken := &entities.ApiToken{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    token[:len(TokenPrefix)+8],
+		Hash:      HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: &expiresAt,
+	}
+	if err := db.Create(apiToken).Error; err != nil {
+		return nil, "", err
+	}
+
+	return apiToken, token, nil
+}
+
+// RevokeToken revokes an active token of a user
+func RevokeToken(db *gorm.DB, userID uint, tokenID string) error {
+	result := db.Model(&entities.ApiToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Token not found")
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the public Anthropic API endpoint
+	DefaultBaseURL = "https://api.anthropic.com"
+	// APIVersion is the Messages API version sent with every request
+	APIVersion = "2023-06-01"
+	// dialTimeout bounds connecting to the API
+	dialTimeout = 30 * time.Second
+	// responseHeaderTimeout bounds waiting for the API to start answering.
+	// Reading a stream is only bounded by the request context, long thinking
+	// and tool use responses take minutes.
+	responseHeaderTimeout = 2 * time.Minute
+)
+
+// AnthropicClient handles Anthropic Messages API interactions
+type AnthropicClient struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// Tool represents a tool definition in the Messages API
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// ContentBlock represents a single block of message content
+type ContentBlock struct {
+	Type      string      `json:"type"`
+	Text      string      `json:"text,omitempty"`
+	ID        string      `json:"id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Input     interface{} `json:"input,omitempty"`
+	ToolUseID string      `json:"tool_use_id,omitempty"`
+	Content   string      `json:"content,omitempty"`
+	IsError   bool        `json:"is_error,omitempty"`
+	Thinking  string      `json:"thinking,omitempty"`
+	Signature string      `json:"signature,omitempty"`
+	Data      string      `json:"data,omitempty"` // Encrypted reasoning of redacted_thinking blocks
+}
+
+// Message represents a message in the Messages API
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// Thinking configures extended thinking
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// MessagesRequest represents a request to /v1/messages
+type MessagesRequest struct {
+	Model       string    `json:"model"`
+	MaxTokens   int       `json:"max_tokens"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	Tools       []Tool    `json:"tools,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Thinking    *Thinking `json:"thinking,omitempty"`
+	Stream      bool      `json:"stream"`
+}
+
+// Delta represents the delta payload of streaming events
+type Delta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// Usage represents token usage reported by the API
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// APIError represents an error returned by the API
+type APIError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("anthropic API error (%s): %s", e.Type, e.Message)
+}
+
+// apiErrorStatus maps the documented error types to their HTTP status codes
+var apiErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// StatusCode returns the HTTP status code of the error type, errors sent in
+// the middle of a stream only carry the type
+func (e *APIError) StatusCode() int {
+	if status, ok := apiErrorStatus[e.Type]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// StatusError is returned when the API answers a request with an error status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("anthropic API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// StreamEvent represents a single server-sent event from a streaming request
+type StreamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
+	Delta        *Delta        `json:"delta,omitempty"`
+	Usage        *Usage        `json:"usage,omitempty"`
+	Message      *struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+		Usage Usage  `json:"usage"`
+	} `json:"message,omitempty"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// NewAnthropicClient creates a new Anthropic client
+func NewAnthropicClient(baseURL string, apiKey string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &AnthropicClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+				ForceAttemptHTTP2:     true,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: responseHeaderTimeout,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+	}
+}
+
+// newRequest creates an authenticated request against the API
+func (c *AnthropicClient) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", APIVersion)
+	if c.apiKey != "" {
+		req.Header.Set("x-api-key", c.apiKey)
+	}
+
+	return req, nil
+}
+
+// StreamMessages sends a streaming Messages API request and returns parsed SSE events
+func (c *AnthropicClient) StreamMessages(ctx context.Context, req MessagesRequest) (<-chan StreamEvent, error) {
+	req.Stream = true
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := c.newRequest(ctx, "POST", "/v1/messages", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	ch := make(chan StreamEvent)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		// Every send gives up when the caller stops reading
+		send := func(event StreamEvent) bool {
+			select {
+			case ch <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			// Event names are repeated in the JSON "type" field, only data lines matter
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "" {
+				continue
+			}
+
+			var event StreamEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				send(StreamEvent{Type: "error", Error: &APIError{Type: "parse_error", Message: err.Error()}})
+				return
+			}
+
+			if !send(event) || event.Type == "message_stop" || event.Type == "error" {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			send(StreamEvent{Type: "error", Error: &APIError{Type: "stream_error", Message: err.Error()}})
+			return
+		}
+
+		// The connection closed without message_stop
+		send(StreamEvent{Type: "error", Error: &APIError{Type: "stream_error", Message: "stream ended unexpectedly"}})
+	}()
+
+	return ch, nil
+}
+
+// ListModelsResponse represents the response from /v1/models
+type ListModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns available models from Anthropic
+func (c *AnthropicClient) ListModels() ([]string, error) {
+	httpReq, err := c.newRequest(context.Background(), "GET", "/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result ListModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]string, len(result.Data))
+	for i, model := range result.Data {
+		models[i] = model.ID
+	}
+
+	return models, nil
+}
@@ -0,0 +1,194 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordedStream is a Messages API stream with a text and a tool_use block
+const recordedStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[],"stop_reason":null,"usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\": \"Ank"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+// replayServer answers every request with the given status and body
+func replayServer(t *testing.T, status int, body string, inspect func(*http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inspect != nil {
+			inspect(r)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// collect reads the events of a stream, failing when it does not close
+func collect(t *testing.T, ch <-chan StreamEvent) []StreamEvent {
+	t.Helper()
+	var events []StreamEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatal("stream was not closed")
+		}
+	}
+}
+
+func TestStreamMessagesReplaysEvents(t *testing.T) {
+	server := replayServer(t, http.StatusOK, recordedStream, func(r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %q, want /v1/messages", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("x-api-key = %q, want test-key", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != APIVersion {
+			t.Errorf("anthropic-version = %q, want %q", got, APIVersion)
+		}
+
+		var req MessagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("request was not streamed")
+		}
+	})
+
+	client := NewAnthropicClient(server.URL+"/", "test-key")
+	ch, err := client.StreamMessages(context.Background(), MessagesRequest{Model: "claude-sonnet-4-5", MaxTokens: 100})
+	if err != nil {
+		t.Fatalf("StreamMessages() error = %v", err)
+	}
+
+	var types []string
+	for _, event := range collect(t, ch) {
+		types = append(types, event.Type)
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "ping", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+}
+
+func TestStreamMessagesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantErr   bool
+		errorType string
+	}{
+		{
+			name:    "non-200 response",
+			status:  http.StatusUnauthorized,
+			body:    `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			wantErr: true,
+		},
+		{
+			name:      "error event",
+			status:    http.StatusOK,
+			body:      "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n",
+			errorType: "overloaded_error",
+		},
+		{
+			name:      "malformed data",
+			status:    http.StatusOK,
+			body:      "event: message_start\ndata: {\"type\":\n\n",
+			errorType: "parse_error",
+		},
+		{
+			name:      "truncated stream",
+			status:    http.StatusOK,
+			body:      strings.Split(recordedStream, "event: message_stop")[0],
+			errorType: "stream_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := replayServer(t, tt.status, tt.body, nil)
+			client := NewAnthropicClient(server.URL, "test-key")
+
+			ch, err := client.StreamMessages(context.Background(), MessagesRequest{Model: "claude-sonnet-4-5", MaxTokens: 100})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+					t.Fatalf("StreamMessages() error = %v, want the API error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StreamMessages() error = %v", err)
+			}
+
+			events := collect(t, ch)
+			last := events[len(events)-1]
+			if last.Type != "error" || last.Error == nil || last.Error.Type != tt.errorType {
+				t.Fatalf("last event = %+v, want a %s error", last, tt.errorType)
+			}
+		})
+	}
+}
+
+func TestStreamMessagesStopsWhenCancelled(t *testing.T) {
+	server := replayServer(t, http.StatusOK, recordedStream, nil)
+	client := NewAnthropicClient(server.URL, "test-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := client.StreamMessages(ctx, MessagesRequest{Model: "claude-sonnet-4-5", MaxTokens: 100})
+	if err != nil {
+		t.Fatalf("StreamMessages() error = %v", err)
+	}
+
+	// The stream has to close once the request is cancelled
+	cancel()
+	collect(t, ch)
+}
@@ -41,6 +41,13 @@ type Config struct {
 	Keycloak  KeycloakConfig `json:"keycloak"`
 	QdrantURL string         `json:"qdrant_url"`
 	OllamaURL string         `json:"ollama_url"`
+	Documents DocumentConfig `json:"documents"`
+}
+
+// DocumentConfig represents document processing configuration
+type DocumentConfig struct {
+	Workers     int `json:"workers"`
+	MaxAttempts int `json:"max_attempts"`
 }
 
 // Load loads configuration from .env file
@@ -87,6 +94,12 @@ func Load() (*Config, error) {
 	ollamaPort := getEnv("OLLAMA_PORT", "11434")
 	config.OllamaURL = "http://" + ollamaHost + ":" + ollamaPort
 
+	// Load document processing configuration
+	config.Documents = DocumentConfig{
+		Workers:     getEnvAsInt("DOCUMENT_WORKERS", 2),
+		MaxAttempts: getEnvAsInt("DOCUMENT_JOB_MAX_ATTEMPTS", 3),
+	}
+
 	return config, nil
 }
 
@@ -0,0 +1,359 @@
+package documentservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sef/app/entities"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// jobTimeout bounds a single processing attempt
+	jobTimeout = 30 * time.Minute
+	// jobPollInterval is how often idle workers look for due jobs
+	jobPollInterval = 2 * time.Second
+	// jobHeartbeatInterval is how often a running job proves its worker is alive
+	jobHeartbeatInterval = 30 * time.Second
+	// jobStaleAfter is how long a running job may go without heartbeat before it is recovered
+	jobStaleAfter = 3 * jobHeartbeatInterval
+	// jobRetryBaseDelay is the delay before the first retry, doubled for every further attempt
+	jobRetryBaseDelay = 30 * time.Second
+	// jobRetryMaxDelay caps the retry backoff
+	jobRetryMaxDelay = 30 * time.Minute
+)
+
+// ErrJobAlreadyQueued is returned when a document already has a pending job
+var ErrJobAlreadyQueued = errors.New("document already has a queued or running job")
+
+// JobQueue processes documents in a pool of workers backed by the document_jobs table,
+// so jobs survive restarts and can be shared between several server instances
+type JobQueue struct {
+	DB              *gorm.DB
+	DocumentService *DocumentService
+	Workers         int
+	MaxAttempts     int
+
+	wake      chan struct{}
+	startOnce sync.Once
+}
+
+// NewJobQueue creates a new document job queue
+func NewJobQueue(db *gorm.DB, documentService *DocumentService, workers, maxAttempts int) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &JobQueue{
+		DB:              db,
+		DocumentService: documentService,
+		Workers:         workers,
+		MaxAttempts:     maxAttempts,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// Start recovers orphaned jobs and starts the workers until the context is cancelled
+func (q *JobQueue) Start(ctx context.Context) {
+	q.startOnce.Do(func() {
+		q.recover()
+
+		for i := 0; i < q.Workers; i++ {
+			go q.work(ctx)
+		}
+
+		go func() {
+			ticker := time.NewTicker(jobStaleAfter)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					q.recover()
+				}
+			}
+		}()
+
+		log.Infof("Started %d document processing workers", q.Workers)
+	})
+}
+
+// Enqueue creates a processing job for a document
+func (q *JobQueue) Enqueue(document *entities.Document) (*entities.DocumentJob, error) {
+	job := &entities.DocumentJob{
+		DocumentID:  document.ID,
+		Status:      entities.JobStatusQueued,
+		RunAt:       time.Now(),
+		MaxAttempts: q.MaxAttempts,
+	}
+
+	err := q.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the document so concurrent requests cannot queue it twice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(document, document.ID).Error; err != nil {
+			return err
+		}
+
+		var pending int64
+		if err := tx.Model(&entities.DocumentJob{}).
+			Where("document_id = ? AND status IN ?", document.ID, []string{entities.JobStatusQueued, entities.JobStatusRunning}).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrJobAlreadyQueued
+		}
+
+		if err := tx.Create(job).Error; err != nil {
+			return fmt.Errorf("failed to create job: %w", err)
+		}
+
+		document.Status = "pending"
+		document.Progress = 0
+		return tx.Model(document).Updates(map[string]interface{}{
+			"status":   document.Status,
+			"progress": document.Progress,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return job, nil
+}
+
+// notify wakes up an idle worker
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work runs due jobs one at a time until the context is cancelled
+func (q *JobQueue) work(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, err := q.claim()
+			if err != nil {
+				log.Errorf("Failed to claim document job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim picks the oldest due job and marks it as running
+func (q *JobQueue) claim() (*entities.DocumentJob, error) {
+	var job entities.DocumentJob
+
+	err := q.DB.Transaction(func(tx *gorm.DB) error {
+		// Skip jobs locked by workers of other instances
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_at <= ?", entities.JobStatusQueued, time.Now()).
+			Order("run_at ASC").
+			First(&job).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		job.Status = entities.JobStatusRunning
+		job.Attempts++
+		job.Progress = 0
+		job.StartedAt = &now
+		job.HeartbeatAt = &now
+		job.FinishedAt = nil
+		return tx.Save(&job).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// run processes the job's document and records the outcome
+func (q *JobQueue) run(ctx context.Context, job *entities.DocumentJob) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	// Keep the heartbeat fresh even while a single embedding call takes long
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.DB.Model(job).Update("heartbeat_at", time.Now()).Error; err != nil {
+					log.Errorf("Failed to update heartbeat of job %d: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	document := entities.Document{Base: entities.Base{ID: job.DocumentID}}
+
+	// A panicking extractor or provider must not take the worker down or leave the job running
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Job %d for document ID %d panicked: %v\n%s", job.ID, job.DocumentID, r, debug.Stack())
+			q.retryOrFail(job, &document, fmt.Sprintf("processing panicked: %v", r))
+		}
+	}()
+
+	// Waits for an update holding the document lock, so the new content is read
+	if err := q.DB.Clauses(clause.Locking{Strength: "UPDATE"}).First(&document, job.DocumentID).Error; err != nil {
+		// The document was deleted, there is nothing left to retry
+		q.finish(job, entities.JobStatusFailed, fmt.Sprintf("document not found: %v", err))
+		return
+	}
+
+	log.Infof("Running job %d for document ID %d (attempt %d/%d)", job.ID, document.ID, job.Attempts, job.MaxAttempts)
+
+	err := q.DocumentService.ProcessDocument(ctx, &document, func(percent int) {
+		if err := q.DB.Model(job).Updates(map[string]interface{}{
+			"progress":     percent,
+			"heartbeat_at": time.Now(),
+		}).Error; err != nil {
+			log.Errorf("Failed to update progress of job %d: %v", job.ID, err)
+		}
+	})
+	if err == nil {
+		job.Progress = 100
+		q.finish(job, entities.JobStatusSucceeded, "")
+		return
+	}
+
+	log.Errorf("Job %d for document ID %d failed: %v", job.ID, document.ID, err)
+	q.retryOrFail(job, &document, err.Error())
+}
+
+// retryOrFail schedules another attempt with exponential backoff or gives up.
+// The failure reason is kept on the document in both cases.
+func (q *JobQueue) retryOrFail(job *entities.DocumentJob, document *entities.Document, reason string) {
+	if job.Attempts >= job.MaxAttempts {
+		q.finish(job, entities.JobStatusFailed, reason)
+		if err := q.DB.Model(document).Updates(map[string]interface{}{
+			"status":         "failed",
+			"failure_reason": reason,
+		}).Error; err != nil {
+			log.Errorf("Failed to mark document ID %d as failed: %v", document.ID, err)
+		}
+		return
+	}
+
+	delay := jobRetryBaseDelay << (job.Attempts - 1)
+	if delay <= 0 || delay > jobRetryMaxDelay {
+		delay = jobRetryMaxDelay
+	}
+	runAt := time.Now().Add(delay)
+
+	if err := q.DB.Model(job).Updates(map[string]interface{}{
+		"status":       entities.JobStatusQueued,
+		"run_at":       runAt,
+		"error":        reason,
+		"heartbeat_at": nil,
+	}).Error; err != nil {
+		log.Errorf("Failed to requeue job %d: %v", job.ID, err)
+		return
+	}
+	if err := q.DB.Model(document).Updates(map[string]interface{}{
+		"status":         "pending",
+		"failure_reason": reason,
+	}).Error; err != nil {
+		log.Errorf("Failed to mark document ID %d as pending: %v", document.ID, err)
+	}
+
+	log.Infof("Retrying job %d for document ID %d at %s", job.ID, job.DocumentID, runAt.Format(time.RFC3339))
+}
+
+// finish marks the job as completed
+func (q *JobQueue) finish(job *entities.DocumentJob, status, reason string) {
+	now := time.Now()
+	job.Status = status
+	job.Error = reason
+	job.FinishedAt = &now
+
+	if err := q.DB.Model(job).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"error":       job.Error,
+		"progress":    job.Progress,
+		"finished_at": job.FinishedAt,
+	}).Error; err != nil {
+		log.Errorf("Failed to finish job %d as %s: %v", job.ID, status, err)
+	}
+}
+
+// recover requeues running jobs whose worker stopped sending heartbeats and
+// queues documents that were left in processing without any job
+func (q *JobQueue) recover() {
+	var stale []entities.DocumentJob
+	if err := q.DB.
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", entities.JobStatusRunning, time.Now().Add(-jobStaleAfter)).
+		Find(&stale).Error; err != nil {
+		log.Errorf("Failed to find orphaned document jobs: %v", err)
+		return
+	}
+
+	for i := range stale {
+		job := &stale[i]
+		log.Infof("Recovering orphaned job %d for document ID %d", job.ID, job.DocumentID)
+
+		var document entities.Document
+		if err := q.DB.First(&document, job.DocumentID).Error; err != nil {
+			q.finish(job, entities.JobStatusFailed, fmt.Sprintf("document not found: %v", err))
+			continue
+		}
+
+		q.retryOrFail(job, &document, "processing was interrupted before it could finish")
+	}
+
+	// Documents stuck before the job queue existed or whose job row is gone
+	var orphaned []entities.Document
+	if err := q.DB.
+		Where("status = ?", "processing").
+		Where("NOT EXISTS (SELECT 1 FROM document_jobs WHERE document_jobs.document_id = documents.id AND document_jobs.status IN ? AND document_jobs.deleted_at IS NULL)",
+			[]string{entities.JobStatusQueued, entities.JobStatusRunning}).
+		Find(&orphaned).Error; err != nil {
+		log.Errorf("Failed to find orphaned documents: %v", err)
+		return
+	}
+
+	for i := range orphaned {
+		log.Infof("Queueing orphaned document ID %d", orphaned[i].ID)
+		if _, err := q.Enqueue(&orphaned[i]); err != nil && !errors.Is(err, ErrJobAlreadyQueued) {
+			log.Errorf("Failed to queue orphaned document ID %d: %v", orphaned[i].ID, err)
+		}
+	}
+}
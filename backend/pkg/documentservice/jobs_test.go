@@ -0,0 +1,300 @@
+package documentservice
+
+import (
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newTestJobQueue returns a queue over an empty database with a single document
+func newTestJobQueue(t *testing.T, maxAttempts int) (*JobQueue, *entities.Document) {
+	t.Helper()
+
+	db := testdb.Open(t, &entities.Document{}, &entities.DocumentJob{})
+	document := &entities.Document{Title: "document", Status: "ready"}
+	if err := db.Create(document).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return NewJobQueue(db, nil, 1, maxAttempts), document
+}
+
+// createJob stores a job for the document
+func createJob(t *testing.T, db *gorm.DB, job entities.DocumentJob) *entities.DocumentJob {
+	t.Helper()
+
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &job
+}
+
+// reload reads the current state of a job and its document
+func reload(t *testing.T, db *gorm.DB, job *entities.DocumentJob) (entities.DocumentJob, entities.Document) {
+	t.Helper()
+
+	var stored entities.DocumentJob
+	if err := db.First(&stored, job.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var document entities.Document
+	if err := db.First(&document, job.DocumentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stored, document
+}
+
+func TestClaimIsExclusive(t *testing.T) {
+	queue, document := newTestJobQueue(t, 3)
+
+	due := make(map[uint]bool)
+	for i := 0; i < 20; i++ {
+		job := createJob(t, queue.DB, entities.DocumentJob{
+			DocumentID:  document.ID,
+			Status:      entities.JobStatusQueued,
+			RunAt:       time.Now().Add(-time.Duration(i) * time.Second),
+			MaxAttempts: 3,
+		})
+		due[job.ID] = true
+	}
+	createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusQueued, RunAt: time.Now().Add(time.Hour), MaxAttempts: 3})
+	createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusRunning, RunAt: time.Now(), MaxAttempts: 3})
+	createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusSucceeded, RunAt: time.Now(), MaxAttempts: 3})
+
+	var mu sync.Mutex
+	claimed := make(map[uint]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := queue.claim()
+				if err != nil {
+					t.Errorf("claim() error = %v", err)
+					return
+				}
+				if job == nil {
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != len(due) {
+		t.Errorf("claimed %d jobs, want the %d due ones", len(claimed), len(due))
+	}
+	for id, count := range claimed {
+		if !due[id] {
+			t.Errorf("claimed job %d that is not due", id)
+		}
+		if count != 1 {
+			t.Errorf("job %d was claimed %d times", id, count)
+		}
+
+		stored, _ := reload(t, queue.DB, &entities.DocumentJob{Base: entities.Base{ID: id}, DocumentID: document.ID})
+		if stored.Status != entities.JobStatusRunning || stored.Attempts != 1 || stored.HeartbeatAt == nil {
+			t.Errorf("job %d is %s after %d attempts, want running after 1 with a heartbeat", id, stored.Status, stored.Attempts)
+		}
+	}
+}
+
+func TestClaimPicksOldestDueJob(t *testing.T) {
+	queue, document := newTestJobQueue(t, 3)
+
+	createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusQueued, RunAt: time.Now().Add(-time.Minute), MaxAttempts: 3})
+	oldest := createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusQueued, RunAt: time.Now().Add(-time.Hour), MaxAttempts: 3})
+
+	job, err := queue.claim()
+	if err != nil {
+		t.Fatalf("claim() error = %v", err)
+	}
+	if job == nil || job.ID != oldest.ID {
+		t.Fatalf("claim() = %v, want job %d", job, oldest.ID)
+	}
+}
+
+func TestRetryOrFail(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		maxAttempts  int
+		wantStatus   string
+		wantDelay    time.Duration
+		wantDocument string
+	}{
+		{
+			name:         "first failure",
+			attempts:     1,
+			maxAttempts:  3,
+			wantStatus:   entities.JobStatusQueued,
+			wantDelay:    jobRetryBaseDelay,
+			wantDocument: "pending",
+		},
+		{
+			name:         "backoff doubles",
+			attempts:     2,
+			maxAttempts:  3,
+			wantStatus:   entities.JobStatusQueued,
+			wantDelay:    2 * jobRetryBaseDelay,
+			wantDocument: "pending",
+		},
+		{
+			name:         "backoff is capped",
+			attempts:     10,
+			maxAttempts:  20,
+			wantStatus:   entities.JobStatusQueued,
+			wantDelay:    jobRetryMaxDelay,
+			wantDocument: "pending",
+		},
+		{
+			name:         "last attempt",
+			attempts:     3,
+			maxAttempts:  3,
+			wantStatus:   entities.JobStatusFailed,
+			wantDocument: "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, document := newTestJobQueue(t, tt.maxAttempts)
+			job := createJob(t, queue.DB, entities.DocumentJob{
+				DocumentID:  document.ID,
+				Status:      entities.JobStatusRunning,
+				RunAt:       time.Now(),
+				Attempts:    tt.attempts,
+				MaxAttempts: tt.maxAttempts,
+			})
+
+			before := time.Now()
+			queue.retryOrFail(job, document, "embedding failed")
+
+			stored, storedDocument := reload(t, queue.DB, job)
+			if stored.Status != tt.wantStatus {
+				t.Errorf("job status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if stored.Error != "embedding failed" {
+				t.Errorf("job error = %q, want the failure reason", stored.Error)
+			}
+			if stored.Attempts != tt.attempts {
+				t.Errorf("job attempts = %d, want %d", stored.Attempts, tt.attempts)
+			}
+			if storedDocument.Status != tt.wantDocument || storedDocument.FailureReason != "embedding failed" {
+				t.Errorf("document is %s with %q, want %s with the failure reason", storedDocument.Status, storedDocument.FailureReason, tt.wantDocument)
+			}
+
+			if tt.wantStatus == entities.JobStatusFailed {
+				if stored.FinishedAt == nil {
+					t.Error("failed job has no finish time")
+				}
+				return
+			}
+			if delay := stored.RunAt.Sub(before); delay < tt.wantDelay || delay > tt.wantDelay+time.Minute {
+				t.Errorf("job runs again after %s, want %s", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryCounting(t *testing.T) {
+	queue, document := newTestJobQueue(t, 3)
+	job, err := queue.Enqueue(document)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		claimed, err := queue.claim()
+		if err != nil || claimed == nil {
+			t.Fatalf("attempt %d: claim() = %v, %v", attempt, claimed, err)
+		}
+		if claimed.Attempts != attempt {
+			t.Fatalf("attempt %d: job has %d attempts", attempt, claimed.Attempts)
+		}
+
+		queue.retryOrFail(claimed, document, "embedding failed")
+
+		// Make the retry due instead of waiting for the backoff
+		if err := queue.DB.Model(job).Update("run_at", time.Now().Add(-time.Second)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if claimed, err := queue.claim(); err != nil || claimed != nil {
+		t.Fatalf("claim() after the last attempt = %v, %v, want nothing", claimed, err)
+	}
+
+	stored, storedDocument := reload(t, queue.DB, job)
+	if stored.Status != entities.JobStatusFailed || stored.Attempts != 3 {
+		t.Errorf("job is %s after %d attempts, want failed after 3", stored.Status, stored.Attempts)
+	}
+	if storedDocument.Status != "failed" {
+		t.Errorf("document status = %s, want failed", storedDocument.Status)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	queue, document := newTestJobQueue(t, 3)
+	stale := time.Now().Add(-2 * jobStaleAfter)
+	fresh := time.Now()
+
+	interrupted := createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusRunning, RunAt: stale, Attempts: 1, MaxAttempts: 3, HeartbeatAt: &stale})
+	exhausted := createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusRunning, RunAt: stale, Attempts: 3, MaxAttempts: 3, HeartbeatAt: &stale})
+	alive := createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID, Status: entities.JobStatusRunning, RunAt: fresh, Attempts: 1, MaxAttempts: 3, HeartbeatAt: &fresh})
+	missing := createJob(t, queue.DB, entities.DocumentJob{DocumentID: document.ID + 100, Status: entities.JobStatusRunning, RunAt: stale, Attempts: 1, MaxAttempts: 3})
+
+	queue.recover()
+
+	tests := []struct {
+		name       string
+		job        *entities.DocumentJob
+		wantStatus string
+	}{
+		{name: "stale job is requeued", job: interrupted, wantStatus: entities.JobStatusQueued},
+		{name: "stale job without attempts left fails", job: exhausted, wantStatus: entities.JobStatusFailed},
+		{name: "job with a fresh heartbeat keeps running", job: alive, wantStatus: entities.JobStatusRunning},
+		{name: "job of a deleted document fails", job: missing, wantStatus: entities.JobStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored entities.DocumentJob
+			if err := queue.DB.First(&stored, tt.job.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("job status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if stored.Attempts != tt.job.Attempts {
+				t.Errorf("job attempts = %d, want %d", stored.Attempts, tt.job.Attempts)
+			}
+		})
+	}
+}
+
+func TestRecoverQueuesOrphanedDocuments(t *testing.T) {
+	queue, document := newTestJobQueue(t, 3)
+	if err := queue.DB.Model(document).Update("status", "processing").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	queue.recover()
+	queue.recover()
+
+	var jobs []entities.DocumentJob
+	if err := queue.DB.Where("document_id = ?", document.ID).Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Status != entities.JobStatusQueued {
+		t.Fatalf("document has jobs %+v, want a single queued one", jobs)
+	}
+}
@@ -0,0 +1,172 @@
+package documentservice
+
+import (
+	"context"
+	"fmt"
+	"sef/app/entities"
+	"sef/pkg/chunking"
+	"sef/pkg/qdrant"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxKeywordTerms bounds the number of query terms sent to full text search
+const maxKeywordTerms = 32
+
+// keywordStopWords are frequent English and Turkish words that carry no meaning
+// on their own. The simple text search configuration keeps them, so they are
+// dropped from queries to keep them from dominating the rank.
+var keywordStopWords = map[string]bool{
+	"the": true, "an": true, "and": true, "or": true, "but": true, "in": true, "on": true,
+	"at": true, "to": true, "for": true, "of": true, "with": true, "by": true, "from": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true, "have": true,
+	"has": true, "had": true, "do": true, "does": true, "did": true, "will": true, "would": true,
+	"could": true, "should": true, "can": true, "this": true, "that": true, "these": true,
+	"those": true, "you": true, "it": true, "we": true, "they": true, "what": true, "which": true,
+	"who": true, "when": true, "where": true, "why": true, "how": true, "me": true, "my": true,
+	"ve": true, "veya": true, "ile": true, "bir": true, "bu": true, "şu": true, "için": true,
+	"ne": true, "nasıl": true, "mi": true, "mı": true, "mu": true, "mü": true, "de": true,
+	"da": true, "ki": true, "gibi": true, "çok": true, "daha": true, "en": true, "ama": true,
+	"hangi": true, "neden": true, "nedir": true, "var": true, "yok": true, "olan": true,
+}
+
+// keywordQuery turns free text into a full text query matching any of its terms
+func keywordQuery(query string) string {
+	seen := make(map[string]bool)
+	var terms []string
+
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 2 || keywordStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxKeywordTerms {
+			break
+		}
+	}
+
+	return strings.Join(terms, " | ")
+}
+
+// saveChunks stores the text of a document's chunks for full text search and
+// removes the chunks the document no longer has
+func (ds *DocumentService) saveChunks(document *entities.Document, chunks []chunking.Chunk) error {
+	rows := make([]entities.DocumentChunk, len(chunks))
+	for i, chunk := range chunks {
+		metadata := entities.SingleJSONB{}
+		for _, key := range locationKeys {
+			if value, ok := chunk.Metadata[key]; ok {
+				metadata[key] = value
+			}
+		}
+
+		rows[i] = entities.DocumentChunk{
+			DocumentID: document.ID,
+			ChunkIndex: chunk.Index,
+			Title:      document.Title,
+			Content:    chunk.Text,
+			Metadata:   metadata,
+		}
+	}
+
+	return ds.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ? AND chunk_index >= ?", document.ID, len(chunks)).
+			Delete(&entities.DocumentChunk{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chunks: %w", err)
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "document_id"}, {Name: "chunk_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"title", "content", "metadata", "updated_at"}),
+		}).CreateInBatches(rows, 500).Error; err != nil {
+			return fmt.Errorf("failed to save chunks: %w", err)
+		}
+		return nil
+	})
+}
+
+// KeywordSearch ranks the chunks of a chatbot's ready documents by full text
+// relevance to the query. Results carry the same payload keys as vector
+// search results, scored by ts_rank_cd.
+func (ds *DocumentService) KeywordSearch(ctx context.Context, query string, chatbotID uint, limit int) ([]qdrant.SearchResult, error) {
+	tsQuery := keywordQuery(query)
+	if tsQuery == "" {
+		return []qdrant.SearchResult{}, nil
+	}
+
+	var rows []struct {
+		entities.DocumentChunk
+		Score float32
+	}
+	if err := ds.DB.WithContext(ctx).
+		Table("document_chunks").
+		Select("document_chunks.document_id, document_chunks.chunk_index, document_chunks.title, document_chunks.content, document_chunks.metadata, "+
+			"ts_rank_cd(document_chunks.search_vector, to_tsquery('simple', ?)) AS score", tsQuery).
+		Joins("JOIN chatbot_documents ON chatbot_documents.document_id = document_chunks.document_id").
+		Joins("JOIN documents ON documents.id = document_chunks.document_id").
+		Where("chatbot_documents.chatbot_id = ?", chatbotID).
+		Where("documents.status = ? AND documents.deleted_at IS NULL", "ready").
+		Where("document_chunks.search_vector @@ to_tsquery('simple', ?)", tsQuery).
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+
+	results := make([]qdrant.SearchResult, len(rows))
+	for i, row := range rows {
+		payload := map[string]interface{}{
+			"document_id": int64(row.DocumentID),
+			"chunk_index": int64(row.ChunkIndex),
+			"title":       row.Title,
+			"text":        row.Content,
+		}
+		for key, value := range row.Metadata {
+			payload[key] = value
+		}
+
+		results[i] = qdrant.SearchResult{
+			ID:      ChunkKey(payload),
+			Score:   row.Score,
+			Payload: payload,
+		}
+	}
+
+	return results, nil
+}
+
+// BackfillChunks stores the chunks of ready documents indexed before full
+// text search existed
+func (ds *DocumentService) BackfillChunks() {
+	var documents []entities.Document
+	if err := ds.DB.
+		Where("status = ?", "ready").
+		Where("NOT EXISTS (SELECT 1 FROM document_chunks WHERE document_chunks.document_id = documents.id)").
+		Find(&documents).Error; err != nil {
+		log.Errorf("Failed to find documents without chunks: %v", err)
+		return
+	}
+
+	for i := range documents {
+		if err := ds.saveChunks(&documents[i], ds.chunkDocument(&documents[i])); err != nil {
+			log.Errorf("Failed to backfill chunks of document ID %d: %v", documents[i].ID, err)
+		}
+	}
+
+	if len(documents) > 0 {
+		log.Infof("Backfilled chunks of %d documents", len(documents))
+	}
+}
@@ -0,0 +1,47 @@
+package documentservice
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestKeywordQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "terms joined with or", query: "Kafka consumer lag", want: "kafka | consumer | lag"},
+		{name: "punctuation splits words", query: "ERR-404: nginx.conf?", want: "err | 404 | nginx | conf"},
+		{name: "stop words dropped", query: "What is the default port of the API?", want: "default | port | api"},
+		{name: "turkish stop words dropped", query: "Şifre nasıl sıfırlanır ve nedir?", want: "şifre | sıfırlanır"},
+		{name: "short words dropped", query: "a b c go", want: "go"},
+		{name: "duplicates dropped", query: "Port port PORT ports", want: "port | ports"},
+		{name: "nothing left", query: "what is it?", want: ""},
+		{name: "empty", query: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keywordQuery(tt.query); got != tt.want {
+				t.Errorf("keywordQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeywordQueryLimitsTerms(t *testing.T) {
+	var words []string
+	for i := range maxKeywordTerms + 10 {
+		words = append(words, fmt.Sprintf("term%d", i))
+	}
+
+	terms := strings.Split(keywordQuery(strings.Join(words, " ")), " | ")
+	if len(terms) != maxKeywordTerms {
+		t.Fatalf("got %d terms, want %d", len(terms), maxKeywordTerms)
+	}
+	if last := terms[len(terms)-1]; last != fmt.Sprintf("term%d", maxKeywordTerms-1) {
+		t.Errorf("last term = %q, want the first %d terms", last, maxKeywordTerms)
+	}
+}
@@ -0,0 +1,375 @@
+package documentservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sef/app/entities"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+)
+
+// migrationHeartbeatInterval is how often a running migration proves its worker is alive
+const migrationHeartbeatInterval = 30 * time.Second
+
+var (
+	// ErrMigrationRunning is returned when another embedding migration has not finished yet
+	ErrMigrationRunning = errors.New("an embedding migration is already running")
+	// ErrMigrationNotRollbackable is returned when a migration is not the active completed one
+	ErrMigrationNotRollbackable = errors.New("only the active completed migration can be rolled back")
+)
+
+// embeddingSettingKeys are the settings switched together when a migration completes
+var embeddingSettingKeys = []string{"embedding_provider_id", "embedding_model", "embedding_vector_size", "embedding_collection"}
+
+// Migrator re-embeds all documents into a new versioned collection when the
+// embedding model changes and switches to it once every document is indexed.
+// Searches keep using the previous collection until the switch.
+type Migrator struct {
+	DB              *gorm.DB
+	DocumentService *DocumentService
+	JobQueue        *JobQueue
+
+	// indexer writes the new collection, the document service unless a test replaces it
+	indexer collectionIndexer
+}
+
+// collectionIndexer creates collections and indexes documents into them
+type collectionIndexer interface {
+	ensureCollection(collection string, vectorSize int) error
+	collectionExists(collection string) (bool, error)
+	indexDocument(ctx context.Context, document *entities.Document, config *EmbeddingConfig, onProgress ProgressFunc) error
+}
+
+// NewMigrator creates a new embedding migrator
+func NewMigrator(db *gorm.DB, documentService *DocumentService, jobQueue *JobQueue) *Migrator {
+	return &Migrator{
+		DB:              db,
+		DocumentService: documentService,
+		JobQueue:        jobQueue,
+		indexer:         documentService,
+	}
+}
+
+// NeedsMigration reports whether switching to the given configuration requires
+// a new collection. Vectors of another model or dimension cannot share the
+// active collection, even when it holds no documents yet.
+func (m *Migrator) NeedsMigration(providerID uint, model string, vectorSize int) (bool, error) {
+	current := m.currentSettings()
+	if current["embedding_provider_id"] == "" || current["embedding_model"] == "" {
+		return false, nil
+	}
+
+	return current["embedding_provider_id"] != strconv.FormatUint(uint64(providerID), 10) ||
+		current["embedding_model"] != model ||
+		current["embedding_vector_size"] != strconv.Itoa(vectorSize), nil
+}
+
+// Start creates a migration to the given configuration and runs it in the background
+func (m *Migrator) Start(providerID uint, model string, vectorSize int) (*entities.EmbeddingMigration, error) {
+	current := m.currentSettings()
+	now := time.Now()
+
+	migration := &entities.EmbeddingMigration{
+		ProviderID:         providerID,
+		Model:              model,
+		VectorSize:         vectorSize,
+		PreviousProviderID: current["embedding_provider_id"],
+		PreviousModel:      current["embedding_model"],
+		PreviousVectorSize: current["embedding_vector_size"],
+		PreviousCollection: m.DocumentService.GetActiveCollection(),
+		Status:             entities.MigrationStatusRunning,
+		StartedAt:          &now,
+		HeartbeatAt:        &now,
+	}
+
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&entities.EmbeddingMigration{}).
+			Where("status = ?", entities.MigrationStatusRunning).
+			Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrMigrationRunning
+		}
+
+		if err := tx.Create(migration).Error; err != nil {
+			return fmt.Errorf("failed to create migration: %w", err)
+		}
+
+		// Versioned collection names keep every migration's vectors apart
+		migration.Collection = fmt.Sprintf("%s_v%d", GlobalCollectionName, migration.ID)
+		return tx.Model(migration).Update("collection", migration.Collection).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go m.run(migration)
+
+	return migration, nil
+}
+
+// Retry runs a failed migration again. Chunks already embedded into its
+// collection are reused.
+func (m *Migrator) Retry(migration *entities.EmbeddingMigration) error {
+	if migration.Status != entities.MigrationStatusFailed {
+		return fmt.Errorf("only failed migrations can be retried")
+	}
+
+	var running int64
+	if err := m.DB.Model(&entities.EmbeddingMigration{}).
+		Where("status = ?", entities.MigrationStatusRunning).
+		Count(&running).Error; err != nil {
+		return err
+	}
+	if running > 0 {
+		return ErrMigrationRunning
+	}
+
+	now := time.Now()
+	migration.Status = entities.MigrationStatusRunning
+	migration.Error = ""
+	migration.HeartbeatAt = &now
+	if err := m.DB.Model(migration).Updates(map[string]interface{}{
+		"status":       migration.Status,
+		"error":        migration.Error,
+		"heartbeat_at": migration.HeartbeatAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	go m.run(migration)
+	return nil
+}
+
+// Resume restarts running migrations whose worker stopped sending heartbeats
+func (m *Migrator) Resume() {
+	var migrations []entities.EmbeddingMigration
+	if err := m.DB.
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", entities.MigrationStatusRunning, time.Now().Add(-3*migrationHeartbeatInterval)).
+		Find(&migrations).Error; err != nil {
+		log.Errorf("Failed to find interrupted embedding migrations: %v", err)
+		return
+	}
+
+	for i := range migrations {
+		log.Infof("Resuming embedding migration %d", migrations[i].ID)
+		go m.run(&migrations[i])
+	}
+}
+
+// Rollback switches back to the configuration that was active before the migration
+func (m *Migrator) Rollback(migration *entities.EmbeddingMigration) error {
+	if migration.Status != entities.MigrationStatusCompleted || m.DocumentService.GetActiveCollection() != migration.Collection {
+		return ErrMigrationNotRollbackable
+	}
+
+	exists, err := m.indexer.collectionExists(migration.PreviousCollection)
+	if err != nil {
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("previous collection %s no longer exists", migration.PreviousCollection)
+	}
+
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveSettings(tx, map[string]string{
+			"embedding_provider_id": migration.PreviousProviderID,
+			"embedding_model":       migration.PreviousModel,
+			"embedding_vector_size": migration.PreviousVectorSize,
+			"embedding_collection":  migration.PreviousCollection,
+		}); err != nil {
+			return err
+		}
+
+		migration.Status = entities.MigrationStatusRolledBack
+		return tx.Model(migration).Update("status", migration.Status).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Rolled back embedding migration %d to collection %s", migration.ID, migration.PreviousCollection)
+
+	// Documents changed after the switch only exist in the migration's collection
+	if migration.FinishedAt != nil {
+		m.requeueChangedSince(*migration.FinishedAt)
+	}
+	return nil
+}
+
+// run re-embeds every document into the migration's collection and switches to it
+func (m *Migrator) run(migration *entities.EmbeddingMigration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(migrationHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.DB.Model(migration).Update("heartbeat_at", time.Now())
+			}
+		}
+	}()
+
+	if err := m.migrate(ctx, migration); err != nil {
+		log.Errorf("Embedding migration %d failed: %v", migration.ID, err)
+		now := time.Now()
+		migration.Status = entities.MigrationStatusFailed
+		migration.Error = err.Error()
+		migration.FinishedAt = &now
+		m.DB.Model(migration).Updates(map[string]interface{}{
+			"status":      migration.Status,
+			"error":       migration.Error,
+			"finished_at": migration.FinishedAt,
+		})
+	}
+}
+
+// migrate indexes all documents and switches the active configuration
+func (m *Migrator) migrate(ctx context.Context, migration *entities.EmbeddingMigration) error {
+	var provider entities.Provider
+	if err := m.DB.First(&provider, migration.ProviderID).Error; err != nil {
+		return fmt.Errorf("embedding provider not found: %w", err)
+	}
+
+	config := &EmbeddingConfig{
+		Provider:   &provider,
+		Model:      migration.Model,
+		VectorSize: migration.VectorSize,
+		Collection: migration.Collection,
+	}
+
+	var documentIDs []uint
+	if err := m.DB.Model(&entities.Document{}).Order("id ASC").Pluck("id", &documentIDs).Error; err != nil {
+		return fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	migration.TotalDocuments = len(documentIDs)
+	migration.ProcessedDocuments = 0
+	migration.FailedDocuments = 0
+	m.DB.Model(migration).Updates(map[string]interface{}{
+		"total_documents":     migration.TotalDocuments,
+		"processed_documents": 0,
+		"failed_documents":    0,
+		"progress":            0,
+	})
+
+	log.Infof("Embedding migration %d: re-embedding %d documents into %s with %s", migration.ID, len(documentIDs), migration.Collection, migration.Model)
+
+	// Uploads after the switch need the collection even when there was nothing to re-embed
+	if err := m.indexer.ensureCollection(migration.Collection, migration.VectorSize); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, id := range documentIDs {
+		var document entities.Document
+		if err := m.DB.First(&document, id).Error; err != nil {
+			// Deleted while the migration was running
+			migration.ProcessedDocuments++
+			continue
+		}
+
+		if err := m.indexer.indexDocument(ctx, &document, config, nil); err != nil {
+			log.Errorf("Embedding migration %d: document ID %d failed: %v", migration.ID, id, err)
+			migration.FailedDocuments++
+			failures = append(failures, fmt.Sprintf("document %d: %v", id, err))
+		}
+
+		migration.ProcessedDocuments++
+		migration.Progress = migration.ProcessedDocuments * 100 / migration.TotalDocuments
+		m.DB.Model(migration).Updates(map[string]interface{}{
+			"processed_documents": migration.ProcessedDocuments,
+			"failed_documents":    migration.FailedDocuments,
+			"progress":            migration.Progress,
+			"heartbeat_at":        time.Now(),
+		})
+	}
+
+	// Searches stay on the previous collection until every document made it
+	if len(failures) > 0 {
+		return fmt.Errorf("%d documents could not be re-embedded: %s", len(failures), strings.Join(failures, "; "))
+	}
+
+	now := time.Now()
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveSettings(tx, map[string]string{
+			"embedding_provider_id": strconv.FormatUint(uint64(migration.ProviderID), 10),
+			"embedding_model":       migration.Model,
+			"embedding_vector_size": strconv.Itoa(migration.VectorSize),
+			"embedding_collection":  migration.Collection,
+		}); err != nil {
+			return err
+		}
+
+		migration.Status = entities.MigrationStatusCompleted
+		migration.Progress = 100
+		migration.FinishedAt = &now
+		return tx.Model(migration).Updates(map[string]interface{}{
+			"status":      migration.Status,
+			"progress":    migration.Progress,
+			"finished_at": migration.FinishedAt,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to switch collection: %w", err)
+	}
+
+	log.Infof("Embedding migration %d completed, switched to collection %s", migration.ID, migration.Collection)
+
+	// Documents changed during the migration may have been indexed with the old model
+	if migration.StartedAt != nil {
+		m.requeueChangedSince(*migration.StartedAt)
+	}
+	return nil
+}
+
+// requeueChangedSince queues documents updated after the given time for processing
+func (m *Migrator) requeueChangedSince(since time.Time) {
+	var documents []entities.Document
+	if err := m.DB.Where("updated_at > ?", since).Find(&documents).Error; err != nil {
+		log.Errorf("Failed to find changed documents: %v", err)
+		return
+	}
+
+	for i := range documents {
+		if _, err := m.JobQueue.Enqueue(&documents[i]); err != nil && !errors.Is(err, ErrJobAlreadyQueued) {
+			log.Errorf("Failed to queue document ID %d: %v", documents[i].ID, err)
+		}
+	}
+}
+
+// currentSettings returns the active embedding settings
+func (m *Migrator) currentSettings() map[string]string {
+	var settings []entities.Settings
+	m.DB.Where("key IN ?", embeddingSettingKeys).Find(&settings)
+
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+	return values
+}
+
+// saveSettings creates or updates settings
+func saveSettings(tx *gorm.DB, values map[string]string) error {
+	for key, value := range values {
+		if err := tx.Where("key = ?", key).
+			Assign(entities.Settings{Key: key, Value: value}).
+			FirstOrCreate(&entities.Settings{}).Error; err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
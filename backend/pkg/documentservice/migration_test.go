@@ -0,0 +1,307 @@
+package documentservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeIndexer keeps collections in memory instead of Qdrant
+type fakeIndexer struct {
+	mu          sync.Mutex
+	collections map[string]int
+	indexed     map[string][]uint
+	failing     map[uint]bool
+}
+
+func newFakeIndexer(collections ...string) *fakeIndexer {
+	indexer := &fakeIndexer{
+		collections: make(map[string]int),
+		indexed:     make(map[string][]uint),
+		failing:     make(map[uint]bool),
+	}
+	for _, collection := range collections {
+		indexer.collections[collection] = 768
+	}
+	return indexer
+}
+
+func (f *fakeIndexer) ensureCollection(collection string, vectorSize int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.collections[collection]; !ok {
+		f.collections[collection] = vectorSize
+	}
+	return nil
+}
+
+func (f *fakeIndexer) collectionExists(collection string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.collections[collection]
+	return ok, nil
+}
+
+func (f *fakeIndexer) indexDocument(ctx context.Context, document *entities.Document, config *EmbeddingConfig, onProgress ProgressFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[document.ID] {
+		return fmt.Errorf("embedding failed")
+	}
+	if f.collections[config.Collection] != config.VectorSize {
+		return fmt.Errorf("collection %s does not hold %d dimensional vectors", config.Collection, config.VectorSize)
+	}
+	f.indexed[config.Collection] = append(f.indexed[config.Collection], document.ID)
+	return nil
+}
+
+// newTestMigrator returns a migrator whose active configuration is provider 1,
+// model "old" and 768 dimensions in the global collection
+func newTestMigrator(t *testing.T, documents int) (*Migrator, *fakeIndexer) {
+	t.Helper()
+
+	db := testdb.Open(t, &entities.Provider{}, &entities.Document{}, &entities.DocumentJob{}, &entities.EmbeddingMigration{}, &entities.Settings{})
+	for _, name := range []string{"old", "new"} {
+		if err := db.Create(&entities.Provider{Name: name, Type: "ollama", BaseURL: "http://localhost:11434"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < documents; i++ {
+		if err := db.Create(&entities.Document{Title: fmt.Sprintf("document %d", i), Status: "ready"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveSettings(db, map[string]string{
+		"embedding_provider_id": "1",
+		"embedding_model":       "old",
+		"embedding_vector_size": "768",
+		"embedding_collection":  GlobalCollectionName,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	documentService := &DocumentService{DB: db}
+	indexer := newFakeIndexer(GlobalCollectionName)
+	migrator := NewMigrator(db, documentService, NewJobQueue(db, documentService, 1, 3))
+	migrator.indexer = indexer
+	return migrator, indexer
+}
+
+// waitForMigration waits until a migration started in the background finished
+func waitForMigration(t *testing.T, db *gorm.DB, id uint) *entities.EmbeddingMigration {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var migration entities.EmbeddingMigration
+		if err := db.First(&migration, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if migration.Status != entities.MigrationStatusRunning {
+			return &migration
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("migration %d is still running", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNeedsMigration(t *testing.T) {
+	tests := []struct {
+		name       string
+		documents  int
+		providerID uint
+		model      string
+		vectorSize int
+		want       bool
+	}{
+		{name: "unchanged", documents: 2, providerID: 1, model: "old", vectorSize: 768, want: false},
+		{name: "model without documents", providerID: 1, model: "new", vectorSize: 768, want: true},
+		{name: "vector size without documents", providerID: 1, model: "old", vectorSize: 1024, want: true},
+		{name: "provider with documents", documents: 2, providerID: 2, model: "old", vectorSize: 768, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, _ := newTestMigrator(t, tt.documents)
+
+			got, err := migrator.NeedsMigration(tt.providerID, tt.model, tt.vectorSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("NeedsMigration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsMigrationWithoutConfiguration(t *testing.T) {
+	db := testdb.Open(t, &entities.Document{}, &entities.Settings{})
+	migrator := NewMigrator(db, &DocumentService{DB: db}, nil)
+
+	got, err := migrator.NeedsMigration(1, "new", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got {
+		t.Error("the first configuration should be saved without a migration")
+	}
+}
+
+func TestMigrationSwitchesCollection(t *testing.T) {
+	for _, documents := range []int{0, 3} {
+		t.Run(fmt.Sprintf("%d documents", documents), func(t *testing.T) {
+			migrator, indexer := newTestMigrator(t, documents)
+
+			started, err := migrator.Start(2, "new", 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			migration := waitForMigration(t, migrator.DB, started.ID)
+
+			if migration.Status != entities.MigrationStatusCompleted {
+				t.Fatalf("status = %q (%s), want completed", migration.Status, migration.Error)
+			}
+			if migration.Collection == GlobalCollectionName {
+				t.Fatal("migration reused the active collection")
+			}
+			if migration.PreviousCollection != GlobalCollectionName {
+				t.Errorf("previous collection = %q, want %q", migration.PreviousCollection, GlobalCollectionName)
+			}
+			if size := indexer.collections[migration.Collection]; size != 1024 {
+				t.Errorf("new collection has %d dimensions, want 1024", size)
+			}
+			if got := len(indexer.indexed[migration.Collection]); got != documents {
+				t.Errorf("indexed %d documents, want %d", got, documents)
+			}
+			if migration.TotalDocuments != documents || migration.ProcessedDocuments != documents {
+				t.Errorf("processed %d of %d documents, want %d", migration.ProcessedDocuments, migration.TotalDocuments, documents)
+			}
+
+			settings := migrator.currentSettings()
+			want := map[string]string{
+				"embedding_provider_id": "2",
+				"embedding_model":       "new",
+				"embedding_vector_size": "1024",
+				"embedding_collection":  migration.Collection,
+			}
+			for key, value := range want {
+				if settings[key] != value {
+					t.Errorf("%s = %q, want %q", key, settings[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrationKeepsSettingsWhenDocumentsFail(t *testing.T) {
+	migrator, indexer := newTestMigrator(t, 3)
+	indexer.failing[2] = true
+
+	started, err := migrator.Start(1, "new", 768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migration := waitForMigration(t, migrator.DB, started.ID)
+
+	if migration.Status != entities.MigrationStatusFailed {
+		t.Fatalf("status = %q, want failed", migration.Status)
+	}
+	if migration.FailedDocuments != 1 || migration.ProcessedDocuments != 3 {
+		t.Errorf("failed %d and processed %d documents, want 1 and 3", migration.FailedDocuments, migration.ProcessedDocuments)
+	}
+	if got := migrator.DocumentService.GetActiveCollection(); got != GlobalCollectionName {
+		t.Errorf("active collection = %q, want %q", got, GlobalCollectionName)
+	}
+	if got := migrator.currentSettings()["embedding_model"]; got != "old" {
+		t.Errorf("model = %q, want old", got)
+	}
+}
+
+func TestMigrationRejectsConcurrentStart(t *testing.T) {
+	migrator, _ := newTestMigrator(t, 0)
+	if err := migrator.DB.Create(&entities.EmbeddingMigration{ProviderID: 1, Model: "other", VectorSize: 768, Status: entities.MigrationStatusRunning}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Start(1, "new", 768); !errors.Is(err, ErrMigrationRunning) {
+		t.Errorf("Start() error = %v, want %v", err, ErrMigrationRunning)
+	}
+}
+
+func TestMigrationRollback(t *testing.T) {
+	for _, documents := range []int{0, 2} {
+		t.Run(fmt.Sprintf("%d documents", documents), func(t *testing.T) {
+			migrator, indexer := newTestMigrator(t, documents)
+
+			started, err := migrator.Start(2, "new", 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			migration := waitForMigration(t, migrator.DB, started.ID)
+			if migration.Status != entities.MigrationStatusCompleted {
+				t.Fatalf("status = %q (%s), want completed", migration.Status, migration.Error)
+			}
+
+			if err := migrator.Rollback(migration); err != nil {
+				t.Fatal(err)
+			}
+
+			settings := migrator.currentSettings()
+			want := map[string]string{
+				"embedding_provider_id": "1",
+				"embedding_model":       "old",
+				"embedding_vector_size": "768",
+				"embedding_collection":  GlobalCollectionName,
+			}
+			for key, value := range want {
+				if settings[key] != value {
+					t.Errorf("%s = %q, want %q", key, settings[key], value)
+				}
+			}
+
+			var stored entities.EmbeddingMigration
+			if err := migrator.DB.First(&stored, migration.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != entities.MigrationStatusRolledBack {
+				t.Errorf("status = %q, want rolled back", stored.Status)
+			}
+
+			// Only the active migration can be rolled back
+			if err := migrator.Rollback(&stored); !errors.Is(err, ErrMigrationNotRollbackable) {
+				t.Errorf("second Rollback() error = %v, want %v", err, ErrMigrationNotRollbackable)
+			}
+			if len(indexer.indexed[GlobalCollectionName]) != 0 {
+				t.Error("rollback re-embedded documents into the previous collection")
+			}
+		})
+	}
+}
+
+func TestMigrationRollbackWithoutPreviousCollection(t *testing.T) {
+	migrator, indexer := newTestMigrator(t, 1)
+
+	started, err := migrator.Start(2, "new", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migration := waitForMigration(t, migrator.DB, started.ID)
+
+	delete(indexer.collections, GlobalCollectionName)
+	if err := migrator.Rollback(migration); err == nil {
+		t.Fatal("rollback to a deleted collection succeeded")
+	}
+	if got := migrator.DocumentService.GetActiveCollection(); got != migration.Collection {
+		t.Errorf("active collection = %q, want %q", got, migration.Collection)
+	}
+}
@@ -0,0 +1,285 @@
+package documentservice
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sef/app/entities"
+	"sef/pkg/qdrant"
+	"strings"
+
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// knowledgeScopeVersion is bumped when the scope payload of indexed documents has to be rebuilt
+const knowledgeScopeVersion = "1"
+
+var knowledgeBasePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidKnowledgeBase reports whether a name can be used as a knowledge base
+func ValidKnowledgeBase(name string) bool {
+	return knowledgeBasePattern.MatchString(name)
+}
+
+// KnowledgeBaseCollection returns the Qdrant collection holding the copies of
+// a knowledge base's documents embedded into the given base collection. Deriving
+// it from the base collection lets embedding migrations fill it as well.
+func KnowledgeBaseCollection(base, name string) string {
+	return base + "_kb_" + name
+}
+
+// documentScope lists the chatbots using a document
+type documentScope struct {
+	ChatbotIDs     []interface{}
+	KnowledgeBases []string
+}
+
+// chatbotFilter matches the points of all documents assigned to a chatbot
+func chatbotFilter(chatbotID uint) map[string]interface{} {
+	return map[string]interface{}{
+		"must": []map[string]interface{}{
+			{
+				"key": "chatbot_ids",
+				"match": map[string]interface{}{
+					"value": chatbotID,
+				},
+			},
+		},
+	}
+}
+
+// ChunkKey returns the key identifying a chunk, which is also its point ID
+func ChunkKey(payload map[string]interface{}) string {
+	return fmt.Sprintf("%v_%v", payload["document_id"], payload["chunk_index"])
+}
+
+// documentScope returns the chatbots and knowledge bases a document is assigned to
+func (ds *DocumentService) documentScope(documentID uint) (*documentScope, error) {
+	var rows []struct {
+		ID            uint
+		KnowledgeBase string
+	}
+	if err := ds.DB.Table("chatbots").
+		Select("chatbots.id, chatbots.knowledge_base").
+		Joins("JOIN chatbot_documents ON chatbot_documents.chatbot_id = chatbots.id").
+		Where("chatbot_documents.document_id = ? AND chatbots.deleted_at IS NULL", documentID).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load document chatbots: %w", err)
+	}
+
+	scope := &documentScope{ChatbotIDs: []interface{}{}}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		scope.ChatbotIDs = append(scope.ChatbotIDs, int64(row.ID))
+		if row.KnowledgeBase != "" && !seen[row.KnowledgeBase] {
+			seen[row.KnowledgeBase] = true
+			scope.KnowledgeBases = append(scope.KnowledgeBases, row.KnowledgeBase)
+		}
+	}
+	return scope, nil
+}
+
+// indexedCollections returns the collections documents are embedded into: the
+// active one and the ones running migrations fill, keyed by name with their vector size
+func (ds *DocumentService) indexedCollections() map[string]int {
+	collections := map[string]int{
+		ds.GetActiveCollection(): ds.getIntSetting("embedding_vector_size", 768),
+	}
+
+	var migrations []entities.EmbeddingMigration
+	ds.DB.Where("status = ?", entities.MigrationStatusRunning).Find(&migrations)
+	for _, migration := range migrations {
+		collections[migration.Collection] = migration.VectorSize
+	}
+	return collections
+}
+
+// knowledgeBaseCollections returns the existing knowledge base collections of a base collection
+func (ds *DocumentService) knowledgeBaseCollections(base string) ([]string, error) {
+	all, err := ds.QdrantClient.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := KnowledgeBaseCollection(base, "")
+	var collections []string
+	for _, collection := range all {
+		if strings.HasPrefix(collection, prefix) {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
+// syncKnowledgeBases copies a document's points from the base collection into
+// the collections of its knowledge bases and removes them from all others
+func (ds *DocumentService) syncKnowledgeBases(documentID uint, base string, vectorSize int, scope *documentScope) error {
+	existing, err := ds.knowledgeBaseCollections(base)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range scope.KnowledgeBases {
+		wanted[KnowledgeBaseCollection(base, name)] = true
+	}
+
+	for _, collection := range existing {
+		if wanted[collection] {
+			continue
+		}
+		if err := ds.QdrantClient.DeletePoints(collection, documentFilter(documentID)); err != nil {
+			return fmt.Errorf("failed to remove document from %s: %w", collection, err)
+		}
+	}
+
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	points, err := ds.QdrantClient.ScrollPoints(base, documentFilter(documentID), true)
+	if err != nil {
+		return fmt.Errorf("failed to load document points: %w", err)
+	}
+	ids := make(map[string]bool, len(points))
+	for _, point := range points {
+		ids[ChunkKey(point.Payload)] = true
+	}
+
+	for collection := range wanted {
+		if err := ds.ensureCollection(collection, vectorSize); err != nil {
+			return err
+		}
+
+		// Points of chunks the document no longer has are not overwritten by the copy
+		copies, err := ds.QdrantClient.ScrollPoints(collection, documentFilter(documentID), false)
+		if err != nil {
+			return fmt.Errorf("failed to load copied points: %w", err)
+		}
+		var orphaned []interface{}
+		for _, point := range copies {
+			if id := ChunkKey(point.Payload); !ids[id] {
+				orphaned = append(orphaned, id)
+			}
+		}
+		if err := ds.QdrantClient.DeletePointsByID(collection, orphaned); err != nil {
+			return fmt.Errorf("failed to delete orphaned points: %w", err)
+		}
+
+		for start := 0; start < len(points); start += upsertBatchSize {
+			batch := points[start:min(start+upsertBatchSize, len(points))]
+			copied := make([]qdrant.Point, len(batch))
+			for i, point := range batch {
+				copied[i] = qdrant.Point{
+					ID:      ChunkKey(point.Payload),
+					Vector:  point.Vector,
+					Payload: point.Payload,
+				}
+			}
+			if err := ds.QdrantClient.UpsertPoints(collection, copied); err != nil {
+				return fmt.Errorf("failed to copy points to %s: %w", collection, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SyncDocumentScope updates which chatbots can retrieve an already indexed
+// document after its chatbot assignments changed
+func (ds *DocumentService) SyncDocumentScope(documentID uint) error {
+	scope, err := ds.documentScope(documentID)
+	if err != nil {
+		return err
+	}
+
+	for collection, vectorSize := range ds.indexedCollections() {
+		exists, err := ds.QdrantClient.CollectionExists(collection)
+		if err != nil {
+			return fmt.Errorf("failed to check collection: %w", err)
+		}
+		if !exists {
+			continue
+		}
+
+		if err := ds.QdrantClient.SetPayload(collection, documentFilter(documentID), map[string]interface{}{
+			"chatbot_ids": scope.ChatbotIDs,
+		}); err != nil {
+			return fmt.Errorf("failed to update document scope: %w", err)
+		}
+
+		if err := ds.syncKnowledgeBases(documentID, collection, vectorSize, scope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SyncScopes updates the scope of the given documents in the background
+func (ds *DocumentService) SyncScopes(documentIDs []uint) {
+	if len(documentIDs) == 0 {
+		return
+	}
+
+	go func() {
+		for _, id := range documentIDs {
+			if err := ds.SyncDocumentScope(id); err != nil {
+				log.Errorf("Failed to sync scope of document ID %d: %v", id, err)
+			}
+		}
+		log.Infof("Synced scope of %d documents", len(documentIDs))
+	}()
+}
+
+// BackfillScopes writes the scope of documents indexed before chatbot scoping
+// was stored with their points. It runs once per scope version.
+func (ds *DocumentService) BackfillScopes() {
+	var setting entities.Settings
+	if err := ds.DB.Where("key = ?", "knowledge_scope_version").First(&setting).Error; err == nil && setting.Value == knowledgeScopeVersion {
+		return
+	}
+
+	var documentIDs []uint
+	if err := ds.DB.Table("chatbot_documents").Distinct("document_id").Pluck("document_id", &documentIDs).Error; err != nil {
+		log.Errorf("Failed to list documents to backfill scope: %v", err)
+		return
+	}
+
+	log.Infof("Backfilling scope of %d documents", len(documentIDs))
+	for _, id := range documentIDs {
+		if err := ds.SyncDocumentScope(id); err != nil {
+			log.Errorf("Failed to backfill scope of document ID %d: %v", id, err)
+			return
+		}
+	}
+
+	ds.DB.Where("key = ?", "knowledge_scope_version").
+		Assign(entities.Settings{Key: "knowledge_scope_version", Value: knowledgeScopeVersion}).
+		FirstOrCreate(&entities.Settings{})
+}
+
+// GetChatbotContext retrieves the chunks most relevant to a query among the
+// documents assigned to a chatbot. Documents are selected by the chatbot_ids
+// payload index, so the filter does not grow with the number of documents.
+func (ds *DocumentService) GetChatbotContext(ctx context.Context, query string, chatbot *entities.Chatbot, limit int) ([]qdrant.SearchResult, error) {
+	config, err := ds.GetEmbeddingConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := config.Collection
+	if chatbot.KnowledgeBase != "" {
+		knowledgeBase := KnowledgeBaseCollection(config.Collection, chatbot.KnowledgeBase)
+		exists, err := ds.QdrantClient.CollectionExists(knowledgeBase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check collection: %w", err)
+		}
+		// Until the first document is copied, the global collection holds everything
+		if exists {
+			collection = knowledgeBase
+		}
+	}
+
+	return ds.search(ctx, config, collection, preprocessQuery(query), limit, chatbotFilter(chatbot.ID))
+}
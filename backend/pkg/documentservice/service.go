@@ -2,19 +2,39 @@ package documentservice
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"runtime/debug"
 	"sef/app/entities"
 	"sef/pkg/chunking"
+	"sef/pkg/extraction"
 	"sef/pkg/providers"
 	"sef/pkg/qdrant"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v3/log"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
 )
 
 const GlobalCollectionName = "global_documents"
 
+const (
+	// DefaultEmbeddingBatchSize is the number of chunks embedded per request
+	DefaultEmbeddingBatchSize = 32
+	// DefaultEmbeddingConcurrency is the number of embedding requests running at once
+	DefaultEmbeddingConcurrency = 4
+	// MaxEmbeddingBatchSize is the largest batch size that can be configured
+	MaxEmbeddingBatchSize = 512
+	// MaxEmbeddingConcurrency is the largest concurrency that can be configured
+	MaxEmbeddingConcurrency = 32
+	// upsertBatchSize is the number of points written to Qdrant per request
+	upsertBatchSize = 256
+)
+
 // DocumentService handles document processing and embedding
 type DocumentService struct {
 	DB           *gorm.DB
@@ -50,6 +70,28 @@ func (ds *DocumentService) GetEmbeddingProvider(ctx context.Context) (*entities.
 	return &provider, modelSetting.Value, nil
 }
 
+// GetEmbeddingBatchSettings returns how many chunks are embedded per request
+// and how many requests run concurrently
+func (ds *DocumentService) GetEmbeddingBatchSettings(ctx context.Context) (int, int) {
+	batchSize := ds.getIntSetting("embedding_batch_size", DefaultEmbeddingBatchSize)
+	concurrency := ds.getIntSetting("embedding_concurrency", DefaultEmbeddingConcurrency)
+	return max(batchSize, 1), max(concurrency, 1)
+}
+
+// getIntSetting returns an integer setting or the default when it is not set
+func (ds *DocumentService) getIntSetting(key string, defaultValue int) int {
+	var setting entities.Settings
+	if err := ds.DB.Where("key = ?", key).First(&setting).Error; err != nil {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(setting.Value)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // GetVectorSize returns vector size for the configured model
 func (ds *DocumentService) GetVectorSize(ctx context.Context) (int, error) {
 	var setting entities.Settings
@@ -62,33 +104,200 @@ func (ds *DocumentService) GetVectorSize(ctx context.Context) (int, error) {
 	return size, nil
 }
 
-// ProcessDocument chunks and embeds a document
-func (ds *DocumentService) ProcessDocument(ctx context.Context, document *entities.Document) error {
+// EmbeddingConfig describes how and where document chunks are embedded
+type EmbeddingConfig struct {
+	Provider   *entities.Provider
+	Model      string
+	VectorSize int
+	Collection string
+}
+
+// GetEmbeddingConfig returns the active embedding configuration. The settings are
+// read in a single query so a migration switching them is seen all at once.
+func (ds *DocumentService) GetEmbeddingConfig(ctx context.Context) (*EmbeddingConfig, error) {
+	var settings []entities.Settings
+	if err := ds.DB.Where("key IN ?", []string{"embedding_provider_id", "embedding_model", "embedding_vector_size", "embedding_collection"}).
+		Find(&settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load embedding settings: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+
+	if values["embedding_provider_id"] == "" {
+		return nil, fmt.Errorf("embedding provider not configured")
+	}
+
+	var provider entities.Provider
+	if err := ds.DB.First(&provider, values["embedding_provider_id"]).Error; err != nil {
+		return nil, fmt.Errorf("embedding provider not found: %w", err)
+	}
+
+	if values["embedding_model"] == "" {
+		return nil, fmt.Errorf("embedding model not configured")
+	}
+
+	config := &EmbeddingConfig{
+		Provider:   &provider,
+		Model:      values["embedding_model"],
+		VectorSize: 768, // Default
+		Collection: values["embedding_collection"],
+	}
+	if size, err := strconv.Atoi(values["embedding_vector_size"]); err == nil && size > 0 {
+		config.VectorSize = size
+	}
+	if config.Collection == "" {
+		config.Collection = GlobalCollectionName
+	}
+
+	return config, nil
+}
+
+// GetActiveCollection returns the Qdrant collection documents are searched in.
+// It changes when an embedding model migration completes.
+func (ds *DocumentService) GetActiveCollection() string {
+	var setting entities.Settings
+	if err := ds.DB.Where("key = ?", "embedding_collection").First(&setting).Error; err != nil || setting.Value == "" {
+		return GlobalCollectionName
+	}
+	return setting.Value
+}
+
+// ProgressFunc receives the processing progress of a document in percent
+type ProgressFunc func(percent int)
+
+// ProcessDocument chunks and embeds a document. On failure the document is
+// marked as failed and the reason is stored on it.
+func (ds *DocumentService) ProcessDocument(ctx context.Context, document *entities.Document, onProgress ProgressFunc) error {
 	// Update status to processing
 	document.Status = "processing"
-	if err := ds.DB.Save(document).Error; err != nil {
+	document.Progress = 0
+	document.FailureReason = ""
+	if err := ds.DB.Model(document).Updates(map[string]interface{}{
+		"status":         document.Status,
+		"progress":       document.Progress,
+		"failure_reason": document.FailureReason,
+	}).Error; err != nil {
 		return fmt.Errorf("failed to update document status: %w", err)
 	}
 
 	log.Infof("Processing document ID %d", document.ID)
 
-	// Get embedding provider and model
-	provider, embedModel, err := ds.GetEmbeddingProvider(ctx)
-	if err != nil {
+	if err := ds.processDocument(ctx, document, onProgress); err != nil {
 		document.Status = "failed"
-		ds.DB.Save(document)
+		document.FailureReason = err.Error()
+		ds.DB.Model(document).Updates(map[string]interface{}{
+			"status":         document.Status,
+			"failure_reason": document.FailureReason,
+		})
 		return err
 	}
 
-	// Get vector size
-	vectorSize, err := ds.GetVectorSize(ctx)
+	// Update document status
+	document.Status = "ready"
+	document.Progress = 100
+	if err := ds.DB.Model(document).Updates(map[string]interface{}{
+		"status":      document.Status,
+		"progress":    document.Progress,
+		"chunk_count": document.ChunkCount,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update document status: %w", err)
+	}
+
+	return nil
+}
+
+// processDocument indexes a document with the active embedding configuration
+func (ds *DocumentService) processDocument(ctx context.Context, document *entities.Document, onProgress ProgressFunc) error {
+	progress := func(percent int) {
+		ds.reportProgress(document, percent, onProgress)
+	}
+
+	for {
+		config, err := ds.GetEmbeddingConfig(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := ds.indexDocument(ctx, document, config, progress); err != nil {
+			return err
+		}
+
+		// A migration switched collections while the document was being indexed
+		if ds.GetActiveCollection() == config.Collection {
+			return nil
+		}
+		log.Infof("Active collection changed while processing document ID %d, indexing it again", document.ID)
+	}
+}
+
+// indexDocument generates and stores the embeddings of a document in the configured collection
+func (ds *DocumentService) indexDocument(ctx context.Context, document *entities.Document, config *EmbeddingConfig, onProgress ProgressFunc) error {
+	embedProvider, err := newEmbeddingProvider(config.Provider)
 	if err != nil {
-		document.Status = "failed"
-		ds.DB.Save(document)
 		return err
 	}
 
-	// Create embedding provider
+	if err := ds.ensureCollection(config.Collection, config.VectorSize); err != nil {
+		return err
+	}
+
+	log.Infof("Chunking document ID %d", document.ID)
+
+	chunks := ds.chunkDocument(document)
+	document.ChunkCount = len(chunks)
+
+	log.Infof("Document ID %d chunked into %d chunks", document.ID, len(chunks))
+
+	scope, err := ds.documentScope(document.ID)
+	if err != nil {
+		return err
+	}
+
+	// Vectors of unchanged chunks are reused instead of being embedded again
+	existing, err := ds.QdrantClient.ScrollPoints(config.Collection, documentFilter(document.ID), true)
+	if err != nil {
+		return fmt.Errorf("failed to load existing points: %w", err)
+	}
+	reuse := make(map[string][]float32)
+	for _, point := range existing {
+		hash, _ := point.Payload["content_hash"].(string)
+		model, _ := point.Payload["embedding_model"].(string)
+		if hash != "" && model == config.Model && len(point.Vector) == config.VectorSize {
+			reuse[hash] = point.Vector
+		}
+	}
+
+	if err := ds.embedChunks(ctx, document, chunks, reuse, scope, embedProvider, config, onProgress); err != nil {
+		return err
+	}
+
+	// Points of chunks beyond the new chunk count are no longer overwritten
+	var orphaned []interface{}
+	for _, point := range existing {
+		if index, ok := point.Payload["chunk_index"].(int64); ok && int(index) >= len(chunks) {
+			orphaned = append(orphaned, fmt.Sprintf("%d_%d", document.ID, index))
+		}
+	}
+	if err := ds.QdrantClient.DeletePointsByID(config.Collection, orphaned); err != nil {
+		return fmt.Errorf("failed to delete orphaned points: %w", err)
+	}
+	if len(orphaned) > 0 {
+		log.Infof("Deleted %d orphaned points of document ID %d", len(orphaned), document.ID)
+	}
+
+	if err := ds.syncKnowledgeBases(document.ID, config.Collection, config.VectorSize, scope); err != nil {
+		return err
+	}
+
+	// Keep the chunk text for full text search in hybrid retrieval
+	return ds.saveChunks(document, chunks)
+}
+
+// newEmbeddingProvider creates the embedding client of a provider
+func newEmbeddingProvider(provider *entities.Provider) (providers.EmbeddingProvider, error) {
 	factory := &providers.EmbeddingProviderFactory{}
 	config := map[string]interface{}{
 		"base_url": provider.BaseURL,
@@ -97,60 +306,208 @@ func (ds *DocumentService) ProcessDocument(ctx context.Context, document *entiti
 
 	embedProvider, err := factory.NewProvider(provider.Type, config)
 	if err != nil {
-		document.Status = "failed"
-		ds.DB.Save(document)
-		return fmt.Errorf("failed to create embedding provider: %w", err)
+		return nil, fmt.Errorf("failed to create embedding provider: %w", err)
 	}
+	return embedProvider, nil
+}
 
-	// Ensure global collection exists
-	exists, err := ds.QdrantClient.CollectionExists(GlobalCollectionName)
+// ensureCollection creates a collection when it does not exist yet
+func (ds *DocumentService) ensureCollection(collection string, vectorSize int) error {
+	log.Infof("Ensuring Qdrant collection '%s' exists", collection)
+
+	exists, err := ds.QdrantClient.CollectionExists(collection)
 	if err != nil {
 		return fmt.Errorf("failed to check collection: %w", err)
 	}
 
-	log.Infof("Ensuring Qdrant collection '%s' exists", GlobalCollectionName)
-
 	if !exists {
-		if err := ds.QdrantClient.CreateCollection(GlobalCollectionName, vectorSize, "Cosine"); err != nil {
+		if err := ds.QdrantClient.CreateCollection(collection, vectorSize, "Cosine"); err != nil {
 			return fmt.Errorf("failed to create collection: %w", err)
 		}
+		return nil
 	}
 
-	log.Infof("Chunking document ID %d", document.ID)
+	// Collections created before payload indexes existed get them now
+	return ds.QdrantClient.EnsurePayloadIndexes(collection)
+}
 
-	// Auto-detect best chunking strategy based on document characteristics
-	strategy := ds.detectChunkingStrategy(document)
-	log.Infof("Using %s chunking strategy for document ID %d", strategy, document.ID)
+// collectionExists reports whether a collection exists
+func (ds *DocumentService) collectionExists(collection string) (bool, error) {
+	return ds.QdrantClient.CollectionExists(collection)
+}
 
-	// Chunk the document with detected strategy
-	var chunks []chunking.Chunk
-	if strategy == "smart" {
-		chunks = chunking.ChunkWithHeaders(document.Content, chunking.SmartStrategy())
-	} else {
-		chunks = chunking.ChunkText(document.Content, chunking.DefaultStrategy())
-	}
-	document.ChunkCount = len(chunks)
+// ContentHash returns the hash used to detect changed content
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
 
-	log.Infof("Document ID %d chunked into %d chunks", document.ID, len(chunks))
+// documentFilter matches all points of a document
+func documentFilter(documentID uint) map[string]interface{} {
+	return map[string]interface{}{
+		"must": []map[string]interface{}{
+			{
+				"key": "document_id",
+				"match": map[string]interface{}{
+					"value": documentID,
+				},
+			},
+		},
+	}
+}
 
-	// Generate embeddings for chunks
-	var points []qdrant.Point
+// embedChunks embeds chunks in batches on several workers and upserts the
+// resulting points to Qdrant in batches as they become available. Chunks whose
+// content hash is in reuse keep their existing vector.
+func (ds *DocumentService) embedChunks(ctx context.Context, document *entities.Document, chunks []chunking.Chunk, reuse map[string][]float32, scope *documentScope, embedProvider providers.EmbeddingProvider, config *EmbeddingConfig, onProgress ProgressFunc) error {
+	batchSize, concurrency := ds.GetEmbeddingBatchSettings(ctx)
 	totalChunks := len(chunks)
-	for _, chunk := range chunks {
-		log.Infof("Generating embedding for document ID %d, chunk %d", document.ID, chunk.Index)
-		embedding, err := embedProvider.GenerateEmbedding(ctx, embedModel, chunk.Text)
+
+	log.Infof("Embedding %d chunks of document ID %d in batches of %d with %d workers", totalChunks, document.ID, batchSize, concurrency)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	batches := make(chan []chunking.Chunk)
+	results := make(chan []qdrant.Point)
+
+	group.Go(recoverPanic(func() error {
+		defer close(batches)
+		for start := 0; start < totalChunks; start += batchSize {
+			end := min(start+batchSize, totalChunks)
+			select {
+			case batches <- chunks[start:end]:
+			case <-groupCtx.Done():
+				return groupCtx.Err()
+			}
+		}
+		return nil
+	}))
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		group.Go(recoverPanic(func() error {
+			defer workers.Done()
+			for batch := range batches {
+				points, err := ds.embedBatch(groupCtx, document, batch, totalChunks, reuse, scope, embedProvider, config.Model)
+				if err != nil {
+					return err
+				}
+				select {
+				case results <- points:
+				case <-groupCtx.Done():
+					return groupCtx.Err()
+				}
+			}
+			return nil
+		}))
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	group.Go(recoverPanic(func() error {
+		var pending []qdrant.Point
+		embedded := 0
+		upserted := 0
+
+		flush := func() error {
+			if len(pending) == 0 {
+				return nil
+			}
+			if err := ds.QdrantClient.UpsertPoints(config.Collection, pending); err != nil {
+				return fmt.Errorf("failed to upsert points: %w", err)
+			}
+			upserted += len(pending)
+			pending = nil
+			return nil
+		}
+
+		for points := range results {
+			pending = append(pending, points...)
+			embedded += len(points)
+			if len(pending) >= upsertBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+			// Embedding is the bulk of the work, the last upsert accounts for the last few percent
+			if onProgress != nil {
+				onProgress(embedded * 95 / totalChunks)
+			}
+		}
+		if err := groupCtx.Err(); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		log.Infof("Upserted %d points to Qdrant for document ID %d", upserted, document.ID)
+		return nil
+	}))
+
+	if err := group.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("processing interrupted: %w", ctx.Err())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// recoverPanic returns a panic in fn as an error. Goroutines started while
+// embedding are outside the recover of the job worker, so a panicking
+// provider would otherwise take the whole server down.
+func recoverPanic(fn func() error) func() error {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("Embedding panicked: %v\n%s", r, debug.Stack())
+				err = fmt.Errorf("embedding panicked: %v", r)
+			}
+		}()
+		return fn()
+	}
+}
+
+// embedBatch generates the embeddings of a batch of chunks and builds their points
+func (ds *DocumentService) embedBatch(ctx context.Context, document *entities.Document, batch []chunking.Chunk, totalChunks int, reuse map[string][]float32, scope *documentScope, embedProvider providers.EmbeddingProvider, embedModel string) ([]qdrant.Point, error) {
+	hashes := make([]string, len(batch))
+	embeddings := make([][]float32, len(batch))
+
+	var texts []string
+	var missing []int
+	for i, chunk := range batch {
+		hashes[i] = ContentHash(chunk.Text)
+		if vector, ok := reuse[hashes[i]]; ok {
+			embeddings[i] = vector
+			continue
+		}
+		texts = append(texts, chunk.Text)
+		missing = append(missing, i)
+	}
+
+	if len(texts) > 0 {
+		generated, err := embedProvider.GenerateEmbeddings(ctx, embedModel, texts)
 		if err != nil {
-			document.Status = "failed"
-			ds.DB.Save(document)
-			return fmt.Errorf("failed to generate embedding for chunk %d: %w", chunk.Index, err)
+			return nil, fmt.Errorf("failed to generate embeddings for chunks %d-%d: %w", batch[0].Index, batch[len(batch)-1].Index, err)
+		}
+		for i, index := range missing {
+			embeddings[index] = generated[i]
 		}
+	}
 
+	points := make([]qdrant.Point, len(batch))
+	for i, chunk := range batch {
 		// Calculate relative position for better context awareness
 		relativePosition := float64(chunk.Index) / float64(totalChunks)
 
 		point := qdrant.Point{
 			ID:     fmt.Sprintf("%d_%d", document.ID, chunk.Index),
-			Vector: embedding,
+			Vector: embeddings[i],
 			Payload: map[string]interface{}{
 				"document_id":       document.ID,
 				"chunk_index":       chunk.Index,
@@ -159,60 +516,138 @@ func (ds *DocumentService) ProcessDocument(ctx context.Context, document *entiti
 				"char_count":        len(chunk.Text),
 				"relative_position": relativePosition, // Where in document (0.0-1.0)
 				"total_chunks":      totalChunks,
+				"content_hash":      hashes[i],
+				"embedding_model":   embedModel,
+				"chatbot_ids":       scope.ChatbotIDs, // Chatbots allowed to retrieve the chunk
 			},
 		}
 
-		points = append(points, point)
+		// Location metadata lets citations point to a page, heading or row range
+		for _, key := range locationKeys {
+			if value, ok := chunk.Metadata[key]; ok {
+				point.Payload[key] = value
+			}
+		}
+
+		points[i] = point
 	}
 
-	log.Infof("Generated %d embeddings for document ID %d", len(points), document.ID)
+	return points, nil
+}
 
-	// Upsert points to Qdrant
-	if err := ds.QdrantClient.UpsertPoints(GlobalCollectionName, points); err != nil {
-		document.Status = "failed"
-		ds.DB.Save(document)
-		return fmt.Errorf("failed to upsert points: %w", err)
+// reportProgress stores the document progress when it changed and notifies the callback
+func (ds *DocumentService) reportProgress(document *entities.Document, percent int, onProgress ProgressFunc) {
+	if percent == document.Progress {
+		return
 	}
 
-	log.Infof("Upserted %d points to Qdrant for document ID %d", len(points), document.ID)
+	document.Progress = percent
+	ds.DB.Model(document).Update("progress", percent)
 
-	// Update document status
-	document.Status = "ready"
-	if err := ds.DB.Save(document).Error; err != nil {
-		return fmt.Errorf("failed to update document status: %w", err)
+	if onProgress != nil {
+		onProgress(percent)
 	}
+}
 
-	return nil
+// locationKeys are the chunk metadata keys copied to the point payload
+var locationKeys = []string{"page", "heading", "sheet", "first_row", "last_row"}
+
+// chunkDocument splits a document into chunks. Documents extracted from
+// structured formats are chunked section by section so each chunk keeps the
+// page, heading or rows it came from.
+func (ds *DocumentService) chunkDocument(document *entities.Document) []chunking.Chunk {
+	sections := extraction.SectionsFromMetadata(document.Metadata)
+	if len(sections) == 0 {
+		// Auto-detect best chunking strategy based on document characteristics
+		strategy := ds.detectChunkingStrategy(document)
+		log.Infof("Using %s chunking strategy for document ID %d", strategy, document.ID)
+
+		var chunks []chunking.Chunk
+		if strategy == "smart" {
+			chunks = chunking.ChunkWithHeaders(document.Content, chunking.SmartStrategy())
+		} else {
+			chunks = chunking.ChunkText(document.Content, chunking.DefaultStrategy())
+		}
+
+		for _, chunk := range chunks {
+			if header, ok := chunk.Metadata["header"].(string); ok && header != "" {
+				chunk.Metadata["heading"] = strings.TrimSpace(strings.TrimLeft(header, "#"))
+			}
+		}
+		return chunks
+	}
+
+	log.Infof("Chunking document ID %d by %d extracted sections", document.ID, len(sections))
+
+	strategy := chunking.DefaultStrategy()
+	var chunks []chunking.Chunk
+	for _, section := range sections {
+		if section.Start < 0 || section.End > len(document.Content) || section.Start >= section.End {
+			continue
+		}
+		text := document.Content[section.Start:section.End]
+
+		// Row groups are sized by the extractor and must not be split mid-row
+		var sectionChunks []chunking.Chunk
+		if section.Tabular() || len(text) <= strategy.ChunkSize {
+			sectionChunks = []chunking.Chunk{{
+				Text:     strings.TrimSpace(text),
+				Metadata: map[string]interface{}{"char_count": len(text)},
+			}}
+		} else {
+			sectionChunks = chunking.ChunkText(text, strategy)
+		}
+
+		for _, chunk := range sectionChunks {
+			if chunk.Metadata == nil {
+				chunk.Metadata = make(map[string]interface{})
+			}
+			if section.Page > 0 {
+				chunk.Metadata["page"] = section.Page
+			}
+			if section.Heading != "" {
+				chunk.Metadata["heading"] = section.Heading
+			}
+			if section.Sheet != "" {
+				chunk.Metadata["sheet"] = section.Sheet
+			}
+			if section.Tabular() {
+				chunk.Metadata["first_row"] = section.FirstRow
+				chunk.Metadata["last_row"] = section.LastRow
+			}
+			chunk.Index = len(chunks)
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks
 }
 
 // SearchDocuments performs semantic search across documents
 func (ds *DocumentService) SearchDocuments(ctx context.Context, query string, limit int, filter map[string]interface{}) ([]qdrant.SearchResult, error) {
-	// Get embedding provider and model
-	provider, embedModel, err := ds.GetEmbeddingProvider(ctx)
+	// Get the active embedding provider, model and collection
+	config, err := ds.GetEmbeddingConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create embedding provider
-	factory := &providers.EmbeddingProviderFactory{}
-	config := map[string]interface{}{
-		"base_url": provider.BaseURL,
-		"api_key":  provider.ApiKey,
-	}
+	return ds.search(ctx, config, config.Collection, query, limit, filter)
+}
 
-	embedProvider, err := factory.NewProvider(provider.Type, config)
+// search embeds the query and searches the given collection
+func (ds *DocumentService) search(ctx context.Context, config *EmbeddingConfig, collection string, query string, limit int, filter map[string]interface{}) ([]qdrant.SearchResult, error) {
+	embedProvider, err := newEmbeddingProvider(config.Provider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding provider: %w", err)
+		return nil, err
 	}
 
 	// Generate embedding for query
-	queryEmbedding, err := embedProvider.GenerateEmbedding(ctx, embedModel, query)
+	queryEmbedding, err := embedProvider.GenerateEmbedding(ctx, config.Model, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	// Search in Qdrant global collection
-	results, err := ds.QdrantClient.Search(GlobalCollectionName, queryEmbedding, limit, filter)
+	results, err := ds.QdrantClient.Search(collection, queryEmbedding, limit, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
@@ -222,20 +657,23 @@ func (ds *DocumentService) SearchDocuments(ctx context.Context, query string, li
 
 // DeleteDocument removes a document and its embeddings
 func (ds *DocumentService) DeleteDocument(ctx context.Context, document *entities.Document) error {
-	// Delete points from Qdrant
-	filter := map[string]interface{}{
-		"must": []map[string]interface{}{
-			{
-				"key": "document_id",
-				"match": map[string]interface{}{
-					"value": document.ID,
-				},
-			},
-		},
+	// Delete points from Qdrant, including the collection a running migration
+	// fills and the copies in knowledge base collections
+	for collection := range ds.indexedCollections() {
+		knowledgeBases, err := ds.knowledgeBaseCollections(collection)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range append([]string{collection}, knowledgeBases...) {
+			if err := ds.QdrantClient.DeletePoints(name, documentFilter(document.ID)); err != nil {
+				return fmt.Errorf("failed to delete points: %w", err)
+			}
+		}
 	}
 
-	if err := ds.QdrantClient.DeletePoints(GlobalCollectionName, filter); err != nil {
-		return fmt.Errorf("failed to delete points: %w", err)
+	if err := ds.DB.Where("document_id = ?", document.ID).Delete(&entities.DocumentChunk{}).Error; err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
 	}
 
 	// Delete from database
@@ -0,0 +1,60 @@
+package documentservice
+
+import (
+	"context"
+	"sef/app/entities"
+	"sef/internal/testdb"
+	"sef/pkg/chunking"
+	"sef/pkg/providers"
+	"strings"
+	"testing"
+)
+
+// panickingProvider embeds every text or panics when told to
+type panickingProvider struct {
+	providers.EmbeddingProvider
+	panics bool
+}
+
+func (p *panickingProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if p.panics {
+		panic("provider bug")
+	}
+	embeddings := make([][]float32, len(texts))
+	for i := range embeddings {
+		embeddings[i] = []float32{1, 0}
+	}
+	return embeddings, nil
+}
+
+func TestEmbedChunksRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   *panickingProvider
+		onProgress ProgressFunc
+	}{
+		{
+			name:     "embedding provider",
+			provider: &panickingProvider{panics: true},
+		},
+		{
+			name:       "upserting points",
+			provider:   &panickingProvider{},
+			onProgress: func(percent int) { panic("progress bug") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &DocumentService{DB: testdb.Open(t, &entities.Settings{})}
+			document := &entities.Document{Base: entities.Base{ID: 1}, Title: "Handbook"}
+			chunks := []chunking.Chunk{{Text: "first", Index: 0}, {Text: "second", Index: 1}}
+			config := &EmbeddingConfig{Model: "nomic-embed-text", VectorSize: 2, Collection: GlobalCollectionName}
+
+			err := ds.embedChunks(context.Background(), document, chunks, nil, &documentScope{}, tt.provider, config, tt.onProgress)
+			if err == nil || !strings.Contains(err.Error(), "panicked") {
+				t.Errorf("embedChunks() error = %v, want the panic as an error", err)
+			}
+		})
+	}
+}
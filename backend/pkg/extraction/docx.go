@@ -0,0 +1,162 @@
+package extraction
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOCXExtractor extracts the text of a Word document split by headings
+type DOCXExtractor struct{}
+
+// Extract returns one section per heading with the page it starts on.
+// Pages are counted from the page breaks Word stores when saving.
+func (DOCXExtractor) Extract(data []byte) (*Result, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DOCX: %w", err)
+	}
+
+	document, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	// Rendered page breaks are only present when Word laid the document out
+	renderedBreaks := bytes.Contains(document, []byte("lastRenderedPageBreak"))
+
+	var (
+		sections  []Section
+		current   = Section{Page: 1}
+		body      strings.Builder
+		paragraph strings.Builder
+		style     string
+		page      = 1
+		cell      strings.Builder
+		cells     []string
+		inTable   int
+	)
+
+	flushParagraph := func() {
+		text := strings.TrimSpace(paragraph.String())
+		heading := isHeadingStyle(style)
+		paragraph.Reset()
+		style = ""
+		if text == "" {
+			return
+		}
+
+		if inTable > 0 {
+			if cell.Len() > 0 {
+				cell.WriteString(" ")
+			}
+			cell.WriteString(text)
+			return
+		}
+
+		if heading {
+			current.Text = body.String()
+			sections = append(sections, current)
+			body.Reset()
+			current = Section{Page: page, Heading: text}
+		}
+		body.WriteString(text)
+		body.WriteString("\n")
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "pStyle":
+				style = xmlAttr(element, "val")
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &element); err != nil {
+					return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+				}
+				paragraph.WriteString(text)
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br":
+				if xmlAttr(element, "type") == "page" && !renderedBreaks {
+					page++
+				} else {
+					paragraph.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				page++
+			case "tbl":
+				inTable++
+			case "tr":
+				cells = nil
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "p":
+				flushParagraph()
+			case "tc":
+				cells = append(cells, cell.String())
+				cell.Reset()
+			case "tr":
+				if len(cells) > 0 {
+					body.WriteString(strings.Join(cells, " | "))
+					body.WriteString("\n")
+				}
+				cells = nil
+			case "tbl":
+				inTable--
+			}
+		}
+	}
+
+	current.Text = body.String()
+	sections = append(sections, current)
+
+	result := newResult("docx", sections)
+	result.PageCount = page
+	return result, nil
+}
+
+// isHeadingStyle reports whether a paragraph style is a title or heading style
+func isHeadingStyle(style string) bool {
+	style = strings.ToLower(style)
+	return style == "title" || strings.HasPrefix(style, "heading")
+}
+
+// readZipFile reads a single file from a zip archive
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// xmlAttr returns the value of an attribute by its local name
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
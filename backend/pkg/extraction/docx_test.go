@@ -0,0 +1,108 @@
+package extraction
+
+import (
+	"slices"
+	"testing"
+)
+
+// wordDocument wraps body XML in a minimal DOCX archive
+func wordDocument(t *testing.T, body string) []byte {
+	return zipArchive(t, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			body + `</w:body></w:document>`,
+	})
+}
+
+func TestDOCXExtractor(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantTexts     []string
+		wantHeadings  []string
+		wantPages     []int
+		wantPageCount int
+	}{
+		{
+			name: "sections by heading",
+			body: `<w:p><w:r><w:t>Önsöz</w:t></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Kurulum</w:t></w:r></w:p>
+				<w:p><w:r><w:t>Adım</w:t><w:tab/><w:t>bir</w:t></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Ek</w:t></w:r></w:p>`,
+			wantTexts:     []string{"Önsöz", "Kurulum\nAdım\tbir", "Ek"},
+			wantHeadings:  []string{"", "Kurulum", "Ek"},
+			wantPages:     []int{1, 1, 1},
+			wantPageCount: 1,
+		},
+		{
+			name: "manual page breaks",
+			body: `<w:p><w:r><w:t>One</w:t><w:br w:type="page"/></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="heading2"/></w:pPr><w:r><w:t>Two</w:t></w:r></w:p>
+				<w:p><w:r><w:t>first</w:t><w:br/><w:t>second</w:t></w:r></w:p>`,
+			wantTexts:     []string{"One", "Two\nfirst\nsecond"},
+			wantHeadings:  []string{"", "Two"},
+			wantPages:     []int{1, 2},
+			wantPageCount: 2,
+		},
+		{
+			name: "rendered page breaks win over manual ones",
+			body: `<w:p><w:r><w:t>One</w:t><w:br w:type="page"/></w:r></w:p>
+				<w:p><w:r><w:lastRenderedPageBreak/><w:t>Two</w:t></w:r></w:p>
+				<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:lastRenderedPageBreak/><w:t>Three</w:t></w:r></w:p>`,
+			wantTexts:     []string{"One\nTwo", "Three"},
+			wantHeadings:  []string{"", "Three"},
+			wantPages:     []int{1, 3},
+			wantPageCount: 3,
+		},
+		{
+			name: "tables",
+			body: `<w:tbl>
+				<w:tr><w:tc><w:p><w:r><w:t>Ad</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Port</w:t></w:r></w:p></w:tc></w:tr>
+				<w:tr><w:tc><w:p><w:r><w:t>api</w:t></w:r></w:p><w:p><w:r><w:t>gw</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>8080</w:t></w:r></w:p></w:tc></w:tr>
+			</w:tbl>`,
+			wantTexts:     []string{"Ad | Port\napi gw | 8080"},
+			wantHeadings:  []string{""},
+			wantPages:     []int{1},
+			wantPageCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := DOCXExtractor{}.Extract(wordDocument(t, tt.body))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			if got := sectionTexts(t, result); !slices.Equal(got, tt.wantTexts) {
+				t.Errorf("sections = %q, want %q", got, tt.wantTexts)
+			}
+			var headings []string
+			var pages []int
+			for _, section := range result.Sections {
+				headings = append(headings, section.Heading)
+				pages = append(pages, section.Page)
+			}
+			if !slices.Equal(headings, tt.wantHeadings) {
+				t.Errorf("headings = %q, want %q", headings, tt.wantHeadings)
+			}
+			if !slices.Equal(pages, tt.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+			if result.PageCount != tt.wantPageCount {
+				t.Errorf("page count = %d, want %d", result.PageCount, tt.wantPageCount)
+			}
+		})
+	}
+}
+
+func TestDOCXExtractorErrors(t *testing.T) {
+	if _, err := (DOCXExtractor{}).Extract([]byte("not a zip")); err == nil {
+		t.Error("Extract() of a non zip file should fail")
+	}
+	if _, err := (DOCXExtractor{}).Extract(zipArchive(t, map[string]string{"other.xml": "<x/>"})); err == nil {
+		t.Error("Extract() without word/document.xml should fail")
+	}
+	if _, err := (DOCXExtractor{}).Extract(wordDocument(t, "<w:p>")); err == nil {
+		t.Error("Extract() of malformed XML should fail")
+	}
+}
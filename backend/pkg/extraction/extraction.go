@@ -0,0 +1,165 @@
+package extraction
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MaxSectionSize is the target size of row-aware sections, matching the default chunk size
+const MaxSectionSize = 512
+
+// Section is a part of an extracted document with its location metadata.
+// Start and End are byte offsets into Result.Text.
+type Section struct {
+	Text     string `json:"-"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Page     int    `json:"page,omitempty"`
+	Heading  string `json:"heading,omitempty"`
+	Sheet    string `json:"sheet,omitempty"`
+	FirstRow int    `json:"first_row,omitempty"`
+	LastRow  int    `json:"last_row,omitempty"`
+}
+
+// Tabular reports whether the section is a group of rows that must not be split
+func (s Section) Tabular() bool {
+	return s.FirstRow > 0
+}
+
+// Result is the plain text of a document and the sections it consists of.
+// Plain text formats have no sections and are chunked as a whole.
+type Result struct {
+	Format    string
+	Text      string
+	Sections  []Section
+	PageCount int
+}
+
+// Extractor converts the raw bytes of a file into text
+type Extractor interface {
+	Extract(data []byte) (*Result, error)
+}
+
+var extractors = map[string]Extractor{}
+
+// Register makes an extractor available for the given file extensions
+func Register(extractor Extractor, extensions ...string) {
+	for _, ext := range extensions {
+		extractors[strings.ToLower(ext)] = extractor
+	}
+}
+
+func init() {
+	Register(TextExtractor{}, ".txt", ".text", ".md", ".markdown")
+	Register(PDFExtractor{}, ".pdf")
+	Register(DOCXExtractor{}, ".docx")
+	Register(HTMLExtractor{}, ".html", ".htm")
+	Register(CSVExtractor{}, ".csv", ".tsv")
+	Register(XLSXExtractor{}, ".xlsx")
+	Register(JSONExtractor{}, ".json")
+}
+
+// ForFile returns the extractor registered for the file's extension
+func ForFile(fileName string) (Extractor, bool) {
+	extractor, ok := extractors[strings.ToLower(filepath.Ext(fileName))]
+	return extractor, ok
+}
+
+// SupportedExtensions returns the registered file extensions in sorted order
+func SupportedExtensions() []string {
+	extensions := make([]string, 0, len(extractors))
+	for ext := range extractors {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// Extract extracts the text of a file using the extractor registered for its extension
+func Extract(fileName string, data []byte) (*Result, error) {
+	extractor, ok := ForFile(fileName)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type %q", filepath.Ext(fileName))
+	}
+
+	result, err := extractor.Extract(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(result.Text) == "" {
+		return nil, fmt.Errorf("no text could be extracted")
+	}
+
+	return result, nil
+}
+
+// newResult joins the sections into a single text, recording each section's offsets
+func newResult(format string, sections []Section) *Result {
+	result := &Result{Format: format}
+
+	var text strings.Builder
+	for _, section := range sections {
+		sectionText := strings.TrimSpace(sanitize(section.Text))
+		if sectionText == "" {
+			continue
+		}
+
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		section.Text = sectionText
+		section.Start = text.Len()
+		text.WriteString(sectionText)
+		section.End = text.Len()
+
+		result.Sections = append(result.Sections, section)
+	}
+	result.Text = text.String()
+
+	return result
+}
+
+// sanitize removes bytes PostgreSQL text columns do not accept
+func sanitize(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	return strings.ReplaceAll(text, "\x00", "")
+}
+
+// SectionsToMetadata converts sections to a JSON compatible value for document metadata
+func SectionsToMetadata(sections []Section) []interface{} {
+	var value []interface{}
+	data, _ := json.Marshal(sections)
+	_ = json.Unmarshal(data, &value)
+	return value
+}
+
+// SectionsFromMetadata reads the sections stored in document metadata
+func SectionsFromMetadata(metadata map[string]interface{}) []Section {
+	raw, ok := metadata["sections"]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+
+	var sections []Section
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil
+	}
+	return sections
+}
+
+// TextExtractor passes plain text and Markdown through unchanged
+type TextExtractor struct{}
+
+// Extract returns the file content as text without sections
+func (TextExtractor) Extract(data []byte) (*Result, error) {
+	return &Result{Format: "text", Text: sanitize(string(data))}, nil
+}
@@ -0,0 +1,111 @@
+package extraction
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipArchive builds an in-memory zip archive, such as an Office document, from file contents
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// sectionTexts returns the text of each section as it appears in the result text
+func sectionTexts(t *testing.T, result *Result) []string {
+	t.Helper()
+	var texts []string
+	for _, section := range result.Sections {
+		if section.Start < 0 || section.End > len(result.Text) || section.Start > section.End {
+			t.Fatalf("section offsets %d-%d are outside the text of length %d", section.Start, section.End, len(result.Text))
+		}
+		if got := result.Text[section.Start:section.End]; got != section.Text {
+			t.Fatalf("section text %q does not match its offsets, got %q", section.Text, got)
+		}
+		texts = append(texts, section.Text)
+	}
+	return texts
+}
+
+func TestTextExtractor(t *testing.T) {
+	result, err := TextExtractor{}.Extract([]byte("# Başlık\x00\n\nMetin \xff"))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.Format != "text" || len(result.Sections) != 0 {
+		t.Errorf("result = %+v, want text without sections", result)
+	}
+	if result.Text != "# Başlık\n\nMetin " {
+		t.Errorf("text = %q, want NUL bytes and invalid UTF-8 removed", result.Text)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     string
+		wantErr  string
+	}{
+		{name: "markdown", fileName: "notes.MD", data: "Hello"},
+		{name: "unsupported", fileName: "image.png", data: "\x89PNG", wantErr: "unsupported file type"},
+		{name: "no text", fileName: "empty.txt", data: " \n\t", wantErr: "no text could be extracted"},
+		{name: "extractor error", fileName: "broken.json", data: "{", wantErr: "failed to parse JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Extract(tt.fileName, []byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Extract() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if result.Text != tt.data {
+				t.Errorf("text = %q, want %q", result.Text, tt.data)
+			}
+		})
+	}
+}
+
+func TestSectionsMetadataRoundTrip(t *testing.T) {
+	sections := []Section{
+		{Text: "dropped", Start: 0, End: 7, Page: 2, Heading: "Intro"},
+		{Start: 9, End: 20, Sheet: "Data", FirstRow: 2, LastRow: 5},
+	}
+
+	got := SectionsFromMetadata(map[string]interface{}{"sections": SectionsToMetadata(sections)})
+	if len(got) != 2 {
+		t.Fatalf("got %d sections, want 2", len(got))
+	}
+	if got[0].Text != "" || got[0].Page != 2 || got[0].Heading != "Intro" || got[0].End != 7 {
+		t.Errorf("first section = %+v, want the location without text", got[0])
+	}
+	if !got[1].Tabular() || got[1].Sheet != "Data" || got[1].LastRow != 5 {
+		t.Errorf("second section = %+v, want the row range", got[1])
+	}
+
+	if SectionsFromMetadata(map[string]interface{}{}) != nil {
+		t.Error("SectionsFromMetadata() without sections should be nil")
+	}
+}
@@ -0,0 +1,206 @@
+package extraction
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLExtractor extracts the main content of an HTML page split by headings
+type HTMLExtractor struct{}
+
+// boilerplateElements never contain document content
+var boilerplateElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Iframe:   true,
+	atom.Svg:      true,
+	atom.Select:   true,
+}
+
+// boilerplateRoles are ARIA landmarks used for navigation and page chrome
+var boilerplateRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+}
+
+// blockElements end the current line of text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Br: true, atom.Li: true, atom.Ul: true, atom.Ol: true, atom.Tr: true, atom.Table: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Dd: true, atom.Dt: true, atom.Hr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// Extract returns one section per heading of the page's main content
+func (HTMLExtractor) Extract(data []byte) (*Result, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	// Prefer the main content area when the page marks one
+	content := findElement(root, atom.Main)
+	if content == nil {
+		content = findElement(root, atom.Article)
+	}
+	if content == nil {
+		content = findElement(root, atom.Body)
+	}
+	if content == nil {
+		content = root
+	}
+
+	extractor := &htmlWalker{}
+	extractor.walk(content)
+	extractor.flush()
+
+	return newResult("html", extractor.sections), nil
+}
+
+// htmlWalker collects text and starts a new section at every heading
+type htmlWalker struct {
+	sections []Section
+	heading  string
+	body     strings.Builder
+	line     strings.Builder
+}
+
+func (w *htmlWalker) walk(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(node.Data), " "); text != "" {
+			if line := w.line.String(); line != "" && !strings.HasSuffix(line, " ") {
+				w.line.WriteString(" ")
+			}
+			w.line.WriteString(text)
+		}
+		return
+	case html.ElementNode:
+		if isBoilerplate(node) {
+			return
+		}
+	case html.CommentNode:
+		return
+	}
+
+	if isHeading(node.DataAtom) {
+		w.endLine()
+		heading := strings.Join(strings.Fields(textContent(node)), " ")
+		if heading != "" {
+			w.flush()
+			w.heading = heading
+			w.body.WriteString(heading)
+			w.body.WriteString("\n")
+		}
+		return
+	}
+
+	if blockElements[node.DataAtom] {
+		w.endLine()
+		if node.DataAtom == atom.Li {
+			w.line.WriteString("- ")
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+		if child.DataAtom == atom.Td || child.DataAtom == atom.Th {
+			w.line.WriteString(" |")
+		}
+	}
+
+	if blockElements[node.DataAtom] {
+		w.endLine()
+	}
+}
+
+// endLine moves the current line into the section body
+func (w *htmlWalker) endLine() {
+	line := strings.TrimSuffix(strings.TrimSpace(w.line.String()), " |")
+	w.line.Reset()
+	if line == "" || line == "-" {
+		return
+	}
+	w.body.WriteString(line)
+	w.body.WriteString("\n")
+}
+
+// flush closes the current section
+func (w *htmlWalker) flush() {
+	w.endLine()
+	if strings.TrimSpace(w.body.String()) != "" {
+		w.sections = append(w.sections, Section{Text: w.body.String(), Heading: w.heading})
+	}
+	w.body.Reset()
+}
+
+// isBoilerplate reports whether an element holds navigation or page chrome
+func isBoilerplate(node *html.Node) bool {
+	if boilerplateElements[node.DataAtom] {
+		return true
+	}
+	for _, attr := range node.Attr {
+		switch attr.Key {
+		case "role":
+			if boilerplateRoles[attr.Val] {
+				return true
+			}
+		case "aria-hidden":
+			if attr.Val == "true" {
+				return true
+			}
+		case "hidden":
+			return true
+		}
+	}
+	return false
+}
+
+func isHeading(a atom.Atom) bool {
+	switch a {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+// findElement returns the first element of the given type in document order
+func findElement(node *html.Node, a atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == a {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent returns the concatenated text of a node and its children
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(textContent(child))
+		text.WriteString(" ")
+	}
+	return text.String()
+}
@@ -0,0 +1,71 @@
+package extraction
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHTMLExtractor(t *testing.T) {
+	tests := []struct {
+		name         string
+		html         string
+		wantTexts    []string
+		wantHeadings []string
+	}{
+		{
+			name: "sections by heading",
+			html: `<html><body>
+				<p>Giriş   metni</p>
+				<h1>Kurulum</h1><p>Adım <b>bir</b></p>
+				<h2>Ayarlar</h2><ul><li>Port</li><li>Host</li></ul>
+			</body></html>`,
+			wantTexts:    []string{"Giriş metni", "Kurulum\nAdım bir", "Ayarlar\n- Port\n- Host"},
+			wantHeadings: []string{"", "Kurulum", "Ayarlar"},
+		},
+		{
+			name: "main content without page chrome",
+			html: `<html><body>
+				<header>Site</header><nav><a href="/">Home</a></nav>
+				<main><h1>Title</h1><p>Body</p><div role="navigation">Menu</div><p hidden>Secret</p></main>
+				<footer>Copyright</footer><script>var x = 1</script>
+			</body></html>`,
+			wantTexts:    []string{"Title\nBody"},
+			wantHeadings: []string{"Title"},
+		},
+		{
+			name:         "tables",
+			html:         `<table><tr><th>Name</th><th>Port</th></tr><tr><td>api</td><td>8080</td></tr></table>`,
+			wantTexts:    []string{"Name | Port\napi | 8080"},
+			wantHeadings: []string{""},
+		},
+		{
+			name:         "empty headings do not start sections",
+			html:         `<article><h2> </h2><p>Text</p><!-- comment --></article>`,
+			wantTexts:    []string{"Text"},
+			wantHeadings: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := HTMLExtractor{}.Extract([]byte(tt.html))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if result.Format != "html" {
+				t.Errorf("format = %q, want html", result.Format)
+			}
+
+			if got := sectionTexts(t, result); !slices.Equal(got, tt.wantTexts) {
+				t.Errorf("sections = %q, want %q", got, tt.wantTexts)
+			}
+			var headings []string
+			for _, section := range result.Sections {
+				headings = append(headings, section.Heading)
+			}
+			if !slices.Equal(headings, tt.wantHeadings) {
+				t.Errorf("headings = %q, want %q", headings, tt.wantHeadings)
+			}
+		})
+	}
+}
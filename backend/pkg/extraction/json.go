@@ -0,0 +1,116 @@
+package extraction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// JSONExtractor flattens JSON documents into "path: value" lines
+type JSONExtractor struct{}
+
+// Extract returns one section per record for top level arrays and one
+// section per top level key for objects
+func (JSONExtractor) Extract(data []byte) (*Result, error) {
+	// Keep numbers as written instead of converting them to floats
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var sections []Section
+	switch v := value.(type) {
+	case []interface{}:
+		sections = recordSections(v)
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			var lines []string
+			flattenJSON(key, v[key], &lines)
+			sections = append(sections, Section{Text: strings.Join(lines, "\n"), Heading: key})
+		}
+	default:
+		var lines []string
+		flattenJSON("", v, &lines)
+		sections = append(sections, Section{Text: strings.Join(lines, "\n")})
+	}
+
+	return newResult("json", sections), nil
+}
+
+// recordSections groups array items into sections of about MaxSectionSize characters.
+// Rows are the one based positions of the items in the array.
+func recordSections(items []interface{}) []Section {
+	var sections []Section
+	var current *Section
+	var body strings.Builder
+
+	for i, item := range items {
+		var lines []string
+		flattenJSON("", item, &lines)
+		record := strings.Join(lines, "; ")
+		if record == "" {
+			continue
+		}
+
+		if current != nil && body.Len()+len(record) > MaxSectionSize {
+			current.Text = body.String()
+			sections = append(sections, *current)
+			current = nil
+			body.Reset()
+		}
+		if current == nil {
+			current = &Section{FirstRow: i + 1}
+		}
+
+		body.WriteString(record)
+		body.WriteString("\n")
+		current.LastRow = i + 1
+	}
+
+	if current != nil {
+		current.Text = body.String()
+		sections = append(sections, *current)
+	}
+
+	return sections
+}
+
+// flattenJSON appends a "path: value" line for every scalar in the value
+func flattenJSON(prefix string, value interface{}, lines *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenJSON(path, v[key], lines)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), item, lines)
+		}
+	case nil:
+		return
+	default:
+		if prefix == "" {
+			*lines = append(*lines, fmt.Sprint(v))
+			return
+		}
+		*lines = append(*lines, fmt.Sprintf("%s: %v", prefix, v))
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,97 @@
+package extraction
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJSONExtractor(t *testing.T) {
+	tests := []struct {
+		name         string
+		json         string
+		wantTexts    []string
+		wantHeadings []string
+		wantErr      bool
+	}{
+		{
+			name:         "object sections by top level key",
+			json:         `{"server": {"port": 8080, "hosts": ["a", "b"]}, "name": "sef", "empty": null}`,
+			wantTexts:    []string{"name: sef", "server.hosts[0]: a\nserver.hosts[1]: b\nserver.port: 8080"},
+			wantHeadings: []string{"name", "server"}, // Keys without values are left out
+		},
+		{
+			name:         "records",
+			json:         `[{"id": 1, "tags": ["x"]}, {}, {"id": 12345678901234567890}]`,
+			wantTexts:    []string{"id: 1; tags[0]: x\nid: 12345678901234567890"},
+			wantHeadings: []string{""},
+		},
+		{
+			name:         "scalar",
+			json:         `"plain text"`,
+			wantTexts:    []string{"plain text"},
+			wantHeadings: []string{""},
+		},
+		{
+			name:    "invalid",
+			json:    `{"a": `,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := JSONExtractor{}.Extract([]byte(tt.json))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Extract() error = nil, want a parse error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			if got := sectionTexts(t, result); !slices.Equal(got, tt.wantTexts) {
+				t.Errorf("sections = %q, want %q", got, tt.wantTexts)
+			}
+			var headings []string
+			for _, section := range result.Sections {
+				headings = append(headings, section.Heading)
+			}
+			if !slices.Equal(headings, tt.wantHeadings) {
+				t.Errorf("headings = %q, want %q", headings, tt.wantHeadings)
+			}
+		})
+	}
+}
+
+func TestJSONExtractorGroupsRecords(t *testing.T) {
+	var records []string
+	for i := range 40 {
+		records = append(records, fmt.Sprintf(`{"id": %d, "description": "a record that takes some room"}`, i))
+	}
+
+	result, err := JSONExtractor{}.Extract([]byte("[" + strings.Join(records, ",") + "]"))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if len(result.Sections) < 2 {
+		t.Fatalf("got %d sections, want records split into groups", len(result.Sections))
+	}
+
+	next := 1
+	for _, section := range result.Sections {
+		if section.FirstRow != next || section.LastRow < section.FirstRow {
+			t.Fatalf("section rows %d-%d, want to start at %d", section.FirstRow, section.LastRow, next)
+		}
+		if len(section.Text) > MaxSectionSize {
+			t.Errorf("section of %d characters is larger than %d", len(section.Text), MaxSectionSize)
+		}
+		next = section.LastRow + 1
+	}
+	if next != 41 {
+		t.Errorf("sections end at row %d, want 40", next-1)
+	}
+}
@@ -0,0 +1,49 @@
+package extraction
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFExtractor extracts the text of a PDF page by page
+type PDFExtractor struct{}
+
+// Extract returns one section per page with its page number
+func (PDFExtractor) Extract(data []byte) (*Result, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+
+	pageCount := reader.NumPage()
+	fonts := make(map[string]*pdf.Font)
+
+	var sections []Section
+	for i := 1; i <= pageCount; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		// Share parsed fonts between pages so charmaps are parsed once
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract text from page %d: %w", i, err)
+		}
+
+		sections = append(sections, Section{Text: text, Page: i})
+	}
+
+	result := newResult("pdf", sections)
+	result.PageCount = pageCount
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package extraction
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// simplePDF builds a PDF with one line of Helvetica text per page,
+// an empty string leaves the page without content
+func simplePDF(pages ...string) []byte {
+	var objects []string
+	kids := make([]string, len(pages))
+	for i, text := range pages {
+		pageID := 4 + 2*i
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+
+		stream := ""
+		if text != "" {
+			stream = fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /Font << /F1 3 0 R >> >> >>", pageID+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+	objects = append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}, objects...)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestPDFExtractor(t *testing.T) {
+	result, err := PDFExtractor{}.Extract(simplePDF("Introduction", "", "Installation guide"))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	if result.Format != "pdf" || result.PageCount != 3 {
+		t.Errorf("result = %s with %d pages, want pdf with 3 pages", result.Format, result.PageCount)
+	}
+
+	texts := sectionTexts(t, result)
+	if len(texts) != 2 {
+		t.Fatalf("sections = %q, want the two pages with text", texts)
+	}
+	if !strings.Contains(texts[0], "Introduction") || result.Sections[0].Page != 1 {
+		t.Errorf("first section = %q on page %d, want Introduction on page 1", texts[0], result.Sections[0].Page)
+	}
+	if !strings.Contains(texts[1], "Installation guide") || result.Sections[1].Page != 3 {
+		t.Errorf("second section = %q on page %d, want the guide on page 3", texts[1], result.Sections[1].Page)
+	}
+}
+
+func TestPDFExtractorInvalid(t *testing.T) {
+	if _, err := (PDFExtractor{}).Extract([]byte("not a pdf")); err == nil {
+		t.Error("Extract() of a non PDF file should fail")
+	}
+}
@@ -0,0 +1,297 @@
+package extraction
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CSVExtractor extracts CSV and TSV files row by row
+type CSVExtractor struct{}
+
+// Extract returns groups of rows, each repeating the header row
+func (CSVExtractor) Extract(data []byte) (*Result, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+
+	return newResult("csv", rowSections(rows, "")), nil
+}
+
+// detectDelimiter picks the most frequent delimiter on the first line
+func detectDelimiter(data []byte) rune {
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+
+	best, bestCount := ',', 0
+	for _, delimiter := range []rune{',', ';', '\t', '|'} {
+		if count := bytes.Count(firstLine, []byte(string(delimiter))); count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	return best
+}
+
+// rowSections groups rows into sections of about MaxSectionSize characters.
+// The first row is treated as the header and each row is rendered as
+// "column: value" pairs so every chunk is understandable on its own.
+// Row numbers match the spreadsheet, the header being row 1.
+func rowSections(rows [][]string, sheet string) []Section {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	header := rows[0]
+	headerLine := strings.Join(header, " | ")
+
+	var sections []Section
+	var current *Section
+	var body strings.Builder
+
+	flush := func() {
+		if current != nil {
+			current.Text = body.String()
+			sections = append(sections, *current)
+		}
+		current = nil
+		body.Reset()
+	}
+
+	for i, row := range rows[1:] {
+		line := formatRow(header, row)
+		if line == "" {
+			continue
+		}
+
+		rowNumber := i + 2
+		if current != nil && body.Len()+len(line) > MaxSectionSize {
+			flush()
+		}
+		if current == nil {
+			current = &Section{Heading: sheet, Sheet: sheet, FirstRow: rowNumber}
+			if sheet != "" {
+				body.WriteString(sheet)
+				body.WriteString("\n")
+			}
+			body.WriteString(headerLine)
+			body.WriteString("\n")
+		}
+
+		body.WriteString(line)
+		body.WriteString("\n")
+		current.LastRow = rowNumber
+	}
+	flush()
+
+	// A file with only a header row still carries text worth indexing
+	if len(sections) == 0 && strings.TrimSpace(headerLine) != "" {
+		sections = append(sections, Section{Text: headerLine, Heading: sheet, Sheet: sheet, FirstRow: 1, LastRow: 1})
+	}
+
+	return sections
+}
+
+// formatRow renders a row as "column: value" pairs, skipping empty cells
+func formatRow(header, row []string) string {
+	var parts []string
+	for i, value := range row {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		column := ""
+		if i < len(header) {
+			column = strings.TrimSpace(header[i])
+		}
+		if column == "" {
+			column = columnName(i)
+		}
+		parts = append(parts, column+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// columnName returns the spreadsheet letter of a zero based column index
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// XLSXExtractor extracts Excel workbooks sheet by sheet and row by row
+type XLSXExtractor struct{}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var text strings.Builder
+	for _, run := range t.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Extract returns groups of rows per sheet, each repeating the sheet's header row
+func (XLSXExtractor) Extract(data []byte) (*Result, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX: %w", err)
+	}
+
+	var workbook xlsxWorkbook
+	if err := readZipXML(archive, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+
+	var relationships xlsxRelationships
+	if err := readZipXML(archive, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range relationships.Relationships {
+		target := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(target, "xl/") {
+			target = path.Join("xl", target)
+		}
+		targets[rel.ID] = target
+	}
+
+	// Workbooks without any text cells have no shared strings part
+	var sharedStrings xlsxSharedStrings
+	if _, err := archive.Open("xl/sharedStrings.xml"); err == nil {
+		if err := readZipXML(archive, "xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	var sections []Section
+	for _, sheetRef := range workbook.Sheets {
+		target, ok := targets[sheetRef.ID]
+		if !ok {
+			continue
+		}
+
+		var sheet xlsxSheet
+		if err := readZipXML(archive, target, &sheet); err != nil {
+			return nil, err
+		}
+
+		var rows [][]string
+		for _, row := range sheet.Rows {
+			var values []string
+			for i, cell := range row.Cells {
+				column := i
+				if ref := cellColumn(cell.Ref); ref >= 0 {
+					column = ref
+				}
+				for len(values) <= column {
+					values = append(values, "")
+				}
+
+				switch cell.Type {
+				case "s":
+					if index, err := strconv.Atoi(cell.Value); err == nil && index < len(sharedStrings.Items) {
+						values[column] = sharedStrings.Items[index].String()
+					}
+				case "inlineStr":
+					values[column] = cell.Inline.String()
+				case "b":
+					values[column] = map[string]string{"0": "FALSE", "1": "TRUE"}[cell.Value]
+				default:
+					values[column] = cell.Value
+				}
+			}
+			rows = append(rows, values)
+		}
+
+		sections = append(sections, rowSections(rows, sheetRef.Name)...)
+	}
+
+	return newResult("xlsx", sections), nil
+}
+
+// cellColumn returns the zero based column index of a cell reference like "C12"
+func cellColumn(ref string) int {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+	return column - 1
+}
+
+// readZipXML decodes an XML file from a zip archive
+func readZipXML(archive *zip.Reader, name string, v interface{}) error {
+	data, err := readZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
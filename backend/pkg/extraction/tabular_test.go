@@ -0,0 +1,143 @@
+package extraction
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCSVExtractor(t *testing.T) {
+	tests := []struct {
+		name      string
+		csv       string
+		wantTexts []string
+		wantRows  [][2]int
+	}{
+		{
+			name:      "comma separated with BOM",
+			csv:       "\xef\xbb\xbfname,port\napi,8080\n,\nworker,\n",
+			wantTexts: []string{"name | port\nname: api; port: 8080\nname: worker"},
+			wantRows:  [][2]int{{2, 4}},
+		},
+		{
+			name:      "semicolon separated with quotes",
+			csv:       "ad;açıklama\n\"Ankara\";\"başkent; büyük şehir\"\n",
+			wantTexts: []string{"ad | açıklama\nad: Ankara; açıklama: başkent; büyük şehir"},
+			wantRows:  [][2]int{{2, 2}},
+		},
+		{
+			name:      "tab separated with missing header columns",
+			csv:       "id\tname\n1\tone\textra\n",
+			wantTexts: []string{"id | name\nid: 1; name: one; C: extra"},
+			wantRows:  [][2]int{{2, 2}},
+		},
+		{
+			name:      "header only",
+			csv:       "name,port\n",
+			wantTexts: []string{"name | port"},
+			wantRows:  [][2]int{{1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CSVExtractor{}.Extract([]byte(tt.csv))
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			if got := sectionTexts(t, result); !slices.Equal(got, tt.wantTexts) {
+				t.Errorf("sections = %q, want %q", got, tt.wantTexts)
+			}
+			var rows [][2]int
+			for _, section := range result.Sections {
+				rows = append(rows, [2]int{section.FirstRow, section.LastRow})
+			}
+			if !slices.Equal(rows, tt.wantRows) {
+				t.Errorf("rows = %v, want %v", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestCSVExtractorGroupsRows(t *testing.T) {
+	csv := "id,description\n"
+	for i := range 50 {
+		csv += fmt.Sprintf("%d,a row that takes some room in the section\n", i)
+	}
+
+	result, err := CSVExtractor{}.Extract([]byte(csv))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if len(result.Sections) < 2 {
+		t.Fatalf("got %d sections, want rows split into groups", len(result.Sections))
+	}
+	for _, section := range result.Sections {
+		if !strings.HasPrefix(section.Text, "id | description\n") {
+			t.Errorf("section %q does not repeat the header", section.Text)
+		}
+	}
+	if last := result.Sections[len(result.Sections)-1]; last.LastRow != 51 {
+		t.Errorf("last row = %d, want 51", last.LastRow)
+	}
+}
+
+func TestXLSXExtractor(t *testing.T) {
+	data := zipArchive(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Sunucular" r:id="rId1"/><sheet name="Boş" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Ad</t></si><si><t>Port</t></si><si><r><t>api</t></r><r><t>-gw</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+			<row><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="D1" t="inlineStr"><is><t>Aktif</t></is></c></row>
+			<row><c r="A2" t="s"><v>2</v></c><c r="B2"><v>8080</v></c><c r="D2" t="b"><v>1</v></c></row>
+		</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData/></worksheet>`,
+	})
+
+	result, err := XLSXExtractor{}.Extract(data)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	want := []string{"Sunucular\nAd | Port |  | Aktif\nAd: api-gw; Port: 8080; Aktif: TRUE"}
+	if got := sectionTexts(t, result); !slices.Equal(got, want) {
+		t.Fatalf("sections = %q, want %q", got, want)
+	}
+	if section := result.Sections[0]; section.Sheet != "Sunucular" || section.FirstRow != 2 || section.LastRow != 2 {
+		t.Errorf("section = %+v, want sheet Sunucular row 2", section)
+	}
+}
+
+func TestXLSXExtractorErrors(t *testing.T) {
+	if _, err := (XLSXExtractor{}).Extract([]byte("not a zip")); err == nil {
+		t.Error("Extract() of a non zip file should fail")
+	}
+
+	missing := zipArchive(t, map[string]string{"xl/workbook.xml": `<workbook/>`})
+	if _, err := (XLSXExtractor{}).Extract(missing); err == nil || !strings.Contains(err.Error(), "workbook.xml.rels") {
+		t.Errorf("Extract() error = %v, want the missing relationships", err)
+	}
+}
+
+func TestCellColumn(t *testing.T) {
+	tests := map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AA1": 26, "AB7": 27, "12": -1, "": -1}
+	for ref, want := range tests {
+		if got := cellColumn(ref); got != want {
+			t.Errorf("cellColumn(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Nerzal/gocloak/v13"
 	"github.com/golang-jwt/jwt/v5"
@@ -18,6 +20,20 @@ type Client struct {
 	clientID     string
 	clientSecret string
 	redirectURL  string
+
+	// Service account token and internal client ID used for admin API requests
+	adminMu        sync.Mutex
+	adminToken     string
+	adminExpiresAt time.Time
+	clientUUID     string
+}
+
+// Account is the current state of a user as Keycloak reports it to the admin API
+type Account struct {
+	Enabled     bool
+	Roles       []string // Realm and client roles, like GetUserRoles
+	ClientRoles []string // Roles of this client, like GetClientRoles
+	Groups      []string // Full group paths, like GetUserGroups
 }
 
 // UserInfo represents the user information from Keycloak
@@ -114,9 +130,43 @@ func (c *Client) VerifyToken(ctx context.Context, accessToken string) (*UserInfo
 	return &user, nil
 }
 
-// GetUserRoles retrieves the roles assigned to a user from the token
+// GetUserRoles extracts the realm and client roles from the token
 func (c *Client) GetUserRoles(accessToken string) ([]string, error) {
-	// Parse the token without verification (we already verified it)
+	claims, err := parseClaims(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract realm roles
+	var roles []string
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		roles = append(roles, claimStrings(realmAccess["roles"])...)
+	}
+
+	return append(roles, c.clientRoles(claims)...), nil
+}
+
+// GetClientRoles extracts only the roles of this client from the token
+func (c *Client) GetClientRoles(accessToken string) ([]string, error) {
+	claims, err := parseClaims(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.clientRoles(claims), nil
+}
+
+func (c *Client) clientRoles(claims jwt.MapClaims) []string {
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		if clientAccess, ok := resourceAccess[c.clientID].(map[string]interface{}); ok {
+			return claimStrings(clientAccess["roles"])
+		}
+	}
+	return nil
+}
+
+// parseClaims reads the claims of an already verified token
+func parseClaims(accessToken string) (jwt.MapClaims, error) {
 	token, _, err := jwt.NewParser().ParseUnverified(accessToken, jwt.MapClaims{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -126,33 +176,39 @@ func (c *Client) GetUserRoles(accessToken string) ([]string, error) {
 	if !ok {
 		return nil, fmt.Errorf("invalid token claims")
 	}
+	return claims, nil
+}
 
-	// Extract realm roles
-	var roles []string
-	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
-		if realmRoles, ok := realmAccess["roles"].([]interface{}); ok {
-			for _, role := range realmRoles {
-				if roleStr, ok := role.(string); ok {
-					roles = append(roles, roleStr)
-				}
+// claimStrings returns the strings of a list claim
+func claimStrings(claim interface{}) []string {
+	var values []string
+	if items, ok := claim.([]interface{}); ok {
+		for _, item := range items {
+			if value, ok := item.(string); ok {
+				values = append(values, value)
 			}
 		}
 	}
+	return values
+}
 
-	// Extract client roles
-	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
-		if clientAccess, ok := resourceAccess[c.clientID].(map[string]interface{}); ok {
-			if clientRoles, ok := clientAccess["roles"].([]interface{}); ok {
-				for _, role := range clientRoles {
-					if roleStr, ok := role.(string); ok {
-						roles = append(roles, roleStr)
-					}
-				}
-			}
+// GetUserGroups extracts the group memberships from the token's groups claim,
+// which needs a group membership mapper on the client. Full group paths are
+// returned without their leading slash.
+func (c *Client) GetUserGroups(accessToken string) ([]string, error) {
+	claims, err := parseClaims(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+	for _, group := range claimStrings(claims["groups"]) {
+		if group = strings.Trim(group, "/"); group != "" {
+			groups = append(groups, group)
 		}
 	}
 
-	return roles, nil
+	return groups, nil
 }
 
 // HasRole checks if a user has a specific role
@@ -174,3 +230,88 @@ func (c *Client) HasRole(accessToken, roleName string) bool {
 func (c *Client) Logout(ctx context.Context, refreshToken string) error {
 	return c.gocloak.Logout(ctx, c.clientID, c.clientSecret, c.realm, refreshToken)
 }
+
+// adminAccess returns a service account token of this client and the client's
+// internal ID, the token is reused until shortly before it expires
+func (c *Client) adminAccess(ctx context.Context) (string, string, error) {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+
+	if c.adminToken == "" || time.Now().After(c.adminExpiresAt) {
+		token, err := c.gocloak.LoginClient(ctx, c.clientID, c.clientSecret, c.realm)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to sign in with the client's service account: %w", err)
+		}
+		c.adminToken = token.AccessToken
+		c.adminExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 10*time.Second)
+	}
+
+	if c.clientUUID == "" {
+		clients, err := c.gocloak.GetClients(ctx, c.adminToken, c.realm, gocloak.GetClientsParams{ClientID: &c.clientID})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to look up client: %w", err)
+		}
+		if len(clients) == 0 || clients[0].ID == nil {
+			return "", "", fmt.Errorf("client %s not found", c.clientID)
+		}
+		c.clientUUID = *clients[0].ID
+	}
+
+	return c.adminToken, c.clientUUID, nil
+}
+
+// GetAccount reads whether a user is enabled and its effective roles and groups
+// with the admin API. The client's service account needs the view-users and
+// view-clients roles of realm-management.
+func (c *Client) GetAccount(ctx context.Context, userID string) (*Account, error) {
+	token, clientUUID, err := c.adminAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := c.gocloak.GetUserByID(ctx, token, c.realm, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	account := &Account{Enabled: user.Enabled != nil && *user.Enabled}
+	if !account.Enabled {
+		return account, nil
+	}
+
+	realmRoles, err := c.gocloak.GetCompositeRealmRolesByUserID(ctx, token, c.realm, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get realm roles: %w", err)
+	}
+	clientRoles, err := c.gocloak.GetCompositeClientRolesByUserID(ctx, token, c.realm, clientUUID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client roles: %w", err)
+	}
+	groups, err := c.gocloak.GetUserGroups(ctx, token, c.realm, userID, gocloak.GetGroupsParams{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	account.ClientRoles = roleNames(clientRoles)
+	account.Roles = append(roleNames(realmRoles), account.ClientRoles...)
+	for _, group := range groups {
+		if group.Path == nil {
+			continue
+		}
+		if path := strings.Trim(*group.Path, "/"); path != "" {
+			account.Groups = append(account.Groups, path)
+		}
+	}
+
+	return account, nil
+}
+
+// roleNames returns the names of roles
+func roleNames(roles []*gocloak.Role) []string {
+	var names []string
+	for _, role := range roles {
+		if role.Name != nil {
+			names = append(names, *role.Name)
+		}
+	}
+	return names
+}
@@ -59,9 +59,19 @@ type EmbeddingResponse struct {
 
 // GenerateEmbedding generates an embedding vector for the given text
 func (c *LiteLLMClient) GenerateEmbedding(ctx context.Context, model string, text string) ([]float32, error) {
+	embeddings, err := c.GenerateEmbeddings(ctx, model, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddings generates embedding vectors for several texts in one request
+func (c *LiteLLMClient) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
 	req := EmbeddingRequest{
 		Model: model,
-		Input: []string{text},
+		Input: texts,
 	}
 
 	reqBody, err := json.Marshal(req)
@@ -106,11 +116,20 @@ func (c *LiteLLMClient) GenerateEmbedding(ctx context.Context, model string, tex
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if len(embeddingResp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data returned from LiteLLM")
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings from LiteLLM, got %d", len(texts), len(embeddingResp.Data))
+	}
+
+	// Results carry the index of their input and are not guaranteed to be in order
+	embeddings := make([][]float32, len(texts))
+	for _, data := range embeddingResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
 	}
 
-	return embeddingResp.Data[0].Embedding, nil
+	return embeddings, nil
 }
 
 // ChatCompletionRequest represents a request for chat completion
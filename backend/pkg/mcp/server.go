@@ -0,0 +1,261 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sef/app/entities"
+	"sef/pkg/providers"
+	"sef/pkg/toolrunners"
+	"slices"
+
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// LatestProtocolVersion is the newest Model Context Protocol revision the server speaks
+const LatestProtocolVersion = "2025-06-18"
+
+// supportedProtocolVersions are accepted from clients, other versions get the latest
+var supportedProtocolVersions = []string{LatestProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Server answers Model Context Protocol requests over a set of tools.
+// It keeps no state between requests, every request lists and runs the
+// tools it was created with.
+type Server struct {
+	Name         string
+	Instructions string
+	Tools        []entities.Tool
+	Definitions  []providers.ToolDefinition // JSON schemas of Tools, in the same order
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type tool struct {
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError"`
+}
+
+// Handle answers a JSON-RPC message or batch. It returns nil when there is
+// nothing to answer, i.e. the body only held notifications.
+func (s *Server) Handle(ctx context.Context, body []byte) interface{} {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			return errorResponse(nil, codeParseError, "invalid JSON-RPC batch")
+		}
+
+		var responses []*response
+		for _, message := range batch {
+			if res := s.handleMessage(ctx, message); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return responses
+	}
+
+	if res := s.handleMessage(ctx, body); res != nil {
+		return res
+	}
+	return nil
+}
+
+// handleMessage answers a single JSON-RPC message, notifications get no answer
+func (s *Server) handleMessage(ctx context.Context, message []byte) *response {
+	var req request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return errorResponse(nil, codeParseError, "invalid JSON")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, codeInvalidRequest, "invalid JSON-RPC request")
+	}
+
+	// Notifications such as notifications/initialized need no answer
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	switch req.Method {
+	case "initialize":
+		return resultResponse(req.ID, s.initialize(req.Params))
+	case "ping":
+		return resultResponse(req.ID, struct{}{})
+	case "tools/list":
+		return resultResponse(req.ID, s.listTools())
+	case "tools/call":
+		result, rpcErr := s.callTool(ctx, req.Params)
+		if rpcErr != nil {
+			return &response{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+		}
+		return resultResponse(req.ID, result)
+	default:
+		return errorResponse(req.ID, codeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+}
+
+// initialize negotiates the protocol version and describes the server
+func (s *Server) initialize(params json.RawMessage) map[string]interface{} {
+	var req struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(params, &req)
+
+	version := LatestProtocolVersion
+	if slices.Contains(supportedProtocolVersions, req.ProtocolVersion) {
+		version = req.ProtocolVersion
+	}
+
+	result := map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities": map[string]interface{}{
+			"tools": map[string]interface{}{"listChanged": false},
+		},
+		"serverInfo": map[string]interface{}{
+			"name":    "sef",
+			"title":   s.Name,
+			"version": "1.0.0",
+		},
+	}
+	if s.Instructions != "" {
+		result["instructions"] = s.Instructions
+	}
+	return result
+}
+
+// listTools returns every tool of the server, there is no pagination
+func (s *Server) listTools() map[string]interface{} {
+	tools := make([]tool, 0, len(s.Tools))
+	for i, t := range s.Tools {
+		schema := map[string]interface{}{"type": "object"}
+		if i < len(s.Definitions) && s.Definitions[i].Function.Parameters != nil {
+			schema = s.Definitions[i].Function.Parameters
+		}
+		tools = append(tools, tool{
+			Name:        t.Name,
+			Title:       t.DisplayName,
+			Description: t.Description,
+			InputSchema: schema,
+		})
+	}
+	return map[string]interface{}{"tools": tools}
+}
+
+// callTool runs a tool with its runner. Failures of the tool itself are
+// reported in the result so the model can read them.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (*toolResult, *rpcError) {
+	var req struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid tool call parameters"}
+	}
+
+	index := slices.IndexFunc(s.Tools, func(t entities.Tool) bool { return t.Name == req.Name })
+	if index < 0 {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", req.Name)}
+	}
+	t := s.Tools[index]
+	if req.Arguments == nil {
+		req.Arguments = map[string]interface{}{}
+	}
+
+	factory := &toolrunners.ToolRunnerFactory{}
+	runner, err := factory.NewToolRunner(t.Type, t.Config, t.Parameters)
+	if err != nil {
+		return nil, &rpcError{Code: codeInternalError, Message: fmt.Sprintf("failed to create tool runner: %v", err)}
+	}
+
+	if err := runner.ValidateParameters(req.Arguments); err != nil {
+		return errorResult(fmt.Sprintf("Invalid arguments for %s: %v", t.Name, err)), nil
+	}
+
+	log.Info("Running MCP tool call:", t.Name)
+	result, err := runner.ExecuteWithContext(ctx, req.Arguments, &toolrunners.ToolCallContext{
+		ToolCallID:   providers.NewToolCallID(),
+		FunctionName: t.Name,
+		ToolName:     t.Name,
+		Metadata: map[string]interface{}{
+			"tool_type":        t.Type,
+			"tool_id":          t.ID,
+			"tool_description": t.Description,
+			"source":           "mcp",
+		},
+	})
+	if err != nil {
+		log.Error("MCP tool call failed:", t.Name, err)
+		return errorResult(fmt.Sprintf("Tool %s failed: %v", t.Name, err)), nil
+	}
+
+	text, ok := result.(string)
+	if !ok {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: fmt.Sprintf("failed to marshal tool result: %v", err)}
+		}
+		text = string(resultJSON)
+	}
+
+	return &toolResult{Content: []content{{Type: "text", Text: text}}}, nil
+}
+
+// errorResult creates a tool result reporting a failure
+func errorResult(message string) *toolResult {
+	return &toolResult{Content: []content{{Type: "text", Text: message}}, IsError: true}
+}
+
+// resultResponse creates a successful JSON-RPC response
+func resultResponse(id json.RawMessage, result interface{}) *response {
+	return &response{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+// errorResponse creates a JSON-RPC error response, requests that could not be
+// parsed are answered with a null ID
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sef/app/entities"
+	"sef/pkg/providers"
+	"strings"
+	"testing"
+)
+
+// reply is a decoded JSON-RPC response
+type reply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *rpcError       `json:"error"`
+}
+
+// testServer serves a tool with a schema and a tool without one
+func testServer() *Server {
+	return &Server{
+		Name:         "Support",
+		Instructions: "Answers support questions",
+		Tools: []entities.Tool{
+			{Name: "lookup_order", DisplayName: "Order lookup", Description: "Finds an order", Type: "api"},
+			{Name: "broken", Type: "unknown"},
+		},
+		Definitions: []providers.ToolDefinition{
+			{Function: providers.ToolFunction{
+				Name:       "lookup_order",
+				Parameters: map[string]interface{}{"type": "object", "required": []interface{}{"id"}},
+			}},
+		},
+	}
+}
+
+// handle sends a body to the server and decodes what it answers, nil when
+// it answers nothing
+func handle(t *testing.T, s *Server, body string) []reply {
+	t.Helper()
+
+	answer := s.Handle(context.Background(), []byte(body))
+	if answer == nil {
+		return nil
+	}
+	data, err := json.Marshal(answer)
+	if err != nil {
+		t.Fatalf("failed to marshal answer: %v", err)
+	}
+
+	var replies []reply
+	if strings.HasPrefix(string(data), "[") {
+		err = json.Unmarshal(data, &replies)
+	} else {
+		replies = make([]reply, 1)
+		err = json.Unmarshal(data, &replies[0])
+	}
+	if err != nil {
+		t.Fatalf("failed to decode answer %s: %v", data, err)
+	}
+	return replies
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantID   string
+		wantCode int
+	}{
+		{name: "parse error", body: `{"jsonrpc": "2.0", "id": 1,`, wantID: "null", wantCode: codeParseError},
+		{name: "invalid batch", body: `[{"jsonrpc": "2.0"`, wantID: "null", wantCode: codeParseError},
+		{name: "empty batch", body: `[]`, wantID: "null", wantCode: codeParseError},
+		{name: "wrong version", body: `{"jsonrpc": "1.0", "id": 2, "method": "ping"}`, wantID: "2", wantCode: codeInvalidRequest},
+		{name: "missing method", body: `{"jsonrpc": "2.0", "id": "a"}`, wantID: `"a"`, wantCode: codeInvalidRequest},
+		{name: "method not found", body: `{"jsonrpc": "2.0", "id": 3, "method": "resources/list"}`, wantID: "3", wantCode: codeMethodNotFound},
+		{name: "unknown tool", body: `{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "missing"}}`, wantID: "4", wantCode: codeInvalidParams},
+		{name: "invalid call parameters", body: `{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": []}`, wantID: "5", wantCode: codeInvalidParams},
+		{name: "unsupported tool type", body: `{"jsonrpc": "2.0", "id": 6, "method": "tools/call", "params": {"name": "broken"}}`, wantID: "6", wantCode: codeInternalError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := handle(t, testServer(), tt.body)
+			if len(replies) != 1 {
+				t.Fatalf("got %d replies, want 1", len(replies))
+			}
+			r := replies[0]
+			if r.JSONRPC != "2.0" || string(r.ID) != tt.wantID {
+				t.Errorf("reply %s with ID %s, want 2.0 with ID %s", r.JSONRPC, r.ID, tt.wantID)
+			}
+			if r.Error == nil || r.Error.Code != tt.wantCode {
+				t.Errorf("error = %+v, want code %d", r.Error, tt.wantCode)
+			}
+			if r.Result != nil {
+				t.Errorf("result = %s, want none with an error", r.Result)
+			}
+		})
+	}
+}
+
+func TestHandleInitialize(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		wantVersion string
+	}{
+		{name: "latest version", version: LatestProtocolVersion, wantVersion: LatestProtocolVersion},
+		{name: "older supported version", version: "2024-11-05", wantVersion: "2024-11-05"},
+		{name: "unknown version gets the latest", version: "2099-01-01", wantVersion: LatestProtocolVersion},
+		{name: "no version gets the latest", version: "", wantVersion: LatestProtocolVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "` + tt.version + `"}}`
+			replies := handle(t, testServer(), body)
+			if len(replies) != 1 || replies[0].Error != nil {
+				t.Fatalf("replies = %+v, want one result", replies)
+			}
+
+			var result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+				Capabilities    struct {
+					Tools map[string]bool `json:"tools"`
+				} `json:"capabilities"`
+				ServerInfo   map[string]string `json:"serverInfo"`
+				Instructions string            `json:"instructions"`
+			}
+			if err := json.Unmarshal(replies[0].Result, &result); err != nil {
+				t.Fatalf("failed to decode result: %v", err)
+			}
+			if result.ProtocolVersion != tt.wantVersion {
+				t.Errorf("protocol version = %q, want %q", result.ProtocolVersion, tt.wantVersion)
+			}
+			if _, ok := result.Capabilities.Tools["listChanged"]; !ok {
+				t.Errorf("capabilities = %+v, want tools", result.Capabilities)
+			}
+			if result.ServerInfo["title"] != "Support" || result.Instructions != "Answers support questions" {
+				t.Errorf("server info = %v, instructions = %q", result.ServerInfo, result.Instructions)
+			}
+		})
+	}
+}
+
+func TestHandlePing(t *testing.T) {
+	replies := handle(t, testServer(), `{"jsonrpc": "2.0", "id": "p", "method": "ping"}`)
+	if len(replies) != 1 || replies[0].Error != nil || string(replies[0].Result) != "{}" || string(replies[0].ID) != `"p"` {
+		t.Errorf("replies = %+v, want an empty result for ID p", replies)
+	}
+}
+
+func TestHandleToolsList(t *testing.T) {
+	replies := handle(t, testServer(), `{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`)
+	if len(replies) != 1 || replies[0].Error != nil {
+		t.Fatalf("replies = %+v, want one result", replies)
+	}
+
+	var result struct {
+		Tools []tool `json:"tools"`
+	}
+	if err := json.Unmarshal(replies[0].Result, &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if len(result.Tools) != 2 {
+		t.Fatalf("got %d tools, want 2", len(result.Tools))
+	}
+
+	lookup := result.Tools[0]
+	if lookup.Name != "lookup_order" || lookup.Title != "Order lookup" || lookup.Description != "Finds an order" {
+		t.Errorf("tool = %+v, want the order lookup", lookup)
+	}
+	if _, ok := lookup.InputSchema["required"]; !ok {
+		t.Errorf("input schema = %v, want the tool definition's parameters", lookup.InputSchema)
+	}
+	if schema := result.Tools[1].InputSchema; len(schema) != 1 || schema["type"] != "object" {
+		t.Errorf("input schema without definition = %v, want an empty object schema", schema)
+	}
+}
+
+func TestHandleNotifications(t *testing.T) {
+	bodies := []string{
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "method": "tools/call", "params": {"name": "missing"}}`,
+		`[{"jsonrpc": "2.0", "method": "notifications/initialized"}, {"jsonrpc": "2.0", "method": "notifications/cancelled"}]`,
+	}
+	for _, body := range bodies {
+		if replies := handle(t, testServer(), body); replies != nil {
+			t.Errorf("Handle(%s) = %+v, want no answer", body, replies)
+		}
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	body := `[
+		{"jsonrpc": "2.0", "id": 1, "method": "ping"},
+		{"jsonrpc": "2.0", "method": "notifications/initialized"},
+		{"jsonrpc": "2.0", "id": 2, "method": "unknown"},
+		"not a request"
+	]`
+	replies := handle(t, testServer(), body)
+	if len(replies) != 3 {
+		t.Fatalf("got %d replies, want one per request that is not a notification", len(replies))
+	}
+
+	if string(replies[0].ID) != "1" || replies[0].Error != nil {
+		t.Errorf("first reply = %+v, want the ping result", replies[0])
+	}
+	if string(replies[1].ID) != "2" || replies[1].Error == nil || replies[1].Error.Code != codeMethodNotFound {
+		t.Errorf("second reply = %+v, want method not found", replies[1])
+	}
+	if string(replies[2].ID) != "null" || replies[2].Error == nil || replies[2].Error.Code != codeParseError {
+		t.Errorf("third reply = %+v, want a parse error", replies[2])
+	}
+}
@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// sessionIDHeader carries the session of a streamable HTTP connection
+const sessionIDHeader = "Mcp-Session-Id"
+
+// RunStdio serves MCP over stdin and stdout for clients that start servers as
+// subprocesses. Messages are relayed to a streamable HTTP endpoint of a sef
+// server, so tools are listed and run with the permissions of the API token.
+//
+//	main mcp -url https://sef.example.com/mcp/chatbots/1 -token sef_...
+//
+// The URL and token default to the SEF_MCP_URL and SEF_TOKEN environment variables.
+func RunStdio(args []string) error {
+	flags := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	endpoint := flags.String("url", os.Getenv("SEF_MCP_URL"), "MCP endpoint of a chatbot or tool category")
+	token := flags.String("token", os.Getenv("SEF_TOKEN"), "personal access token or service account token")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *endpoint == "" {
+		return errors.New("the MCP endpoint URL is required, set -url or SEF_MCP_URL")
+	}
+	if *token == "" {
+		return errors.New("an API token is required, set -token or SEF_TOKEN")
+	}
+
+	return Bridge(context.Background(), *endpoint, *token, os.Stdin, os.Stdout)
+}
+
+// Bridge relays newline delimited JSON-RPC messages from in to a streamable
+// HTTP endpoint and writes the answers to out until in is closed
+func Bridge(ctx context.Context, endpoint string, token string, in io.Reader, out io.Writer) error {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	sessionID := ""
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		message := bytes.TrimSpace(scanner.Bytes())
+		if len(message) == 0 {
+			continue
+		}
+
+		answer, err := relay(ctx, client, endpoint, token, &sessionID, message)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "MCP request failed:", err)
+			answer = relayError(message, err)
+		}
+		if len(answer) == 0 {
+			continue
+		}
+
+		if _, err := out.Write(append(answer, '\n')); err != nil {
+			return fmt.Errorf("failed to write MCP response: %w", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// relay sends one message to the endpoint and returns its JSON answer, which is
+// empty for notifications
+func relay(ctx context.Context, client *http.Client, endpoint string, token string, sessionID *string, message []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if *sessionID != "" {
+		req.Header.Set(sessionIDHeader, *sessionID)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(sessionIDHeader); id != "" {
+		*sessionID = id
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		return nil, nil
+	}
+	// Authentication and routing errors are not JSON-RPC answers
+	if resp.StatusCode >= 400 && !bytes.Contains(body, []byte(`"jsonrpc"`)) {
+		return nil, fmt.Errorf("server responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// Servers may answer with a single event stream instead of JSON
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var data [][]byte
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+				data = append(data, bytes.TrimSpace(payload))
+			}
+		}
+		return bytes.Join(data, []byte("\n")), nil
+	}
+
+	return bytes.TrimSpace(body), nil
+}
+
+// relayError answers a request that could not be relayed, notifications are dropped
+func relayError(message []byte, err error) []byte {
+	var req struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(message, &req) != nil || len(req.ID) == 0 {
+		return nil
+	}
+
+	answer, _ := json.Marshal(errorResponse(req.ID, codeInternalError, err.Error()))
+	return answer
+}
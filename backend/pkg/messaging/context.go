@@ -0,0 +1,130 @@
+package messaging
+
+import (
+	"sef/app/entities"
+	"sef/pkg/providers"
+	"sef/pkg/tokenizer"
+
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// historyBudget returns how many tokens of history fit next to the given messages,
+// a quarter of the context window is left for the answer
+func (s *MessagingService) historyBudget(session *entities.Session, fixed []providers.ChatMessage) int {
+	maxContext := session.Chatbot.GetMaxContextTokens()
+	toolFormat := session.Chatbot.ToolFormat
+	if toolFormat == "" {
+		toolFormat = "json"
+	}
+
+	budget := maxContext - maxContext/4 -
+		tokenizer.EstimateMessages(fixed) -
+		tokenizer.EstimateTools(s.ConvertToolsToDefinitions(session.Chatbot.Tools, toolFormat))
+	return max(budget, 0)
+}
+
+// fitHistory returns the rolling summary and the newest turns of the branch that fit in the budget.
+// When the turns after the current summary do not fit anymore, the older ones are folded into
+// a new summary and only the turns within half of the budget are kept, so the summary is not
+// rebuilt on every message. Without a summary service older turns are dropped.
+func (s *MessagingService) fitHistory(session *entities.Session, branch []entities.Message, budget int) (string, []entities.Message) {
+	turns := splitTurns(branch)
+
+	// Continue after the newest summary that covers a prefix of this branch
+	var current *entities.ContextSummary
+	start := 0
+	if s.SummaryService != nil {
+		summaries, err := s.SummaryService.ContextSummaries(session.ID)
+		if err != nil {
+			log.Warn("Failed to load context summaries:", err)
+		}
+
+		turnEnds := make(map[uint]int)
+		for i, turn := range turns {
+			turnEnds[lastTurnMessageID(turn)] = i
+		}
+		for i := range summaries {
+			if index, ok := turnEnds[summaries[i].UpToMessageID]; ok {
+				current = &summaries[i]
+				start = index + 1
+				break
+			}
+		}
+	}
+
+	summaryText := ""
+	if current != nil {
+		summaryText = current.Content
+	}
+
+	remaining := turns[start:]
+	used := tokenizer.EstimateTokens(summaryText)
+	for _, turn := range remaining {
+		used += estimateTurn(turn)
+	}
+	if used <= budget {
+		return summaryText, flattenTurns(remaining)
+	}
+
+	keep := len(remaining)
+	kept := 0
+	for keep > 0 {
+		tokens := estimateTurn(remaining[keep-1])
+		if kept+tokens > budget/2 {
+			break
+		}
+		kept += tokens
+		keep--
+	}
+
+	older := remaining[:keep]
+	log.Info("Context window of session", session.ID, "exceeded, summarizing", len(older), "older turns")
+
+	if s.SummaryService != nil && len(older) > 0 {
+		updated, err := s.SummaryService.UpdateContextSummary(session, current, flattenTurns(older))
+		if err != nil {
+			log.Warn("Failed to update context summary, dropping older turns:", err)
+		} else {
+			summaryText = updated.Content
+		}
+	}
+
+	return summaryText, flattenTurns(remaining[keep:])
+}
+
+// splitTurns splits a branch into turns, each starting with a user message
+func splitTurns(branch []entities.Message) [][]entities.Message {
+	var turns [][]entities.Message
+	for _, msg := range branch {
+		if len(turns) == 0 || msg.Role == "user" {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return turns
+}
+
+// lastTurnMessageID returns the ID of the last message shown of a turn
+func lastTurnMessageID(turn []entities.Message) uint {
+	var last uint
+	for _, msg := range turn {
+		if IsTurnMessage(msg) {
+			last = msg.ID
+		}
+	}
+	return last
+}
+
+// estimateTurn approximates the prompt tokens of a turn
+func estimateTurn(turn []entities.Message) int {
+	return tokenizer.EstimateMessages(threadHistoryMessages(turn))
+}
+
+// flattenTurns joins turns back into a list of messages
+func flattenTurns(turns [][]entities.Message) []entities.Message {
+	var messages []entities.Message
+	for _, turn := range turns {
+		messages = append(messages, turn...)
+	}
+	return messages
+}
@@ -0,0 +1,156 @@
+package messaging
+
+import (
+	"errors"
+	"sef/app/entities"
+	"sef/pkg/summary"
+	"slices"
+	"testing"
+)
+
+// fakeSummaries serves context summaries from memory and records updates
+type fakeSummaries struct {
+	summary.SummaryServiceInterface
+	summaries []entities.ContextSummary
+	updateErr error
+	folded    []uint
+}
+
+func (f *fakeSummaries) ContextSummaries(sessionID uint) ([]entities.ContextSummary, error) {
+	return f.summaries, nil
+}
+
+func (f *fakeSummaries) UpdateContextSummary(session *entities.Session, previous *entities.ContextSummary, messages []entities.Message) (*entities.ContextSummary, error) {
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.folded = messageIDs(messages)
+	return &entities.ContextSummary{UpToMessageID: messages[len(messages)-1].ID, Content: "new summary"}, nil
+}
+
+// conversation returns turns of a user question and an assistant answer of equal size,
+// the messages of turn n have the IDs 2n-1 and 2n
+func conversation(turns int) []entities.Message {
+	var messages []entities.Message
+	for i := 1; i <= turns; i++ {
+		parentID := uint(2*i - 2)
+		messages = append(messages,
+			entities.Message{Base: entities.Base{ID: uint(2*i - 1)}, ParentID: &parentID, Role: "user", Content: "What is the capital city of Turkey?"},
+			entities.Message{Base: entities.Base{ID: uint(2 * i)}, Role: "assistant", Content: "The capital city of Turkey is Ankara."},
+		)
+	}
+	return messages
+}
+
+func TestFitHistory(t *testing.T) {
+	turn := estimateTurn(conversation(1))
+
+	tests := []struct {
+		name        string
+		summaries   *fakeSummaries
+		budget      int
+		wantSummary string
+		wantIDs     []uint
+		wantFolded  []uint
+	}{
+		{
+			name:    "everything fits",
+			budget:  4 * turn,
+			wantIDs: []uint{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name:    "older turns are dropped without a summary service",
+			budget:  3 * turn,
+			wantIDs: []uint{7, 8},
+		},
+		{
+			// Three turns would fit, but only half of the budget is kept after folding
+			name:        "older turns are folded into a summary",
+			summaries:   &fakeSummaries{},
+			budget:      3 * turn,
+			wantSummary: "new summary",
+			wantIDs:     []uint{7, 8},
+			wantFolded:  []uint{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name: "existing summary covers the older turns",
+			summaries: &fakeSummaries{summaries: []entities.ContextSummary{
+				{UpToMessageID: 4, Content: "old"},
+			}},
+			budget:      3 * turn,
+			wantSummary: "old",
+			wantIDs:     []uint{5, 6, 7, 8},
+		},
+		{
+			name: "summary of another branch is ignored",
+			summaries: &fakeSummaries{summaries: []entities.ContextSummary{
+				{UpToMessageID: 42, Content: "other branch"},
+			}},
+			budget:  4 * turn,
+			wantIDs: []uint{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name: "newest matching summary is continued",
+			summaries: &fakeSummaries{summaries: []entities.ContextSummary{
+				{UpToMessageID: 6, Content: "newer"},
+				{UpToMessageID: 2, Content: "older"},
+			}},
+			budget:      2 * turn,
+			wantSummary: "newer",
+			wantIDs:     []uint{7, 8},
+		},
+		{
+			name:      "failed summary drops the older turns",
+			summaries: &fakeSummaries{updateErr: errors.New("provider unavailable")},
+			budget:    3 * turn,
+			wantIDs:   []uint{7, 8},
+		},
+		{
+			name:    "nothing fits",
+			budget:  0,
+			wantIDs: []uint{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &MessagingService{}
+			if tt.summaries != nil {
+				service.SummaryService = tt.summaries
+			}
+
+			summaryText, history := service.fitHistory(&entities.Session{}, conversation(4), tt.budget)
+			if summaryText != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", summaryText, tt.wantSummary)
+			}
+			if got := messageIDs(history); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("history = %v, want %v", got, tt.wantIDs)
+			}
+			if tt.summaries != nil && !slices.Equal(tt.summaries.folded, tt.wantFolded) {
+				t.Errorf("folded = %v, want %v", tt.summaries.folded, tt.wantFolded)
+			}
+		})
+	}
+}
+
+func TestSplitTurns(t *testing.T) {
+	messages := []entities.Message{
+		{Base: entities.Base{ID: 1}, Role: "assistant"}, // Greeting before the first question
+		{Base: entities.Base{ID: 2}, Role: "user"},
+		{Base: entities.Base{ID: 3}, Role: "assistant", ToolCalls: entities.MessageToolCalls{{ID: "call_1"}}},
+		{Base: entities.Base{ID: 4}, Role: "tool"},
+		{Base: entities.Base{ID: 5}, Role: "assistant"},
+		{Base: entities.Base{ID: 6}, Role: "user"},
+	}
+
+	turns := splitTurns(messages)
+	if len(turns) != 3 {
+		t.Fatalf("got %d turns, want 3", len(turns))
+	}
+	if got := messageIDs(turns[1]); !slices.Equal(got, []uint{2, 3, 4, 5}) {
+		t.Errorf("second turn = %v, want [2 3 4 5]", got)
+	}
+	if got := lastTurnMessageID(turns[1]); got != 5 {
+		t.Errorf("lastTurnMessageID() = %d, want the answer 5", got)
+	}
+}
@@ -0,0 +1,104 @@
+package messaging
+
+import (
+	"sef/app/entities"
+	"sef/pkg/providers"
+)
+
+// StreamProtocolVersion is the version of the typed chat stream event schema,
+// sent back in the X-Stream-Protocol header of every typed stream
+const StreamProtocolVersion = "1"
+
+// Stream event types
+const (
+	EventContentDelta     = "content_delta"
+	EventThinkingDelta    = "thinking_delta"
+	EventToolCallStarted  = "tool_call_started"
+	EventToolCallFinished = "tool_call_finished"
+	EventRAGSources       = "rag_sources"
+	EventError            = "error"
+	EventUsage            = "usage"
+	EventDone             = "done"
+)
+
+// Error codes sent with error events
+const (
+	ErrorCodeProviderConnection = "provider_connection"
+	ErrorCodeProviderAuth       = "provider_auth"
+	ErrorCodeModelUnsupported   = "model_unsupported"
+	ErrorCodeProviderError      = "provider_error"
+	ErrorCodeToolCallLimit      = "tool_call_limit_exceeded"
+	ErrorCodeMaxIterations      = "max_iterations_exceeded"
+)
+
+// StreamEvent is a single event of the chat response stream.
+// Legacy is the same event in the pseudo-tag text format of older clients;
+// events without a type only exist in that format (e.g. closing </think> tags).
+type StreamEvent struct {
+	Type   string
+	Data   interface{}
+	Legacy string
+}
+
+// DeltaEvent carries a piece of answer or thinking text
+type DeltaEvent struct {
+	Content string `json:"content"`
+}
+
+// ToolCallEvent describes a tool call when it starts and finishes
+type ToolCallEvent struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	DisplayName string                 `json:"display_name"`
+	Arguments   map[string]interface{} `json:"arguments,omitempty"`
+	Result      string                 `json:"result,omitempty"`
+	IsError     bool                   `json:"is_error,omitempty"`
+	DurationMs  int64                  `json:"duration_ms,omitempty"`
+}
+
+// RAGSourcesEvent lists the document chunks the answer may cite as [n]
+type RAGSourcesEvent struct {
+	Sources []entities.MessageCitation `json:"sources"`
+	Timings map[string]int64           `json:"timings_ms,omitempty"` // Duration of each retrieval stage
+}
+
+// ErrorEvent reports a failure with a machine readable code
+type ErrorEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// UsageEvent reports the token usage of the whole generation
+type UsageEvent struct {
+	providers.Usage
+	Model     string `json:"model,omitempty"`
+	Estimated bool   `json:"estimated"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// DoneEvent closes the stream
+type DoneEvent struct {
+	MessageID uint   `json:"message_id"`
+	Stopped   bool   `json:"stopped"`
+	Version   string `json:"version"`
+}
+
+// contentDelta creates an answer text event
+func contentDelta(content string) StreamEvent {
+	return StreamEvent{Type: EventContentDelta, Data: DeltaEvent{Content: content}, Legacy: content}
+}
+
+// thinkingDelta creates a thinking text event, legacy prefix opens the <think> tag when needed
+func thinkingDelta(content string, legacyPrefix string) StreamEvent {
+	return StreamEvent{Type: EventThinkingDelta, Data: DeltaEvent{Content: content}, Legacy: legacyPrefix + content}
+}
+
+// legacyOnly creates an event that is only sent to legacy clients
+func legacyOnly(text string) StreamEvent {
+	return StreamEvent{Legacy: text}
+}
+
+// errorEvent creates an error event shown to the user
+func errorEvent(code string, message string) StreamEvent {
+	return StreamEvent{Type: EventError, Data: ErrorEvent{Code: code, Message: message}, Legacy: message}
+}
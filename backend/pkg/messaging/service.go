@@ -3,16 +3,22 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"regexp"
 	"sef/app/entities"
 	"sef/internal/validation"
 	"sef/pkg/providers"
 	"sef/pkg/rag"
+	"sef/pkg/summary"
+	"sef/pkg/tokenizer"
 	"sef/pkg/toolrunners"
 	"sef/pkg/toon"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v3/log"
@@ -25,21 +31,37 @@ type SendMessageRequest struct {
 }
 
 type MessagingService struct {
-	DB         *gorm.DB
-	RAGService *rag.RAGService
+	DB             *gorm.DB
+	RAGService     *rag.RAGService
+	SummaryService summary.SummaryServiceInterface
+
+	// generations holds the cancel functions of in-flight generations by assistant message ID
+	generations sync.Map
 }
 
+var (
+	// ErrGenerationStopped is the cancellation cause when the user presses stop
+	ErrGenerationStopped = errors.New("generation stopped by user")
+	// ErrClientDisconnected is the cancellation cause when the streaming client goes away
+	ErrClientDisconnected = errors.New("client disconnected")
+)
+
 type MessagingServiceInterface interface {
 	ValidateAndParseSessionID(sessionIDStr string) (uint, error)
 	GetSessionByIDAndUser(sessionID, userID uint) (*entities.Session, error)
 	ParseSendMessageRequest(body []byte) (*SendMessageRequest, error)
 	LoadSessionWithChatbotAndMessages(sessionID, userID uint) (*entities.Session, error)
 	LoadSessionWithChatbotToolsAndMessages(sessionID, userID uint) (*entities.Session, error)
-	SaveUserMessage(sessionID uint, content string) error
-	PrepareChatMessages(session *entities.Session, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult)
-	CreateAssistantMessage(sessionID uint) (*entities.Message, error)
-	CreateToolMessage(sessionID uint, content string) (*entities.Message, error)
-	GenerateChatResponse(session *entities.Session, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool) (<-chan string, *entities.Message, error)
+	SaveUserMessage(sessionID uint, parentID *uint, content string) (*entities.Message, error)
+	PrepareChatMessages(session *entities.Session, parentID *uint, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult)
+	PrepareCompletionMessages(session *entities.Session, history []providers.ChatMessage, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult)
+	CreateAssistantMessage(sessionID uint, parentID uint) (*entities.Message, error)
+	CreateToolCallMessage(sessionID uint, turnID uint, toolCalls []providers.ToolCall) (*entities.Message, error)
+	CreateToolMessage(sessionID uint, turnID uint, content string, toolCallID string, name string) (*entities.Message, error)
+	SetActiveMessage(sessionID uint, messageID uint) error
+	ActivateBranch(session *entities.Session, messageID uint) (uint, error)
+	GenerateChatResponse(ctx context.Context, session *entities.Session, parentID uint, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool) (<-chan StreamEvent, *entities.Message, error)
+	StopGeneration(messageID uint) bool
 	UpdateAssistantMessage(assistantMessage *entities.Message, content string)
 	UpdateAssistantMessageWithCallback(assistantMessage *entities.Message, content string, callback func())
 	ConvertToolsToDefinitions(tools []entities.Tool, format string) []providers.ToolDefinition
@@ -85,6 +107,11 @@ func (s *MessagingService) ParseSendMessageRequest(body []byte) (*SendMessageReq
 	return &req, nil
 }
 
+// orderMessages keeps preloaded messages in the order they were written
+func orderMessages(db *gorm.DB) *gorm.DB {
+	return db.Order("id ASC")
+}
+
 // LoadSessionWithChatbotAndMessages loads session with chatbot and messages
 func (s *MessagingService) LoadSessionWithChatbotAndMessages(sessionID, userID uint) (*entities.Session, error) {
 	var session entities.Session
@@ -92,7 +119,7 @@ func (s *MessagingService) LoadSessionWithChatbotAndMessages(sessionID, userID u
 		Where("id = ? AND user_id = ?", sessionID, userID).
 		Preload("Chatbot").
 		Preload("Chatbot.Provider").
-		Preload("Messages").
+		Preload("Messages", orderMessages).
 		First(&session).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("chat session not found")
@@ -111,7 +138,7 @@ func (s *MessagingService) LoadSessionWithChatbotToolsAndMessages(sessionID, use
 		Preload("Chatbot").
 		Preload("Chatbot.Provider").
 		Preload("Chatbot.Tools").
-		Preload("Messages").
+		Preload("Messages", orderMessages).
 		First(&session).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("chat session not found")
@@ -391,22 +418,114 @@ func (s *MessagingService) executeWebSearchTool(ctx context.Context, toolCall pr
 	return string(resultJSON), nil
 }
 
-// SaveUserMessage saves the user message to database
-func (s *MessagingService) SaveUserMessage(sessionID uint, content string) error {
+// SaveUserMessage saves the user message as the next message of the branch ending at parentID
+func (s *MessagingService) SaveUserMessage(sessionID uint, parentID *uint, content string) (*entities.Message, error) {
 	userMessage := entities.Message{
 		SessionID: sessionID,
+		ParentID:  parentID,
 		Role:      "user",
 		Content:   content,
 	}
 
 	if err := s.DB.Create(&userMessage).Error; err != nil {
 		log.Error("Failed to save user message:", err)
-		return fmt.Errorf("failed to save message: %w", err)
+		return nil, fmt.Errorf("failed to save message: %w", err)
+	}
+
+	if err := s.SetActiveMessage(sessionID, userMessage.ID); err != nil {
+		return nil, err
 	}
 
+	return &userMessage, nil
+}
+
+// SetActiveMessage makes the branch ending at messageID the active branch of the session
+func (s *MessagingService) SetActiveMessage(sessionID uint, messageID uint) error {
+	if err := s.DB.Model(&entities.Session{}).
+		Where("id = ?", sessionID).
+		Update("active_message_id", messageID).Error; err != nil {
+		log.Error("Failed to update active message:", err)
+		return fmt.Errorf("failed to update active message: %w", err)
+	}
 	return nil
 }
 
+// ActivateBranch switches the session to the newest branch going through messageID.
+// Returns the last message of that branch.
+func (s *MessagingService) ActivateBranch(session *entities.Session, messageID uint) (uint, error) {
+	leafID, ok := BranchLeaf(session.Messages, messageID)
+	if !ok {
+		return 0, fmt.Errorf("message not found")
+	}
+
+	if err := s.SetActiveMessage(session.ID, leafID); err != nil {
+		return 0, err
+	}
+	return leafID, nil
+}
+
+// BranchLeaf returns the last message of the newest branch going through messageID,
+// false when messageID is not a message shown in the conversation
+func BranchLeaf(messages []entities.Message, messageID uint) (uint, bool) {
+	children := make(map[uint][]uint)
+	found := false
+	for _, msg := range messages {
+		if msg.ID == messageID && IsTurnMessage(msg) {
+			found = true
+		}
+		if IsTurnMessage(msg) && msg.ParentID != nil {
+			children[*msg.ParentID] = append(children[*msg.ParentID], msg.ID)
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	// Messages are ordered by ID, so the last child is the newest one
+	leafID := messageID
+	for len(children[leafID]) > 0 {
+		leafID = children[leafID][len(children[leafID])-1]
+	}
+	return leafID, true
+}
+
+// IsTurnMessage reports whether a message is shown in the conversation.
+// Tool call requests and tool results belong to the assistant message of their turn.
+func IsTurnMessage(msg entities.Message) bool {
+	return msg.Role != "tool" && len(msg.ToolCalls) == 0
+}
+
+// BranchMessages returns the messages on the branch ending at leafID, together with
+// the tool rows of each turn, in the order they were written
+func BranchMessages(messages []entities.Message, leafID *uint) []entities.Message {
+	if leafID == nil {
+		return nil
+	}
+
+	byID := make(map[uint]entities.Message, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+
+	onBranch := make(map[uint]bool)
+	for id := leafID; id != nil; {
+		msg, ok := byID[*id]
+		if !ok || onBranch[msg.ID] {
+			break
+		}
+		onBranch[msg.ID] = true
+		id = msg.ParentID
+	}
+
+	var branch []entities.Message
+	for _, msg := range messages {
+		if onBranch[msg.ID] || (!IsTurnMessage(msg) && msg.ParentID != nil && onBranch[*msg.ParentID]) {
+			branch = append(branch, msg)
+		}
+	}
+	return branch
+}
+
 // cleanAssistantContent removes internal tags from assistant content before saving
 func cleanAssistantContent(content string) string {
 	// Remove <think> tags and content
@@ -428,10 +547,11 @@ func cleanAssistantContent(content string) string {
 	return strings.TrimSpace(content)
 }
 
-// PrepareChatMessages prepares the messages array for the chat API
-func (s *MessagingService) PrepareChatMessages(session *entities.Session, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult) {
+// PrepareChatMessages prepares the messages array for the chat API.
+// The history is the branch ending at parentID, other branches of the session are left out.
+// Older turns that do not fit in the chatbot's context window are replaced by a rolling summary.
+func (s *MessagingService) PrepareChatMessages(session *entities.Session, parentID *uint, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult) {
 	var messages []providers.ChatMessage
-	var ragResult *rag.AugmentPromptResult
 
 	// Add system message if system prompt exists
 	if session.Chatbot.SystemPrompt != "" {
@@ -441,36 +561,44 @@ func (s *MessagingService) PrepareChatMessages(session *entities.Session, userCo
 		})
 	}
 
-	// Add current chat session messages
-	for _, msg := range session.Messages {
+	// Current user message (possibly augmented with RAG context)
+	augmentedContent, ragResult := s.augmentUserContent(session.Chatbot.ID, userContent)
+	userMessage := providers.ChatMessage{
+		Role:    "user",
+		Content: augmentedContent,
+	}
+
+	// Add the chat session messages that fit in the context window
+	budget := s.historyBudget(session, append(messages, userMessage))
+	summary, history := s.fitHistory(session, BranchMessages(session.Messages, parentID), budget)
+	if summary != "" {
 		messages = append(messages, providers.ChatMessage{
-			Role:    msg.Role,
-			Content: cleanAssistantContent(msg.Content),
+			Role:    "system",
+			Content: "Summary of the earlier conversation:\n" + summary,
 		})
 	}
+	messages = append(messages, threadHistoryMessages(history)...)
 
-	// Check if RAG is available and augment the user message if needed
-	augmentedContent := userContent
-	if s.RAGService != nil {
-		// Check if chatbot has documents
-		isAvailable, err := s.RAGService.IsRAGAvailable(session.Chatbot.ID)
-		if err != nil {
-			log.Warn("Failed to check RAG availability:", err)
-		} else if isAvailable {
-			// Augment the prompt with RAG context
-			// Using 7 chunks provides good context while staying within token limits
-			result, err := s.RAGService.AugmentPrompt(context.Background(), userContent, session.Chatbot.ID, 0)
-			if err != nil {
-				log.Warn("Failed to augment prompt with RAG:", err)
-			} else if result != nil {
-				augmentedContent = result.AugmentedPrompt
-				ragResult = result
-				log.Info("RAG augmented prompt with", len(result.DocumentsUsed), "documents")
-			}
-		}
+	messages = append(messages, userMessage)
+
+	return messages, ragResult
+}
+
+// PrepareCompletionMessages prepares the messages array for a conversation whose history
+// is kept by the client instead of the session, as in OpenAI compatible requests.
+// The chatbot's system prompt comes first and only the new user message is augmented with RAG.
+func (s *MessagingService) PrepareCompletionMessages(session *entities.Session, history []providers.ChatMessage, userContent string) ([]providers.ChatMessage, *rag.AugmentPromptResult) {
+	var messages []providers.ChatMessage
+
+	if session.Chatbot.SystemPrompt != "" {
+		messages = append(messages, providers.ChatMessage{
+			Role:    "system",
+			Content: session.Chatbot.SystemPrompt,
+		})
 	}
+	messages = append(messages, history...)
 
-	// Add current user message (possibly augmented with RAG context)
+	augmentedContent, ragResult := s.augmentUserContent(session.Chatbot.ID, userContent)
 	messages = append(messages, providers.ChatMessage{
 		Role:    "user",
 		Content: augmentedContent,
@@ -479,10 +607,177 @@ func (s *MessagingService) PrepareChatMessages(session *entities.Session, userCo
 	return messages, ragResult
 }
 
-// CreateAssistantMessage creates an empty assistant message record
-func (s *MessagingService) CreateAssistantMessage(sessionID uint) (*entities.Message, error) {
+// augmentUserContent adds the context of the chatbot's documents to a user message when it has any
+func (s *MessagingService) augmentUserContent(chatbotID uint, userContent string) (string, *rag.AugmentPromptResult) {
+	if s.RAGService == nil {
+		return userContent, nil
+	}
+
+	// Check if chatbot has documents
+	isAvailable, err := s.RAGService.IsRAGAvailable(chatbotID)
+	if err != nil {
+		log.Warn("Failed to check RAG availability:", err)
+		return userContent, nil
+	}
+	if !isAvailable {
+		return userContent, nil
+	}
+
+	// Augment the prompt with RAG context
+	result, err := s.RAGService.AugmentPrompt(context.Background(), userContent, chatbotID, 0)
+	if err != nil {
+		log.Warn("Failed to augment prompt with RAG:", err)
+		return userContent, nil
+	}
+	if result == nil {
+		return userContent, nil
+	}
+
+	log.Info("RAG augmented prompt with", len(result.DocumentsUsed), "documents")
+	return result.AugmentedPrompt, result
+}
+
+// threadHistoryMessages rebuilds the provider history from persisted messages.
+// Within a turn the displayed assistant message is created before the tool calls
+// it triggers, so it is moved after them to keep assistant tool_calls directly
+// followed by their tool results. Unanswered tool calls and legacy tool rows
+// without a tool_call_id are dropped since providers reject them.
+func threadHistoryMessages(history []entities.Message) []providers.ChatMessage {
+	answered := make(map[string]bool)
+	for _, msg := range history {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			answered[msg.ToolCallID] = true
+		}
+	}
+
+	var messages []providers.ChatMessage
+	var pendingAssistant *providers.ChatMessage
+	flush := func() {
+		if pendingAssistant != nil {
+			messages = append(messages, *pendingAssistant)
+			pendingAssistant = nil
+		}
+	}
+
+	for _, msg := range history {
+		switch {
+		case msg.Role == "tool":
+			if msg.ToolCallID == "" || !answered[msg.ToolCallID] {
+				continue
+			}
+			messages = append(messages, providers.ChatMessage{
+				Role:       "tool",
+				Content:    msg.Content,
+				ToolCallID: msg.ToolCallID,
+				Name:       msg.Name,
+			})
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			toolCalls := fromMessageToolCalls(msg.ToolCalls, answered)
+			if len(toolCalls) == 0 {
+				continue
+			}
+			messages = append(messages, providers.ChatMessage{
+				Role:      "assistant",
+				Content:   cleanAssistantContent(msg.Content),
+				ToolCalls: toolCalls,
+			})
+		case msg.Role == "assistant":
+			flush()
+			pendingAssistant = &providers.ChatMessage{
+				Role:    "assistant",
+				Content: cleanAssistantContent(msg.Content),
+			}
+		default:
+			flush()
+			messages = append(messages, providers.ChatMessage{
+				Role:    msg.Role,
+				Content: msg.Content,
+			})
+		}
+	}
+	flush()
+
+	// A tool result that lost its assistant message would be rejected as well
+	requested := make(map[string]bool)
+	threaded := messages[:0]
+	for _, msg := range messages {
+		for _, toolCall := range msg.ToolCalls {
+			requested[toolCall.ID] = true
+		}
+		if msg.Role == "tool" && !requested[msg.ToolCallID] {
+			continue
+		}
+		threaded = append(threaded, msg)
+	}
+
+	return threaded
+}
+
+// toMessageToolCalls converts provider tool calls to their persisted form
+func toMessageToolCalls(toolCalls []providers.ToolCall) entities.MessageToolCalls {
+	result := make(entities.MessageToolCalls, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		result = append(result, entities.MessageToolCall{
+			ID:        toolCall.ID,
+			Type:      toolCall.Type,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	return result
+}
+
+// fromMessageToolCalls converts persisted tool calls back, keeping only answered ones
+func fromMessageToolCalls(toolCalls entities.MessageToolCalls, answered map[string]bool) []providers.ToolCall {
+	var result []providers.ToolCall
+	for _, toolCall := range toolCalls {
+		if !answered[toolCall.ID] {
+			continue
+		}
+		toolType := toolCall.Type
+		if toolType == "" {
+			toolType = "function"
+		}
+		result = append(result, providers.ToolCall{
+			ID:   toolCall.ID,
+			Type: toolType,
+			Function: providers.ToolCallFunction{
+				Name:      toolCall.Name,
+				Arguments: toolCall.Arguments,
+			},
+		})
+	}
+	return result
+}
+
+// normalizeToolCalls makes sure every tool call has an ID and parsed arguments
+// so it can be threaded through the history and replayed to any provider
+func normalizeToolCalls(toolCalls []providers.ToolCall) []providers.ToolCall {
+	for i := range toolCalls {
+		if toolCalls[i].ID == "" {
+			toolCalls[i].ID = providers.NewToolCallID()
+		}
+		if toolCalls[i].Type == "" {
+			toolCalls[i].Type = "function"
+		}
+		if rawArgs, ok := toolCalls[i].Function.Arguments["raw"].(string); ok {
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(rawArgs), &args); err == nil {
+				toolCalls[i].Function.Arguments = args
+			}
+		}
+		if toolCalls[i].Function.Arguments == nil {
+			toolCalls[i].Function.Arguments = map[string]interface{}{}
+		}
+	}
+	return toolCalls
+}
+
+// CreateAssistantMessage creates an empty assistant message record answering the parent user message
+func (s *MessagingService) CreateAssistantMessage(sessionID uint, parentID uint) (*entities.Message, error) {
 	assistantMessage := entities.Message{
 		SessionID: sessionID,
+		ParentID:  &parentID,
 		Role:      "assistant",
 		Content:   "",
 	}
@@ -492,15 +787,41 @@ func (s *MessagingService) CreateAssistantMessage(sessionID uint) (*entities.Mes
 		return nil, fmt.Errorf("failed to create message record: %w", err)
 	}
 
+	if err := s.SetActiveMessage(sessionID, assistantMessage.ID); err != nil {
+		return nil, err
+	}
+
 	return &assistantMessage, nil
 }
 
-// CreateToolMessage creates a tool message record
-func (s *MessagingService) CreateToolMessage(sessionID uint, content string) (*entities.Message, error) {
-	toolMessage := entities.Message{
+// CreateToolCallMessage creates the assistant message record that requested tool calls
+// during the turn of the assistant message turnID
+func (s *MessagingService) CreateToolCallMessage(sessionID uint, turnID uint, toolCalls []providers.ToolCall) (*entities.Message, error) {
+	toolCallMessage := entities.Message{
 		SessionID: sessionID,
-		Role:      "tool",
-		Content:   content,
+		ParentID:  &turnID,
+		Role:      "assistant",
+		Content:   "",
+		ToolCalls: toMessageToolCalls(toolCalls),
+	}
+
+	if err := s.DB.Create(&toolCallMessage).Error; err != nil {
+		log.Error("Failed to create tool call message:", err)
+		return nil, fmt.Errorf("failed to create tool call message record: %w", err)
+	}
+
+	return &toolCallMessage, nil
+}
+
+// CreateToolMessage creates a tool message record during the turn of the assistant message turnID
+func (s *MessagingService) CreateToolMessage(sessionID uint, turnID uint, content string, toolCallID string, name string) (*entities.Message, error) {
+	toolMessage := entities.Message{
+		SessionID:  sessionID,
+		ParentID:   &turnID,
+		Role:       "tool",
+		Content:    content,
+		ToolCallID: toolCallID,
+		Name:       name,
 	}
 
 	if err := s.DB.Create(&toolMessage).Error; err != nil {
@@ -511,87 +832,197 @@ func (s *MessagingService) CreateToolMessage(sessionID uint, content string) (*e
 	return &toolMessage, nil
 }
 
-// processToolCalls handles the execution of tool calls and returns updated messages
-// Returns: updated messages, shouldStop flag, stop reason
-func (s *MessagingService) processToolCalls(session *entities.Session, toolCalls []providers.ToolCall, messages []providers.ChatMessage, outputCh chan<- string, assistantContent *strings.Builder, toolCallCounter map[string]int, outputFormat string) ([]providers.ChatMessage, bool, string) {
-	for _, toolCall := range toolCalls {
-		displayName := toolCall.Function.Name
-		// Extract tool display name from session.Chatbot.Tools
-		for _, t := range session.Chatbot.Tools {
-			if t.Name == toolCall.Function.Name {
-				displayName = t.DisplayName
-				break
-			}
-		}
+// toolCallResult holds the outcome of a single tool call executed in parallel
+type toolCallResult struct {
+	index    int
+	result   string
+	failed   bool
+	duration time.Duration
+}
 
-		// Ensure we have a valid display name, fallback to function name if empty
-		if displayName == "" {
-			if toolCall.Function.Name != "" {
-				displayName = toolCall.Function.Name
-			} else {
-				displayName = "Unknown Tool"
-			}
+// toolDisplayName returns the user facing name of the tool behind a tool call
+func toolDisplayName(session *entities.Session, toolCall providers.ToolCall) string {
+	displayName := toolCall.Function.Name
+	// Extract tool display name from session.Chatbot.Tools
+	for _, t := range session.Chatbot.Tools {
+		if t.Name == toolCall.Function.Name {
+			displayName = t.DisplayName
+			break
 		}
+	}
 
-		if displayName == "web_search" {
-			displayName = "Web Search"
+	// Ensure we have a valid display name, fallback to function name if empty
+	if displayName == "" {
+		if toolCall.Function.Name != "" {
+			displayName = toolCall.Function.Name
+		} else {
+			displayName = "Unknown Tool"
 		}
+	}
+
+	if displayName == "web_search" {
+		displayName = "Web Search"
+	}
 
-		// Check if this tool has been called too many times
+	return displayName
+}
+
+// processToolCalls handles the execution of tool calls and returns updated messages.
+// Independent tool calls of one model turn run concurrently, bounded by the chatbot's
+// tool concurrency. Markers are streamed as calls start and finish, while tool results
+// are added to the history in the order the model requested them.
+// Returns: updated messages, shouldStop flag, stop reason
+func (s *MessagingService) processToolCalls(ctx context.Context, session *entities.Session, turnID uint, toolCalls []providers.ToolCall, messages []providers.ChatMessage, outputCh chan<- StreamEvent, assistantContent *strings.Builder, toolCallCounter map[string]int, outputFormat string) ([]providers.ChatMessage, bool, string) {
+	displayNames := make([]string, len(toolCalls))
+	for i, toolCall := range toolCalls {
+		displayNames[i] = toolDisplayName(session, toolCall)
+	}
+
+	// Check call limits up front, calls before the first exceeded one still run
+	runnable := len(toolCalls)
+	for i, toolCall := range toolCalls {
 		toolCallCounter[toolCall.Function.Name]++
 		if toolCallCounter[toolCall.Function.Name] > 2 {
 			log.Warn("Tool", toolCall.Function.Name, "has been called more than 2 times, stopping execution")
-			errorMsg := fmt.Sprintf("Özür dilerim, '%s' aracını kullanarak istediğiniz bilgiyi alamadım. Lütfen sorunuzu farklı bir şekilde sorun veya daha spesifik bilgi verin.", displayName)
-			outputCh <- errorMsg
-			assistantContent.WriteString(errorMsg)
-			return messages, true, "tool_call_limit_exceeded"
+			runnable = i
+			break
 		}
-
 		log.Info("Calling tool", toolCall.Function.Name, "- attempt", toolCallCounter[toolCall.Function.Name], "of 2")
+	}
 
-		// Send tool executing indicator
-		executingStr := fmt.Sprintf("<tool_executing>%s</tool_executing>", displayName)
-		outputCh <- executingStr
+	concurrency := session.Chatbot.GetToolConcurrency()
+	log.Info("Executing", runnable, "tool calls with concurrency", concurrency, "for session:", session.ID)
+
+	// Send tool executing indicators
+	for i := 0; i < runnable; i++ {
+		executingStr := fmt.Sprintf("<tool_executing>%s</tool_executing>", displayNames[i])
+		outputCh <- StreamEvent{
+			Type: EventToolCallStarted,
+			Data: ToolCallEvent{
+				ID:          toolCalls[i].ID,
+				Name:        toolCalls[i].Function.Name,
+				DisplayName: displayNames[i],
+				Arguments:   toolCalls[i].Function.Arguments,
+			},
+			Legacy: executingStr,
+		}
 		assistantContent.WriteString(executingStr)
+	}
 
-		toolResult, err := s.ExecuteToolCall(context.Background(), toolCall, outputFormat)
-		if err != nil {
-			log.Error("Tool execution failed:", err)
-			// Provide more user-friendly tool error messages
-			if strings.Contains(err.Error(), "not found") {
-				toolResult = fmt.Sprintf("The tool '%s' is not available or has been removed.", displayName)
-			} else if strings.Contains(err.Error(), "timeout") {
-				toolResult = fmt.Sprintf("The tool '%s' took too long to respond. Please try again.", displayName)
-			} else if strings.Contains(err.Error(), "arguments") {
-				toolResult = fmt.Sprintf("There was an issue with the parameters provided to '%s'. Please try rephrasing your request.", displayName)
-			} else {
-				toolResult = fmt.Sprintf("Tool '%s' encountered an error: %v", displayName, err)
+	results := make([]string, runnable)
+	done := make(chan toolCallResult)
+	semaphore := make(chan struct{}, concurrency)
+	for i := 0; i < runnable; i++ {
+		go func(index int, toolCall providers.ToolCall) {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			started := time.Now()
+			result, failed := s.executeToolCallForChat(ctx, toolCall, displayNames[index], outputFormat)
+			done <- toolCallResult{
+				index:    index,
+				result:   result,
+				failed:   failed,
+				duration: time.Since(started),
 			}
-		}
+		}(i, toolCalls[i])
+	}
 
-		// Send tool executed indicator
-		executedStr := fmt.Sprintf("<tool_executed>%s</tool_executed>", displayName)
-		outputCh <- executedStr
+	// Send tool executed indicators as each call finishes
+	for completed := 0; completed < runnable; completed++ {
+		finished := <-done
+		results[finished.index] = finished.result
+
+		toolCall := toolCalls[finished.index]
+		executedStr := fmt.Sprintf("<tool_executed>%s</tool_executed>", displayNames[finished.index])
+		outputCh <- StreamEvent{
+			Type: EventToolCallFinished,
+			Data: ToolCallEvent{
+				ID:          toolCall.ID,
+				Name:        toolCall.Function.Name,
+				DisplayName: displayNames[finished.index],
+				Arguments:   toolCall.Function.Arguments,
+				Result:      finished.result,
+				IsError:     finished.failed,
+				DurationMs:  finished.duration.Milliseconds(),
+			},
+			Legacy: executedStr,
+		}
 		assistantContent.WriteString(executedStr)
+	}
+
+	for i := 0; i < runnable; i++ {
+		toolCall := toolCalls[i]
 
 		// Save tool message
-		_, err = s.CreateToolMessage(session.ID, toolResult)
-		if err != nil {
+		if _, err := s.CreateToolMessage(session.ID, turnID, results[i], toolCall.ID, toolCall.Function.Name); err != nil {
 			log.Error("Failed to save tool message:", err)
 		}
 
 		// Add to messages for followup
 		toolMessage := providers.ChatMessage{
-			Role:    "tool",
-			Content: toolResult,
+			Role:       "tool",
+			Content:    results[i],
+			ToolCallID: toolCall.ID,
+			Name:       toolCall.Function.Name,
 		}
 		messages = append(messages, toolMessage)
 	}
+
+	if runnable < len(toolCalls) {
+		errorMsg := fmt.Sprintf("Özür dilerim, '%s' aracını kullanarak istediğiniz bilgiyi alamadım. Lütfen sorunuzu farklı bir şekilde sorun veya daha spesifik bilgi verin.", displayNames[runnable])
+		outputCh <- errorEvent(ErrorCodeToolCallLimit, errorMsg)
+		assistantContent.WriteString(errorMsg)
+		return messages, true, "tool_call_limit_exceeded"
+	}
+
 	return messages, false, ""
 }
 
-// GenerateChatResponse generates the chat response stream with infinite tool call chain support
-func (s *MessagingService) GenerateChatResponse(session *entities.Session, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool) (<-chan string, *entities.Message, error) {
+// executeToolCallForChat executes a tool call and turns failures into a result the model can read.
+// Returns the result and whether the tool failed.
+func (s *MessagingService) executeToolCallForChat(ctx context.Context, toolCall providers.ToolCall, displayName string, outputFormat string) (string, bool) {
+	toolResult, err := s.ExecuteToolCall(ctx, toolCall, outputFormat)
+	if err != nil {
+		log.Error("Tool execution failed:", err)
+		// Provide more user-friendly tool error messages
+		if strings.Contains(err.Error(), "not found") {
+			toolResult = fmt.Sprintf("The tool '%s' is not available or has been removed.", displayName)
+		} else if strings.Contains(err.Error(), "timeout") {
+			toolResult = fmt.Sprintf("The tool '%s' took too long to respond. Please try again.", displayName)
+		} else if strings.Contains(err.Error(), "arguments") {
+			toolResult = fmt.Sprintf("There was an issue with the parameters provided to '%s'. Please try rephrasing your request.", displayName)
+		} else {
+			toolResult = fmt.Sprintf("Tool '%s' encountered an error: %v", displayName, err)
+		}
+		return toolResult, true
+	}
+	return toolResult, false
+}
+
+// StopGeneration cancels the in-flight generation of an assistant message.
+// Returns false if no generation is running for the message.
+func (s *MessagingService) StopGeneration(messageID uint) bool {
+	cancel, ok := s.generations.Load(messageID)
+	if !ok {
+		return false
+	}
+	cancel.(context.CancelCauseFunc)(ErrGenerationStopped)
+	return true
+}
+
+// saveStoppedMessage persists the partial answer of a cancelled generation
+func (s *MessagingService) saveStoppedMessage(ctx context.Context, assistantMessage *entities.Message, content string) {
+	log.Info("Generation cancelled for message", assistantMessage.ID, "- cause:", context.Cause(ctx))
+	assistantMessage.Stopped = true
+	s.UpdateAssistantMessage(assistantMessage, content)
+}
+
+// GenerateChatResponse generates the chat response stream with infinite tool call chain support.
+// The answer is stored as a reply to the user message parentID. The generation, including
+// provider requests and tool runs, stops when ctx is cancelled or StopGeneration is called
+// for the returned message.
+func (s *MessagingService) GenerateChatResponse(ctx context.Context, session *entities.Session, parentID uint, messages []providers.ChatMessage, ragResult *rag.AugmentPromptResult, webSearchEnabled bool) (<-chan StreamEvent, *entities.Message, error) {
 	// Create provider instance
 	factory := &providers.ProviderFactory{}
 	providerConfig := map[string]interface{}{
@@ -633,6 +1064,9 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 	} else {
 		log.Info("Using default model for chatbot:", session.Chatbot.Name)
 	}
+	if session.Chatbot.ThinkingBudget > 0 {
+		options["thinking_budget"] = session.Chatbot.ThinkingBudget
+	}
 
 	// Add additional logging for debugging
 	log.Info("Chat generation parameters:", map[string]interface{}{
@@ -679,17 +1113,31 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 		}
 		log.Info("====================================")
 	} // Create output channel
-	outputCh := make(chan string)
+	outputCh := make(chan StreamEvent)
 
 	// Create first assistant message synchronously
-	firstAssistant, err := s.CreateAssistantMessage(session.ID)
+	firstAssistant, err := s.CreateAssistantMessage(session.ID, parentID)
 	if err != nil {
 		log.Error("Failed to create assistant message:", err)
 		return nil, nil, fmt.Errorf("failed to create assistant message: %w", err)
 	}
 
+	// Keep the sources with the answer so its [n] citations resolve later
+	if ragResult != nil && len(ragResult.Citations) > 0 {
+		firstAssistant.Citations = ragResult.Citations
+		if err := s.DB.Model(firstAssistant).Update("citations", firstAssistant.Citations).Error; err != nil {
+			log.Error("Failed to save message citations:", err)
+		}
+	}
+
+	genCtx, cancel := context.WithCancelCause(ctx)
+	s.generations.Store(firstAssistant.ID, cancel)
+	started := time.Now()
+
 	go func() {
 		defer close(outputCh)
+		defer cancel(nil)
+		defer s.generations.Delete(firstAssistant.ID)
 
 		var assistantContent strings.Builder
 		thinkingStarted := false
@@ -697,17 +1145,35 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 		// Stream document used indicators if RAG was used
 		if ragResult != nil && len(ragResult.DocumentsUsed) > 0 {
+			// Note: We stream this to frontend but DON'T add to assistantContent
+			// so it won't be saved to DB (cleanAssistantContent will remove it anyway)
+			var legacyTags strings.Builder
 			for _, doc := range ragResult.DocumentsUsed {
-				docTag := fmt.Sprintf("<document_used>%s (Skor: %.2f)</document_used>", doc.Title, doc.Score)
-				outputCh <- docTag
-				// Note: We stream this to frontend but DON'T add to assistantContent
-				// so it won't be saved to DB (cleanAssistantContent will remove it anyway)
+				legacyTags.WriteString(fmt.Sprintf("<document_used>%s (Skor: %.2f)</document_used>", doc.Title, doc.Score))
+			}
+			outputCh <- StreamEvent{
+				Type:   EventRAGSources,
+				Data:   RAGSourcesEvent{Sources: ragResult.Citations, Timings: ragResult.Timings.Milliseconds()},
+				Legacy: legacyTags.String(),
 			}
 		}
 
-		// Keep-alive ticker to prevent timeouts
-		keepAliveTicker := time.NewTicker(30 * time.Second)
-		defer keepAliveTicker.Stop()
+		// Token usage summed over all provider requests of this generation
+		var usage providers.Usage
+		usageEstimated := false
+		defer func() {
+			if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+				return
+			}
+			latency := time.Since(started)
+			s.saveMessageUsage(firstAssistant, session.Chatbot, usage, usageEstimated, latency)
+			outputCh <- StreamEvent{Type: EventUsage, Data: UsageEvent{
+				Usage:     usage,
+				Model:     firstAssistant.Model,
+				Estimated: usageEstimated,
+				LatencyMs: latency.Milliseconds(),
+			}}
+		}()
 
 		// Maximum iterations to prevent infinite loops
 		const maxIterations = 10
@@ -718,11 +1184,16 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 		// Continuous loop to handle infinite tool call chains
 		for {
+			if genCtx.Err() != nil {
+				s.saveStoppedMessage(genCtx, firstAssistant, assistantContent.String())
+				return
+			}
+
 			iteration++
 			if iteration > maxIterations {
 				log.Warn("Maximum tool call iterations reached for session:", session.ID)
 				errorMsg := "Özür dilerim, çok fazla araç çağrısı yapıldı. Lütfen sorunuzu daha basit bir şekilde sorun."
-				outputCh <- errorMsg
+				outputCh <- errorEvent(ErrorCodeMaxIterations, errorMsg)
 				assistantContent.WriteString(errorMsg)
 				s.UpdateAssistantMessage(firstAssistant, assistantContent.String())
 				return
@@ -732,23 +1203,17 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 			// Generate chat response
 			log.Info("Calling GenerateChatWithTools for session:", session.ID, "with", len(currentMessages), "messages")
-			chatStream, err := provider.GenerateChatWithTools(context.Background(), currentMessages, toolDefinitions, options)
+			chatStream, err := provider.GenerateChatWithTools(genCtx, currentMessages, toolDefinitions, options)
 			if err != nil {
-				log.Error("Failed to generate response:", err)
-				// Kullanıcı dostu hata mesajı gönder
-				errorMsg := "Özür dilerim, şu anda yanıt oluşturmakta zorlanıyorum. "
-				if strings.Contains(err.Error(), "connection") || strings.Contains(err.Error(), "timeout") {
-					errorMsg += "AI servisi ile bağlantı sorunu yaşanıyor gibi görünüyor. Lütfen bir süre sonra tekrar deneyin."
-				} else if strings.Contains(err.Error(), "authentication") || strings.Contains(err.Error(), "auth") {
-					errorMsg += "AI servisi ile kimlik doğrulama sorunu yaşanıyor. Lütfen bir yönetici ile iletişime geçin."
-				} else if strings.Contains(err.Error(), "model") || strings.Contains(err.Error(), "does not support") {
-					errorMsg += "Seçilen AI modeli kullanılamıyor veya araçları desteklemiyor. Lütfen farklı bir chatbot deneyin veya bir yönetici ile iletişime geçin."
-				} else {
-					errorMsg += fmt.Sprintf("Hata detayları: %v", err)
+				if genCtx.Err() != nil {
+					s.saveStoppedMessage(genCtx, firstAssistant, assistantContent.String())
+					return
 				}
 
+				log.Error("Failed to generate response:", err)
+				errorCode, errorMsg := describeProviderError(err)
 				log.Info("Sending error message to client:", errorMsg)
-				outputCh <- errorMsg
+				outputCh <- errorEvent(errorCode, errorMsg)
 
 				// Assistant mesajını hata içeriği ile güncelle
 				s.UpdateAssistantMessage(firstAssistant, errorMsg)
@@ -759,30 +1224,51 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 			hasToolCalls := false
 			var pendingToolCalls []providers.ToolCall
+			var iterationContent strings.Builder
+			var iterationThinking strings.Builder
+			var iterationThinkingBlocks []providers.ThinkingBlock
+			var iterationUsage *providers.Usage
+			var streamErr error
 
 			// Process the stream
 			responseCount := 0
 			for response := range chatStream {
+				// Keep draining after cancellation so the provider goroutine can exit
+				if genCtx.Err() != nil {
+					continue
+				}
+
 				responseCount++
 
+				if response.Usage != nil {
+					iterationUsage = response.Usage
+				}
+				if response.Error != nil {
+					streamErr = response.Error
+				}
+				iterationThinkingBlocks = append(iterationThinkingBlocks, response.ThinkingBlocks...)
+
 				// Handle thinking tokens
 				if response.Thinking != "" {
+					legacyPrefix := ""
 					if !thinkingStarted {
-						outputCh <- "<think>"
+						legacyPrefix = "<think>"
 						thinkingStarted = true
 					}
-					outputCh <- response.Thinking
+					outputCh <- thinkingDelta(response.Thinking, legacyPrefix)
+					iterationThinking.WriteString(response.Thinking)
 					assistantContent.WriteString("<think>" + response.Thinking)
 				} else if thinkingStarted {
-					outputCh <- "</think>"
+					outputCh <- legacyOnly("</think>")
 					thinkingStarted = false
 					assistantContent.WriteString("</think>")
 				}
 
 				// Handle content
 				if response.Content != "" {
-					outputCh <- response.Content
+					outputCh <- contentDelta(response.Content)
 					assistantContent.WriteString(response.Content)
+					iterationContent.WriteString(response.Content)
 				}
 
 				// Collect tool calls
@@ -796,7 +1282,7 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 				if response.Done {
 					log.Info("Response marked as done after", responseCount, "responses")
 					if thinkingStarted {
-						outputCh <- "</think>"
+						outputCh <- legacyOnly("</think>")
 						thinkingStarted = false
 						assistantContent.WriteString("</think>")
 					}
@@ -806,6 +1292,40 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 			log.Info("Stream processing finished. Total responses:", responseCount, "HasToolCalls:", hasToolCalls)
 
+			// Fall back to an estimate when the provider did not report usage
+			if iterationUsage == nil {
+				iterationUsage = &providers.Usage{
+					PromptTokens: tokenizer.EstimateMessages(currentMessages) + tokenizer.EstimateTools(toolDefinitions),
+					CompletionTokens: tokenizer.EstimateTokens(iterationContent.String()) +
+						tokenizer.EstimateTokens(iterationThinking.String()) +
+						tokenizer.EstimateMessages([]providers.ChatMessage{{ToolCalls: pendingToolCalls}}),
+				}
+				usageEstimated = true
+			}
+			usage.PromptTokens += iterationUsage.PromptTokens
+			usage.CompletionTokens += iterationUsage.CompletionTokens
+
+			if genCtx.Err() != nil {
+				if thinkingStarted {
+					assistantContent.WriteString("</think>")
+				}
+				s.saveStoppedMessage(genCtx, firstAssistant, assistantContent.String())
+				return
+			}
+
+			// Keep what was streamed before the provider failed
+			if streamErr != nil {
+				log.Error("Response stream failed:", streamErr)
+				errorCode, errorMsg := describeProviderError(streamErr)
+				outputCh <- errorEvent(errorCode, errorMsg)
+				if assistantContent.Len() > 0 {
+					assistantContent.WriteString("\n\n")
+				}
+				assistantContent.WriteString(errorMsg)
+				s.UpdateAssistantMessage(firstAssistant, assistantContent.String())
+				return
+			}
+
 			// If no tool calls were made, we're done
 			if !hasToolCalls {
 				// Update the assistant message with full content
@@ -815,23 +1335,31 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 
 			// Close thinking if open before processing tools
 			if thinkingStarted {
-				outputCh <- "</think>"
+				outputCh <- legacyOnly("</think>")
 				thinkingStarted = false
 				assistantContent.WriteString("</think>")
 			}
 
 			// IMPORTANT: Add the assistant's response to the message history
 			// This helps the LLM understand what it has already said and prevents re-calling tools
+			pendingToolCalls = normalizeToolCalls(pendingToolCalls)
 			assistantMessage := providers.ChatMessage{
-				Role:    "assistant",
-				Content: cleanAssistantContent(assistantContent.String()),
+				Role:           "assistant",
+				Content:        cleanAssistantContent(iterationContent.String()),
+				ToolCalls:      pendingToolCalls,
+				ThinkingBlocks: iterationThinkingBlocks,
 			}
 			currentMessages = append(currentMessages, assistantMessage)
 
+			// Persist the tool calls so the history can be replayed on the next turn
+			if _, err := s.CreateToolCallMessage(session.ID, firstAssistant.ID, pendingToolCalls); err != nil {
+				log.Error("Failed to save tool call message:", err)
+			}
+
 			// Process tool calls and update messages for next iteration
 			var shouldStop bool
 			var stopReason string
-			currentMessages, shouldStop, stopReason = s.processToolCalls(session, pendingToolCalls, currentMessages, outputCh, &assistantContent, toolCallCounter, outputFormat)
+			currentMessages, shouldStop, stopReason = s.processToolCalls(genCtx, session, firstAssistant.ID, pendingToolCalls, currentMessages, outputCh, &assistantContent, toolCallCounter, outputFormat)
 
 			// If we should stop (e.g., tool call limit exceeded), save message and exit
 			if shouldStop {
@@ -845,6 +1373,58 @@ func (s *MessagingService) GenerateChatResponse(session *entities.Session, messa
 	return outputCh, firstAssistant, nil
 }
 
+// describeProviderError returns the error code and the user facing message of a
+// failed provider request, classified by the status code the provider answered with
+func describeProviderError(err error) (string, string) {
+	// Kullanıcı dostu hata mesajı gönder
+	errorMsg := "Özür dilerim, şu anda yanıt oluşturmakta zorlanıyorum. "
+	connectionMsg := errorMsg + "AI servisi ile bağlantı sorunu yaşanıyor gibi görünüyor. Lütfen bir süre sonra tekrar deneyin."
+
+	status, answered := providers.ErrorStatus(err)
+	if !answered {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+			return ErrorCodeProviderConnection, connectionMsg
+		}
+		return ErrorCodeProviderError, errorMsg + fmt.Sprintf("Hata detayları: %v", err)
+	}
+
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorCodeProviderAuth, errorMsg + "AI servisi ile kimlik doğrulama sorunu yaşanıyor. Lütfen bir yönetici ile iletişime geçin."
+	case http.StatusNotFound:
+		return ErrorCodeModelUnsupported, errorMsg + "Seçilen AI modeli kullanılamıyor veya araçları desteklemiyor. Lütfen farklı bir chatbot deneyin veya bir yönetici ile iletişime geçin."
+	case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrorCodeProviderConnection, connectionMsg
+	default:
+		return ErrorCodeProviderError, errorMsg + fmt.Sprintf("Hata detayları: %v", err)
+	}
+}
+
+// saveMessageUsage stores the token usage, model and latency of a generation on the assistant message
+func (s *MessagingService) saveMessageUsage(assistantMessage *entities.Message, chatbot entities.Chatbot, usage providers.Usage, estimated bool, latency time.Duration) {
+	providerID := chatbot.ProviderID
+	assistantMessage.Model = chatbot.ModelName
+	assistantMessage.ProviderID = &providerID
+	assistantMessage.PromptTokens = usage.PromptTokens
+	assistantMessage.CompletionTokens = usage.CompletionTokens
+	assistantMessage.UsageEstimated = estimated
+	assistantMessage.LatencyMs = latency.Milliseconds()
+
+	if err := s.DB.Model(&entities.Message{}).
+		Where("id = ?", assistantMessage.ID).
+		Updates(map[string]interface{}{
+			"model":             assistantMessage.Model,
+			"provider_id":       assistantMessage.ProviderID,
+			"prompt_tokens":     assistantMessage.PromptTokens,
+			"completion_tokens": assistantMessage.CompletionTokens,
+			"usage_estimated":   assistantMessage.UsageEstimated,
+			"latency_ms":        assistantMessage.LatencyMs,
+		}).Error; err != nil {
+		log.Error("Failed to save message usage:", err)
+	}
+}
+
 // UpdateAssistantMessage updates the assistant message with the full response
 func (s *MessagingService) UpdateAssistantMessage(assistantMessage *entities.Message, content string) {
 	if assistantMessage == nil {
@@ -0,0 +1,178 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sef/app/entities"
+	"sef/pkg/anthropic"
+	"sef/pkg/ollama"
+	"slices"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// branchedConversation is a session where the first answer to message 3 used
+// a tool and was regenerated as 7, and message 3 was edited as 8:
+//
+//	1 user ─ 2 assistant ─┬─ 3 user ─┬─ 4 assistant (5 tool call, 6 tool result)
+//	                      │          └─ 7 assistant
+//	                      └─ 8 user ─── 9 assistant ─ 10 user
+func branchedConversation() []entities.Message {
+	parent := func(id uint) *uint { return &id }
+	message := func(id uint, parentID *uint, role string) entities.Message {
+		return entities.Message{Base: entities.Base{ID: id}, ParentID: parentID, Role: role}
+	}
+
+	toolCall := message(5, parent(4), "assistant")
+	toolCall.ToolCalls = entities.MessageToolCalls{{ID: "call_1"}}
+
+	return []entities.Message{
+		message(1, nil, "user"),
+		message(2, parent(1), "assistant"),
+		message(3, parent(2), "user"),
+		message(4, parent(3), "assistant"),
+		toolCall,
+		message(6, parent(4), "tool"),
+		message(7, parent(3), "assistant"),
+		message(8, parent(2), "user"),
+		message(9, parent(8), "assistant"),
+		message(10, parent(9), "user"),
+	}
+}
+
+func messageIDs(messages []entities.Message) []uint {
+	ids := []uint{}
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestBranchMessages(t *testing.T) {
+	leaf := func(id uint) *uint { return &id }
+	tests := []struct {
+		name   string
+		leafID *uint
+		want   []uint
+	}{
+		{name: "no active message", leafID: nil, want: []uint{}},
+		{name: "branch with tool rows", leafID: leaf(4), want: []uint{1, 2, 3, 4, 5, 6}},
+		{name: "regenerated answer leaves out the old tool rows", leafID: leaf(7), want: []uint{1, 2, 3, 7}},
+		{name: "edited question", leafID: leaf(10), want: []uint{1, 2, 8, 9, 10}},
+		{name: "middle of a branch", leafID: leaf(3), want: []uint{1, 2, 3}},
+		{name: "unknown message", leafID: leaf(99), want: []uint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messageIDs(BranchMessages(branchedConversation(), tt.leafID))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("BranchMessages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchMessagesStopsOnCycles(t *testing.T) {
+	first, second := uint(1), uint(2)
+	messages := []entities.Message{
+		{Base: entities.Base{ID: 1}, ParentID: &second, Role: "user"},
+		{Base: entities.Base{ID: 2}, ParentID: &first, Role: "assistant"},
+	}
+
+	if got := messageIDs(BranchMessages(messages, &second)); !slices.Equal(got, []uint{1, 2}) {
+		t.Errorf("BranchMessages() = %v, want [1 2]", got)
+	}
+}
+
+func TestBranchLeaf(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID uint
+		want      uint
+		wantFound bool
+	}{
+		{name: "root follows the newest branches", messageID: 1, want: 10, wantFound: true},
+		{name: "newest answer of a question", messageID: 3, want: 7, wantFound: true},
+		{name: "older answer is its own leaf", messageID: 4, want: 4, wantFound: true},
+		{name: "edited question", messageID: 8, want: 10, wantFound: true},
+		{name: "leaf", messageID: 10, want: 10, wantFound: true},
+		{name: "tool call rows cannot be selected", messageID: 5},
+		{name: "tool results cannot be selected", messageID: 6},
+		{name: "unknown message", messageID: 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := BranchLeaf(branchedConversation(), tt.messageID)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("BranchLeaf(%d) = %d, %v, want %d, %v", tt.messageID, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestDescribeProviderError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "rejected api key",
+			err:  fmt.Errorf("failed to generate Ollama chat response with tools: %w", &ollama.StatusError{StatusCode: 401, Body: "unauthorized"}),
+			want: ErrorCodeProviderAuth,
+		},
+		{
+			name: "missing model",
+			err:  &openai.APIError{HTTPStatusCode: 404, Message: "The model does not exist"},
+			want: ErrorCodeModelUnsupported,
+		},
+		{
+			name: "overloaded in the middle of a stream",
+			err:  fmt.Errorf("anthropic stream error: %w", &anthropic.APIError{Type: "overloaded_error", Message: "Overloaded"}),
+			want: ErrorCodeProviderError,
+		},
+		{
+			name: "authentication error in the middle of a stream",
+			err:  &anthropic.APIError{Type: "authentication_error", Message: "invalid x-api-key"},
+			want: ErrorCodeProviderAuth,
+		},
+		{
+			name: "unavailable gateway",
+			err:  &anthropic.StatusError{StatusCode: 503, Body: "upstream connect error"},
+			want: ErrorCodeProviderConnection,
+		},
+		{
+			name: "refused connection",
+			err:  fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}),
+			want: ErrorCodeProviderConnection,
+		},
+		{
+			name: "deadline",
+			err:  fmt.Errorf("failed to send request: %w", context.DeadlineExceeded),
+			want: ErrorCodeProviderConnection,
+		},
+		{
+			name: "bad request mentioning the model",
+			err:  &ollama.StatusError{StatusCode: 400, Body: "invalid model options"},
+			want: ErrorCodeProviderError,
+		},
+		{
+			name: "message mentioning authentication",
+			err:  errors.New("tool arguments of author lookup are invalid"),
+			want: ErrorCodeProviderError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := describeProviderError(tt.err); got != tt.want {
+				t.Errorf("describeProviderError() code = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
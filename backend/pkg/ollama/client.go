@@ -20,6 +20,16 @@ type OllamaClient struct {
 	client  *http.Client
 }
 
+// StatusError is returned when the Ollama API answers with an error status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ollama API error (status %d): %s", e.StatusCode, e.Body)
+}
+
 // OllamaTool represents a tool/function that can be called
 type OllamaTool struct {
 	Type     string             `json:"type"`
@@ -39,12 +49,15 @@ type OllamaChatMessage struct {
 	Content   string           `json:"content"`
 	Thinking  string           `json:"thinking,omitempty"`
 	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // For tool result messages
 }
 
 // OllamaChatResponse represents the response from chat
 type OllamaChatResponse struct {
-	Message OllamaChatMessage `json:"message"`
-	Done    bool              `json:"done"`
+	Message         OllamaChatMessage `json:"message"`
+	Done            bool              `json:"done"`
+	PromptEvalCount int               `json:"prompt_eval_count,omitempty"` // Set on the final frame
+	EvalCount       int               `json:"eval_count,omitempty"`        // Set on the final frame
 }
 
 // OllamaToolCall represents a tool call in the response
@@ -144,7 +157,7 @@ func (oc *OllamaClient) generateText(ctx context.Context, req GenerateRequest) (
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API error: %s", string(body))
+		return "", &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var ollamaResp OllamaGenerateResponse
@@ -221,7 +234,7 @@ func (oc *OllamaClient) generateChatStream(ctx context.Context, req GenerateRequ
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("ollama API error: %s", string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	ch := make(chan OllamaChatResponse)
@@ -276,7 +289,7 @@ func (oc *OllamaClient) ListModels() ([]string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error: %s", string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var result OllamaListResponse
@@ -375,7 +388,7 @@ func (oc *OllamaClient) GenerateEmbedding(ctx context.Context, model string, tex
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error: %s", string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var embeddingResp EmbeddingResponse
@@ -386,8 +399,60 @@ func (oc *OllamaClient) GenerateEmbedding(ctx context.Context, model string, tex
 	return embeddingResp.Embedding, nil
 }
 
-// GenerateEmbeddings generates embeddings for multiple texts in batch
+// BatchEmbeddingRequest represents a request to the batch embed API
+type BatchEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// BatchEmbeddingResponse represents the response from the batch embed API
+type BatchEmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// GenerateEmbeddings generates embeddings for multiple texts in batch.
+// Ollama versions without the /api/embed endpoint get one request per text.
 func (oc *OllamaClient) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(BatchEmbeddingRequest{Model: model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", oc.baseURL+"/api/embed", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := oc.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return oc.generateEmbeddingsSequentially(ctx, model, texts)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var embeddingResp BatchEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(embeddingResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddingResp.Embeddings))
+	}
+
+	return embeddingResp.Embeddings, nil
+}
+
+// generateEmbeddingsSequentially generates embeddings one text at a time
+func (oc *OllamaClient) generateEmbeddingsSequentially(ctx context.Context, model string, texts []string) ([][]float32, error) {
 	embeddings := make([][]float32, len(texts))
 
 	for i, text := range texts {
@@ -0,0 +1,368 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sef/pkg/anthropic"
+	"strings"
+)
+
+// AnthropicProvider implements the LLMProvider interface for the Anthropic Messages API
+type AnthropicProvider struct {
+	client *anthropic.AnthropicClient
+}
+
+// NewAnthropicProvider creates a new Anthropic provider instance
+func NewAnthropicProvider(config map[string]interface{}) *AnthropicProvider {
+	baseURL := anthropic.DefaultBaseURL
+	if url, ok := config["base_url"].(string); ok && url != "" {
+		baseURL = url
+	}
+
+	apiKey := ""
+	if key, ok := config["api_key"].(string); ok {
+		apiKey = key
+	}
+
+	return &AnthropicProvider{
+		client: anthropic.NewAnthropicClient(baseURL, apiKey),
+	}
+}
+
+// ValidateConfig validates the Anthropic provider configuration
+func (a *AnthropicProvider) ValidateConfig(config map[string]interface{}) error {
+	if baseURL, ok := config["base_url"].(string); ok && baseURL != "" && baseURL != anthropic.DefaultBaseURL {
+		// Custom gateways may handle authentication themselves
+		return nil
+	}
+
+	if apiKey, ok := config["api_key"].(string); !ok || apiKey == "" {
+		return fmt.Errorf("api_key is required for Anthropic provider")
+	}
+	return nil
+}
+
+// Generate generates a response from Anthropic with streaming support
+func (a *AnthropicProvider) Generate(ctx context.Context, prompt string, options map[string]interface{}) (<-chan string, error) {
+	return a.GenerateChat(ctx, []ChatMessage{{Role: "user", Content: prompt}}, options)
+}
+
+// GenerateChat generates a response using the Messages API with proper message roles.
+// The response is collected before it is returned, so a stream that fails
+// after it started reaches the caller as an error instead of a short answer.
+func (a *AnthropicProvider) GenerateChat(ctx context.Context, messages []ChatMessage, options map[string]interface{}) (<-chan string, error) {
+	stream, err := a.GenerateChatWithTools(ctx, messages, nil, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	for response := range stream {
+		if response.Error != nil {
+			// Drain so the stream goroutine can exit
+			for range stream {
+			}
+			return nil, response.Error
+		}
+		content.WriteString(response.Content)
+		if response.Done {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan string, 1)
+	if content.Len() > 0 {
+		ch <- content.String()
+	}
+	close(ch)
+	return ch, nil
+}
+
+// GenerateChatWithTools generates a response using the Messages API with tool calling support
+func (a *AnthropicProvider) GenerateChatWithTools(ctx context.Context, messages []ChatMessage, tools []ToolDefinition, options map[string]interface{}) (<-chan ChatResponse, error) {
+	req := a.buildRequest(messages, tools, options)
+
+	stream, err := a.client.StreamMessages(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Anthropic chat response: %w", err)
+	}
+
+	ch := make(chan ChatResponse)
+	go func() {
+		defer close(ch)
+
+		// Every send gives up when the caller stops reading
+		send := func(response ChatResponse) bool {
+			select {
+			case ch <- response:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// Content blocks are streamed by index, tool input arrives as partial JSON
+		// and thinking arrives as text followed by its signature
+		blocks := make(map[int]*anthropic.ContentBlock)
+		toolInputs := make(map[int]*strings.Builder)
+
+		// Input tokens arrive with message_start, output tokens with message_delta
+		usage := &Usage{}
+
+		for event := range stream {
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					usage.PromptTokens = event.Message.Usage.InputTokens
+				}
+
+			case "message_delta":
+				if event.Usage != nil {
+					usage.CompletionTokens = event.Usage.OutputTokens
+				}
+
+			case "content_block_start":
+				if event.ContentBlock == nil {
+					continue
+				}
+				switch event.ContentBlock.Type {
+				case "tool_use":
+					blocks[event.Index] = event.ContentBlock
+					toolInputs[event.Index] = &strings.Builder{}
+				case "thinking", "redacted_thinking":
+					blocks[event.Index] = event.ContentBlock
+				}
+
+			case "content_block_delta":
+				if event.Delta == nil {
+					continue
+				}
+				switch event.Delta.Type {
+				case "text_delta":
+					if event.Delta.Text != "" && !send(ChatResponse{Content: event.Delta.Text}) {
+						return
+					}
+				case "thinking_delta":
+					if block, ok := blocks[event.Index]; ok {
+						block.Thinking += event.Delta.Thinking
+					}
+					if event.Delta.Thinking != "" && !send(ChatResponse{Thinking: event.Delta.Thinking}) {
+						return
+					}
+				case "signature_delta":
+					if block, ok := blocks[event.Index]; ok {
+						block.Signature += event.Delta.Signature
+					}
+				case "input_json_delta":
+					if input, ok := toolInputs[event.Index]; ok {
+						input.WriteString(event.Delta.PartialJSON)
+					}
+				}
+
+			case "content_block_stop":
+				block, ok := blocks[event.Index]
+				if !ok {
+					continue
+				}
+				delete(blocks, event.Index)
+
+				var response ChatResponse
+				switch block.Type {
+				case "thinking":
+					response.ThinkingBlocks = []ThinkingBlock{{Thinking: block.Thinking, Signature: block.Signature}}
+				case "redacted_thinking":
+					response.ThinkingBlocks = []ThinkingBlock{{RedactedData: block.Data}}
+				default:
+					args := map[string]interface{}{}
+					if raw := toolInputs[event.Index].String(); raw != "" {
+						if err := json.Unmarshal([]byte(raw), &args); err != nil {
+							args = map[string]interface{}{"raw": raw}
+						}
+					}
+					delete(toolInputs, event.Index)
+
+					response.ToolCalls = []ToolCall{{
+						ID:   block.ID,
+						Type: "function",
+						Function: ToolCallFunction{
+							Name:      block.Name,
+							Arguments: args,
+						},
+					}}
+				}
+				if !send(response) {
+					return
+				}
+
+			case "message_stop":
+				send(ChatResponse{Done: true, Usage: usage})
+				return
+
+			case "error":
+				err := fmt.Errorf("anthropic stream error: unknown error")
+				if event.Error != nil {
+					err = fmt.Errorf("anthropic stream error: %w", event.Error)
+				}
+				send(ChatResponse{Error: err, Done: true})
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// buildRequest converts provider messages and tools to a Messages API request
+func (a *AnthropicProvider) buildRequest(messages []ChatMessage, tools []ToolDefinition, options map[string]interface{}) anthropic.MessagesRequest {
+	model := "claude-sonnet-4-5" // Default model
+	if m, ok := options["model"].(string); ok && m != "" {
+		model = m
+	}
+
+	maxTokens := 4096
+	if mt, ok := options["max_tokens"].(int); ok && mt > 0 {
+		maxTokens = mt
+	}
+
+	req := anthropic.MessagesRequest{
+		Model:     model,
+		MaxTokens: maxTokens,
+	}
+
+	if temp, ok := options["temperature"].(float64); ok {
+		req.Temperature = &temp
+	}
+
+	// Extended thinking needs a token budget that fits inside max_tokens
+	if budget, ok := options["thinking_budget"].(int); ok && budget > 0 {
+		if req.MaxTokens <= budget {
+			req.MaxTokens = budget + maxTokens
+		}
+		req.Thinking = &anthropic.Thinking{Type: "enabled", BudgetTokens: budget}
+		req.Temperature = nil // Thinking does not allow a custom temperature
+	}
+
+	var systemParts []string
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+		appendAnthropicMessage(&req.Messages, convertToAnthropicMessage(msg))
+	}
+	req.System = strings.Join(systemParts, "\n\n")
+
+	for _, tool := range tools {
+		req.Tools = append(req.Tools, anthropic.Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: anthropicInputSchema(tool.Function.Parameters),
+		})
+	}
+
+	return req
+}
+
+// convertToAnthropicMessage converts a single chat message to Anthropic content blocks
+func convertToAnthropicMessage(msg ChatMessage) anthropic.Message {
+	switch msg.Role {
+	case "assistant":
+		// Thinking has to come first and unchanged, or the API rejects the tool results
+		var content []anthropic.ContentBlock
+		for _, block := range msg.ThinkingBlocks {
+			if block.RedactedData != "" {
+				content = append(content, anthropic.ContentBlock{Type: "redacted_thinking", Data: block.RedactedData})
+				continue
+			}
+			content = append(content, anthropic.ContentBlock{Type: "thinking", Thinking: block.Thinking, Signature: block.Signature})
+		}
+		content = append(content, anthropic.ContentBlock{Type: "text", Text: msg.Content})
+		for _, toolCall := range msg.ToolCalls {
+			input := toolCall.Function.Arguments
+			if input == nil {
+				input = map[string]interface{}{}
+			}
+			content = append(content, anthropic.ContentBlock{
+				Type:  "tool_use",
+				ID:    toolCall.ID,
+				Name:  toolCall.Function.Name,
+				Input: input,
+			})
+		}
+		return anthropic.Message{
+			Role:    "assistant",
+			Content: content,
+		}
+	case "tool":
+		// Tool results are sent back in a user turn referencing the tool_use block
+		if msg.ToolCallID != "" {
+			return anthropic.Message{
+				Role: "user",
+				Content: []anthropic.ContentBlock{{
+					Type:      "tool_result",
+					ToolUseID: msg.ToolCallID,
+					Content:   msg.Content,
+				}},
+			}
+		}
+		return anthropic.Message{
+			Role:    "user",
+			Content: []anthropic.ContentBlock{{Type: "text", Text: "Tool result:\n" + msg.Content}},
+		}
+	default:
+		return anthropic.Message{
+			Role:    "user",
+			Content: []anthropic.ContentBlock{{Type: "text", Text: msg.Content}},
+		}
+	}
+}
+
+// appendAnthropicMessage appends a message, merging consecutive turns of the same role
+// since the Messages API requires user and assistant turns to alternate
+func appendAnthropicMessage(messages *[]anthropic.Message, msg anthropic.Message) {
+	// Empty text blocks are rejected by the API
+	content := msg.Content[:0]
+	for _, block := range msg.Content {
+		if block.Type == "text" && strings.TrimSpace(block.Text) == "" {
+			continue
+		}
+		content = append(content, block)
+	}
+	if len(content) == 0 {
+		return
+	}
+	msg.Content = content
+
+	if n := len(*messages); n > 0 && (*messages)[n-1].Role == msg.Role {
+		(*messages)[n-1].Content = append((*messages)[n-1].Content, msg.Content...)
+		return
+	}
+	*messages = append(*messages, msg)
+}
+
+// anthropicInputSchema makes sure the tool parameters are a JSON schema object
+func anthropicInputSchema(parameters map[string]interface{}) map[string]interface{} {
+	if parameters == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+
+	// TOON formatted parameters are not a JSON schema, describe them instead
+	if toonContent, ok := parameters["toon_content"].(string); ok {
+		return map[string]interface{}{
+			"type":        "object",
+			"description": toonContent,
+			"properties":  map[string]interface{}{},
+		}
+	}
+
+	return parameters
+}
+
+// ListModels returns available models from Anthropic
+func (a *AnthropicProvider) ListModels() ([]string, error) {
+	return a.client.ListModels()
+}
@@ -0,0 +1,297 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sse formats recorded Messages API events as a server-sent event stream
+func sse(events ...string) string {
+	var b strings.Builder
+	for _, event := range events {
+		b.WriteString("data: " + event + "\n\n")
+	}
+	return b.String()
+}
+
+const (
+	messageStart = `{"type":"message_start","message":{"id":"msg_01","model":"claude-sonnet-4-5","usage":{"input_tokens":42,"output_tokens":1}}}`
+	messageStop  = `{"type":"message_stop"}`
+)
+
+// replayAnthropic streams the recorded events through an Anthropic provider
+func replayAnthropic(t *testing.T, stream string) []ChatResponse {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, stream)
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewAnthropicProvider(map[string]interface{}{"base_url": server.URL, "api_key": "test-key"})
+	ch, err := provider.GenerateChatWithTools(context.Background(), []ChatMessage{{Role: "user", Content: "Hi"}}, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateChatWithTools() error = %v", err)
+	}
+
+	var responses []ChatResponse
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case response, ok := <-ch:
+			if !ok {
+				return responses
+			}
+			responses = append(responses, response)
+		case <-timeout:
+			t.Fatal("response stream was not closed")
+		}
+	}
+}
+
+func TestAnthropicGenerateChatWithToolsTextAndUsage(t *testing.T) {
+	responses := replayAnthropic(t, sse(
+		messageStart,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Merhaba"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" dünya"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		messageStop,
+	))
+
+	var content strings.Builder
+	for _, response := range responses {
+		content.WriteString(response.Content)
+	}
+	if content.String() != "Merhaba dünya" {
+		t.Errorf("content = %q, want %q", content.String(), "Merhaba dünya")
+	}
+
+	last := responses[len(responses)-1]
+	if !last.Done || last.Error != nil {
+		t.Fatalf("last response = %+v, want done without error", last)
+	}
+	if last.Usage == nil || last.Usage.PromptTokens != 42 || last.Usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v, want 42 prompt and 7 completion tokens", last.Usage)
+	}
+}
+
+func TestAnthropicGenerateChatWithToolsToolUse(t *testing.T) {
+	responses := replayAnthropic(t, sse(
+		messageStart,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_01","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\": \"Ank"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"ara\", \"days\": 3}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_02","name":"get_time","input":{}}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+		messageStop,
+	))
+
+	var calls []ToolCall
+	for _, response := range responses {
+		calls = append(calls, response.ToolCalls...)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(calls))
+	}
+
+	weather := calls[0]
+	if weather.ID != "toolu_01" || weather.Function.Name != "get_weather" {
+		t.Errorf("first tool call = %+v, want toolu_01 get_weather", weather)
+	}
+	if weather.Function.Arguments["city"] != "Ankara" || weather.Function.Arguments["days"] != float64(3) {
+		t.Errorf("arguments = %v, want the streamed JSON input", weather.Function.Arguments)
+	}
+	if calls[1].Function.Arguments == nil || len(calls[1].Function.Arguments) != 0 {
+		t.Errorf("arguments without input = %v, want an empty object", calls[1].Function.Arguments)
+	}
+}
+
+func TestAnthropicGenerateChatWithToolsThinking(t *testing.T) {
+	responses := replayAnthropic(t, sse(
+		messageStart,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"The user greets, "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"answer politely."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"EqQBCgIYAhIM"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"EmwKAhgBEgy3va"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"Hello!"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		messageStop,
+	))
+
+	var thinking strings.Builder
+	var blocks []ThinkingBlock
+	for _, response := range responses {
+		thinking.WriteString(response.Thinking)
+		blocks = append(blocks, response.ThinkingBlocks...)
+	}
+
+	if thinking.String() != "The user greets, answer politely." {
+		t.Errorf("thinking = %q, want the streamed deltas", thinking.String())
+	}
+	want := []ThinkingBlock{
+		{Thinking: "The user greets, answer politely.", Signature: "EqQBCgIYAhIM"},
+		{RedactedData: "EmwKAhgBEgy3va"},
+	}
+	if len(blocks) != len(want) || blocks[0] != want[0] || blocks[1] != want[1] {
+		t.Errorf("thinking blocks = %+v, want %+v", blocks, want)
+	}
+}
+
+func TestAnthropicGenerateChatWithToolsErrorEvent(t *testing.T) {
+	responses := replayAnthropic(t, sse(
+		messageStart,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	))
+
+	last := responses[len(responses)-1]
+	if !last.Done || last.Error == nil {
+		t.Fatalf("last response = %+v, want done with an error", last)
+	}
+	if !strings.Contains(last.Error.Error(), "overloaded_error") || !strings.Contains(last.Error.Error(), "Overloaded") {
+		t.Errorf("error = %v, want the API error type and message", last.Error)
+	}
+	for _, response := range responses {
+		if strings.Contains(response.Content, "Error") {
+			t.Errorf("error was streamed as content: %q", response.Content)
+		}
+	}
+}
+
+func TestAnthropicGenerateChat(t *testing.T) {
+	textBlock := `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`
+	tests := []struct {
+		name    string
+		status  int
+		stream  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "complete answer",
+			status: http.StatusOK,
+			stream: sse(
+				messageStart,
+				textBlock,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+				messageStop,
+			),
+			want: "Hello world",
+		},
+		{
+			name:   "stream fails after it started",
+			status: http.StatusOK,
+			stream: sse(
+				messageStart,
+				textBlock,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`,
+				`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			),
+			wantErr: "overloaded_error",
+		},
+		{
+			name:    "rejected request",
+			status:  http.StatusUnauthorized,
+			stream:  `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			wantErr: "status 401",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.stream)
+			}))
+			defer server.Close()
+
+			provider := NewAnthropicProvider(map[string]interface{}{"base_url": server.URL, "api_key": "test-key"})
+			ch, err := provider.GenerateChat(context.Background(), []ChatMessage{{Role: "user", Content: "Hi"}}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GenerateChat() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateChat() error = %v", err)
+			}
+
+			var got strings.Builder
+			for chunk := range ch {
+				got.WriteString(chunk)
+			}
+			if got.String() != tt.want {
+				t.Errorf("GenerateChat() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicBuildRequestThinking(t *testing.T) {
+	provider := NewAnthropicProvider(map[string]interface{}{"api_key": "test-key"})
+	messages := []ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Weather in Ankara?"},
+		{
+			Role:           "assistant",
+			ThinkingBlocks: []ThinkingBlock{{Thinking: "Call the tool.", Signature: "sig"}, {RedactedData: "secret"}},
+			ToolCalls:      []ToolCall{{ID: "toolu_01", Function: ToolCallFunction{Name: "get_weather", Arguments: map[string]interface{}{"city": "Ankara"}}}},
+		},
+		{Role: "tool", ToolCallID: "toolu_01", Content: "Sunny"},
+	}
+
+	req := provider.buildRequest(messages, nil, map[string]interface{}{
+		"model":           "claude-sonnet-4-5",
+		"temperature":     0.5,
+		"thinking_budget": 2048,
+	})
+
+	if req.Thinking == nil || req.Thinking.Type != "enabled" || req.Thinking.BudgetTokens != 2048 {
+		t.Fatalf("thinking = %+v, want enabled with a 2048 token budget", req.Thinking)
+	}
+	if req.MaxTokens <= 2048 {
+		t.Errorf("max tokens = %d, want more than the thinking budget", req.MaxTokens)
+	}
+	if req.Temperature != nil {
+		t.Errorf("temperature = %v, want none with thinking", *req.Temperature)
+	}
+	if req.System != "Be brief." {
+		t.Errorf("system = %q, want the system message", req.System)
+	}
+
+	if len(req.Messages) != 3 {
+		t.Fatalf("got %d messages, want user, assistant and tool result turns", len(req.Messages))
+	}
+	assistant := req.Messages[1]
+	var types []string
+	for _, block := range assistant.Content {
+		types = append(types, block.Type)
+	}
+	if strings.Join(types, ",") != "thinking,redacted_thinking,tool_use" {
+		t.Fatalf("assistant blocks = %v, want thinking first and no empty text", types)
+	}
+	if assistant.Content[0].Signature != "sig" || assistant.Content[1].Data != "secret" {
+		t.Errorf("assistant thinking = %+v, want the signed blocks unchanged", assistant.Content[:2])
+	}
+	if result := req.Messages[2].Content[0]; result.Type != "tool_result" || result.ToolUseID != "toolu_01" {
+		t.Errorf("tool result = %+v, want a tool_result for toolu_01", result)
+	}
+}
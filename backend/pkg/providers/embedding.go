@@ -14,6 +14,9 @@ import (
 type EmbeddingProvider interface {
 	// GenerateEmbedding generates embeddings for a given text
 	GenerateEmbedding(ctx context.Context, model string, text string) ([]float32, error)
+	// GenerateEmbeddings generates embeddings for several texts in one request,
+	// returned in the same order as the texts
+	GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error)
 	// ListModels returns available models for the provider
 	ListModels() ([]string, error)
 }
@@ -39,6 +42,10 @@ func (o *OllamaEmbeddingProvider) GenerateEmbedding(ctx context.Context, model s
 	return o.client.GenerateEmbedding(ctx, model, text)
 }
 
+func (o *OllamaEmbeddingProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	return o.client.GenerateEmbeddings(ctx, model, texts)
+}
+
 func (o *OllamaEmbeddingProvider) ListModels() ([]string, error) {
 	return o.client.ListModels()
 }
@@ -67,19 +74,37 @@ func NewOpenAIEmbeddingProvider(config map[string]interface{}) *OpenAIEmbeddingP
 }
 
 func (o *OpenAIEmbeddingProvider) GenerateEmbedding(ctx context.Context, model string, text string) ([]float32, error) {
+	embeddings, err := o.GenerateEmbeddings(ctx, model, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+func (o *OpenAIEmbeddingProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
 	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Model: openai.EmbeddingModel(model),
-		Input: []string{text},
+		Input: texts,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data returned")
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	// Results carry the index of their input and are not guaranteed to be in order
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
 	}
 
-	return resp.Data[0].Embedding, nil
+	return embeddings, nil
 }
 
 func (o *OpenAIEmbeddingProvider) ListModels() ([]string, error) {
@@ -128,6 +153,10 @@ func (o *LiteLLMEmbeddingProvider) GenerateEmbedding(ctx context.Context, model
 	return o.client.GenerateEmbedding(ctx, model, text)
 }
 
+func (o *LiteLLMEmbeddingProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	return o.client.GenerateEmbeddings(ctx, model, texts)
+}
+
 func (o *LiteLLMEmbeddingProvider) ListModels() ([]string, error) {
 	return o.client.ListModels()
 }
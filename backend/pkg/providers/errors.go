@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"errors"
+	"sef/pkg/anthropic"
+	"sef/pkg/ollama"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrorStatus returns the HTTP status code a provider API rejected a request
+// with, or false when the request failed before the API answered
+func ErrorStatus(err error) (int, bool) {
+	var ollamaErr *ollama.StatusError
+	var anthropicErr *anthropic.StatusError
+	var anthropicStreamErr *anthropic.APIError
+	var openaiErr *openai.APIError
+	var openaiRequestErr *openai.RequestError
+
+	switch {
+	case errors.As(err, &ollamaErr):
+		return ollamaErr.StatusCode, true
+	case errors.As(err, &anthropicErr):
+		return anthropicErr.StatusCode, true
+	case errors.As(err, &anthropicStreamErr):
+		return anthropicStreamErr.StatusCode(), true
+	case errors.As(err, &openaiErr) && openaiErr.HTTPStatusCode > 0:
+		return openaiErr.HTTPStatusCode, true
+	case errors.As(err, &openaiRequestErr) && openaiRequestErr.HTTPStatusCode > 0:
+		return openaiRequestErr.HTTPStatusCode, true
+	}
+	return 0, false
+}
@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -23,6 +25,23 @@ type LLMProvider interface {
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are the tool calls requested by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a tool message to the assistant tool call it answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Name is the function name of the tool that produced a tool message
+	Name string `json:"name,omitempty"`
+	// ThinkingBlocks are the signed reasoning blocks of an assistant message,
+	// providers that require them are sent them back with the tool calls
+	ThinkingBlocks []ThinkingBlock `json:"thinking_blocks,omitempty"`
+}
+
+// ThinkingBlock is a reasoning block that has to be replayed unchanged
+type ThinkingBlock struct {
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// RedactedData is set instead of Thinking for encrypted reasoning
+	RedactedData string `json:"redacted_data,omitempty"`
 }
 
 // ToolDefinition represents a tool that can be called by the LLM
@@ -40,10 +59,19 @@ type ToolFunction struct {
 
 // ChatResponse represents a streaming response that can contain content, tool calls, or thinking
 type ChatResponse struct {
-	Content   string     `json:"content,omitempty"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
-	Thinking  string     `json:"thinking,omitempty"`
-	Done      bool       `json:"done"`
+	Content        string          `json:"content,omitempty"`
+	ToolCalls      []ToolCall      `json:"tool_calls,omitempty"`
+	Thinking       string          `json:"thinking,omitempty"`
+	ThinkingBlocks []ThinkingBlock `json:"thinking_blocks,omitempty"` // Completed reasoning blocks to replay with the tool calls
+	Usage          *Usage          `json:"usage,omitempty"`
+	Error          error           `json:"-"` // Set with Done when the stream failed after it started
+	Done           bool            `json:"done"`
+}
+
+// Usage represents the token usage reported by the provider for one request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 // ToolCall represents a tool call from the LLM
@@ -59,6 +87,15 @@ type ToolCallFunction struct {
 	Arguments map[string]interface{} `json:"arguments"`
 }
 
+// NewToolCallID generates an ID for providers that do not return tool call IDs
+func NewToolCallID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "call_unknown"
+	}
+	return "call_" + hex.EncodeToString(b)
+}
+
 // ProviderFactory creates provider instances
 type ProviderFactory struct{}
 
@@ -71,6 +108,8 @@ func (f *ProviderFactory) NewProvider(providerType string, config map[string]int
 		return NewOpenAIProvider(config), nil
 	case "litellm":
 		return NewLiteLLMProvider(config), nil
+	case "anthropic":
+		return NewAnthropicProvider(config), nil
 	default:
 		return nil, fmt.Errorf("unsupported provider type: %s", providerType)
 	}
@@ -54,13 +54,7 @@ func (o *OllamaProvider) GenerateChat(ctx context.Context, messages []ChatMessag
 	}
 
 	// Convert to Ollama chat messages
-	ollamaMessages := make([]ollama.OllamaChatMessage, len(messages))
-	for i, msg := range messages {
-		ollamaMessages[i] = ollama.OllamaChatMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	ollamaMessages := toOllamaMessages(messages)
 
 	req := ollama.GenerateRequest{
 		Mode:     "chat",
@@ -100,13 +94,7 @@ func (o *OllamaProvider) GenerateChatWithTools(ctx context.Context, messages []C
 	}
 
 	// Convert to Ollama chat messages
-	ollamaMessages := make([]ollama.OllamaChatMessage, len(messages))
-	for i, msg := range messages {
-		ollamaMessages[i] = ollama.OllamaChatMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+	ollamaMessages := toOllamaMessages(messages)
 
 	// Convert tools to Ollama format
 	var ollamaTools []ollama.OllamaTool
@@ -153,9 +141,17 @@ func (o *OllamaProvider) GenerateChatWithTools(ctx context.Context, messages []C
 				Done:     resp.Done,
 			}
 
-			// Convert Ollama tool calls to provider format
+			if resp.Done && (resp.PromptEvalCount > 0 || resp.EvalCount > 0) {
+				chatResp.Usage = &Usage{
+					PromptTokens:     resp.PromptEvalCount,
+					CompletionTokens: resp.EvalCount,
+				}
+			}
+
+			// Convert Ollama tool calls to provider format, Ollama does not assign IDs
 			for _, toolCall := range resp.Message.ToolCalls {
 				chatResp.ToolCalls = append(chatResp.ToolCalls, ToolCall{
+					ID:   NewToolCallID(),
 					Type: "function",
 					Function: ToolCallFunction{
 						Name:      toolCall.Function.Name,
@@ -171,6 +167,32 @@ func (o *OllamaProvider) GenerateChatWithTools(ctx context.Context, messages []C
 	return ch, nil
 }
 
+// toOllamaMessages converts provider messages to Ollama chat messages
+func toOllamaMessages(messages []ChatMessage) []ollama.OllamaChatMessage {
+	ollamaMessages := make([]ollama.OllamaChatMessage, len(messages))
+	for i, msg := range messages {
+		ollamaMessages[i] = ollama.OllamaChatMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+
+		for _, toolCall := range msg.ToolCalls {
+			ollamaMessages[i].ToolCalls = append(ollamaMessages[i].ToolCalls, ollama.OllamaToolCall{
+				Function: ollama.OllamaToolCallFunction{
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				},
+			})
+		}
+
+		// Ollama matches tool results by function name instead of call ID
+		if msg.Role == "tool" {
+			ollamaMessages[i].ToolName = msg.Name
+		}
+	}
+	return ollamaMessages
+}
+
 // ListModels returns available models from Ollama
 func (o *OllamaProvider) ListModels() ([]string, error) {
 	return o.client.ListModels()
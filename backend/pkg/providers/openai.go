@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -106,24 +107,7 @@ func (o *OpenAIProvider) GenerateChat(ctx context.Context, messages []ChatMessag
 	}
 
 	// Convert to OpenAI chat messages
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		var role string
-		switch msg.Role {
-		case "user":
-			role = openai.ChatMessageRoleUser
-		case "assistant":
-			role = openai.ChatMessageRoleAssistant
-		case "system":
-			role = openai.ChatMessageRoleSystem
-		default:
-			role = openai.ChatMessageRoleUser
-		}
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
 	req := openai.ChatCompletionRequest{
 		Model:    model,
@@ -176,26 +160,7 @@ func (o *OpenAIProvider) GenerateChatWithTools(ctx context.Context, messages []C
 	}
 
 	// Convert to OpenAI chat messages
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		var role string
-		switch msg.Role {
-		case "user":
-			role = openai.ChatMessageRoleUser
-		case "assistant":
-			role = openai.ChatMessageRoleAssistant
-		case "system":
-			role = openai.ChatMessageRoleSystem
-		case "tool":
-			role = openai.ChatMessageRoleTool
-		default:
-			role = openai.ChatMessageRoleUser
-		}
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		}
-	}
+	openaiMessages := toOpenAIMessages(messages)
 
 	// Convert tools to OpenAI format
 	var openaiTools []openai.Tool
@@ -214,6 +179,8 @@ func (o *OpenAIProvider) GenerateChatWithTools(ctx context.Context, messages []C
 		Model:    model,
 		Messages: openaiMessages,
 		Stream:   true,
+		// Usage is sent in an extra chunk after the finish reason
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
 	}
 
 	// Add tools if provided
@@ -239,67 +206,163 @@ func (o *OpenAIProvider) GenerateChatWithTools(ctx context.Context, messages []C
 		defer close(ch)
 		defer stream.Close()
 
+		// Tool calls are streamed as fragments keyed by index, the ID and name
+		// arrive with the first fragment and the arguments are split across the rest
+		var toolCalls []*streamedToolCall
+		toolCallsByIndex := make(map[int]*streamedToolCall)
+		var usage *Usage
+
 		for {
 			response, err := stream.Recv()
 			if err != nil {
 				break
 			}
 
+			if response.Usage != nil {
+				usage = &Usage{
+					PromptTokens:     response.Usage.PromptTokens,
+					CompletionTokens: response.Usage.CompletionTokens,
+				}
+			}
+
 			if len(response.Choices) == 0 {
 				continue
 			}
 
 			choice := response.Choices[0]
-			chatResp := ChatResponse{}
 
 			// Handle content
 			if choice.Delta.Content != "" {
-				chatResp.Content = choice.Delta.Content
+				ch <- ChatResponse{Content: choice.Delta.Content}
 			}
 
-			// Handle tool calls
-			if choice.Delta.ToolCalls != nil {
-				for _, toolCall := range choice.Delta.ToolCalls {
-					// Parse arguments JSON string if it's complete
-					var args map[string]interface{}
-					if toolCall.Function.Arguments != "" {
-						// Try to parse as JSON
-						if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-							// If not valid JSON yet (streaming), store raw
-							args = map[string]interface{}{"raw": toolCall.Function.Arguments}
-						}
-					}
-
-					chatResp.ToolCalls = append(chatResp.ToolCalls, ToolCall{
-						ID:   toolCall.ID,
-						Type: string(toolCall.Type),
-						Function: ToolCallFunction{
-							Name:      toolCall.Function.Name,
-							Arguments: args,
-						},
-					})
+			// Collect tool call fragments
+			for position, toolCall := range choice.Delta.ToolCalls {
+				index := position
+				if toolCall.Index != nil {
+					index = *toolCall.Index
 				}
-			}
 
-			// Check if finished
-			if choice.FinishReason != "" {
-				chatResp.Done = true
-			}
-
-			// Send response if there's content or tool calls
-			if chatResp.Content != "" || len(chatResp.ToolCalls) > 0 || chatResp.Done {
-				ch <- chatResp
+				accumulated, ok := toolCallsByIndex[index]
+				if !ok {
+					accumulated = &streamedToolCall{}
+					toolCallsByIndex[index] = accumulated
+					toolCalls = append(toolCalls, accumulated)
+				}
+				if toolCall.ID != "" {
+					accumulated.id = toolCall.ID
+				}
+				if toolCall.Type != "" {
+					accumulated.toolType = string(toolCall.Type)
+				}
+				if toolCall.Function.Name != "" {
+					accumulated.name = toolCall.Function.Name
+				}
+				accumulated.arguments.WriteString(toolCall.Function.Arguments)
 			}
+		}
 
-			if choice.FinishReason != "" {
-				break
-			}
+		chatResp := ChatResponse{Done: true, Usage: usage}
+		for _, toolCall := range toolCalls {
+			chatResp.ToolCalls = append(chatResp.ToolCalls, toolCall.toToolCall())
 		}
+		ch <- chatResp
 	}()
 
 	return ch, nil
 }
 
+// streamedToolCall accumulates a tool call streamed in fragments
+type streamedToolCall struct {
+	id        string
+	toolType  string
+	name      string
+	arguments strings.Builder
+}
+
+// toToolCall converts the accumulated fragments to a tool call
+func (s *streamedToolCall) toToolCall() ToolCall {
+	args := map[string]interface{}{}
+	if raw := s.arguments.String(); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			// Keep invalid JSON as raw so the error surfaces when the tool is executed
+			args = map[string]interface{}{"raw": raw}
+		}
+	}
+
+	toolType := s.toolType
+	if toolType == "" {
+		toolType = "function"
+	}
+
+	id := s.id
+	if id == "" {
+		id = NewToolCallID()
+	}
+
+	return ToolCall{
+		ID:   id,
+		Type: toolType,
+		Function: ToolCallFunction{
+			Name:      s.name,
+			Arguments: args,
+		},
+	}
+}
+
+// toOpenAIMessages converts provider messages to OpenAI chat messages
+func toOpenAIMessages(messages []ChatMessage) []openai.ChatCompletionMessage {
+	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		var role string
+		switch msg.Role {
+		case "user":
+			role = openai.ChatMessageRoleUser
+		case "assistant":
+			role = openai.ChatMessageRoleAssistant
+		case "system":
+			role = openai.ChatMessageRoleSystem
+		case "tool":
+			role = openai.ChatMessageRoleTool
+		default:
+			role = openai.ChatMessageRoleUser
+		}
+		openaiMessages[i] = openai.ChatCompletionMessage{
+			Role:       role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		for _, toolCall := range msg.ToolCalls {
+			openaiMessages[i].ToolCalls = append(openaiMessages[i].ToolCalls, openai.ToolCall{
+				ID:   toolCall.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      toolCall.Function.Name,
+					Arguments: encodeToolArguments(toolCall.Function.Arguments),
+				},
+			})
+		}
+	}
+	return openaiMessages
+}
+
+// encodeToolArguments converts parsed tool arguments back to the JSON string OpenAI expects
+func encodeToolArguments(args map[string]interface{}) string {
+	if raw, ok := args["raw"].(string); ok && len(args) == 1 {
+		return raw
+	}
+	if args == nil {
+		return "{}"
+	}
+
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
 // ListModels returns available models from OpenAI
 func (o *OpenAIProvider) ListModels() ([]string, error) {
 	models, err := o.client.ListModels(context.Background())
@@ -24,6 +24,13 @@ type Point struct {
 	Payload map[string]interface{} `json:"payload,omitempty"`
 }
 
+// IndexedPayloadFields are the payload fields every collection indexes, so
+// filtering by document or chatbot stays fast with many documents
+var IndexedPayloadFields = map[string]qdrant.FieldType{
+	"document_id": qdrant.FieldType_FieldTypeInteger,
+	"chatbot_ids": qdrant.FieldType_FieldTypeInteger,
+}
+
 // SearchResult represents a search result from Qdrant (kept for backward compatibility)
 type SearchResult struct {
 	ID      interface{}            `json:"id"`
@@ -108,10 +115,55 @@ func (q *QdrantClient) CreateCollection(collectionName string, vectorSize int, d
 		return err
 	}
 
+	for field, fieldType := range IndexedPayloadFields {
+		if err := q.createFieldIndex(ctx, collectionName, field, fieldType); err != nil {
+			return err
+		}
+	}
+
 	log.Infof("Successfully created collection '%s'", collectionName)
 	return nil
 }
 
+// EnsurePayloadIndexes creates the payload indexes missing on a collection
+// that was created before they were introduced
+func (q *QdrantClient) EnsurePayloadIndexes(collectionName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := q.client.GetCollectionInfo(ctx, collectionName)
+	if err != nil {
+		return fmt.Errorf("failed to get collection info: %w", err)
+	}
+
+	for field, fieldType := range IndexedPayloadFields {
+		if _, ok := info.GetPayloadSchema()[field]; ok {
+			continue
+		}
+		if err := q.createFieldIndex(ctx, collectionName, field, fieldType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createFieldIndex creates a payload index and waits until it is built
+func (q *QdrantClient) createFieldIndex(ctx context.Context, collectionName, field string, fieldType qdrant.FieldType) error {
+	log.Infof("Creating payload index on '%s' in collection '%s'", field, collectionName)
+
+	_, err := q.client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: collectionName,
+		FieldName:      field,
+		FieldType:      fieldType.Enum(),
+		Wait:           qdrant.PtrOf(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create payload index on %s: %w", field, err)
+	}
+	return nil
+}
+
 // CollectionExists checks if a collection exists
 func (q *QdrantClient) CollectionExists(collectionName string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -129,6 +181,18 @@ func (q *QdrantClient) CollectionExists(collectionName string) (bool, error) {
 	return exists, nil
 }
 
+// ListCollections returns the names of all collections
+func (q *QdrantClient) ListCollections() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collections, err := q.client.ListCollections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return collections, nil
+}
+
 // DeleteCollection deletes a collection
 func (q *QdrantClient) DeleteCollection(collectionName string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -182,25 +246,7 @@ func (q *QdrantClient) UpsertPoints(collectionName string, points []Point) (err
 	// Convert our Point type to Qdrant PointStruct
 	qdrantPoints := make([]*qdrant.PointStruct, len(points))
 	for i, point := range points {
-		// Convert ID to appropriate type
-		var pointID *qdrant.PointId
-		switch v := point.ID.(type) {
-		case string:
-			// For string IDs, we need to convert to a numeric ID
-			// since Qdrant only supports UUID or numeric IDs
-			// We'll hash the string to get a consistent numeric ID
-			pointID = qdrant.NewIDNum(hashStringToUint64(v))
-		case int:
-			pointID = qdrant.NewIDNum(uint64(v))
-		case uint64:
-			pointID = qdrant.NewIDNum(v)
-		case int64:
-			pointID = qdrant.NewIDNum(uint64(v))
-		default:
-			// Convert to string and hash
-			strID := fmt.Sprintf("%v", v)
-			pointID = qdrant.NewIDNum(hashStringToUint64(strID))
-		}
+		pointID := toPointID(point.ID)
 
 		// Sanitize payload to ensure all values are compatible with NewValueMap
 		// NewValueMap can panic on certain types, so we need to ensure compatibility
@@ -242,6 +288,103 @@ func (q *QdrantClient) UpsertPoints(collectionName string, points []Point) (err
 	return err
 }
 
+// toPointID converts an ID to a Qdrant point ID
+func toPointID(id interface{}) *qdrant.PointId {
+	switch v := id.(type) {
+	case string:
+		// For string IDs, we need to convert to a numeric ID
+		// since Qdrant only supports UUID or numeric IDs
+		// We'll hash the string to get a consistent numeric ID
+		return qdrant.NewIDNum(hashStringToUint64(v))
+	case int:
+		return qdrant.NewIDNum(uint64(v))
+	case uint64:
+		return qdrant.NewIDNum(v)
+	case int64:
+		return qdrant.NewIDNum(uint64(v))
+	default:
+		// Convert to string and hash
+		strID := fmt.Sprintf("%v", v)
+		return qdrant.NewIDNum(hashStringToUint64(strID))
+	}
+}
+
+// ScrollPoints returns all points matching the filter with their payload and optionally their vectors
+func (q *QdrantClient) ScrollPoints(collectionName string, filter map[string]interface{}, withVectors bool) ([]Point, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	request := &qdrant.ScrollPoints{
+		CollectionName: collectionName,
+		Limit:          qdrant.PtrOf(uint32(256)),
+		WithPayload:    qdrant.NewWithPayload(true),
+		WithVectors:    qdrant.NewWithVectors(withVectors),
+	}
+	if filter != nil {
+		request.Filter = convertFilter(filter)
+	}
+
+	var points []Point
+	for {
+		retrieved, offset, err := q.client.ScrollAndOffset(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scroll points: %w", err)
+		}
+
+		for _, point := range retrieved {
+			var id interface{}
+			if point.Id.GetNum() != 0 {
+				id = point.Id.GetNum()
+			} else {
+				id = point.Id.GetUuid()
+			}
+
+			var vector []float32
+			if output := point.GetVectors().GetVector(); output != nil {
+				if dense := output.GetDense(); dense != nil {
+					vector = dense.GetData()
+				} else {
+					vector = output.GetData()
+				}
+			}
+
+			payload := make(map[string]interface{})
+			if point.Payload != nil {
+				payload = convertPayloadToMap(point.Payload)
+			}
+
+			points = append(points, Point{ID: id, Vector: vector, Payload: payload})
+		}
+
+		if offset == nil {
+			return points, nil
+		}
+		request.Offset = offset
+	}
+}
+
+// DeletePointsByID deletes points by their IDs
+func (q *QdrantClient) DeletePointsByID(collectionName string, ids []interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pointIDs := make([]*qdrant.PointId, len(ids))
+	for i, id := range ids {
+		pointIDs[i] = toPointID(id)
+	}
+
+	_, err := q.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: collectionName,
+		Points:         qdrant.NewPointsSelector(pointIDs...),
+	})
+
+	return err
+}
+
 // Search performs a vector similarity search
 func (q *QdrantClient) Search(collectionName string, vector []float32, limit int, filter map[string]interface{}) ([]SearchResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -321,6 +464,25 @@ func (q *QdrantClient) DeletePoints(collectionName string, filter map[string]int
 	return err
 }
 
+// SetPayload sets payload keys of all points matching the filter, keeping their other keys
+func (q *QdrantClient) SetPayload(collectionName string, filter map[string]interface{}, payload map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	qdrantFilter := convertFilter(filter)
+	if qdrantFilter == nil {
+		return fmt.Errorf("invalid filter provided")
+	}
+
+	_, err := q.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
+		CollectionName: collectionName,
+		Payload:        qdrant.NewValueMap(payload),
+		PointsSelector: qdrant.NewPointsSelectorFilter(qdrantFilter),
+	})
+
+	return err
+}
+
 // CountPoints returns the number of points in a collection
 func (q *QdrantClient) CountPoints(collectionName string, filter map[string]interface{}) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
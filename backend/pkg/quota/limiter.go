@@ -0,0 +1,297 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sef/app/entities"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+)
+
+// Limit names reported when a quota is exceeded
+const (
+	LimitMessagesPerMinute     = "messages_per_minute"
+	LimitTokensPerDay          = "tokens_per_day"
+	LimitConcurrentGenerations = "concurrent_generations"
+)
+
+const (
+	// concurrencyTTL frees slots of generations that never released them, e.g. after a crash
+	concurrencyTTL = 15 * time.Minute
+	// concurrencyRetryAfter is suggested to clients waiting for a running generation
+	concurrencyRetryAfter = 5 * time.Second
+)
+
+// Limiter enforces the configured quotas
+type Limiter struct {
+	DB    *gorm.DB
+	Store Store
+}
+
+// NewLimiter creates a limiter with the default counter store
+func NewLimiter(db *gorm.DB) *Limiter {
+	return &Limiter{
+		DB:    db,
+		Store: NewStore(),
+	}
+}
+
+// Subject identifies who is sending a message and to which chatbot
+type Subject struct {
+	UserID    uint
+	Roles     []string
+	ChatbotID uint
+}
+
+// Limits are the effective limits of one scope, zero is unlimited
+type Limits struct {
+	MessagesPerMinute     int
+	TokensPerDay          int
+	ConcurrentGenerations int
+}
+
+// ExceededError is returned when a quota is exhausted
+type ExceededError struct {
+	Limit      string
+	Scope      string
+	Max        int64
+	Current    int64
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded for %s scope (%d/%d)", e.Limit, e.Scope, e.Current, e.Max)
+}
+
+// scopedLimits are the limits of a scope with the key of its counters
+type scopedLimits struct {
+	scope     string
+	key       string
+	chatbotID uint
+	limits    Limits
+}
+
+// Acquire checks the quotas of the subject and reserves a concurrent generation slot.
+// Returns an ExceededError when a quota is exhausted. The release function frees the
+// reserved slot and is safe to call more than once.
+func (l *Limiter) Acquire(ctx context.Context, subject Subject) (func(), error) {
+	userLimits, chatbotLimits, err := l.Resolve(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []scopedLimits{{
+		scope:  entities.QuotaScopeUser,
+		key:    fmt.Sprintf("user:%d", subject.UserID),
+		limits: userLimits,
+	}}
+	if subject.ChatbotID != 0 {
+		scopes = append(scopes, scopedLimits{
+			scope:     entities.QuotaScopeChatbot,
+			key:       fmt.Sprintf("user:%d:chatbot:%d", subject.UserID, subject.ChatbotID),
+			chatbotID: subject.ChatbotID,
+			limits:    chatbotLimits,
+		})
+	}
+
+	now := time.Now()
+
+	// Tokens are read from the usage recorded on the messages
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, s := range scopes {
+		if s.limits.TokensPerDay == 0 {
+			continue
+		}
+		used, err := l.tokensUsedSince(subject.UserID, s.chatbotID, dayStart)
+		if err != nil {
+			return nil, err
+		}
+		if used >= int64(s.limits.TokensPerDay) {
+			return nil, &ExceededError{
+				Limit:      LimitTokensPerDay,
+				Scope:      s.scope,
+				Max:        int64(s.limits.TokensPerDay),
+				Current:    used,
+				RetryAfter: dayStart.AddDate(0, 0, 1).Sub(now),
+			}
+		}
+	}
+
+	return reserve(ctx, pin(l.Store), scopes, now)
+}
+
+// reserve takes a concurrent generation slot and counts the message in the
+// window of now for every scope. Nothing stays counted when a limit rejects
+// the request.
+func reserve(ctx context.Context, store Store, scopes []scopedLimits, now time.Time) (func(), error) {
+	var acquired []string
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			for _, key := range acquired {
+				if _, err := store.Increment(context.Background(), key, -1, concurrencyTTL); err != nil {
+					log.Error("Failed to release concurrent generation slot:", key, err)
+				}
+			}
+		})
+	}
+
+	for _, s := range scopes {
+		if s.limits.ConcurrentGenerations == 0 {
+			continue
+		}
+		key := "quota:concurrent:" + s.key
+		running, err := store.Increment(ctx, key, 1, concurrencyTTL)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		acquired = append(acquired, key)
+
+		if running > int64(s.limits.ConcurrentGenerations) {
+			release()
+			return nil, &ExceededError{
+				Limit:      LimitConcurrentGenerations,
+				Scope:      s.scope,
+				Max:        int64(s.limits.ConcurrentGenerations),
+				Current:    running - 1,
+				RetryAfter: concurrencyRetryAfter,
+			}
+		}
+	}
+
+	// Messages are counted in fixed one minute windows
+	window := now.Unix() / 60
+	var counted []string
+	reject := func() {
+		release()
+		for _, key := range counted {
+			if _, err := store.Increment(context.Background(), key, -1, time.Minute); err != nil {
+				log.Error("Failed to uncount rejected message:", key, err)
+			}
+		}
+	}
+
+	for _, s := range scopes {
+		if s.limits.MessagesPerMinute == 0 {
+			continue
+		}
+		key := fmt.Sprintf("quota:messages:%s:%d", s.key, window)
+		sent, err := store.Increment(ctx, key, 1, time.Minute)
+		if err != nil {
+			reject()
+			return nil, err
+		}
+		counted = append(counted, key)
+
+		if sent > int64(s.limits.MessagesPerMinute) {
+			reject()
+			return nil, &ExceededError{
+				Limit:      LimitMessagesPerMinute,
+				Scope:      s.scope,
+				Max:        int64(s.limits.MessagesPerMinute),
+				Current:    sent - 1,
+				RetryAfter: time.Unix((window+1)*60, 0).Sub(now),
+			}
+		}
+	}
+
+	return release, nil
+}
+
+// Resolve returns the effective user limits, merged from user and role quotas, and the chatbot limits
+func (l *Limiter) Resolve(subject Subject) (Limits, Limits, error) {
+	conditions := l.DB.Where("scope = ? AND target = ?", entities.QuotaScopeUser, strconv.FormatUint(uint64(subject.UserID), 10))
+	if len(subject.Roles) > 0 {
+		conditions = conditions.Or("scope = ? AND target IN ?", entities.QuotaScopeRole, subject.Roles)
+	}
+	if subject.ChatbotID != 0 {
+		conditions = conditions.Or("scope = ? AND target = ?", entities.QuotaScopeChatbot, strconv.FormatUint(uint64(subject.ChatbotID), 10))
+	}
+
+	var quotas []entities.Quota
+	if err := l.DB.Where(conditions).Find(&quotas).Error; err != nil {
+		return Limits{}, Limits{}, fmt.Errorf("failed to load quotas: %w", err)
+	}
+
+	var user, role, chatbot Limits
+	hasRole := false
+	for _, quota := range quotas {
+		limits := Limits{
+			MessagesPerMinute:     quota.MessagesPerMinute,
+			TokensPerDay:          quota.TokensPerDay,
+			ConcurrentGenerations: quota.ConcurrentGenerations,
+		}
+
+		switch quota.Scope {
+		case entities.QuotaScopeUser:
+			user = user.merge(limits, strictest)
+		case entities.QuotaScopeRole:
+			if !hasRole {
+				role = limits
+				hasRole = true
+			} else {
+				role = role.merge(limits, mostGenerous)
+			}
+		case entities.QuotaScopeChatbot:
+			chatbot = chatbot.merge(limits, strictest)
+		}
+	}
+
+	// User quotas override role quotas limit by limit
+	return role.merge(user, func(roleLimit, userLimit int) int {
+		if userLimit != 0 {
+			return userLimit
+		}
+		return roleLimit
+	}), chatbot, nil
+}
+
+// tokensUsedSince sums the tokens of the user's generations, optionally for one chatbot
+func (l *Limiter) tokensUsedSince(userID uint, chatbotID uint, since time.Time) (int64, error) {
+	db := l.DB.Table("messages").
+		Joins("JOIN sessions ON sessions.id = messages.session_id").
+		Where("sessions.user_id = ? AND messages.created_at >= ?", userID, since)
+	if chatbotID != 0 {
+		db = db.Where("sessions.chatbot_id = ?", chatbotID)
+	}
+
+	var used int64
+	if err := db.Select("COALESCE(SUM(messages.prompt_tokens + messages.completion_tokens), 0)").
+		Scan(&used).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum token usage: %w", err)
+	}
+	return used, nil
+}
+
+// merge combines two limits field by field
+func (l Limits) merge(other Limits, combine func(a, b int) int) Limits {
+	return Limits{
+		MessagesPerMinute:     combine(l.MessagesPerMinute, other.MessagesPerMinute),
+		TokensPerDay:          combine(l.TokensPerDay, other.TokensPerDay),
+		ConcurrentGenerations: combine(l.ConcurrentGenerations, other.ConcurrentGenerations),
+	}
+}
+
+// strictest returns the lower limit, zero is unlimited
+func strictest(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	if b == 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+// mostGenerous returns the higher limit, zero is unlimited
+func mostGenerous(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
+}
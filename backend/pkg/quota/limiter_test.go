@@ -0,0 +1,147 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sef/app/entities"
+	"testing"
+	"time"
+)
+
+// userScope returns the scopes of user 1 with the given limits, and of chatbot 2 when set
+func userScope(user Limits, chatbot *Limits) []scopedLimits {
+	scopes := []scopedLimits{{scope: entities.QuotaScopeUser, key: "user:1", limits: user}}
+	if chatbot != nil {
+		scopes = append(scopes, scopedLimits{scope: entities.QuotaScopeChatbot, key: "user:1:chatbot:2", chatbotID: 2, limits: *chatbot})
+	}
+	return scopes
+}
+
+func TestReserveMessageWindows(t *testing.T) {
+	start := time.Unix(1_700_000_020, 0) // 40 seconds into a window
+	steps := []struct {
+		name        string
+		after       time.Duration
+		wantLimit   string
+		wantRetryIn time.Duration
+	}{
+		{name: "first message", after: 0},
+		{name: "second message", after: 5 * time.Second},
+		{name: "over the limit", after: 10 * time.Second, wantLimit: LimitMessagesPerMinute, wantRetryIn: 10 * time.Second},
+		{name: "rejected messages are not counted", after: 15 * time.Second, wantLimit: LimitMessagesPerMinute, wantRetryIn: 5 * time.Second},
+		{name: "next window", after: 20 * time.Second},
+		{name: "second in next window", after: 30 * time.Second},
+		{name: "over the limit in next window", after: 40 * time.Second, wantLimit: LimitMessagesPerMinute, wantRetryIn: 40 * time.Second},
+	}
+
+	store := NewMemoryStore()
+	scopes := userScope(Limits{MessagesPerMinute: 2}, nil)
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			release, err := reserve(context.Background(), store, scopes, start.Add(step.after))
+			if step.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("reserve() error = %v, want admitted", err)
+				}
+				release()
+				return
+			}
+
+			var exceeded *ExceededError
+			if !errors.As(err, &exceeded) {
+				t.Fatalf("reserve() error = %v, want ExceededError", err)
+			}
+			if exceeded.Limit != step.wantLimit || exceeded.RetryAfter != step.wantRetryIn || exceeded.Current != 2 {
+				t.Errorf("exceeded = %+v, want %s with 2 sent, retry in %s", exceeded, step.wantLimit, step.wantRetryIn)
+			}
+		})
+	}
+}
+
+func TestReserveChatbotRejectionDoesNotCountUser(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1_700_000_000, 0)
+	scopes := userScope(Limits{MessagesPerMinute: 3}, &Limits{MessagesPerMinute: 1})
+
+	if _, err := reserve(context.Background(), store, scopes, now); err != nil {
+		t.Fatalf("reserve() error = %v, want admitted", err)
+	}
+	for range 3 {
+		_, err := reserve(context.Background(), store, scopes, now)
+		var exceeded *ExceededError
+		if !errors.As(err, &exceeded) || exceeded.Scope != entities.QuotaScopeChatbot {
+			t.Fatalf("reserve() error = %v, want the chatbot quota exceeded", err)
+		}
+	}
+
+	// The user still has two messages left for other chatbots
+	for range 2 {
+		if _, err := reserve(context.Background(), store, userScope(Limits{MessagesPerMinute: 3}, nil), now); err != nil {
+			t.Fatalf("reserve() error = %v, rejected messages were counted for the user", err)
+		}
+	}
+}
+
+func TestReserveConcurrentGenerations(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1_700_000_000, 0)
+	scopes := userScope(Limits{ConcurrentGenerations: 1, MessagesPerMinute: 10}, nil)
+
+	release, err := reserve(context.Background(), store, scopes, now)
+	if err != nil {
+		t.Fatalf("reserve() error = %v, want admitted", err)
+	}
+
+	_, err = reserve(context.Background(), store, scopes, now)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Limit != LimitConcurrentGenerations || exceeded.RetryAfter != concurrencyRetryAfter {
+		t.Fatalf("reserve() error = %v, want the concurrent generations exceeded", err)
+	}
+
+	release()
+	release() // Releasing twice frees one slot
+	if _, err := reserve(context.Background(), store, scopes, now); err != nil {
+		t.Fatalf("reserve() error = %v, want the released slot", err)
+	}
+	if _, err := reserve(context.Background(), store, scopes, now); err == nil {
+		t.Fatal("reserve() admitted a second generation after a double release")
+	}
+}
+
+// flakyStore fails while down is set
+type flakyStore struct {
+	*MemoryStore
+	down bool
+}
+
+func (s *flakyStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if s.down {
+		return 0, errors.New("connection refused")
+	}
+	return s.MemoryStore.Increment(ctx, key, delta, ttl)
+}
+
+func TestReserveReleasesOnPinnedBackend(t *testing.T) {
+	primary := &flakyStore{MemoryStore: NewMemoryStore(), down: true}
+	fallback := NewMemoryStore()
+	store := &fallbackStore{primary: primary, fallback: fallback}
+	now := time.Unix(1_700_000_000, 0)
+	scopes := userScope(Limits{ConcurrentGenerations: 1}, nil)
+
+	release, err := reserve(context.Background(), pin(store), scopes, now)
+	if err != nil {
+		t.Fatalf("reserve() error = %v, want admitted on the fallback", err)
+	}
+
+	// The primary comes back before the generation ends
+	primary.down = false
+	release()
+
+	key := "quota:concurrent:user:1"
+	if value, _ := fallback.Increment(context.Background(), key, 0, time.Minute); value != 0 {
+		t.Errorf("fallback counter = %d, want the slot released", value)
+	}
+	if value, _ := primary.Increment(context.Background(), key, 0, time.Minute); value != 0 {
+		t.Errorf("primary counter = %d, want it untouched", value)
+	}
+}
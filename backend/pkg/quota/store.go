@@ -0,0 +1,156 @@
+package quota
+
+import (
+	"context"
+	"os"
+	"sef/internal/redis"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Store keeps the quota counters
+type Store interface {
+	// Increment adds delta to the counter, refreshes its expiry and returns the new value
+	Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// NewStore returns a Redis backed store when REDIS_URL is configured, in-memory counters otherwise
+func NewStore() Store {
+	memory := NewMemoryStore()
+	if os.Getenv("REDIS_URL") == "" {
+		log.Info("REDIS_URL is not set, quota counters are kept in memory")
+		return memory
+	}
+
+	return &fallbackStore{
+		primary:  &RedisStore{client: redis.NewConnection()},
+		fallback: memory,
+	}
+}
+
+// RedisStore keeps counters in Redis so limits are shared between instances
+type RedisStore struct {
+	client *goredis.Client
+}
+
+func (s *RedisStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, delta)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// MemoryStore keeps counters in process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	lastSweep time.Time
+}
+
+type memoryCounter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters:  make(map[string]*memoryCounter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, counter := range s.counters {
+			if now.After(counter.expiresAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		counter = &memoryCounter{}
+		s.counters[key] = counter
+	}
+	counter.value += delta
+	counter.expiresAt = now.Add(ttl)
+
+	return counter.value, nil
+}
+
+// pinner is implemented by stores that switch between backends
+type pinner interface {
+	// Pin returns a store that keeps using the backend of its first increment
+	Pin() Store
+}
+
+// pin returns a store whose related counters all stay on one backend
+func pin(store Store) Store {
+	if p, ok := store.(pinner); ok {
+		return p.Pin()
+	}
+	return store
+}
+
+// fallbackStore uses in-memory counters while the primary store is unavailable
+type fallbackStore struct {
+	primary  Store
+	fallback Store
+}
+
+func (s *fallbackStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	value, _, err := s.increment(ctx, key, delta, ttl)
+	return value, err
+}
+
+// increment updates the counter and returns the backend that holds it
+func (s *fallbackStore) increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, Store, error) {
+	value, err := s.primary.Increment(ctx, key, delta, ttl)
+	if err != nil {
+		log.Warn("Quota store unavailable, using in-memory counters:", err)
+		value, err = s.fallback.Increment(ctx, key, delta, ttl)
+		return value, s.fallback, err
+	}
+	return value, s.primary, nil
+}
+
+// Pin keeps a reservation and its release on the same backend. Otherwise a slot
+// taken in memory while Redis was down would be released in Redis once it is back.
+func (s *fallbackStore) Pin() Store {
+	return &pinnedStore{store: s}
+}
+
+// pinnedStore sends every increment to the backend that answered the first one
+type pinnedStore struct {
+	store   *fallbackStore
+	mu      sync.Mutex
+	backend Store
+}
+
+func (p *pinnedStore) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.backend != nil {
+		return p.backend.Increment(ctx, key, delta, ttl)
+	}
+
+	value, backend, err := p.store.increment(ctx, key, delta, ttl)
+	if err == nil {
+		p.backend = backend
+	}
+	return value, err
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"fmt"
+	"sef/app/entities"
+	"sef/pkg/qdrant"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetLength bounds the excerpt of a chunk shown with its citation
+const snippetLength = 240
+
+// newCitation describes a retrieved chunk numbered in the augmented prompt
+func newCitation(number int, result qdrant.SearchResult) entities.MessageCitation {
+	title, _ := result.Payload["title"].(string)
+	heading, _ := result.Payload["heading"].(string)
+	text, _ := result.Payload["text"].(string)
+
+	return entities.MessageCitation{
+		Number:     number,
+		DocumentID: uint(payloadInt(result.Payload, "document_id")),
+		ChunkIndex: payloadInt(result.Payload, "chunk_index"),
+		Title:      title,
+		Page:       payloadInt(result.Payload, "page"),
+		Heading:    heading,
+		Snippet:    snippet(text),
+		Score:      result.Score,
+	}
+}
+
+// sourceHeader labels a chunk in the augmented prompt, e.g. "[2] Manual (page 4)"
+func sourceHeader(citation entities.MessageCitation) string {
+	var location []string
+	if citation.Page > 0 {
+		location = append(location, fmt.Sprintf("page %d", citation.Page))
+	}
+	if citation.Heading != "" {
+		location = append(location, citation.Heading)
+	}
+
+	header := fmt.Sprintf("[%d] %s", citation.Number, citation.Title)
+	if len(location) > 0 {
+		header += " (" + strings.Join(location, ", ") + ")"
+	}
+	return header
+}
+
+// payloadInt reads an integer payload value. Vector search returns integers,
+// full text search returns the JSON numbers stored with the chunk.
+func payloadInt(payload map[string]interface{}, key string) int {
+	switch value := payload[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	case string:
+		number, _ := strconv.Atoi(value)
+		return number
+	default:
+		return 0
+	}
+}
+
+// snippet returns the beginning of a chunk on a single line
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetLength {
+		return text
+	}
+
+	runes := []rune(text)
+	cut := string(runes[:snippetLength])
+	if i := strings.LastIndex(cut, " "); i > snippetLength/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
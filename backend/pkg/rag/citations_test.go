@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"sef/app/entities"
+	"sef/pkg/qdrant"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("kelime ", 60)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "empty", text: "", want: ""},
+		{name: "whitespace collapsed", text: "  Kurulum\n\n\tadımları  burada ", want: "Kurulum adımları burada"},
+		{name: "exactly the limit", text: strings.Repeat("a", snippetLength), want: strings.Repeat("a", snippetLength)},
+		{name: "cut at a word boundary", text: long, want: strings.TrimSpace(long[:snippetLength-2]) + "…"},
+		{name: "cut inside a long word", text: strings.Repeat("ş", snippetLength+10), want: strings.Repeat("ş", snippetLength) + "…"},
+		{name: "space too early to cut at", text: "a " + strings.Repeat("b", snippetLength), want: "a " + strings.Repeat("b", snippetLength-2) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snippet(tt.text)
+			if got != tt.want {
+				t.Errorf("snippet() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("snippet() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func TestPayloadInt(t *testing.T) {
+	payload := map[string]interface{}{
+		"int":     7,
+		"int64":   int64(8),
+		"float64": float64(9),
+		"string":  "10",
+		"invalid": "page",
+		"bool":    true,
+	}
+
+	tests := map[string]int{"int": 7, "int64": 8, "float64": 9, "string": 10, "invalid": 0, "bool": 0, "missing": 0}
+	for key, want := range tests {
+		if got := payloadInt(payload, key); got != want {
+			t.Errorf("payloadInt(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestNewCitation(t *testing.T) {
+	result := qdrant.SearchResult{
+		Score: 0.8,
+		Payload: map[string]interface{}{
+			"document_id": float64(3),
+			"chunk_index": int64(2),
+			"title":       "Kılavuz",
+			"page":        4,
+			"heading":     "Kurulum",
+			"text":        "Adım\nbir",
+		},
+	}
+
+	citation := newCitation(1, result)
+	want := entities.MessageCitation{Number: 1, DocumentID: 3, ChunkIndex: 2, Title: "Kılavuz", Page: 4, Heading: "Kurulum", Snippet: "Adım bir", Score: 0.8}
+	if citation != want {
+		t.Errorf("newCitation() = %+v, want %+v", citation, want)
+	}
+	if header := sourceHeader(citation); header != "[1] Kılavuz (page 4, Kurulum)" {
+		t.Errorf("sourceHeader() = %q", header)
+	}
+	if header := sourceHeader(entities.MessageCitation{Number: 2, Title: "Notlar"}); header != "[2] Notlar" {
+		t.Errorf("sourceHeader() without location = %q", header)
+	}
+}
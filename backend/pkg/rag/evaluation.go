@@ -0,0 +1,451 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime/debug"
+	"sef/app/entities"
+	"sef/pkg/providers"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3/log"
+	"gorm.io/gorm"
+)
+
+// DefaultEvaluationK is the rank cut-off used when a run does not set one
+const DefaultEvaluationK = 5
+
+// evaluationTimeout bounds the retrieval and generation of a single question
+const evaluationTimeout = 3 * time.Minute
+
+// ErrEvaluationRunning is returned when the chatbot already has a run in progress
+var ErrEvaluationRunning = errors.New("an evaluation of this chatbot is already running")
+
+var (
+	thinkBlockPattern = regexp.MustCompile(`(?s)<think>.*?(</think>|$)`)
+	jsonObjectPattern = regexp.MustCompile(`(?s)\{.*\}`)
+)
+
+// Evaluator scores a chatbot's retrieval and answers against its golden
+// questions so configuration changes can be compared before they are rolled out
+type Evaluator struct {
+	DB         *gorm.DB
+	RAGService *RAGService
+}
+
+// NewEvaluator creates a new RAG evaluator
+func NewEvaluator(db *gorm.DB, ragService *RAGService) *Evaluator {
+	return &Evaluator{
+		DB:         db,
+		RAGService: ragService,
+	}
+}
+
+// Start creates a run of all golden questions of a chatbot and evaluates them
+// in the background. Answers are only generated and graded when requested
+// since it takes two model requests per question.
+func (e *Evaluator) Start(chatbotID uint, k int, generateAnswers bool) (*entities.EvaluationRun, error) {
+	if k < 1 {
+		k = DefaultEvaluationK
+	}
+
+	var chatbot entities.Chatbot
+	if err := e.DB.First(&chatbot, chatbotID).Error; err != nil {
+		return nil, err
+	}
+
+	var questions int64
+	if err := e.DB.Model(&entities.EvaluationQuestion{}).Where("chatbot_id = ?", chatbotID).Count(&questions).Error; err != nil {
+		return nil, err
+	}
+	if questions == 0 {
+		return nil, errors.New("the chatbot has no evaluation questions")
+	}
+
+	config, err := e.configSnapshot(&chatbot)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	run := &entities.EvaluationRun{
+		ChatbotID:       chatbotID,
+		Status:          entities.EvaluationStatusRunning,
+		K:               k,
+		GenerateAnswers: generateAnswers,
+		Config:          config,
+		TotalQuestions:  int(questions),
+		StartedAt:       &now,
+	}
+
+	if err := e.DB.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&entities.EvaluationRun{}).
+			Where("chatbot_id = ? AND status = ?", chatbotID, entities.EvaluationStatusRunning).
+			Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrEvaluationRunning
+		}
+		return tx.Create(run).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	// The worker owns its copy, the caller may serialize the returned run
+	worker := *run
+	go e.run(&worker, &chatbot)
+
+	return run, nil
+}
+
+// FailInterrupted marks runs that were in progress when the server stopped as failed
+func (e *Evaluator) FailInterrupted() {
+	now := time.Now()
+	if err := e.DB.Model(&entities.EvaluationRun{}).
+		Where("status = ?", entities.EvaluationStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      entities.EvaluationStatusFailed,
+			"error":       "interrupted by a server restart",
+			"finished_at": now,
+		}).Error; err != nil {
+		log.Errorf("Failed to mark interrupted evaluation runs: %v", err)
+	}
+}
+
+// run evaluates every question of the run and stores the aggregated scores
+func (e *Evaluator) run(run *entities.EvaluationRun, chatbot *entities.Chatbot) {
+	// A panicking provider or retrieval stage must not leave the run running forever
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Evaluation run %d panicked: %v\n%s", run.ID, r, debug.Stack())
+			e.finish(run, fmt.Errorf("evaluation panicked: %v", r))
+		}
+	}()
+
+	var questions []entities.EvaluationQuestion
+	if err := e.DB.Where("chatbot_id = ?", run.ChatbotID).Order("id").Find(&questions).Error; err != nil {
+		e.finish(run, fmt.Errorf("failed to load questions: %w", err))
+		return
+	}
+
+	var provider providers.LLMProvider
+	if run.GenerateAnswers {
+		var err error
+		if provider, err = e.chatProvider(chatbot); err != nil {
+			e.finish(run, err)
+			return
+		}
+	}
+
+	// Results are kept on the run as they come in, a failed run stores the finished ones
+	run.Results = make(entities.EvaluationResults, 0, len(questions))
+	for _, question := range questions {
+		run.Results = append(run.Results, e.evaluate(run, chatbot, provider, question))
+
+		if err := e.DB.Model(run).Update("processed_questions", len(run.Results)).Error; err != nil {
+			log.Errorf("Failed to update evaluation run %d progress: %v", run.ID, err)
+		}
+	}
+
+	summarizeEvaluation(run)
+	e.finish(run, nil)
+}
+
+// evaluate retrieves context for one question the way a chat message would and
+// scores the retrieved documents, and the answer when requested
+func (e *Evaluator) evaluate(run *entities.EvaluationRun, chatbot *entities.Chatbot, provider providers.LLMProvider, question entities.EvaluationQuestion) entities.EvaluationResult {
+	started := time.Now()
+	result := entities.EvaluationResult{
+		QuestionID:           question.ID,
+		Question:             question.Question,
+		ExpectedDocumentIDs:  question.ExpectedDocumentIDs,
+		RetrievedDocumentIDs: []uint{},
+	}
+	defer func() { result.DurationMs = time.Since(started).Milliseconds() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), evaluationTimeout)
+	defer cancel()
+
+	augmented, err := e.RAGService.AugmentPrompt(ctx, question.Question, run.ChatbotID, run.K)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.RetrievedDocumentIDs = rankedDocuments(augmented.Citations)
+	result.Recall, result.ReciprocalRank = retrievalScores(question.ExpectedDocumentIDs, result.RetrievedDocumentIDs, run.K)
+
+	if provider == nil {
+		return result
+	}
+
+	answer, err := e.answer(ctx, provider, chatbot, augmented.AugmentedPrompt)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = answer
+
+	faithfulness, correctness, err := e.grade(ctx, provider, chatbot, question, augmented.Citations, answer)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Faithfulness = faithfulness
+	result.Correctness = correctness
+
+	return result
+}
+
+// answer generates the chatbot's answer to an augmented prompt without tools
+func (e *Evaluator) answer(ctx context.Context, provider providers.LLMProvider, chatbot *entities.Chatbot, prompt string) (string, error) {
+	var messages []providers.ChatMessage
+	if chatbot.SystemPrompt != "" {
+		messages = append(messages, providers.ChatMessage{Role: "system", Content: chatbot.SystemPrompt})
+	}
+	messages = append(messages, providers.ChatMessage{Role: "user", Content: prompt})
+
+	answer, err := generateText(ctx, provider, chatbot.ModelName, messages)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate answer: %w", err)
+	}
+	return answer, nil
+}
+
+// grade asks the model how well the answer is supported by the retrieved
+// sources and, when the question has one, how well it matches the expected answer
+func (e *Evaluator) grade(ctx context.Context, provider providers.LLMProvider, chatbot *entities.Chatbot, question entities.EvaluationQuestion, citations []entities.MessageCitation, answer string) (*float64, *float64, error) {
+	var sources strings.Builder
+	for _, citation := range citations {
+		// Grade against the whole chunk the model saw, not just the snippet
+		text := citation.Snippet
+		var contents []string
+		e.DB.Model(&entities.DocumentChunk{}).
+			Where("document_id = ? AND chunk_index = ?", citation.DocumentID, citation.ChunkIndex).
+			Limit(1).
+			Pluck("content", &contents)
+		if len(contents) > 0 {
+			text = contents[0]
+		}
+		fmt.Fprintf(&sources, "%s\n%s\n\n", sourceHeader(citation), text)
+	}
+	if sources.Len() == 0 {
+		sources.WriteString("(no sources were retrieved)")
+	}
+
+	prompt := fmt.Sprintf("Question: %s\n\nSources:\n\n%s\nAnswer:\n%s", question.Question, sources.String(), answer)
+	instructions := `You grade answers of a retrieval augmented assistant. Reply with a JSON object only.
+"faithfulness" is a grade from 0 to 10 of how much of the answer is supported by the sources, where 10 means every claim is supported and 0 means none is.`
+	if question.ExpectedAnswer != "" {
+		prompt += "\n\nExpected answer:\n" + question.ExpectedAnswer
+		instructions += `
+"correctness" is a grade from 0 to 10 of how well the answer agrees with the expected answer, where 10 means it has the same meaning and 0 means it contradicts or misses it.`
+	}
+
+	output, err := generateText(ctx, provider, chatbot.ModelName, []providers.ChatMessage{
+		{Role: "system", Content: instructions},
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to grade answer: %w", err)
+	}
+
+	var grades struct {
+		Faithfulness *float64 `json:"faithfulness"`
+		Correctness  *float64 `json:"correctness"`
+	}
+	if err := json.Unmarshal([]byte(jsonObjectPattern.FindString(output)), &grades); err != nil || grades.Faithfulness == nil {
+		return nil, nil, fmt.Errorf("model returned no grades: %q", output)
+	}
+
+	faithfulness := normalizeGrade(*grades.Faithfulness)
+	if question.ExpectedAnswer == "" || grades.Correctness == nil {
+		return &faithfulness, nil, nil
+	}
+	correctness := normalizeGrade(*grades.Correctness)
+	return &faithfulness, &correctness, nil
+}
+
+// finish stores the final state of a run
+func (e *Evaluator) finish(run *entities.EvaluationRun, err error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = entities.EvaluationStatusCompleted
+	if err != nil {
+		run.Status = entities.EvaluationStatusFailed
+		run.Error = err.Error()
+		log.Errorf("Evaluation run %d failed: %v", run.ID, err)
+	} else {
+		log.Infof("Evaluation run %d completed: recall@%d %.3f, MRR %.3f", run.ID, run.K, run.RecallAtK, run.MRR)
+	}
+
+	if err := e.DB.Model(run).Updates(map[string]interface{}{
+		"status":              run.Status,
+		"processed_questions": len(run.Results),
+		"recall_at_k":         run.RecallAtK,
+		"mrr":                 run.MRR,
+		"faithfulness":        run.Faithfulness,
+		"correctness":         run.Correctness,
+		"results":             run.Results,
+		"error":               run.Error,
+		"finished_at":         run.FinishedAt,
+	}).Error; err != nil {
+		log.Errorf("Failed to save evaluation run %d: %v", run.ID, err)
+	}
+}
+
+// chatProvider creates the provider answering with the chatbot's model
+func (e *Evaluator) chatProvider(chatbot *entities.Chatbot) (providers.LLMProvider, error) {
+	if err := e.DB.First(&chatbot.Provider, chatbot.ProviderID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chatbot provider: %w", err)
+	}
+
+	factory := &providers.ProviderFactory{}
+	provider, err := factory.NewProvider(chatbot.Provider.Type, map[string]interface{}{
+		"base_url": chatbot.Provider.BaseURL,
+		"api_key":  chatbot.Provider.ApiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider: %w", err)
+	}
+	return provider, nil
+}
+
+// configSnapshot records the settings that decide what a run retrieves
+func (e *Evaluator) configSnapshot(chatbot *entities.Chatbot) (entities.SingleJSONB, error) {
+	config := entities.SingleJSONB{
+		"retrieval_mode": chatbot.RetrievalMode,
+		"reranker":       chatbot.Reranker,
+		"rerank_top_n":   chatbot.GetRerankTopN(),
+		"rerank_top_k":   chatbot.GetRerankTopK(),
+		"knowledge_base": chatbot.KnowledgeBase,
+	}
+
+	embedding, err := e.RAGService.DocumentService.GetEmbeddingConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	config["embedding_model"] = embedding.Model
+	config["embedding_vector_size"] = embedding.VectorSize
+	config["embedding_collection"] = embedding.Collection
+	if embedding.Provider != nil {
+		config["embedding_provider_id"] = embedding.Provider.ID
+	}
+
+	return config, nil
+}
+
+// rankedDocuments returns the distinct documents of the citations in rank order
+func rankedDocuments(citations []entities.MessageCitation) []uint {
+	documents := []uint{}
+	seen := make(map[uint]bool)
+	for _, citation := range citations {
+		if !seen[citation.DocumentID] {
+			seen[citation.DocumentID] = true
+			documents = append(documents, citation.DocumentID)
+		}
+	}
+	return documents
+}
+
+// retrievalScores returns the share of expected documents among the first k
+// retrieved ones and the reciprocal rank of the first expected document
+func retrievalScores(expected, retrieved []uint, k int) (float64, float64) {
+	if len(expected) == 0 {
+		return 0, 0
+	}
+
+	wanted := make(map[uint]bool, len(expected))
+	for _, id := range expected {
+		wanted[id] = true
+	}
+
+	var found int
+	var reciprocalRank float64
+	for rank, id := range retrieved {
+		if !wanted[id] {
+			continue
+		}
+		if reciprocalRank == 0 {
+			reciprocalRank = 1 / float64(rank+1)
+		}
+		if rank < k {
+			found++
+		}
+	}
+
+	return float64(found) / float64(len(wanted)), reciprocalRank
+}
+
+// summarizeEvaluation averages the scores of a run's results. Questions
+// without expected documents do not count towards recall and MRR, failed
+// retrievals count as misses.
+func summarizeEvaluation(run *entities.EvaluationRun) {
+	var retrievalCount, faithfulnessCount, correctnessCount int
+	var recall, mrr, faithfulness, correctness float64
+
+	for _, result := range run.Results {
+		if len(result.ExpectedDocumentIDs) > 0 {
+			retrievalCount++
+			recall += result.Recall
+			mrr += result.ReciprocalRank
+		}
+		if result.Faithfulness != nil {
+			faithfulnessCount++
+			faithfulness += *result.Faithfulness
+		}
+		if result.Correctness != nil {
+			correctnessCount++
+			correctness += *result.Correctness
+		}
+	}
+
+	if retrievalCount > 0 {
+		run.RecallAtK = recall / float64(retrievalCount)
+		run.MRR = mrr / float64(retrievalCount)
+	}
+	if faithfulnessCount > 0 {
+		average := faithfulness / float64(faithfulnessCount)
+		run.Faithfulness = &average
+	}
+	if correctnessCount > 0 {
+		average := correctness / float64(correctnessCount)
+		run.Correctness = &average
+	}
+}
+
+// normalizeGrade maps a 0-10 grade to 0-1
+func normalizeGrade(grade float64) float64 {
+	grade /= 10
+	if grade < 0 {
+		return 0
+	}
+	if grade > 1 {
+		return 1
+	}
+	return grade
+}
+
+// generateText collects a complete chat response without reasoning blocks
+func generateText(ctx context.Context, provider providers.LLMProvider, model string, messages []providers.ChatMessage) (string, error) {
+	stream, err := provider.GenerateChat(ctx, messages, map[string]interface{}{"model": model})
+	if err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	for chunk := range stream {
+		output.WriteString(chunk)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("generation interrupted: %w", err)
+	}
+
+	return strings.TrimSpace(thinkBlockPattern.ReplaceAllString(output.String(), "")), nil
+}
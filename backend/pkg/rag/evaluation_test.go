@@ -0,0 +1,126 @@
+package rag
+
+import (
+	"math"
+	"sef/app/entities"
+	"slices"
+	"testing"
+)
+
+func TestRetrievalScores(t *testing.T) {
+	tests := []struct {
+		name       string
+		expected   []uint
+		retrieved  []uint
+		k          int
+		wantRecall float64
+		wantRR     float64
+	}{
+		{name: "no expected documents", expected: nil, retrieved: []uint{1, 2}, k: 5, wantRecall: 0, wantRR: 0},
+		{name: "nothing retrieved", expected: []uint{1}, retrieved: nil, k: 5, wantRecall: 0, wantRR: 0},
+		{name: "first hit", expected: []uint{1}, retrieved: []uint{1, 2, 3}, k: 5, wantRecall: 1, wantRR: 1},
+		{name: "later hit", expected: []uint{3}, retrieved: []uint{1, 2, 3}, k: 5, wantRecall: 1, wantRR: 1.0 / 3},
+		{name: "some expected found", expected: []uint{2, 4, 6, 8}, retrieved: []uint{1, 2, 3, 4}, k: 5, wantRecall: 0.5, wantRR: 0.5},
+		{name: "hits past k only count for the rank", expected: []uint{1, 4}, retrieved: []uint{2, 3, 4, 1}, k: 2, wantRecall: 0, wantRR: 1.0 / 3},
+		{name: "duplicate expected documents", expected: []uint{1, 1}, retrieved: []uint{1}, k: 5, wantRecall: 1, wantRR: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recall, rr := retrievalScores(tt.expected, tt.retrieved, tt.k)
+			if math.Abs(recall-tt.wantRecall) > 1e-9 || math.Abs(rr-tt.wantRR) > 1e-9 {
+				t.Errorf("retrievalScores() = %f, %f, want %f, %f", recall, rr, tt.wantRecall, tt.wantRR)
+			}
+		})
+	}
+}
+
+// grade returns a pointer to a normalized grade
+func grade(value float64) *float64 {
+	return &value
+}
+
+func TestSummarizeEvaluation(t *testing.T) {
+	tests := []struct {
+		name             string
+		results          entities.EvaluationResults
+		wantRecall       float64
+		wantMRR          float64
+		wantFaithfulness *float64
+		wantCorrectness  *float64
+	}{
+		{
+			name: "no results",
+		},
+		{
+			name: "questions without expected documents are left out",
+			results: entities.EvaluationResults{
+				{ExpectedDocumentIDs: []uint{1}, Recall: 1, ReciprocalRank: 1},
+				{ExpectedDocumentIDs: []uint{2}, Recall: 0.5, ReciprocalRank: 0.5},
+				{Recall: 0, ReciprocalRank: 0},
+			},
+			wantRecall: 0.75,
+			wantMRR:    0.75,
+		},
+		{
+			name: "failed retrievals count as misses",
+			results: entities.EvaluationResults{
+				{ExpectedDocumentIDs: []uint{1}, Recall: 1, ReciprocalRank: 1},
+				{ExpectedDocumentIDs: []uint{1}, Error: "search failed"},
+			},
+			wantRecall: 0.5,
+			wantMRR:    0.5,
+		},
+		{
+			name: "grades average over graded answers",
+			results: entities.EvaluationResults{
+				{Faithfulness: grade(1), Correctness: grade(0.4)},
+				{Faithfulness: grade(0.5)},
+				{Error: "generation failed"},
+			},
+			wantFaithfulness: grade(0.75),
+			wantCorrectness:  grade(0.4),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := &entities.EvaluationRun{Results: tt.results}
+			summarizeEvaluation(run)
+
+			if math.Abs(run.RecallAtK-tt.wantRecall) > 1e-9 || math.Abs(run.MRR-tt.wantMRR) > 1e-9 {
+				t.Errorf("recall, MRR = %f, %f, want %f, %f", run.RecallAtK, run.MRR, tt.wantRecall, tt.wantMRR)
+			}
+			if !sameGrade(run.Faithfulness, tt.wantFaithfulness) {
+				t.Errorf("faithfulness = %v, want %v", run.Faithfulness, tt.wantFaithfulness)
+			}
+			if !sameGrade(run.Correctness, tt.wantCorrectness) {
+				t.Errorf("correctness = %v, want %v", run.Correctness, tt.wantCorrectness)
+			}
+		})
+	}
+}
+
+// sameGrade compares optional grades
+func sameGrade(got, want *float64) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return math.Abs(*got-*want) < 1e-9
+}
+
+func TestRankedDocuments(t *testing.T) {
+	citations := []entities.MessageCitation{{DocumentID: 3}, {DocumentID: 1}, {DocumentID: 3}, {DocumentID: 2}}
+	if got := rankedDocuments(citations); !slices.Equal(got, []uint{3, 1, 2}) {
+		t.Errorf("rankedDocuments() = %v, want [3 1 2]", got)
+	}
+}
+
+func TestNormalizeGrade(t *testing.T) {
+	tests := map[float64]float64{-2: 0, 0: 0, 7: 0.7, 10: 1, 14: 1}
+	for value, want := range tests {
+		if got := normalizeGrade(value); math.Abs(got-want) > 1e-9 {
+			t.Errorf("normalizeGrade(%v) = %v, want %v", value, got, want)
+		}
+	}
+}
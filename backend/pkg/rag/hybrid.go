@@ -3,318 +3,212 @@ package rag
 import (
 	"context"
 	"fmt"
-	"math"
 	"sef/app/entities"
+	"sef/pkg/documentservice"
 	"sef/pkg/qdrant"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3/log"
+	"golang.org/x/sync/errgroup"
 )
 
-// HybridSearchResult combines vector similarity with keyword matching
-type HybridSearchResult struct {
-	Result          qdrant.SearchResult
-	SemanticScore   float32
-	KeywordScore    float32
-	CombinedScore   float32
-	MatchedKeywords []string
-}
-
-// HybridSearch performs both semantic and keyword-based search
-func HybridSearch(results []qdrant.SearchResult, query string, semanticWeight float32, keywordWeight float32) []HybridSearchResult {
-	if semanticWeight+keywordWeight == 0 {
-		semanticWeight = 0.7
-		keywordWeight = 0.3
-	}
-
-	// Extract keywords from query
-	keywords := extractKeywords(query)
-
-	hybridResults := make([]HybridSearchResult, 0, len(results))
-
-	for _, result := range results {
-		text := ""
-		if t, ok := result.Payload["text"].(string); ok {
-			text = t
-		}
-
-		// Calculate keyword score
-		keywordScore, matched := calculateKeywordScore(text, keywords)
-
-		// Combine scores
-		combined := (result.Score * semanticWeight) + (keywordScore * keywordWeight)
-
-		hybridResults = append(hybridResults, HybridSearchResult{
-			Result:          result,
-			SemanticScore:   result.Score,
-			KeywordScore:    keywordScore,
-			CombinedScore:   combined,
-			MatchedKeywords: matched,
-		})
-	}
+const (
+	// rrfK dampens the weight of the top ranks in reciprocal rank fusion. 60 is
+	// the value used in the original paper and by most search engines.
+	rrfK = 60
+	// hybridMinDenseScore is the vector score a chunk without any keyword match
+	// needs to be considered relevant
+	hybridMinDenseScore float32 = 0.70
+	// hybridMinKeywordDenseScore is the lower vector score a chunk matched by
+	// full text search needs
+	hybridMinKeywordDenseScore float32 = 0.55
+	// hybridKeywordTopRanks is the number of best full text matches that are
+	// relevant without any vector score, such as exact codes or names the
+	// embedding model does not capture
+	hybridKeywordTopRanks = 3
+)
 
-	// Sort by combined score
-	for i := 0; i < len(hybridResults); i++ {
-		for j := i + 1; j < len(hybridResults); j++ {
-			if hybridResults[j].CombinedScore > hybridResults[i].CombinedScore {
-				hybridResults[i], hybridResults[j] = hybridResults[j], hybridResults[i]
+// ReciprocalRankFusion merges ranked result lists into one. Every result scores
+// the sum of 1/(k+rank) over the lists it appears in, normalized so a result
+// ranked first in every list scores 1. Results are matched by document and
+// chunk, the payload of the first list containing a result is kept.
+func ReciprocalRankFusion(lists ...[]qdrant.SearchResult) []qdrant.SearchResult {
+	if len(lists) == 0 {
+		return []qdrant.SearchResult{}
+	}
+
+	maxScore := float32(len(lists)) / float32(rrfK+1)
+	scores := make(map[string]float32)
+	fused := make(map[string]qdrant.SearchResult)
+	var order []string
+
+	for _, list := range lists {
+		for rank, result := range list {
+			key := documentservice.ChunkKey(result.Payload)
+			if _, ok := fused[key]; !ok {
+				fused[key] = result
+				order = append(order, key)
 			}
+			scores[key] += 1 / float32(rrfK+rank+1)
 		}
 	}
 
-	return hybridResults
-}
-
-// extractKeywords extracts meaningful keywords from query
-func extractKeywords(query string) []string {
-	// Simple keyword extraction - can be improved with NLP
-	query = strings.ToLower(query)
-	words := strings.Fields(query)
-
-	// Filter out common stop words
-	stopWords := map[string]bool{
-		"the": true, "a": true, "an": true, "and": true, "or": true,
-		"but": true, "in": true, "on": true, "at": true, "to": true,
-		"for": true, "of": true, "with": true, "by": true, "from": true,
-		"is": true, "are": true, "was": true, "were": true, "be": true,
-		"been": true, "being": true, "have": true, "has": true, "had": true,
-		"do": true, "does": true, "did": true, "will": true, "would": true,
-		"could": true, "should": true, "may": true, "might": true, "must": true,
-		"can": true, "this": true, "that": true, "these": true, "those": true,
-		"i": true, "you": true, "he": true, "she": true, "it": true,
-		"we": true, "they": true, "what": true, "which": true, "who": true,
-		"when": true, "where": true, "why": true, "how": true,
+	results := make([]qdrant.SearchResult, len(order))
+	for i, key := range order {
+		results[i] = fused[key]
+		results[i].Score = scores[key] / maxScore
 	}
 
-	keywords := make([]string, 0)
-	for _, word := range words {
-		word = strings.TrimSpace(word)
-		// Keep words that are at least 3 chars and not stop words
-		if len(word) >= 3 && !stopWords[word] {
-			keywords = append(keywords, word)
-		}
-	}
+	// Stable so ties keep the order of the earlier lists
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
 
-	return keywords
+	return results
 }
 
-// calculateKeywordScore calculates how many keywords appear in text
-func calculateKeywordScore(text string, keywords []string) (float32, []string) {
-	if len(keywords) == 0 {
-		return 0, []string{}
+// relevantHybridResults keeps the fused results among the best full text
+// matches and those whose vector score reaches the relevance floor, which is
+// lower for chunks full text search matched as well
+func relevantHybridResults(dense, keyword, fused []qdrant.SearchResult) []qdrant.SearchResult {
+	denseScores := make(map[string]float32, len(dense))
+	for _, r := range dense {
+		denseScores[documentservice.ChunkKey(r.Payload)] = r.Score
 	}
-
-	text = strings.ToLower(text)
-	matched := make([]string, 0)
-	matchCount := 0
-
-	for _, keyword := range keywords {
-		if strings.Contains(text, keyword) {
-			matchCount++
-			matched = append(matched, keyword)
+	keywordRanks := make(map[string]int, len(keyword))
+	for rank, r := range keyword {
+		key := documentservice.ChunkKey(r.Payload)
+		if _, ok := keywordRanks[key]; !ok {
+			keywordRanks[key] = rank
 		}
 	}
 
-	// Score is percentage of keywords found, with bonus for exact phrase
-	score := float32(matchCount) / float32(len(keywords))
+	relevant := []qdrant.SearchResult{}
+	for _, r := range fused {
+		key := documentservice.ChunkKey(r.Payload)
+		rank, matched := keywordRanks[key]
+		score, scored := denseScores[key]
 
-	// Bonus if all keywords appear in order (phrase match)
-	if matchCount == len(keywords) {
-		phrase := strings.Join(keywords, " ")
-		if strings.Contains(text, phrase) {
-			score = float32(math.Min(1.0, float64(score*1.5))) // 50% bonus capped at 1.0
+		switch {
+		case matched && rank < hybridKeywordTopRanks:
+			relevant = append(relevant, r)
+		case scored && score >= hybridMinDenseScore:
+			relevant = append(relevant, r)
+		case scored && matched && score >= hybridMinKeywordDenseScore:
+			relevant = append(relevant, r)
 		}
 	}
-
-	return score, matched
-}
-
-// RerankResults applies cross-encoder style re-ranking (simplified version)
-func RerankResults(results []qdrant.SearchResult, query string, topK int) []qdrant.SearchResult {
-	// Calculate additional relevance signals
-	type scoredResult struct {
-		result     qdrant.SearchResult
-		finalScore float32
-	}
-
-	scored := make([]scoredResult, 0, len(results))
-
-	for i, result := range results {
-		text := ""
-		if t, ok := result.Payload["text"].(string); ok {
-			text = t
-		}
-
-		// Positional bias: slightly prefer earlier results from vector search
-		positionalScore := float32(1.0) - (float32(i) / float32(len(results)) * 0.1)
-
-		// Length penalty: prefer chunks that are not too short
-		lengthScore := float32(1.0)
-		if len(text) < 100 {
-			lengthScore = 0.8
-		}
-
-		// Calculate final score
-		finalScore := result.Score * positionalScore * lengthScore
-
-		scored = append(scored, scoredResult{
-			result:     result,
-			finalScore: finalScore,
-		})
-	}
-
-	// Sort by final score
-	for i := 0; i < len(scored); i++ {
-		for j := i + 1; j < len(scored); j++ {
-			if scored[j].finalScore > scored[i].finalScore {
-				scored[i], scored[j] = scored[j], scored[i]
-			}
-		}
-	}
-
-	// Return top K
-	if topK > len(scored) {
-		topK = len(scored)
-	}
-
-	reranked := make([]qdrant.SearchResult, topK)
-	for i := 0; i < topK; i++ {
-		reranked[i] = scored[i].result
-		reranked[i].Score = scored[i].finalScore // Update with re-ranked score
-	}
-
-	return reranked
+	return relevant
 }
 
-// AugmentPromptWithHybridSearch is an enhanced version using hybrid search
-func (rs *RAGService) AugmentPromptWithHybridSearch(ctx context.Context, userPrompt string, chatbotID uint, limit int) (*AugmentPromptResult, error) {
-	// Calculate dynamic chunk limit based on query complexity
-	dynamicLimit := rs.calculateDynamicChunkLimit(userPrompt, limit)
-
-	if limit == 0 {
-		limit = dynamicLimit
-	}
-
-	log.Infof("Hybrid search: requesting %d chunks (dynamic limit: %d)", limit, dynamicLimit)
-
-	// Get chatbot with documents
-	var chatbot entities.Chatbot
-	if err := rs.DB.Preload("Documents").First(&chatbot, chatbotID).Error; err != nil {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
-	}
-
-	if len(chatbot.Documents) == 0 {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
-	}
-
-	// Get document IDs
-	documentIDs := make([]uint, 0, len(chatbot.Documents))
-	for _, doc := range chatbot.Documents {
-		if doc.Status == "ready" {
-			documentIDs = append(documentIDs, doc.ID)
-		}
-	}
-
-	if len(documentIDs) == 0 {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
-	}
-
-	// Get relevant context
-	results, err := rs.DocumentService.GetRelevantContext(ctx, userPrompt, documentIDs, limit)
+// AugmentPromptWithHybridSearch retrieves context with vector and full text
+// search in parallel and fuses both rankings with reciprocal rank fusion.
+// The fused ranking is reranked when the chatbot has a reranker.
+func (rs *RAGService) AugmentPromptWithHybridSearch(ctx context.Context, userPrompt string, chatbot *entities.Chatbot, limit int, reranker Reranker, timings Timings) (*AugmentPromptResult, error) {
+	// Each retriever returns more candidates than needed so fusion can surface
+	// chunks that only one of them ranks high
+	candidates := limit * 2
+
+	var dense, keyword []qdrant.SearchResult
+	var denseDuration, keywordDuration time.Duration
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		started := time.Now()
+		defer func() { denseDuration = time.Since(started) }()
+
+		var err error
+		dense, err = rs.DocumentService.GetChatbotContext(groupCtx, userPrompt, chatbot, candidates)
+		return err
+	})
+	group.Go(func() error {
+		started := time.Now()
+		defer func() { keywordDuration = time.Since(started) }()
+
+		var err error
+		keyword, err = rs.DocumentService.KeywordSearch(groupCtx, userPrompt, chatbot.ID, candidates)
+		if err != nil {
+			// Vector search alone still gives usable context
+			log.Warnf("Hybrid search: full text search failed: %v", err)
+			keyword = nil
+		}
+		return nil
+	})
+	err := group.Wait()
+	timings["dense"] = denseDuration
+	timings["keyword"] = keywordDuration
 	if err != nil {
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, err
 	}
 
-	if len(results) == 0 {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
-	}
-
-	// Apply hybrid search (70% semantic, 30% keyword)
-	hybridResults := HybridSearch(results, userPrompt, 0.7, 0.3)
-
-	// Re-rank top results
-	topResults := make([]qdrant.SearchResult, 0, len(hybridResults))
-	for _, hr := range hybridResults {
-		hr.Result.Score = hr.CombinedScore // Use combined score
-		topResults = append(topResults, hr.Result)
-	}
+	log.Infof("Hybrid search: %d vector and %d full text candidates", len(dense), len(keyword))
 
-	// Calculate dynamic max chunks for final selection
 	var maxScore, sumScore float32
-	for _, r := range topResults {
+	for _, r := range dense {
 		if r.Score > maxScore {
 			maxScore = r.Score
 		}
 		sumScore += r.Score
 	}
-	meanScore := sumScore / float32(len(topResults))
+
+	fusionStarted := time.Now()
+	fused := relevantHybridResults(dense, keyword, ReciprocalRankFusion(dense, keyword))
+	timings["fusion"] = time.Since(fusionStarted)
+	if len(fused) == 0 {
+		log.Infof("Hybrid search: no full text match and max score %.2f, no chunk reaches %.2f or %.2f with a keyword match - no relevant documents found",
+			maxScore, hybridMinDenseScore, hybridMinKeywordDenseScore)
+		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
+	}
+
+	if reranker != nil {
+		return rs.augmentWithReranking(ctx, reranker, userPrompt, chatbot, fused, timings)
+	}
 
 	// Determine number of qualifying documents
 	seenDocs := make(map[string]bool)
-	for _, r := range topResults {
+	for _, r := range fused {
 		if title, ok := r.Payload["title"].(string); ok {
 			seenDocs[title] = true
 		}
 	}
 
-	dynamicMaxChunks := rs.calculateMaxChunks(userPrompt, maxScore, meanScore, len(seenDocs))
-	log.Infof("Hybrid search: using dynamic max chunks: %d", dynamicMaxChunks)
-
-	// Further re-rank considering position and length
-	reranked := RerankResults(topResults, userPrompt, dynamicMaxChunks)
+	var meanScore float32
+	if len(dense) > 0 {
+		meanScore = sumScore / float32(len(dense))
+	}
+	maxChunks := min(rs.calculateMaxChunks(userPrompt, maxScore, meanScore, len(seenDocs)), limit)
+	log.Infof("Hybrid search: using %d of %d fused chunks", min(maxChunks, len(fused)), len(fused))
 
-	// Use the standard logic but with re-ranked results
-	return rs.buildAugmentedPrompt(userPrompt, reranked)
+	return rs.buildAugmentedPrompt(userPrompt, fused[:min(maxChunks, len(fused))])
 }
 
-// buildAugmentedPrompt is a helper to build the final prompt
+// buildAugmentedPrompt builds the final prompt from the selected chunks.
+// Every chunk is numbered so the model can cite it inline as [n].
 func (rs *RAGService) buildAugmentedPrompt(userPrompt string, results []qdrant.SearchResult) (*AugmentPromptResult, error) {
-	if len(results) == 0 {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
-	}
-
-	// Calculate adaptive threshold
-	var maxScore float32 = 0
-	for _, result := range results {
-		if result.Score > maxScore {
-			maxScore = result.Score
-		}
-	}
-
-	adaptiveThreshold := maxScore * 0.85
-	if adaptiveThreshold < 0.55 {
-		adaptiveThreshold = 0.55
-	}
-
-	// Collect qualifying chunks
+	// Collect chunks, callers already selected the relevant ones
 	var documentsUsed []DocumentInfo
+	var citations []entities.MessageCitation
 	var contextParts []string
 	seenTitles := make(map[string]bool)
 
 	for _, result := range results {
-		if result.Score < adaptiveThreshold {
+		text, _ := result.Payload["text"].(string)
+		if strings.TrimSpace(text) == "" {
 			continue
 		}
 
-		title := ""
-		if t, ok := result.Payload["title"].(string); ok {
-			title = t
-		}
-
-		text := ""
-		if txt, ok := result.Payload["text"].(string); ok {
-			text = txt
-		}
-
-		if !seenTitles[title] {
+		citation := newCitation(len(citations)+1, result)
+		if !seenTitles[citation.Title] {
 			documentsUsed = append(documentsUsed, DocumentInfo{
-				Title: title,
+				Title: citation.Title,
 				Score: result.Score,
 			})
-			seenTitles[title] = true
+			seenTitles[citation.Title] = true
 		}
 
-		contextParts = append(contextParts, text)
+		citations = append(citations, citation)
+		contextParts = append(contextParts, sourceHeader(citation)+"\n"+text)
 	}
 
 	if len(contextParts) == 0 {
@@ -323,7 +217,7 @@ func (rs *RAGService) buildAugmentedPrompt(userPrompt string, results []qdrant.S
 
 	contextStr := joinStrings(contextParts, "\n\n---\n\n")
 
-	augmentedPrompt := fmt.Sprintf(`You are provided with relevant documentation to help answer the user's question accurately.
+	augmentedPrompt := fmt.Sprintf(`You are provided with relevant documentation to help answer the user's question accurately. Each source is numbered.
 
 === RELEVANT DOCUMENTATION ===
 %s
@@ -331,12 +225,13 @@ func (rs *RAGService) buildAugmentedPrompt(userPrompt string, results []qdrant.S
 
 User Question: %s
 
-Please provide a comprehensive and accurate answer based on the documentation provided above. If the documentation doesn't contain enough information to fully answer the question, please indicate that in your response.`,
+Please provide a comprehensive and accurate answer based on the documentation provided above. Cite the sources you use inline with their number in square brackets, such as [1] or [2][3], right after the statement they support, and only cite the numbers listed above. If the documentation doesn't contain enough information to fully answer the question, please indicate that in your response.`,
 		contextStr,
 		userPrompt)
 
 	return &AugmentPromptResult{
 		AugmentedPrompt: augmentedPrompt,
 		DocumentsUsed:   documentsUsed,
+		Citations:       citations,
 	}, nil
 }
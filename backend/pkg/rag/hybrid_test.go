@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+	"sef/pkg/qdrant"
+	"slices"
+	"testing"
+)
+
+// chunk builds a search result for a chunk of a document
+func chunk(documentID, index int, score float32) qdrant.SearchResult {
+	return qdrant.SearchResult{
+		Score:   score,
+		Payload: map[string]interface{}{"document_id": documentID, "chunk_index": index},
+	}
+}
+
+// chunkKeys lists the results as document_chunk keys in order
+func chunkKeys(results []qdrant.SearchResult) []string {
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = fmt.Sprintf("%v_%v", r.Payload["document_id"], r.Payload["chunk_index"])
+	}
+	return keys
+}
+
+func TestReciprocalRankFusion(t *testing.T) {
+	tests := []struct {
+		name       string
+		lists      [][]qdrant.SearchResult
+		wantKeys   []string
+		wantScores []float64
+	}{
+		{
+			name:  "no lists",
+			lists: nil,
+		},
+		{
+			name:       "single list keeps its order",
+			lists:      [][]qdrant.SearchResult{{chunk(1, 0, 0.9), chunk(1, 1, 0.8)}},
+			wantKeys:   []string{"1_0", "1_1"},
+			wantScores: []float64{1, 61.0 / 62},
+		},
+		{
+			name: "results in both lists rank first",
+			lists: [][]qdrant.SearchResult{
+				{chunk(1, 0, 0.9), chunk(2, 0, 0.8)},
+				{chunk(2, 0, 3), chunk(3, 0, 2)},
+			},
+			wantKeys:   []string{"2_0", "1_0", "3_0"},
+			wantScores: []float64{(1.0/62 + 1.0/61) * 61 / 2, 0.5, 61.0 / 62 / 2},
+		},
+		{
+			name: "first in every list scores one",
+			lists: [][]qdrant.SearchResult{
+				{chunk(1, 0, 0.9)},
+				{chunk(1, 0, 5)},
+			},
+			wantKeys:   []string{"1_0"},
+			wantScores: []float64{1},
+		},
+		{
+			name: "ties keep the order of the earlier lists",
+			lists: [][]qdrant.SearchResult{
+				{chunk(1, 0, 0.9)},
+				{chunk(2, 0, 5)},
+			},
+			wantKeys:   []string{"1_0", "2_0"},
+			wantScores: []float64{0.5, 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := ReciprocalRankFusion(tt.lists...)
+			if got := chunkKeys(results); !slices.Equal(got, tt.wantKeys) {
+				t.Fatalf("results = %v, want %v", got, tt.wantKeys)
+			}
+			for i, want := range tt.wantScores {
+				if got := float64(results[i].Score); math.Abs(got-want) > 1e-5 {
+					t.Errorf("score of %s = %f, want %f", tt.wantKeys[i], got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReciprocalRankFusionKeepsFirstPayload(t *testing.T) {
+	dense := chunk(1, 0, 0.9)
+	dense.Payload["content"] = "from vector search"
+	keyword := chunk(1, 0, 2)
+	keyword.Payload["content"] = "from full text search"
+
+	results := ReciprocalRankFusion([]qdrant.SearchResult{dense}, []qdrant.SearchResult{keyword})
+	if len(results) != 1 || results[0].Payload["content"] != "from vector search" {
+		t.Errorf("results = %v, want one result with the vector search payload", results)
+	}
+}
+
+func TestRelevantHybridResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		dense   []qdrant.SearchResult
+		keyword []qdrant.SearchResult
+		want    []string
+	}{
+		{
+			name:  "vector scores alone",
+			dense: []qdrant.SearchResult{chunk(1, 0, 0.8), chunk(1, 1, 0.6)},
+			want:  []string{"1_0"},
+		},
+		{
+			name:    "keyword match lowers the floor",
+			dense:   []qdrant.SearchResult{chunk(1, 0, 0.8), chunk(1, 1, 0.6)},
+			keyword: []qdrant.SearchResult{chunk(1, 1, 1)},
+			want:    []string{"1_1", "1_0"},
+		},
+		{
+			name:    "best keyword matches need no vector score",
+			dense:   []qdrant.SearchResult{chunk(1, 0, 0.3)},
+			keyword: []qdrant.SearchResult{chunk(1, 0, 1), chunk(2, 0, 0.5)},
+			want:    []string{"1_0", "2_0"},
+		},
+		{
+			name:    "lower keyword matches need a vector score",
+			dense:   []qdrant.SearchResult{chunk(1, 0, 0.6)},
+			keyword: []qdrant.SearchResult{chunk(2, 0, 4), chunk(3, 0, 3), chunk(4, 0, 2), chunk(1, 0, 1.5), chunk(5, 0, 1)},
+			want:    []string{"1_0", "2_0", "3_0", "4_0"},
+		},
+		{
+			name:    "keyword match below the lower floor",
+			dense:   []qdrant.SearchResult{chunk(1, 0, 0.5)},
+			keyword: []qdrant.SearchResult{chunk(2, 0, 3), chunk(3, 0, 2), chunk(4, 0, 1.5), chunk(1, 0, 1)},
+			want:    []string{"2_0", "3_0", "4_0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := ReciprocalRankFusion(tt.dense, tt.keyword)
+			if got := chunkKeys(relevantHybridResults(tt.dense, tt.keyword, fused)); !slices.Equal(got, tt.want) {
+				t.Errorf("relevant = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sef/app/entities"
+	"sef/pkg/providers"
+	"sef/pkg/qdrant"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rerankTimeout bounds a single rerank request
+const rerankTimeout = 60 * time.Second
+
+// Request formats of rerank endpoints
+const (
+	RerankFormatCohere = "cohere" // Cohere, Jina, vLLM, LiteLLM and Infinity
+	RerankFormatTEI    = "tei"    // Hugging Face Text Embeddings Inference
+)
+
+// RerankResult is the relevance of one document to the query
+type RerankResult struct {
+	Index int     // Position of the document in the reranked input
+	Score float32 // Relevance between 0 and 1
+}
+
+// Reranker orders documents by their relevance to a query
+type Reranker interface {
+	// Rerank returns the topK most relevant documents, most relevant first
+	Rerank(ctx context.Context, query string, documents []string, topK int) ([]RerankResult, error)
+}
+
+// HTTPReranker calls a cross-encoder behind a rerank endpoint
+type HTTPReranker struct {
+	URL    string
+	APIKey string
+	Model  string
+	Format string
+	Client *http.Client
+}
+
+// NewHTTPReranker creates a reranker for a rerank endpoint
+func NewHTTPReranker(url, apiKey, model, format string) *HTTPReranker {
+	if format == "" {
+		format = RerankFormatCohere
+	}
+
+	return &HTTPReranker{
+		URL:    url,
+		APIKey: apiKey,
+		Model:  model,
+		Format: format,
+		Client: &http.Client{Timeout: rerankTimeout},
+	}
+}
+
+// Rerank sends the documents to the endpoint and returns its ranking
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, documents []string, topK int) ([]RerankResult, error) {
+	var request interface{}
+	if r.Format == RerankFormatTEI {
+		request = map[string]interface{}{
+			"query": query,
+			"texts": documents,
+		}
+	} else {
+		body := map[string]interface{}{
+			"query":     query,
+			"documents": documents,
+			"top_n":     topK,
+		}
+		if r.Model != "" {
+			body["model"] = r.Model
+		}
+		request = body
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call rerank endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rerank response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	results, err := parseRerankResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank endpoint returned unknown document index %d", result.Index)
+		}
+	}
+
+	return topResults(results, topK), nil
+}
+
+// parseRerankResponse reads Cohere style {"results": [{"index", "relevance_score"}]}
+// and TEI style [{"index", "score"}] responses
+func parseRerankResponse(body []byte) ([]RerankResult, error) {
+	type item struct {
+		Index          int      `json:"index"`
+		RelevanceScore *float32 `json:"relevance_score"`
+		Score          *float32 `json:"score"`
+	}
+
+	var items []item
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse rerank response: %w", err)
+		}
+	} else {
+		var response struct {
+			Results []item `json:"results"`
+		}
+		if err := json.Unmarshal(trimmed, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse rerank response: %w", err)
+		}
+		items = response.Results
+	}
+
+	results := make([]RerankResult, 0, len(items))
+	for _, it := range items {
+		result := RerankResult{Index: it.Index}
+		if it.RelevanceScore != nil {
+			result.Score = *it.RelevanceScore
+		} else if it.Score != nil {
+			result.Score = *it.Score
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// LLMReranker asks a chat model to grade every document, used when no rerank
+// endpoint is available
+type LLMReranker struct {
+	Provider providers.LLMProvider
+	Model    string
+}
+
+// NewLLMReranker creates a reranker using the chatbot's provider and model
+func NewLLMReranker(chatbot *entities.Chatbot) (*LLMReranker, error) {
+	factory := &providers.ProviderFactory{}
+	provider, err := factory.NewProvider(chatbot.Provider.Type, map[string]interface{}{
+		"base_url": chatbot.Provider.BaseURL,
+		"api_key":  chatbot.Provider.ApiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	return &LLMReranker{Provider: provider, Model: chatbot.ModelName}, nil
+}
+
+var scoreListPattern = regexp.MustCompile(`\[[\d\s.,]*\]`)
+
+// Rerank grades all documents in one request from 0 to 10
+func (r *LLMReranker) Rerank(ctx context.Context, query string, documents []string, topK int) ([]RerankResult, error) {
+	var passages strings.Builder
+	for i, document := range documents {
+		// Long chunks only slow the model down, their beginning decides the grade
+		if len(document) > 1500 {
+			document = strings.ToValidUTF8(document[:1500], "") + "..."
+		}
+		fmt.Fprintf(&passages, "[%d] %s\n\n", i+1, document)
+	}
+
+	messages := []providers.ChatMessage{
+		{
+			Role: "system",
+			Content: "You grade how well passages answer a question. Reply with a JSON array containing one grade from 0 to 10 per passage, in passage order, " +
+				"where 10 means the passage answers the question and 0 means it is unrelated. Reply with the array only.",
+		},
+		{
+			Role:    "user",
+			Content: fmt.Sprintf("Question: %s\n\nPassages:\n\n%s", query, passages.String()),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rerankTimeout)
+	defer cancel()
+
+	output, err := generateText(ctx, r.Provider, r.Model, messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate grades: %w", err)
+	}
+
+	match := scoreListPattern.FindString(output)
+	if match == "" {
+		return nil, fmt.Errorf("model returned no grades: %q", output)
+	}
+
+	var grades []float32
+	for _, field := range strings.FieldsFunc(strings.Trim(match, "[]"), func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		grade, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, fmt.Errorf("model returned an invalid grade %q", field)
+		}
+		grades = append(grades, float32(grade))
+	}
+	if len(grades) != len(documents) {
+		return nil, fmt.Errorf("model returned %d grades for %d passages", len(grades), len(documents))
+	}
+
+	results := make([]RerankResult, len(grades))
+	for i, grade := range grades {
+		score := grade / 10
+		if score < 0 {
+			score = 0
+		} else if score > 1 {
+			score = 1
+		}
+		results[i] = RerankResult{Index: i, Score: score}
+	}
+
+	return topResults(results, topK), nil
+}
+
+// topResults sorts results by score and keeps the first topK
+func topResults(results []RerankResult, topK int) []RerankResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// NewReranker returns the reranker configured for a chatbot, or nil when it
+// does not rerank. Chatbots set to use the rerank endpoint fall back to their
+// own model while no endpoint is configured.
+func NewReranker(db *gorm.DB, chatbot *entities.Chatbot) (Reranker, error) {
+	switch chatbot.Reranker {
+	case "":
+		return nil, nil
+	case entities.RerankerHTTP:
+		settings := rerankSettings(db)
+		if settings["rerank_url"] != "" {
+			apiKey, err := entities.DecryptValue(settings["rerank_api_key"])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt rerank API key: %w", err)
+			}
+			return NewHTTPReranker(settings["rerank_url"], apiKey, settings["rerank_model"], settings["rerank_format"]), nil
+		}
+		fallthrough
+	case entities.RerankerLLM:
+		if chatbot.Provider.ID == 0 {
+			if err := db.First(&chatbot.Provider, chatbot.ProviderID).Error; err != nil {
+				return nil, fmt.Errorf("failed to load chatbot provider: %w", err)
+			}
+		}
+		return NewLLMReranker(chatbot)
+	default:
+		return nil, fmt.Errorf("unknown reranker: %s", chatbot.Reranker)
+	}
+}
+
+// rerankSettings returns the rerank endpoint settings
+func rerankSettings(db *gorm.DB) map[string]string {
+	var settings []entities.Settings
+	db.Where("key IN ?", []string{"rerank_url", "rerank_api_key", "rerank_model", "rerank_format"}).Find(&settings)
+
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+	return values
+}
+
+// rerank reorders the first topN candidates with the reranker and keeps the
+// best topK. The reranker's relevance replaces the retrieval score.
+func rerank(ctx context.Context, reranker Reranker, query string, candidates []qdrant.SearchResult, topN, topK int) ([]qdrant.SearchResult, error) {
+	if len(candidates) > topN {
+		candidates = candidates[:topN]
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	documents := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		documents[i], _ = candidate.Payload["text"].(string)
+	}
+
+	ranking, err := reranker.Rerank(ctx, query, documents, topK)
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := make([]qdrant.SearchResult, len(ranking))
+	for i, result := range ranking {
+		reranked[i] = candidates[result.Index]
+		reranked[i].Score = result.Score
+	}
+	return reranked, nil
+}
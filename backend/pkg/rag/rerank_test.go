@@ -0,0 +1,204 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sef/pkg/providers"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHTTPReranker(t *testing.T) {
+	documents := []string{"zero", "one", "two"}
+
+	tests := []struct {
+		name     string
+		format   string
+		status   int
+		response string
+		topK     int
+		want     []RerankResult
+		wantErr  string
+	}{
+		{
+			name:     "cohere results",
+			format:   RerankFormatCohere,
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 2, "relevance_score": 0.9}, {"index": 0, "relevance_score": 0.2}, {"index": 1, "relevance_score": 0.5}]}`,
+			topK:     2,
+			want:     []RerankResult{{Index: 2, Score: 0.9}, {Index: 1, Score: 0.5}},
+		},
+		{
+			name:     "tei array",
+			format:   RerankFormatTEI,
+			status:   http.StatusOK,
+			response: ` [{"index": 0, "score": 0.1}, {"index": 1, "score": 0.7}, {"index": 2, "score": 0.4}]`,
+			topK:     3,
+			want:     []RerankResult{{Index: 1, Score: 0.7}, {Index: 2, Score: 0.4}, {Index: 0, Score: 0.1}},
+		},
+		{
+			name:     "index past the documents",
+			format:   RerankFormatCohere,
+			status:   http.StatusOK,
+			response: `{"results": [{"index": 3, "relevance_score": 0.9}]}`,
+			wantErr:  "unknown document index 3",
+		},
+		{
+			name:     "negative index",
+			format:   RerankFormatTEI,
+			status:   http.StatusOK,
+			response: `[{"index": -1, "score": 0.9}]`,
+			wantErr:  "unknown document index -1",
+		},
+		{
+			name:     "error status",
+			format:   RerankFormatCohere,
+			status:   http.StatusUnauthorized,
+			response: "invalid api key\n",
+			wantErr:  "status 401: invalid api key",
+		},
+		{
+			name:     "malformed response",
+			format:   RerankFormatCohere,
+			status:   http.StatusOK,
+			response: `{"results": [`,
+			wantErr:  "failed to parse rerank response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request map[string]interface{}
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			reranker := NewHTTPReranker(server.URL, "secret", "rerank-model", tt.format)
+			results, err := reranker.Rerank(context.Background(), "question", documents, tt.topK)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Rerank() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rerank() error = %v", err)
+			}
+			if !slices.Equal(results, tt.want) {
+				t.Errorf("results = %v, want %v", results, tt.want)
+			}
+
+			if authorization != "Bearer secret" {
+				t.Errorf("authorization = %q, want the API key", authorization)
+			}
+			if request["query"] != "question" {
+				t.Errorf("query = %v, want question", request["query"])
+			}
+			if tt.format == RerankFormatTEI {
+				if _, ok := request["texts"]; !ok || request["model"] != nil {
+					t.Errorf("TEI request = %v, want texts without a model", request)
+				}
+			} else if request["documents"] == nil || request["model"] != "rerank-model" || request["top_n"] != float64(tt.topK) {
+				t.Errorf("Cohere request = %v, want documents, model and top_n", request)
+			}
+		})
+	}
+}
+
+func TestParseRerankResponse(t *testing.T) {
+	results, err := parseRerankResponse([]byte(`{"results": [{"index": 1, "relevance_score": 0.4, "score": 0.9}, {"index": 0}]}`))
+	if err != nil {
+		t.Fatalf("parseRerankResponse() error = %v", err)
+	}
+	want := []RerankResult{{Index: 1, Score: 0.4}, {Index: 0, Score: 0}}
+	if !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}
+
+// fakeProvider answers every chat with a fixed output
+type fakeProvider struct {
+	providers.LLMProvider
+	output string
+}
+
+func (p *fakeProvider) GenerateChat(ctx context.Context, messages []providers.ChatMessage, options map[string]interface{}) (<-chan string, error) {
+	stream := make(chan string, 1)
+	stream <- p.output
+	close(stream)
+	return stream, nil
+}
+
+func TestLLMReranker(t *testing.T) {
+	documents := []string{"zero", "one", "two"}
+
+	tests := []struct {
+		name    string
+		output  string
+		topK    int
+		want    []RerankResult
+		wantErr string
+	}{
+		{
+			name:   "grades in passage order",
+			output: "[2, 9, 5]",
+			topK:   3,
+			want:   []RerankResult{{Index: 1, Score: 0.9}, {Index: 2, Score: 0.5}, {Index: 0, Score: 0.2}},
+		},
+		{
+			name:   "array inside prose and thinking",
+			output: "<think>[1, 1]</think>Grades:\n[10,\n 0.5, 7]\nDone.",
+			topK:   2,
+			want:   []RerankResult{{Index: 0, Score: 1}, {Index: 2, Score: 0.7}},
+		},
+		{
+			name:   "grades out of range are clamped",
+			output: "[12, 3, 0]",
+			want:   []RerankResult{{Index: 0, Score: 1}, {Index: 1, Score: 0.3}, {Index: 2, Score: 0}},
+		},
+		{
+			name:    "no array",
+			output:  "All passages are relevant.",
+			wantErr: "model returned no grades",
+		},
+		{
+			name:    "wrong number of grades",
+			output:  "[1, 2]",
+			wantErr: "2 grades for 3 passages",
+		},
+		{
+			name:    "invalid grade",
+			output:  "[1, 2.5.1, 3]",
+			wantErr: `invalid grade "2.5.1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reranker := &LLMReranker{Provider: &fakeProvider{output: tt.output}, Model: "model"}
+			results, err := reranker.Rerank(context.Background(), "question", documents, tt.topK)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Rerank() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rerank() error = %v", err)
+			}
+			if !slices.Equal(results, tt.want) {
+				t.Errorf("results = %v, want %v", results, tt.want)
+			}
+		})
+	}
+}
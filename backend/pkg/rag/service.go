@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"sef/app/entities"
 	"sef/pkg/documentservice"
+	"sef/pkg/qdrant"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3/log"
 	"gorm.io/gorm"
@@ -35,10 +38,54 @@ type DocumentInfo struct {
 type AugmentPromptResult struct {
 	AugmentedPrompt string
 	DocumentsUsed   []DocumentInfo
+	Citations       []entities.MessageCitation // Chunks numbered in the prompt, in order
+	Timings         Timings
 }
 
-// AugmentPrompt retrieves relevant context and augments the user's prompt
+// Timings records how long each retrieval stage took
+type Timings map[string]time.Duration
+
+// Milliseconds returns the stage durations in milliseconds
+func (t Timings) Milliseconds() map[string]int64 {
+	ms := make(map[string]int64, len(t))
+	for stage, duration := range t {
+		ms[stage] = duration.Milliseconds()
+	}
+	return ms
+}
+
+func (t Timings) String() string {
+	stages := make([]string, 0, len(t))
+	for stage := range t {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+
+	parts := make([]string, len(stages))
+	for i, stage := range stages {
+		parts[i] = fmt.Sprintf("%s=%s", stage, t[stage].Round(time.Millisecond))
+	}
+	return strings.Join(parts, " ")
+}
+
+// AugmentPrompt retrieves relevant context and augments the user's prompt.
+// The duration of every retrieval stage is recorded in the result.
 func (rs *RAGService) AugmentPrompt(ctx context.Context, userPrompt string, chatbotID uint, limit int) (*AugmentPromptResult, error) {
+	started := time.Now()
+	timings := Timings{}
+
+	result, err := rs.augmentPrompt(ctx, userPrompt, chatbotID, limit, timings)
+
+	timings["total"] = time.Since(started)
+	if result != nil {
+		result.Timings = timings
+	}
+	log.Infof("RAG stage timings for chatbot %d: %s", chatbotID, timings)
+
+	return result, err
+}
+
+func (rs *RAGService) augmentPrompt(ctx context.Context, userPrompt string, chatbotID uint, limit int, timings Timings) (*AugmentPromptResult, error) {
 	// Check if query is just a greeting/small talk - skip RAG if so
 	if rs.isSmallTalk(userPrompt) {
 		log.Info("Query detected as small talk/greeting - skipping RAG")
@@ -54,31 +101,34 @@ func (rs *RAGService) AugmentPrompt(ctx context.Context, userPrompt string, chat
 
 	log.Infof("Query complexity analysis: requesting %d chunks (dynamic limit: %d)", limit, dynamicLimit)
 
-	// Get chatbot with documents
+	// Get chatbot
 	var chatbot entities.Chatbot
-	if err := rs.DB.Preload("Documents").First(&chatbot, chatbotID).Error; err != nil {
+	if err := rs.DB.First(&chatbot, chatbotID).Error; err != nil {
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
 	}
 
-	// If no documents assigned, return original prompt
-	if len(chatbot.Documents) == 0 {
+	// If no documents are ready, return original prompt
+	if available, err := rs.IsRAGAvailable(chatbotID); err != nil || !available {
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
 	}
 
-	// Get document IDs
-	documentIDs := make([]uint, 0, len(chatbot.Documents))
-	for _, doc := range chatbot.Documents {
-		if doc.Status == "ready" {
-			documentIDs = append(documentIDs, doc.ID)
-		}
+	reranker, err := NewReranker(rs.DB, &chatbot)
+	if err != nil {
+		log.Warnf("Reranking disabled for chatbot %d: %v", chatbot.ID, err)
+	}
+	if reranker != nil {
+		// The reranker picks the best chunks out of a wider candidate set
+		limit = max(limit, chatbot.GetRerankTopN())
 	}
 
-	if len(documentIDs) == 0 {
-		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
+	if chatbot.RetrievalMode == entities.RetrievalModeHybrid {
+		return rs.AugmentPromptWithHybridSearch(ctx, userPrompt, &chatbot, limit, reranker, timings)
 	}
 
-	// Get relevant context
-	results, err := rs.DocumentService.GetRelevantContext(ctx, userPrompt, documentIDs, limit)
+	// Get relevant context among the chatbot's documents
+	retrievalStarted := time.Now()
+	results, err := rs.DocumentService.GetChatbotContext(ctx, userPrompt, &chatbot, limit)
+	timings["dense"] = time.Since(retrievalStarted)
 	if err != nil {
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, err
 	}
@@ -112,6 +162,10 @@ func (rs *RAGService) AugmentPrompt(ctx context.Context, userPrompt string, chat
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
 	}
 
+	if reranker != nil {
+		return rs.augmentWithReranking(ctx, reranker, userPrompt, &chatbot, results, timings)
+	}
+
 	// Use adaptive threshold: use chunks that are either:
 	// 1. Above 0.70 (minimum threshold for relevance - increased from 0.55)
 	// 2. Within 90% of the top score (relative threshold - increased from 85%)
@@ -149,13 +203,9 @@ func (rs *RAGService) AugmentPrompt(ctx context.Context, userPrompt string, chat
 	maxChunksToInclude := rs.calculateMaxChunks(userPrompt, maxScore, meanScore, len(qualifyingTitles))
 	log.Infof("Using dynamic max chunks: %d (based on query complexity and score quality)", maxChunksToInclude)
 
-	var documentsUsed []DocumentInfo
-	var contextParts []string
-	seenTitles := make(map[string]bool)
-	chunksIncluded := 0
-
+	var selected []qdrant.SearchResult
 	for _, result := range results {
-		if chunksIncluded >= maxChunksToInclude {
+		if len(selected) >= maxChunksToInclude {
 			break
 		}
 
@@ -164,98 +214,80 @@ func (rs *RAGService) AugmentPrompt(ctx context.Context, userPrompt string, chat
 			title = t
 		}
 
-		text := ""
-		if txt, ok := result.Payload["text"].(string); ok {
-			text = txt
-		}
-
 		// Only include chunks from documents that have at least one chunk above threshold
 		if _, isQualifying := qualifyingTitles[title]; !isQualifying {
 			continue
 		}
 
-		// Track unique documents used (use the highest score for the document)
-		if !seenTitles[title] {
-			documentsUsed = append(documentsUsed, DocumentInfo{
-				Title: title,
-				Score: qualifyingTitles[title],
-			})
-			seenTitles[title] = true
-		}
-
-		contextParts = append(contextParts, text)
-		chunksIncluded++
+		selected = append(selected, result)
 	}
 
 	// If no chunks passed the relevance threshold, return original prompt
-	if len(contextParts) == 0 {
+	if len(selected) == 0 {
 		log.Infof("No chunks passed relevance threshold of %.2f", adaptiveThreshold)
 		return &AugmentPromptResult{AugmentedPrompt: userPrompt}, nil
 	}
 
-	log.Infof("Using %d chunks from %d documents", len(contextParts), len(documentsUsed))
-
-	// Build context from chunks
-	contextStr := joinStrings(contextParts, "\n\n---\n\n")
-
-	// Augment the prompt with retrieved context
-	augmentedPrompt := fmt.Sprintf(`You are provided with relevant documentation to help answer the user's question accurately.
+	log.Infof("Using %d chunks from %d documents", len(selected), len(qualifyingTitles))
 
-=== RELEVANT DOCUMENTATION ===
-%s
-=== END OF DOCUMENTATION ===
+	return rs.buildAugmentedPrompt(userPrompt, selected)
+}
 
-User Question: %s
+// augmentWithReranking reranks the candidates and builds the prompt from the
+// best ones. When reranking fails the retrieval order is kept.
+func (rs *RAGService) augmentWithReranking(ctx context.Context, reranker Reranker, userPrompt string, chatbot *entities.Chatbot, candidates []qdrant.SearchResult, timings Timings) (*AugmentPromptResult, error) {
+	started := time.Now()
+	reranked, err := rerank(ctx, reranker, userPrompt, candidates, chatbot.GetRerankTopN(), chatbot.GetRerankTopK())
+	timings["rerank"] = time.Since(started)
 
-Please provide a comprehensive and accurate answer based on the documentation provided above. If the documentation doesn't contain enough information to fully answer the question, fill the blank with your own knowledge. If you do not know the answer, please say "I don't know." Do not make up an answer.`,
-		contextStr,
-		userPrompt)
+	if err != nil {
+		log.Warnf("Reranking failed for chatbot %d, keeping retrieval order: %v", chatbot.ID, err)
+		reranked = candidates[:min(len(candidates), chatbot.GetRerankTopK())]
+	}
 
-	return &AugmentPromptResult{
-		AugmentedPrompt: augmentedPrompt,
-		DocumentsUsed:   documentsUsed,
-	}, nil
+	log.Infof("Reranked %d candidates into %d chunks", min(len(candidates), chatbot.GetRerankTopN()), len(reranked))
+	return rs.buildAugmentedPrompt(userPrompt, reranked)
 }
 
 // GetDocumentStats returns statistics about chatbot's documents
 func (rs *RAGService) GetDocumentStats(chatbotID uint) (map[string]interface{}, error) {
-	var chatbot entities.Chatbot
-	if err := rs.DB.Preload("Documents").First(&chatbot, chatbotID).Error; err != nil {
+	var stats struct {
+		DocumentCount  int
+		TotalChunks    int
+		TotalDocuments int
+	}
+	if err := rs.chatbotDocuments(chatbotID).
+		Select("COUNT(*) FILTER (WHERE documents.status = 'ready') AS document_count, " +
+			"COALESCE(SUM(documents.chunk_count) FILTER (WHERE documents.status = 'ready'), 0) AS total_chunks, " +
+			"COUNT(*) AS total_documents").
+		Scan(&stats).Error; err != nil {
 		return nil, err
 	}
 
-	readyCount := 0
-	totalChunks := 0
-	for _, doc := range chatbot.Documents {
-		if doc.Status == "ready" {
-			readyCount++
-			totalChunks += doc.ChunkCount
-		}
-	}
-
-	stats := map[string]interface{}{
-		"document_count":  readyCount,
-		"total_chunks":    totalChunks,
-		"total_documents": len(chatbot.Documents),
-	}
-
-	return stats, nil
+	return map[string]interface{}{
+		"document_count":  stats.DocumentCount,
+		"total_chunks":    stats.TotalChunks,
+		"total_documents": stats.TotalDocuments,
+	}, nil
 }
 
 // IsRAGAvailable checks if RAG is available for the chatbot
 func (rs *RAGService) IsRAGAvailable(chatbotID uint) (bool, error) {
-	var chatbot entities.Chatbot
-	if err := rs.DB.Preload("Documents").First(&chatbot, chatbotID).Error; err != nil {
+	var ready int64
+	if err := rs.chatbotDocuments(chatbotID).
+		Where("documents.status = ?", "ready").
+		Count(&ready).Error; err != nil {
 		return false, err
 	}
 
-	for _, doc := range chatbot.Documents {
-		if doc.Status == "ready" {
-			return true, nil
-		}
-	}
+	return ready > 0, nil
+}
 
-	return false, nil
+// chatbotDocuments queries the documents assigned to a chatbot without loading them all
+func (rs *RAGService) chatbotDocuments(chatbotID uint) *gorm.DB {
+	return rs.DB.Table("documents").
+		Joins("JOIN chatbot_documents ON chatbot_documents.document_id = documents.id").
+		Where("chatbot_documents.chatbot_id = ? AND documents.deleted_at IS NULL", chatbotID)
 }
 
 // Helper function to join strings
@@ -21,6 +21,8 @@ type SummaryServiceInterface interface {
 	UpdateSessionSummary(sessionID uint, userID uint, summary string) error
 	ShouldGenerateSummary(session *entities.Session) bool
 	AutoGenerateSummaryIfNeeded(sessionID uint, userID uint) error
+	ContextSummaries(sessionID uint) ([]entities.ContextSummary, error)
+	UpdateContextSummary(session *entities.Session, previous *entities.ContextSummary, messages []entities.Message) (*entities.ContextSummary, error)
 }
 
 // NewSummaryService creates a new instance of SummaryService
@@ -166,8 +168,8 @@ func (s *SummaryService) formatConversationForSummary(messages []entities.Messag
 
 	for i := startIndex; i < len(messages); i++ {
 		message := messages[i]
-		if message.Role == "tool" {
-			continue // Skip tool messages
+		if message.Role == "tool" || len(message.ToolCalls) > 0 {
+			continue // Skip tool messages and tool call requests
 		}
 
 		role := "User"
@@ -193,6 +195,26 @@ func (s *SummaryService) formatConversationForSummary(messages []entities.Messag
 
 // generateSummaryWithProvider generates a summary using the AI provider
 func (s *SummaryService) generateSummaryWithProvider(session *entities.Session, conversationText string) (string, error) {
+	// Prepare the prompt for summarization
+	prompt := s.buildSummaryPrompt(conversationText)
+
+	summaryText, err := s.generateWithProvider(session, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	// Limit summary length to maximum 6 words
+	words := strings.Fields(summaryText)
+	if len(words) > 6 {
+		summaryText = strings.Join(words[:6], " ")
+	}
+
+	log.Info(fmt.Sprintf("Successfully generated summary for session %d: %s", session.ID, summaryText))
+	return summaryText, nil
+}
+
+// generateWithProvider runs a prompt on the session's chatbot provider with retries
+func (s *SummaryService) generateWithProvider(session *entities.Session, prompt string) (string, error) {
 	// Create provider factory and get provider instance
 	factory := &providers.ProviderFactory{}
 	providerConfig := map[string]interface{}{
@@ -205,9 +227,6 @@ func (s *SummaryService) generateSummaryWithProvider(session *entities.Session,
 		return "", fmt.Errorf("failed to create provider: %w", err)
 	}
 
-	// Prepare the prompt for summarization
-	prompt := s.buildSummaryPrompt(conversationText)
-
 	// Set options
 	options := map[string]interface{}{}
 	if session.Chatbot.ModelName != "" {
@@ -277,13 +296,7 @@ func (s *SummaryService) generateSummaryWithProvider(session *entities.Session,
 			continue
 		}
 
-		// Limit summary length to maximum 6 words
-		words := strings.Fields(summaryText)
-		if len(words) > 6 {
-			summaryText = strings.Join(words[:6], " ")
-		}
-
-		log.Info(fmt.Sprintf("Successfully generated summary for session %d on attempt %d: %s", session.ID, attempt, summaryText))
+		log.Info(fmt.Sprintf("Summary generated for session %d on attempt %d", session.ID, attempt))
 		return summaryText, nil
 	}
 
@@ -299,6 +312,88 @@ func (s *SummaryService) buildSummaryPrompt(conversationText string) string {
 Title:`, conversationText)
 }
 
+// ContextSummaries returns the rolling context summaries of a session, newest first
+func (s *SummaryService) ContextSummaries(sessionID uint) ([]entities.ContextSummary, error) {
+	var summaries []entities.ContextSummary
+	if err := s.DB.
+		Where("session_id = ?", sessionID).
+		Order("up_to_message_id DESC").
+		Find(&summaries).Error; err != nil {
+		return nil, fmt.Errorf("failed to load context summaries: %w", err)
+	}
+	return summaries, nil
+}
+
+// UpdateContextSummary extends the rolling summary of a session branch with the messages
+// that follow it and no longer fit in the model context, and stores the new summary
+func (s *SummaryService) UpdateContextSummary(session *entities.Session, previous *entities.ContextSummary, messages []entities.Message) (*entities.ContextSummary, error) {
+	var upToMessageID uint
+	var conversation strings.Builder
+	for _, message := range messages {
+		if message.Role == "tool" || len(message.ToolCalls) > 0 {
+			continue // Tool rows belong to the assistant message of their turn
+		}
+		upToMessageID = message.ID
+
+		role := "User"
+		if message.Role == "assistant" {
+			role = "Assistant"
+		}
+
+		// Long answers are cut, the summary only needs their gist
+		content := s.removeThinkTags(message.Content)
+		if len(content) > 2000 {
+			content = strings.ToValidUTF8(content[:2000], "") + "..."
+		}
+
+		conversation.WriteString(fmt.Sprintf("%s: %s\n\n", role, content))
+	}
+
+	if upToMessageID == 0 {
+		return nil, fmt.Errorf("no messages to summarize")
+	}
+
+	previousSummary := ""
+	if previous != nil {
+		previousSummary = previous.Content
+	}
+
+	content, err := s.generateWithProvider(session, s.buildContextSummaryPrompt(previousSummary, conversation.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate context summary: %w", err)
+	}
+	content = s.removeThinkTags(content)
+
+	summary := &entities.ContextSummary{
+		SessionID:     session.ID,
+		UpToMessageID: upToMessageID,
+		Content:       content,
+	}
+	if err := s.DB.Create(summary).Error; err != nil {
+		return nil, fmt.Errorf("failed to save context summary: %w", err)
+	}
+
+	log.Info(fmt.Sprintf("Context summary of session %d extended up to message %d", session.ID, upToMessageID))
+	return summary, nil
+}
+
+// buildContextSummaryPrompt creates the prompt that folds older messages into the rolling summary
+func (s *SummaryService) buildContextSummaryPrompt(previousSummary string, conversationText string) string {
+	if previousSummary == "" {
+		previousSummary = "(empty)"
+	}
+
+	return fmt.Sprintf(`Update the summary of an ongoing conversation with the new messages below. Keep the facts, names, numbers, decisions and open questions the assistant needs to continue the conversation. Use the conversation's language. Answer with the updated summary only, in at most 300 words.
+
+Current summary:
+%s
+
+New messages:
+%s
+
+Updated summary:`, previousSummary, conversationText)
+}
+
 // removeThinkTags removes content within <think></think> tags from the message
 func (s *SummaryService) removeThinkTags(content string) string {
 	// Use regex to remove all <think>...</think> blocks (case-insensitive, multiline)
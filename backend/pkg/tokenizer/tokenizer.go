@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"sef/pkg/providers"
+	"unicode"
+)
+
+// messageOverhead is the number of tokens chat templates add around each message
+const messageOverhead = 4
+
+// EstimateTokens approximates the BPE token count of a text for providers that
+// do not report usage. Text is split the way BPE pre-tokenizers do: letters are
+// grouped into words of roughly four characters per token, digits into groups
+// of three and every other symbol counts as its own token.
+func EstimateTokens(text string) int {
+	tokens := 0
+	letters := 0
+	digits := 0
+
+	flush := func() {
+		tokens += (letters+3)/4 + (digits+2)/3
+		letters = 0
+		digits = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			// Non-ASCII letters are split into more tokens by most vocabularies
+			if r > unicode.MaxASCII {
+				letters += 2
+			} else {
+				letters++
+			}
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// EstimateMessages approximates the prompt tokens of a chat request
+func EstimateMessages(messages []providers.ChatMessage) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += messageOverhead + EstimateTokens(message.Content)
+		for _, toolCall := range message.ToolCalls {
+			tokens += EstimateTokens(toolCall.Function.Name) + estimateJSON(toolCall.Function.Arguments)
+		}
+	}
+	return tokens
+}
+
+// EstimateTools approximates the prompt tokens used by tool definitions
+func EstimateTools(tools []providers.ToolDefinition) int {
+	tokens := 0
+	for _, tool := range tools {
+		tokens += EstimateTokens(tool.Function.Name) + EstimateTokens(tool.Function.Description) + estimateJSON(tool.Function.Parameters)
+	}
+	return tokens
+}
+
+// estimateJSON approximates the tokens of a value serialized as JSON
+func estimateJSON(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return EstimateTokens(string(data))
+}
@@ -10,6 +10,14 @@ const nextConfig = {
         source: "/api/:path*",
         destination: `http://backend:8110/api/:path*`,
       },
+      {
+        source: "/openai/:path*",
+        destination: `http://backend:8110/openai/:path*`,
+      },
+      {
+        source: "/mcp/:path*",
+        destination: `http://backend:8110/mcp/:path*`,
+      },
     ]
   },
   // Increase timeouts for long-running requests
@@ -32,6 +40,19 @@ const nextConfig = {
           },
         ],
       },
+      {
+        source: '/openai/:path*',
+        headers: [
+          {
+            key: 'X-Accel-Buffering',
+            value: 'no',
+          },
+          {
+            key: 'Cache-Control',
+            value: 'no-cache',
+          },
+        ],
+      },
     ]
   },
 }
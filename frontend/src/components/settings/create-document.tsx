@@ -286,7 +286,7 @@ export default function CreateDocument() {
                   <Input
                     id="file"
                     type="file"
-                    accept=".txt,.md,.markdown,.pdf,.doc,.docx"
+                    accept=".txt,.md,.markdown,.pdf,.docx,.html,.htm,.csv,.tsv,.xlsx,.json"
                     onChange={handleFileSelect}
                     disabled={uploading}
                   />
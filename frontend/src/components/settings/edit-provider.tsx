@@ -96,8 +96,14 @@ export default function EditProvider() {
   }, [])
 
   const handleEdit = (values: z.infer<typeof formSchema>) => {
+    // The masked key is only sent when it was changed, an emptied field clears it
+    const payload: Partial<z.infer<typeof formSchema>> = { ...values }
+    if (!form.formState.dirtyFields.api_key) {
+      delete payload.api_key
+    }
+
     http
-      .patch(`/providers/${values.id}`, values)
+      .patch(`/providers/${values.id}`, payload)
       .then((res) => {
         if (res.status === 200) {
           toast({
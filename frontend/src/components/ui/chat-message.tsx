@@ -15,6 +15,7 @@ import {
 } from "lucide-react"
 
 import { cn } from "@/lib/utils"
+import { Citation } from "@/types/chat"
 import { useCurrentUser } from "@/hooks/auth/useCurrentUser"
 import {
   Collapsible,
@@ -33,6 +34,47 @@ const TIME_FORMAT_OPTIONS: Intl.DateTimeFormatOptions = {
   minute: "2-digit",
 } as const
 
+// Code spans and blocks keep their [n] text as is
+const CODE_REGEX = /(```[\s\S]*?(?:```|$)|`[^`\n]*`)/g
+// [n] not already followed by a link target or reference definition
+const CITATION_REGEX = /\[(\d+)\](?![(:[])/g
+
+// citationLocation describes where a cited chunk is, e.g. "sayfa 4, Kurulum"
+function citationLocation(citation: Citation): string {
+  const location: string[] = []
+  if (citation.page) location.push(`sayfa ${citation.page}`)
+  if (citation.heading) location.push(citation.heading)
+  return location.join(", ")
+}
+
+// linkCitations turns the [n] markers of cited sources into links to the
+// source list of the message, titled with the cited document
+function linkCitations(
+  text: string,
+  citations: Citation[] | undefined,
+  anchorPrefix: string
+): string {
+  if (!citations?.length) return text
+
+  const byNumber = new Map(citations.map((c) => [c.number, c]))
+  return text
+    .split(CODE_REGEX)
+    .map((segment, index) => {
+      // Odd segments are the captured code
+      if (index % 2 === 1) return segment
+      return segment.replace(CITATION_REGEX, (marker, number) => {
+        const citation = byNumber.get(Number(number))
+        if (!citation) return marker
+        const location = citationLocation(citation)
+        const title = (
+          location ? `${citation.title} (${location})` : citation.title
+        ).replace(/"/g, "'")
+        return `[\\[${number}\\]](#${anchorPrefix}-${number} "${title}")`
+      })
+    })
+    .join("")
+}
+
 // Optimized parsing functions with error handling
 function parseTextForTools(content: string): MessagePart[] {
   if (!content?.trim()) return []
@@ -304,6 +346,7 @@ export interface Message {
   role: "user" | "assistant" | (string & {})
   content: string
   createdAt?: Date
+  citations?: Citation[]
   experimental_attachments?: Attachment[]
   toolInvocations?: ToolInvocation[]
   parts?: MessagePart[]
@@ -356,6 +399,8 @@ const MessageContent = memo(
     parsedParts,
     toolInvocations,
     content,
+    citations,
+    anchorPrefix,
     isStreaming,
   }: {
     isUser: boolean
@@ -363,6 +408,8 @@ const MessageContent = memo(
     parsedParts: MessagePart[]
     toolInvocations?: ToolInvocation[]
     content: string
+    citations?: Citation[]
+    anchorPrefix: string
     isStreaming?: boolean
   }) => {
     if (isUser) {
@@ -401,7 +448,7 @@ const MessageContent = memo(
                 if (part.type === "text") {
                   return (
                     <MarkdownRenderer key={`text-${index}`}>
-                      {part.text}
+                      {linkCitations(part.text, citations, anchorPrefix)}
                     </MarkdownRenderer>
                   )
                 } else if (part.type === "reasoning") {
@@ -450,7 +497,9 @@ const MessageContent = memo(
             </>
           ) : (
             <>
-              <MarkdownRenderer>{content}</MarkdownRenderer>
+              <MarkdownRenderer>
+                {linkCitations(content, citations, anchorPrefix)}
+              </MarkdownRenderer>
               {isStreaming && (
                 <div className="flex -space-x-2.5 -ml-2 mt-3">
                   <Dot
@@ -475,6 +524,10 @@ const MessageContent = memo(
               )}
             </>
           )}
+
+          {citations && citations.length > 0 && (
+            <CitationList citations={citations} anchorPrefix={anchorPrefix} />
+          )}
         </div>
       </>
     )
@@ -484,8 +537,10 @@ MessageContent.displayName = "MessageContent"
 
 export const ChatMessage = memo<ChatMessageProps>(
   ({
+    id,
     role,
     content,
+    citations,
     createdAt,
     showTimeStamp = false,
     animation = "scale",
@@ -539,6 +594,8 @@ export const ChatMessage = memo<ChatMessageProps>(
               parsedParts={parsedParts}
               toolInvocations={toolInvocations}
               content={content}
+              citations={citations}
+              anchorPrefix={`citation-${id}`}
               isStreaming={!isUser && isStreaming}
             />
           </div>
@@ -668,6 +725,41 @@ const DocumentUsedComponent = memo(
 )
 DocumentUsedComponent.displayName = "DocumentUsedComponent"
 
+const CitationList = memo(
+  ({
+    citations,
+    anchorPrefix,
+  }: {
+    citations: Citation[]
+    anchorPrefix: string
+  }) => {
+    return (
+      <div className="mt-3 flex flex-col gap-1 text-muted-foreground text-sm">
+        <span className="font-semibold">Kaynaklar</span>
+        {citations.map((citation) => {
+          const location = citationLocation(citation)
+          return (
+            <span
+              key={citation.number}
+              id={`${anchorPrefix}-${citation.number}`}
+              title={citation.snippet}
+              className="flex items-start gap-1 scroll-mt-4"
+            >
+              <FileText className="size-3 mt-1 shrink-0" />
+              <span>
+                <span className="font-semibold">[{citation.number}]</span>{" "}
+                {citation.title}
+                {location && ` (${location})`}
+              </span>
+            </span>
+          )
+        })}
+      </div>
+    )
+  }
+)
+CitationList.displayName = "CitationList"
+
 const ToolCallComponent = memo(
   ({ toolInvocations }: Pick<ChatMessageProps, "toolInvocations">) => {
     if (!toolInvocations?.length) return null
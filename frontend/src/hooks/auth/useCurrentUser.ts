@@ -9,6 +9,7 @@ const defaultUserObject: IUser = {
   name: "",
   username: "guest",
   super_admin: false,
+  permissions: [],
 } as IUser
 
 let user = {
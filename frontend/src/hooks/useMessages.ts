@@ -21,6 +21,7 @@ export function useMessages(sessionId: string | string[] | undefined) {
           role: msg.role,
           content: msg.content,
           createdAt: new Date(msg.created_at),
+          citations: msg.citations,
         }))
         setMessages(formattedMessages)
       } catch (err) {
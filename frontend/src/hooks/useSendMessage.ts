@@ -1,5 +1,27 @@
 import { useState, useCallback } from "react"
-import { Message } from "@/types/chat"
+import { Citation, Message } from "@/types/chat"
+
+// Version of the typed stream event schema this client understands
+const STREAM_PROTOCOL_VERSION = "1"
+
+interface StreamEvent {
+  type: string
+  data: string
+}
+
+// parseStreamEvent reads one SSE frame, comments like keep-alive pings return null
+function parseStreamEvent(frame: string): StreamEvent | null {
+  let type = "message"
+  const data: string[] = []
+  for (const line of frame.split("\n")) {
+    if (line.startsWith("event:")) {
+      type = line.slice(6).trim()
+    } else if (line.startsWith("data:")) {
+      data.push(line.slice(5).replace(/^ /, ""))
+    }
+  }
+  return data.length > 0 ? { type, data: data.join("\n") } : null
+}
 
 export function useSendMessage(
   sessionId: string | string[] | undefined, 
@@ -37,6 +59,7 @@ export function useSendMessage(
           headers: {
             "Content-Type": "application/json",
             "Authorization": `Bearer ${localStorage.getItem('token')}`,
+            "X-Stream-Protocol": STREAM_PROTOCOL_VERSION,
           },
           body: JSON.stringify({
             content: content.trim(),
@@ -47,16 +70,25 @@ export function useSendMessage(
 
         clearTimeout(timeoutId)
 
+        if (response.status === 429) {
+          // Quota exceeded, retrying would only count against the quota again
+          const retryAfter = response.headers.get("Retry-After")
+          setError(`Mesaj kotanız doldu. Lütfen ${retryAfter ?? "birkaç"} saniye sonra tekrar deneyin.`)
+          setIsGenerating(false)
+          return
+        }
+
         if (!response.ok) {
           throw new Error("Mesaj gönderilirken hata oluştu")
         }
 
-        // Handle JSON streaming response
+        // Handle typed SSE response
         const reader = response.body?.getReader()
         const decoder = new TextDecoder()
         let assistantContent = ""
+        let citations: Citation[] = []
+        let thinking = false
         let buffer = ""
-        let lastActivityTime = Date.now()
 
         // Add empty assistant message
         const assistantMessage: Message = {
@@ -67,51 +99,87 @@ export function useSendMessage(
         }
         setMessages(prev => [...prev, assistantMessage])
 
+        const updateAssistant = () => {
+          const content = assistantContent
+          setMessages(prev => prev.map(msg =>
+            msg.id === assistantMessageId
+              ? { ...msg, content, citations }
+              : msg
+          ))
+        }
+
+        // Thinking is rendered from <think> tags, like persisted messages
+        const closeThinking = () => {
+          if (thinking) {
+            assistantContent += "</think>"
+            thinking = false
+          }
+        }
+
         if (reader) {
           while (true) {
             const { done, value } = await reader.read()
             if (done) break
 
-            lastActivityTime = Date.now()
             buffer += decoder.decode(value, { stream: true })
-            const lines = buffer.split('\n')
-            buffer = lines.pop() || "" // Keep incomplete line in buffer
+            const frames = buffer.split("\n\n")
+            buffer = frames.pop() || "" // Keep incomplete frame in buffer
 
-            for (const line of lines) {
-              if (line.trim() === "") continue
+            for (const frame of frames) {
+              const event = parseStreamEvent(frame)
+              if (!event) continue // Keep-alive comment
+
+              let data: any
               try {
-                const parsed = JSON.parse(line)
-                if (parsed.type === "chunk") {
-                  assistantContent += parsed.data
-                  // Update the assistant message in real-time
-                  setMessages(prev => prev.map(msg =>
-                    msg.id === assistantMessageId
-                      ? { ...msg, content: assistantContent }
-                      : msg
-                  ))
-                } else if (parsed.type === "error") {
-                  // Handle error messages from the backend
-                  assistantContent += parsed.data
-                  setMessages(prev => prev.map(msg =>
-                    msg.id === assistantMessageId
-                      ? { ...msg, content: assistantContent }
-                      : msg
-                  ))
-                  // Set error state but don't stop the stream as the error is part of the response
-                  console.warn("Chat error:", parsed.data)
-                } else if (parsed.type === "done") {
+                data = JSON.parse(event.data)
+              } catch (e) {
+                console.error("Failed to parse stream event:", e, "Frame:", frame)
+                continue
+              }
+
+              switch (event.type) {
+                case "content_delta":
+                  closeThinking()
+                  assistantContent += data.content
+                  updateAssistant()
+                  break
+                case "thinking_delta":
+                  if (!thinking) {
+                    assistantContent += "<think>"
+                    thinking = true
+                  }
+                  assistantContent += data.content
+                  updateAssistant()
+                  break
+                case "tool_call_started":
+                  closeThinking()
+                  assistantContent += `<tool_executing>${data.display_name}</tool_executing>`
+                  updateAssistant()
+                  break
+                case "tool_call_finished":
+                  assistantContent += `<tool_executed>${data.display_name}</tool_executed>`
+                  updateAssistant()
+                  break
+                case "rag_sources":
+                  citations = data.sources || []
+                  updateAssistant()
+                  break
+                case "error":
+                  // The error is shown as part of the response, the stream still ends with done
+                  closeThinking()
+                  assistantContent += assistantContent ? `\n\n${data.message}` : data.message
+                  updateAssistant()
+                  console.warn("Chat error:", data.code, data.message)
+                  break
+                case "done":
+                  closeThinking()
+                  updateAssistant()
                   setIsGenerating(false) // Set generating to false when done
                   // Trigger callback for session updates (summary polling)
                   if (onMessageComplete) {
                     onMessageComplete()
                   }
                   return // Success - exit retry loop
-                } else if (parsed.type === "ping") {
-                  // Keep-alive ping, do nothing
-                  continue
-                }
-              } catch (e) {
-                console.error("Failed to parse JSON line:", e, "Line:", line)
               }
             }
           }
@@ -17,6 +17,7 @@ export const Settings = {
       description: "Sistemdeki AI sağlayıcılarını yönetin.",
       icon: CloudCog,
       href: "/settings/providers",
+      permission: "providers:manage",
     },
     {
       id: "chatbots",
@@ -24,6 +25,7 @@ export const Settings = {
       description: "Sistemdeki chatbot türlerini yönetin, sistem promptlarını düzenleyebilir ve yenilerini ekleyebilirsiniz.",
       icon: MessageCircleMoreIcon,
       href: "/settings/chatbots",
+      permission: "chatbots:manage",
     },
     {
       id: "tools",
@@ -31,6 +33,7 @@ export const Settings = {
       description: "AI araçlarınızı ve yapılandırmalarınızı yönetin.",
       icon: Wrench,
       href: "/settings/tools",
+      permission: "tools:manage",
     },
     {
       id: "documents",
@@ -38,6 +41,7 @@ export const Settings = {
       description: "RAG için döküman ve bilgi tabanlarını yönetin.",
       icon: FileText,
       href: "/settings/documents",
+      permission: "documents:manage",
     },
     {
       id: "sessions",
@@ -45,6 +49,7 @@ export const Settings = {
       description: "Sistemdeki sohbet oturumlarını görüntüleyin ve yönetin.",
       icon: ScrollText,
       href: "/settings/sessions",
+      permission: "sessions:audit",
     },
     {
       id: "embedding",
@@ -52,6 +57,7 @@ export const Settings = {
       description: "RAG için gömme modeli ve vektör yapılandırmasını yönetin.",
       icon: SettingsIcon,
       href: "/settings/embedding",
+      permission: "settings:manage",
     },
     {
       id: "widget",
@@ -59,6 +65,7 @@ export const Settings = {
       description: "Şef chat widget'ını web sitenize entegre edin ve yapılandırın.",
       icon: Code2,
       href: "/settings/widget",
+      permission: "chatbots:manage",
     },
   ],
 }
@@ -14,6 +14,7 @@ import {
   SelectValue,
 } from "@/components/ui/select"
 import { Input } from "@/components/ui/input"
+import { Progress } from "@/components/ui/progress"
 import PageHeader from "@/components/ui/page-header"
 import { useToast } from "@/components/ui/use-toast"
 import { http } from "@/services"
@@ -30,10 +31,22 @@ interface IEmbeddingModel {
   vector_size: number
 }
 
+interface IEmbeddingMigration {
+  id: number
+  model: string
+  status: string
+  total_documents: number
+  processed_documents: number
+  failed_documents: number
+  progress: number
+}
+
 interface IEmbeddingConfig {
   provider: IProvider | null
   model: string
   vector_size: string
+  collection: string
+  migration: IEmbeddingMigration | null
 }
 
 export default function EmbeddingSettingsPage() {
@@ -55,6 +68,14 @@ export default function EmbeddingSettingsPage() {
     fetchCurrentConfig()
   }, [])
 
+  // Follow a running migration until it finishes
+  useEffect(() => {
+    if (!currentConfig?.migration) return
+
+    const interval = setInterval(fetchCurrentConfig, 5000)
+    return () => clearInterval(interval)
+  }, [currentConfig?.migration?.id])
+
   const fetchProviders = async () => {
     try {
       const response = await http.get("/providers")
@@ -139,7 +160,7 @@ export default function EmbeddingSettingsPage() {
 
     setLoading(true)
     try {
-      await http.put("/settings/embedding", {
+      const response = await http.put("/settings/embedding", {
         provider_id: parseInt(selectedProviderId),
         model: selectedModel,
         vector_size: parseInt(vectorSize),
@@ -147,7 +168,9 @@ export default function EmbeddingSettingsPage() {
 
       toast({
         title: t("success"),
-        description: t("embedding.save_success"),
+        description: response.data.migration
+          ? t("embedding.migration_started")
+          : t("embedding.save_success"),
       })
       fetchCurrentConfig()
     } catch (error: any) {
@@ -192,6 +215,26 @@ export default function EmbeddingSettingsPage() {
                 <span className="text-sm font-medium">{t("embedding.vector_size")}:</span>
                 <Badge>{currentConfig.vector_size || "-"}</Badge>
               </div>
+              <div className="flex items-center justify-between">
+                <span className="text-sm font-medium">{t("embedding.collection")}:</span>
+                <Badge variant="outline">{currentConfig.collection || "-"}</Badge>
+              </div>
+              {currentConfig.migration && (
+                <div className="space-y-2 pt-2">
+                  <div className="flex items-center justify-between text-sm">
+                    <span className="font-medium">
+                      {t("embedding.migration_running", {
+                        model: currentConfig.migration.model,
+                      })}
+                    </span>
+                    <span className="text-muted-foreground">
+                      {currentConfig.migration.processed_documents}/
+                      {currentConfig.migration.total_documents}
+                    </span>
+                  </div>
+                  <Progress value={currentConfig.migration.progress} />
+                </div>
+              )}
             </CardContent>
           </Card>
         )}
@@ -9,18 +9,22 @@ export default function SettingsPage() {
   const user = useCurrentUser()
   const { t } = useTranslation("settings")
 
+  const systemSettings = Settings.system.filter((setting) =>
+    user.permissions?.includes(setting.permission)
+  )
+
   return (
     <>
       <PageHeader title={t("title")} description={t("description")} />
 
       <div className="h-full flex-1 flex-col p-8 pt-2 md:flex">
-        {user.super_admin === true && (
+        {systemSettings.length > 0 && (
           <>
             <h2 className="mb-3 text-xl font-bold tracking-tight">
               {t("system_settings")}
             </h2>
             <div className="grid gap-8 lg:grid-cols-2 xl:grid-cols-3">
-              {Settings.system.map((setting) => (
+              {systemSettings.map((setting) => (
                 <SettingCard
                   href={setting.href}
                   icon={setting.icon}
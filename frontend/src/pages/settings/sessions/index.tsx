@@ -117,6 +117,7 @@ function ChatHistoryDialog({ session }: { session: ISession }) {
       role: msg.role as "user" | "assistant",
       content: msg.content,
       createdAt: msg.created_at ? new Date(msg.created_at) : undefined,
+      citations: msg.citations,
     }))
 
   return (
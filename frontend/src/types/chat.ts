@@ -1,8 +1,21 @@
+// Citation is a document chunk an assistant answer cites as [number]
+export interface Citation {
+  number: number
+  document_id: number
+  chunk_index: number
+  title: string
+  page?: number
+  heading?: string
+  snippet: string
+  score: number
+}
+
 export interface Message {
   id: string
   role: "user" | "assistant"
   content: string
   createdAt: Date
+  citations?: Citation[]
 }
 
 export interface ApiMessage {
@@ -10,6 +23,7 @@ export interface ApiMessage {
   role: "user" | "assistant"
   content: string
   created_at: string
+  citations?: Citation[]
 }
 
 export interface ChatSession {
@@ -1,11 +1,13 @@
 import { IUser } from './user'
 import { IChatbot } from './chatbot'
+import { Citation } from './chat'
 
 export interface IMessage {
   id: number
   session_id: number
   role: string
   content: string
+  citations?: Citation[]
   session?: ISession
   created_at?: string
   updated_at?: string
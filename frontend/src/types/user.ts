@@ -3,6 +3,7 @@ export interface IUser {
   username: string
   name: string
   super_admin: boolean
+  permissions?: string[]
   created_at?: string
   updated_at?: string
   locale: "tr" | "en"